@@ -0,0 +1,128 @@
+package permutation
+
+import (
+	"fmt"
+	"iter"
+	"math/big"
+)
+
+// All returns an iterator over the (input, output) pairs for the inputs in [0, m), in
+// ascending order of input.  m must be in [0, n]; inputs removed by WithForbidden are
+// skipped.  The iterator uses p's scratch space, so p must not be used concurrently.
+func (p *ArbitraryN) All(m int) iter.Seq2[int, int] {
+	p.checkAll(m)
+	return func(yield func(int, int) bool) {
+		p.all(m, p.PermuteInt, yield)
+	}
+}
+
+// Values returns an iterator over the outputs of All(m), without their inputs.  Over the
+// whole domain (m == n) it yields every value in [0, n) not removed by WithForbidden
+// exactly once, in permuted order.
+func (p *ArbitraryN) Values(m int) iter.Seq[int] {
+	p.checkAll(m)
+	return func(yield func(int) bool) {
+		p.all(m, p.PermuteInt, func(_, out int) bool { return yield(out) })
+	}
+}
+
+// AllInverse returns an iterator over the (output, input) pairs for the outputs in [0, m):
+// it calls the inverse methods, so the pairs are in ascending order of output and the
+// inputs, the second element of each pair, are not sorted.  Over the whole domain (m == n)
+// it yields exactly the pairs of All with their elements swapped, which allows a reverse
+// lookup to be built by streaming.  As for All, m must be in [0, n], forbidden values are
+// skipped and p must not be used concurrently.
+func (p *ArbitraryN) AllInverse(m int) iter.Seq2[int, int] {
+	p.checkAll(m)
+	return func(yield func(int, int) bool) {
+		p.all(m, p.InvertInt, yield)
+	}
+}
+
+func (p *ArbitraryN) checkAll(m int) {
+	if m < 0 || big.NewInt(int64(m)).Cmp(&p.n) > 0 {
+		panic(fmt.Sprintf("count %d is outside [0, %v]", m, &p.n))
+	}
+}
+
+func (p *ArbitraryN) all(m int, step func(int) int, yield func(int, int) bool) {
+	var v big.Int
+	for i := range m {
+		if p.forbidden != nil && p.isForbidden(v.SetInt64(int64(i))) {
+			continue
+		}
+		if !yield(i, step(i)) {
+			return
+		}
+	}
+}
+
+// Sample returns k distinct values in [0, n), the outputs for the first k inputs not
+// removed by WithForbidden.  For a random key this is a uniformly random sample without
+// replacement, reproducible from the key.  It panics unless 0 <= k <= the number of values
+// in the domain.
+func (p *ArbitraryN) Sample(k int) []int {
+	var size big.Int
+	size.Sub(&p.n, big.NewInt(int64(len(p.forbidden))))
+	if k < 0 || big.NewInt(int64(k)).Cmp(&size) > 0 {
+		panic(fmt.Sprintf("sample size %d is outside [0, %v]", k, &size))
+	}
+	out := make([]int, 0, k)
+	var v big.Int
+	for i := 0; len(out) < k; i++ {
+		if p.forbidden != nil && p.isForbidden(v.SetInt64(int64(i))) {
+			continue
+		}
+		out = append(out, p.PermuteInt(i))
+	}
+	return out
+}
+
+// PermutePage returns the outputs for the inputs in [offset, offset+limit), in ascending
+// order of input, truncated at n so that the last page may be short.  Concatenating the
+// pages for offsets 0, limit, 2*limit, ... gives the outputs of All(n), which makes it
+// easy to export a shuffled table one page at a time.  Inputs removed by WithForbidden are
+// skipped, so a page may have fewer than limit values.  It panics unless offset is in
+// [0, n] and limit is non-negative.
+func (p *ArbitraryN) PermutePage(offset, limit int) []int {
+	p.checkAll(offset)
+	if limit < 0 {
+		panic(fmt.Sprintf("limit must not be negative, got: %v", limit))
+	}
+	var end big.Int
+	end.SetInt64(int64(offset))
+	end.Add(&end, big.NewInt(int64(limit)))
+	if end.Cmp(&p.n) > 0 {
+		end.Set(&p.n)
+	}
+	stop := int(end.Int64())
+	out := make([]int, 0, stop-offset)
+	for i := offset; i < stop; i++ {
+		if p.forbidden != nil && p.isForbidden(p.in.SetInt64(int64(i))) {
+			continue
+		}
+		out = append(out, p.PermuteInt(i))
+	}
+	return out
+}
+
+// MaxInverseMap is the largest count that InverseMap accepts, to stop a typo from trying
+// to build a map over a huge domain.  A map of this size takes tens of megabytes.
+const MaxInverseMap = 1 << 20
+
+// InverseMap returns a map from output to input for the outputs in [0, m), for debugging
+// and for fast reverse lookups in small domains.  It holds the pairs of AllInverse(m), so
+// for m == n it is the exact inverse of PermutePage(0, n).  It panics unless m is in
+// [0, n] and at most MaxInverseMap.
+func (p *ArbitraryN) InverseMap(m int) map[int]int {
+	p.checkAll(m)
+	if m > MaxInverseMap {
+		panic(fmt.Sprintf("count %d is more than MaxInverseMap (%d)", m, MaxInverseMap))
+	}
+	inverse := make(map[int]int, m)
+	p.all(m, p.InvertInt, func(out, in int) bool {
+		inverse[out] = in
+		return true
+	})
+	return inverse
+}
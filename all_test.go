@@ -0,0 +1,261 @@
+package permutation
+
+import (
+	"math/big"
+	"slices"
+	"testing"
+)
+
+func TestAllInverse(t *testing.T) {
+	for _, p := range []*ArbitraryN{
+		NewNInt([]byte("foo"), 1000),
+		NewNInt([]byte("foo"), 1024),
+		NewNInt([]byte("foo"), 7),
+		NewNInt([]byte("foo"), 100).WithForbidden(big.NewInt(0), big.NewInt(42)),
+	} {
+		n := int(p.n.Int64())
+		forward := make(map[int]int)
+		for in, out := range p.All(n) {
+			forward[in] = out
+		}
+		count, prev := 0, -1
+		for out, in := range p.AllInverse(n) {
+			if expected, ok := forward[in]; !ok || expected != out {
+				t.Fatalf("n=%v: AllInverse yielded (%v, %v) but All mapped %v to %v", n, out, in, in, expected)
+			}
+			if out <= prev {
+				t.Fatalf("n=%v: AllInverse yielded output %v after %v", n, out, prev)
+			}
+			count, prev = count+1, out
+		}
+		if count != len(forward) {
+			t.Fatalf("n=%v: AllInverse yielded %v pairs but All yielded %v", n, count, len(forward))
+		}
+		if expected := n - len(p.forbidden); count != expected {
+			t.Fatalf("n=%v: expected %v pairs, got %v", n, expected, count)
+		}
+	}
+}
+
+func TestAllPrefixAndBreak(t *testing.T) {
+	p := NewNInt([]byte("foo"), 1000)
+	count := 0
+	for out, in := range p.AllInverse(10) {
+		if out != count || p.PermuteInt(in) != out {
+			t.Fatalf("unexpected pair (%v, %v) at position %v", out, in, count)
+		}
+		count++
+		if count == 5 {
+			break
+		}
+	}
+	if count != 5 {
+		t.Fatalf("expected to stop after 5 pairs, got %v", count)
+	}
+
+	for _, m := range []int{-1, 1001} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for count %v", m)
+				}
+			}()
+			p.AllInverse(m)
+		}()
+	}
+}
+
+func TestValues(t *testing.T) {
+	for _, p := range []*ArbitraryN{
+		NewNInt([]byte("foo"), 1000),
+		NewNInt([]byte("foo"), 1),
+		NewNInt([]byte("foo"), 100).WithForbidden(big.NewInt(42)),
+	} {
+		n := int(p.n.Int64())
+		var fromAll []int
+		for _, out := range p.All(n) {
+			fromAll = append(fromAll, out)
+		}
+		values := slices.Collect(p.Values(n))
+		if !slices.Equal(values, fromAll) {
+			t.Fatalf("n=%v: Values yielded %v, All yielded %v", n, values, fromAll)
+		}
+		seen := make([]bool, n)
+		for _, v := range values {
+			if v < 0 || v >= n || seen[v] {
+				t.Fatalf("n=%v: value %v is out of range or a duplicate", n, v)
+			}
+			seen[v] = true
+		}
+		if expected := n - len(p.forbidden); len(values) != expected {
+			t.Fatalf("n=%v: expected %v values, got %v", n, expected, len(values))
+		}
+	}
+
+	p := NewNInt([]byte("foo"), 1000)
+	count := 0
+	for v := range p.Values(1000) {
+		if v != p.PermuteInt(count) {
+			t.Fatalf("value %v at position %v, expected %v", v, count, p.PermuteInt(count))
+		}
+		count++
+		if count == 3 {
+			break
+		}
+	}
+	if count != 3 {
+		t.Fatalf("expected to stop after 3 values, got %v", count)
+	}
+}
+
+func TestSample(t *testing.T) {
+	p := NewNInt([]byte("foo"), 1000)
+	sample := p.Sample(100)
+	if len(sample) != 100 {
+		t.Fatalf("expected 100 values, got %d", len(sample))
+	}
+	seen := make(map[int]bool)
+	for _, v := range sample {
+		if v < 0 || v >= 1000 || seen[v] {
+			t.Fatalf("sample value %d is out of range or a duplicate", v)
+		}
+		seen[v] = true
+	}
+	if again := NewNInt([]byte("foo"), 1000).Sample(100); !slices.Equal(again, sample) {
+		t.Error("same key gave a different sample")
+	}
+	if other := NewNInt([]byte("bar"), 1000).Sample(100); slices.Equal(other, sample) {
+		t.Error("different key gave the same sample")
+	}
+	if len(p.Sample(0)) != 0 {
+		t.Error("expected empty sample for k=0")
+	}
+
+	all := p.Sample(1000)
+	slices.Sort(all)
+	for i, v := range all {
+		if v != i {
+			t.Fatalf("sample of the whole domain is missing %d", i)
+		}
+	}
+
+	forbidden := NewNInt([]byte("foo"), 10).WithForbidden(big.NewInt(3))
+	if s := forbidden.Sample(9); slices.Contains(s, 3) || len(s) != 9 {
+		t.Errorf("sample with 3 forbidden = %v", s)
+	}
+
+	for _, k := range []int{-1, 1001} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for k=%d", k)
+				}
+			}()
+			p.Sample(k)
+		}()
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic sampling every value including a forbidden one")
+			}
+		}()
+		forbidden.Sample(10)
+	}()
+}
+
+func TestPermutePage(t *testing.T) {
+	p := NewNInt([]byte("foo"), 1000)
+	for _, limit := range []int{1, 7, 100, 1000, 5000} {
+		var all []int
+		for offset := 0; offset < 1000; offset += limit {
+			page := p.PermutePage(offset, limit)
+			if len(page) != min(limit, 1000-offset) {
+				t.Fatalf("limit %d: page at %d has %d values", limit, offset, len(page))
+			}
+			all = append(all, page...)
+		}
+		for i, v := range all {
+			if v != p.PermuteInt(i) {
+				t.Fatalf("limit %d: value %d of the pages is %d, expected %d", limit, i, v, p.PermuteInt(i))
+			}
+		}
+		slices.Sort(all)
+		for i, v := range all {
+			if v != i {
+				t.Fatalf("limit %d: pages have a gap or duplicate at %d", limit, i)
+			}
+		}
+	}
+	if page := p.PermutePage(1000, 10); len(page) != 0 {
+		t.Errorf("page at n = %v, expected none", page)
+	}
+
+	forbidden := NewNInt([]byte("foo"), 10).WithForbidden(big.NewInt(3))
+	if page := forbidden.PermutePage(0, 5); len(page) != 4 || slices.Contains(page, 3) {
+		t.Errorf("page with 3 forbidden = %v", page)
+	}
+
+	for _, tc := range [][2]int{{-1, 10}, {1001, 10}, {0, -1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for offset %d, limit %d", tc[0], tc[1])
+				}
+			}()
+			p.PermutePage(tc[0], tc[1])
+		}()
+	}
+}
+
+func TestInverseMap(t *testing.T) {
+	for _, n := range []int{1, 2, 100, 1000, 1 << 12} {
+		p := NewNInt([]byte("foo"), n)
+		forward := p.PermutePage(0, n)
+		inverse := p.InverseMap(n)
+		if len(inverse) != n {
+			t.Fatalf("n=%d: InverseMap has %d entries", n, len(inverse))
+		}
+		for in, out := range forward {
+			if inverse[out] != in {
+				t.Fatalf("n=%d: InverseMap[%d] = %d, expected %d", n, out, inverse[out], in)
+			}
+		}
+		for out, in := range inverse {
+			if forward[in] != out {
+				t.Fatalf("n=%d: forward[InverseMap[%d]] = %d", n, out, forward[in])
+			}
+		}
+	}
+
+	// A prefix of the outputs, skipping forbidden values.
+	p := NewNInt([]byte("foo"), 1000).WithForbidden(big.NewInt(3))
+	inverse := p.InverseMap(10)
+	if len(inverse) != 9 {
+		t.Errorf("InverseMap(10) has %d entries, expected 9", len(inverse))
+	}
+	for out, in := range inverse {
+		if out >= 10 || p.PermuteInt(in) != out {
+			t.Errorf("InverseMap(10)[%d] = %d is wrong", out, in)
+		}
+	}
+
+	for _, m := range []int{-1, 1001} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for InverseMap(%d)", m)
+				}
+			}()
+			p.InverseMap(m)
+		}()
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic above MaxInverseMap")
+			}
+		}()
+		NewNInt([]byte("foo"), MaxInverseMap+1).InverseMap(MaxInverseMap + 1)
+	}()
+}
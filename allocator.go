@@ -0,0 +1,62 @@
+package permutation
+
+import (
+	"fmt"
+	"math"
+)
+
+// Allocator hands out the values of a domain in an order that looks random but never
+// repeats: the i-th call to Next returns the permutation of the counter i, skipping
+// inputs removed by ArbitraryN.WithForbidden.  Its state is just the counter, which can be
+// saved with Counter and restored with SetCounter to resume allocating after a restart.
+// Like ArbitraryN, it must not be used concurrently.
+type Allocator struct {
+	p       *ArbitraryN
+	n       int
+	counter int
+}
+
+// NewAllocator returns an Allocator over p's domain with its counter at 0.  It panics
+// unless the domain fits in an int.
+func NewAllocator(p *ArbitraryN) *Allocator {
+	if !p.n.IsInt64() || p.n.Int64() > math.MaxInt {
+		panic(fmt.Sprintf("domain %v doesn't fit in an int", &p.n))
+	}
+	return &Allocator{p: p, n: int(p.n.Int64())}
+}
+
+// Next returns the next value and advances the counter.  Once every value has been
+// allocated it returns an error wrapping ErrExhausted.
+func (a *Allocator) Next() (int, error) {
+	for ; a.counter < a.n; a.counter++ {
+		if a.p.forbidden != nil && a.p.isForbidden(a.p.in.SetInt64(int64(a.counter))) {
+			continue
+		}
+		out := a.p.PermuteInt(a.counter)
+		a.counter++
+		return out, nil
+	}
+	return 0, errorf(ErrExhausted, "all %d values of the domain have been allocated", a.n)
+}
+
+// Counter returns the number of inputs that Next has used, including skipped ones, which
+// is the state to save to resume allocating.
+func (a *Allocator) Counter() int {
+	return a.counter
+}
+
+// SetCounter restores a counter returned by Counter.  It panics unless counter is in
+// [0, n].
+func (a *Allocator) SetCounter(counter int) {
+	if counter < 0 || counter > a.n {
+		panic(fmt.Sprintf("counter %d is outside [0, %d]", counter, a.n))
+	}
+	a.counter = counter
+}
+
+// Allocated returns whether Next has returned v since the counter was at 0, which is
+// when the input that permutes to v is below the counter.  It panics if v is outside the
+// domain.
+func (a *Allocator) Allocated(v int) bool {
+	return a.p.InvertInt(v) < a.counter
+}
@@ -0,0 +1,65 @@
+package permutation
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestAllocator(t *testing.T) {
+	const n = 1000
+	p := NewNInt([]byte("foo"), n).WithForbidden(big.NewInt(0), big.NewInt(500))
+	a := NewAllocator(p)
+	seen := make(map[int]bool, n)
+	var order []int
+	for range n - 2 {
+		v, err := a.Next()
+		if err != nil {
+			t.Fatalf("Next() after %d values: %v", len(order), err)
+		}
+		if v < 0 || v >= n || seen[v] || v == 0 || v == 500 {
+			t.Fatalf("Next() = %d is out of range, forbidden or a duplicate", v)
+		}
+		if !a.Allocated(v) {
+			t.Fatalf("Allocated(%d) = false after Next returned it", v)
+		}
+		seen[v] = true
+		order = append(order, v)
+	}
+	for range 2 {
+		if _, err := a.Next(); !errors.Is(err, ErrExhausted) {
+			t.Fatalf("expected ErrExhausted, got %v", err)
+		}
+	}
+	if a.Counter() != n {
+		t.Errorf("Counter() = %d after exhausting the domain", a.Counter())
+	}
+
+	// Resuming from a saved counter continues the same sequence.
+	b := NewAllocator(NewNInt([]byte("foo"), n).WithForbidden(big.NewInt(0), big.NewInt(500)))
+	for range 300 {
+		b.Next()
+	}
+	saved := b.Counter()
+	resumed := NewAllocator(NewNInt([]byte("foo"), n).WithForbidden(big.NewInt(0), big.NewInt(500)))
+	resumed.SetCounter(saved)
+	for i := 300; i < 310; i++ {
+		if v, _ := resumed.Next(); v != order[i] {
+			t.Fatalf("resumed Next() = %d, expected %d", v, order[i])
+		}
+	}
+	if resumed.Allocated(order[400]) {
+		t.Errorf("Allocated(%d) = true before it was allocated", order[400])
+	}
+
+	for _, c := range []int{-1, n + 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for SetCounter(%d)", c)
+				}
+			}()
+			a.SetCounter(c)
+		}()
+	}
+}
@@ -0,0 +1,86 @@
+package permutation
+
+import (
+	"fmt"
+	"math/big"
+	"unicode/utf8"
+)
+
+// alphabet converts between integers and fixed-width strings of digits drawn from a set of
+// runes.  The first rune is the zero digit.
+type alphabet struct {
+	runes []rune
+	index map[rune]int
+	radix big.Int
+}
+
+func newAlphabet(runes []rune) (*alphabet, error) {
+	if len(runes) < 2 {
+		return nil, fmt.Errorf("alphabet must have at least 2 characters, got %d", len(runes))
+	}
+	a := &alphabet{
+		runes: runes,
+		index: make(map[rune]int, len(runes)),
+	}
+	for i, r := range runes {
+		if _, ok := a.index[r]; ok {
+			return nil, fmt.Errorf("alphabet contains duplicate character %q", r)
+		}
+		a.index[r] = i
+	}
+	a.radix.SetInt64(int64(len(runes)))
+	return a, nil
+}
+
+// width returns the minimum number of digits needed to represent every value in [0, n),
+// which is at least 1.
+func (a *alphabet) width(n *big.Int) int {
+	return digitWidth(&a.radix, n)
+}
+
+// digitWidth returns the minimum number of base-radix digits needed to represent every
+// value in [0, n), which is at least 1.
+func digitWidth(radix, n *big.Int) int {
+	width := 1
+	limit := new(big.Int).Set(radix)
+	for limit.Cmp(n) < 0 {
+		limit.Mul(limit, radix)
+		width++
+	}
+	return width
+}
+
+// encode returns v as a string of exactly width digits, which must be enough.
+func (a *alphabet) encode(v *big.Int, width int) string {
+	digits := make([]rune, width)
+	var q, r big.Int
+	q.Set(v)
+	for i := width - 1; i >= 0; i-- {
+		q.QuoRem(&q, &a.radix, &r)
+		digits[i] = a.runes[r.Int64()]
+	}
+	if q.Sign() != 0 {
+		panic(fmt.Sprintf("value %v doesn't fit in %v digits", v, width))
+	}
+	return string(digits)
+}
+
+// decode parses a string of exactly width digits into v.
+func (a *alphabet) decode(v *big.Int, s string, width int) error {
+	if n := utf8.RuneCountInString(s); n != width {
+		return errorf(ErrInvalidLength, "input must be %v characters, got %v", width, n)
+	}
+	v.SetInt64(0)
+	var d big.Int
+	i := 0
+	for _, r := range s {
+		digit, ok := a.index[r]
+		if !ok {
+			return fmt.Errorf("character %q at index %d is not in the alphabet", r, i)
+		}
+		v.Mul(v, &a.radix)
+		v.Add(v, d.SetInt64(int64(digit)))
+		i++
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package permutation
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// longWalks holds the results of the cycle walks that take more than a bound number of
+// iterations, keyed by the big-endian bytes of their start.
+type longWalks struct {
+	maxIterations    int
+	forward, inverse map[string]*big.Int
+}
+
+// WithBoundedWalk bounds the work done by PermuteInPlace and InvertInPlace without a tweak
+// (and so by PermuteInt, InvertInt and the methods built on them) to maxIterations
+// iterations of the underlying permutation.  It precomputes the result of every walk that
+// would take longer and looks them up instead.  Tweaked calls walk as usual.  Returns p as
+// a convenience.
+//
+// The outputs are exactly those of the unbounded walk, so the mapping is unchanged and
+// remains a bijection: the domain is partitioned into the inputs whose walk takes at most
+// maxIterations, which are walked, and the rest, which are looked up.  The table is found
+// by enumerating the values of the underlying permutation's domain that are outside
+// [0, n) or forbidden.  Every long walk passes through at least one of them straight after
+// its start, so following each run of such values from its predecessor finds every long
+// walk, at a cost of one or two iterations per value.  That count must be at most
+// MaxTableSize, otherwise WithBoundedWalk panics, as it does unless maxIterations is
+// positive.  WithForbidden and ExtendDomain rebuild the table.
+func (p *ArbitraryN) WithBoundedWalk(maxIterations int) *ArbitraryN {
+	if maxIterations <= 0 {
+		panic(fmt.Sprintf("maxIterations must be positive, got: %v", maxIterations))
+	}
+	p.longWalks = &longWalks{maxIterations: maxIterations}
+	p.buildLongWalks()
+	return p
+}
+
+// PermuteInPlaceN is TryPermuteInPlace, but gives up after maxIters iterations of the
+// underlying permutation have all been out of range, returning nil and an error wrapping
+// ErrWalkLimit and leaving inOut unchanged, for latency-sensitive callers that would rather
+// fail than wait.  A successful result is always in [0, n), and is the same as
+// PermuteInPlace's, so retrying with a higher limit or falling back to PermuteInPlace gives
+// a consistent mapping.  Long walks that WithBoundedWalk looks up count as one iteration.
+// The walk observer, if any, sees the number of iterations taken by each successful call,
+// which is the figure to use for choosing maxIters.  It panics unless maxIters is positive.
+func (p *ArbitraryN) PermuteInPlaceN(inOut *big.Int, tweak []byte, maxIters int) (*big.Int, error) {
+	return p.walkBounded(false, inOut, tweak, maxIters)
+}
+
+// InvertInPlaceN is PermuteInPlaceN for InvertInPlace.  Inverting a value takes exactly as
+// many iterations as the call that produced it.
+func (p *ArbitraryN) InvertInPlaceN(inOut *big.Int, tweak []byte, maxIters int) (*big.Int, error) {
+	return p.walkBounded(true, inOut, tweak, maxIters)
+}
+
+func (p *ArbitraryN) walkBounded(inverse bool, inOut *big.Int, tweak []byte, maxIters int) (*big.Int, error) {
+	if maxIters <= 0 {
+		panic(fmt.Sprintf("maxIters must be positive, got: %v", maxIters))
+	}
+	if err := p.check(inOut, tweak); err != nil {
+		return nil, err
+	}
+	if guardEnabled {
+		p.guard.enter()
+		defer p.guard.exit()
+	}
+	return p.walkN(inverse, inOut, tweak, maxIters)
+}
+
+func (p *ArbitraryN) buildLongWalks() {
+	w := p.longWalks
+	w.forward = make(map[string]*big.Int)
+	w.inverse = make(map[string]*big.Int)
+
+	var outside big.Int
+	outside.Sub(&p.blockN, &p.n)
+	if outside.Cmp(big.NewInt(MaxTableSize-int64(len(p.forbidden)))) > 0 {
+		panic(fmt.Sprintf("%v values of the block permutation are outside the domain, more than %v", &outside, MaxTableSize))
+	}
+
+	visit := func(z *big.Int) {
+		// Only start at the first value in each run of unacceptable values.
+		start := p.p.InvertInPlace(new(big.Int).Set(z), nil)
+		if !p.acceptable(start) {
+			return
+		}
+		v := new(big.Int).Set(z)
+		iterations := 1
+		for !p.acceptable(v) {
+			p.p.PermuteInPlace(v, nil)
+			iterations++
+		}
+		if iterations > w.maxIterations {
+			w.forward[string(start.Bytes())] = v
+			w.inverse[string(v.Bytes())] = start
+		}
+	}
+	for z := new(big.Int).Set(&p.n); z.Cmp(&p.blockN) < 0; z.Add(z, big.NewInt(1)) {
+		visit(z)
+	}
+	for i := range p.forbidden {
+		visit(&p.forbidden[i])
+	}
+}
+
+// acceptable returns whether a value of the underlying permutation ends a walk.
+func (p *ArbitraryN) acceptable(v *big.Int) bool {
+	return v.Cmp(&p.n) < 0 && !p.isForbidden(v)
+}
+
+// lookup sets inOut to the result of its walk, in the inverse direction if inverse is
+// set, and returns true if it's a long walk.
+func (w *longWalks) lookup(inverse bool, inOut *big.Int, tweak []byte) bool {
+	if w == nil || len(tweak) > 0 {
+		return false
+	}
+	table := w.forward
+	if inverse {
+		table = w.inverse
+	}
+	out, ok := table[string(inOut.Bytes())]
+	if ok {
+		inOut.Set(out)
+	}
+	return ok
+}
@@ -0,0 +1,160 @@
+package permutation
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestWithBoundedWalk(t *testing.T) {
+	key := []byte("foo")
+	for _, tc := range []struct {
+		n, maxIterations int
+	}{
+		{1025, 1}, {1025, 2}, {1025, 4}, {600, 3}, {5, 1}, {1 << 12, 1},
+	} {
+		plain := NewNInt(key, tc.n)
+		maxSeen := 0
+		p := NewNInt(key, tc.n).WithBoundedWalk(tc.maxIterations)
+		var calls int
+		p.WithWalkObserver(func(iterations int) { calls = iterations })
+
+		seen := make(map[int]bool)
+		for i := range tc.n {
+			out := p.PermuteInt(i)
+			if calls > tc.maxIterations {
+				t.Fatalf("n=%d: PermuteInt(%d) took %d iterations, more than %d", tc.n, i, calls, tc.maxIterations)
+			}
+			if expected := plain.PermuteInt(i); out != expected {
+				t.Fatalf("n=%d: PermuteInt(%d) = %d, unbounded walk gives %d", tc.n, i, out, expected)
+			}
+			if seen[out] {
+				t.Fatalf("n=%d: duplicate output %d", tc.n, out)
+			}
+			seen[out] = true
+			if inv := p.InvertInt(out); inv != i || calls > tc.maxIterations {
+				t.Fatalf("n=%d: InvertInt(%d) = %d after %d iterations, expected %d", tc.n, out, inv, calls, i)
+			}
+		}
+		plain.WithWalkObserver(func(iterations int) { maxSeen = max(maxSeen, iterations) })
+		for i := range tc.n {
+			plain.PermuteInt(i)
+		}
+		if maxSeen > tc.maxIterations && len(p.longWalks.forward) == 0 {
+			t.Errorf("n=%d: unbounded walks take up to %d iterations but no long walks were found", tc.n, maxSeen)
+		}
+	}
+}
+
+func TestWithBoundedWalkTweakAndForbidden(t *testing.T) {
+	key := []byte("foo")
+	p := NewNInt(key, 1025).WithBoundedWalk(2)
+	plain := NewNInt(key, 1025)
+	tweak := []byte("tweak")
+	for i := range int64(1025) {
+		out := p.PermuteInPlace(big.NewInt(i), tweak)
+		if expected := plain.PermuteInPlace(big.NewInt(i), tweak); out.Cmp(expected) != 0 {
+			t.Fatalf("tweaked PermuteInPlace(%d) = %v, expected %v", i, out, expected)
+		}
+	}
+
+	p.WithForbidden(big.NewInt(0), big.NewInt(17))
+	plain.WithForbidden(big.NewInt(0), big.NewInt(17))
+	var iterations int
+	p.WithWalkObserver(func(n int) { iterations = n })
+	for i := 1; i < 1025; i++ {
+		if i == 17 {
+			continue
+		}
+		out := p.PermuteInt(i)
+		if iterations > 2 {
+			t.Fatalf("PermuteInt(%d) took %d iterations with forbidden values", i, iterations)
+		}
+		if expected := plain.PermuteInt(i); out != expected {
+			t.Fatalf("PermuteInt(%d) = %d with forbidden values, expected %d", i, out, expected)
+		}
+	}
+
+	p.ExtendDomain(big.NewInt(1500))
+	plain.ExtendDomain(big.NewInt(1500))
+	for i := 1; i < 1500; i++ {
+		if i == 17 {
+			continue
+		}
+		if out, expected := p.PermuteInt(i), plain.PermuteInt(i); out != expected || iterations > 2 {
+			t.Fatalf("after ExtendDomain, PermuteInt(%d) = %d after %d iterations, expected %d", i, out, iterations, expected)
+		}
+	}
+
+	for _, f := range []func(){
+		func() { NewNInt(key, 1025).WithBoundedWalk(0) },
+		func() {
+			NewN(key, new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 40), big.NewInt(1))).WithBoundedWalk(3)
+		},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestPermuteInPlaceN(t *testing.T) {
+	key := []byte("foo")
+	tweak := []byte("tweak")
+	plain := NewNInt(key, 1025)
+	var iterations int
+	plain.WithWalkObserver(func(n int) { iterations = n })
+	p := NewNInt(key, 1025)
+	var observed int
+	p.WithWalkObserver(func(n int) { observed = n })
+	limited := 0
+	for _, maxIters := range []int{1, 2, 3} {
+		for i := range int64(1025) {
+			expected := plain.PermuteInPlace(big.NewInt(i), tweak)
+			in := big.NewInt(i)
+			observed = 0
+			out, err := p.PermuteInPlaceN(in, tweak, maxIters)
+			if iterations > maxIters {
+				limited++
+				if !errors.Is(err, ErrWalkLimit) || out != nil || in.Int64() != i || observed != 0 {
+					t.Fatalf("PermuteInPlaceN(%d, %d) = %v, %v, leaving %v, expected ErrWalkLimit after %d iterations", i, maxIters, out, err, in, iterations)
+				}
+				continue
+			}
+			if err != nil || out.Cmp(expected) != 0 || observed != iterations {
+				t.Fatalf("PermuteInPlaceN(%d, %d) = %v, %v after %d iterations, expected %v after %d", i, maxIters, out, err, observed, expected, iterations)
+			}
+			if inv, err := p.InvertInPlaceN(out, tweak, iterations); err != nil || inv.Int64() != i {
+				t.Fatalf("InvertInPlaceN(%v, %d) = %v, %v, expected %d", expected, iterations, inv, err, i)
+			}
+		}
+	}
+	if limited == 0 {
+		t.Error("no walk reached its limit")
+	}
+
+	// Long walks that WithBoundedWalk looks up take one iteration.
+	p.WithBoundedWalk(1)
+	for i := range int64(1025) {
+		if out, err := p.PermuteInPlaceN(big.NewInt(i), nil, 1); err != nil || out.Int64() != int64(plain.PermuteInt(int(i))) {
+			t.Fatalf("bounded PermuteInPlaceN(%d) = %v, %v, expected %d", i, out, err, plain.PermuteInt(int(i)))
+		}
+	}
+
+	if _, err := p.PermuteInPlaceN(big.NewInt(1025), nil, 10); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("expected ErrOutOfRange, got %v", err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic for maxIters 0")
+			}
+		}()
+		p.PermuteInPlaceN(big.NewInt(1), nil, 0)
+	}()
+}
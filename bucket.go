@@ -0,0 +1,62 @@
+package permutation
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+// PermuteBucketed permutes in and also returns out % numBuckets, a bucket assignment for
+// sharding that is uniform when n is large compared to numBuckets and is derived from out
+// without a second hash.  Since the bucket depends only on out, it can be recomputed from
+// a stored output, and InvertInt recovers in.  numBuckets must be positive.
+func (p *ArbitraryN) PermuteBucketed(in, numBuckets int) (out, bucket int) {
+	if numBuckets <= 0 {
+		panic(fmt.Sprintf("numBuckets must be positive, got: %v", numBuckets))
+	}
+	out = p.PermuteInt(in)
+	return out, out % numBuckets
+}
+
+// BucketWeights is a table of bucket weights for PermuteWeighted.
+type BucketWeights struct {
+	// cumulative[i] is the total weight of buckets 0 to i.
+	cumulative []uint64
+}
+
+// NewBucketWeights returns a table in which bucket i receives a share of the outputs
+// proportional to weights[i].  It panics unless every weight is non-negative and at least
+// one is positive.
+func NewBucketWeights(weights ...int) *BucketWeights {
+	w := &BucketWeights{cumulative: make([]uint64, len(weights))}
+	var total uint64
+	for i, weight := range weights {
+		if weight < 0 {
+			panic(fmt.Sprintf("weights must not be negative, got: %v", weights))
+		}
+		total += uint64(weight)
+		w.cumulative[i] = total
+	}
+	if total == 0 {
+		panic(fmt.Sprintf("at least one weight must be positive, got: %v", weights))
+	}
+	return w
+}
+
+// Bucket returns the bucket of out, an output of a permutation over [0, n): [0, n) is
+// divided into consecutive ranges in proportion to the weights, and out's bucket is the
+// one whose range contains it.  Buckets with weight 0 are never returned.
+func (w *BucketWeights) Bucket(out, n int) int {
+	total := w.cumulative[len(w.cumulative)-1]
+	// scaled = floor(out * total / n), in [0, total), without overflow.
+	hi, lo := bits.Mul64(uint64(out), total)
+	scaled, _ := bits.Div64(hi, lo, uint64(n))
+	return sort.Search(len(w.cumulative), func(i int) bool { return w.cumulative[i] > scaled })
+}
+
+// PermuteWeighted permutes in and returns the result along with its bucket in weights.
+// As for PermuteBucketed, the bucket can be recomputed from out with weights.Bucket.
+func (p *ArbitraryN) PermuteWeighted(in int, weights *BucketWeights) (out, bucket int) {
+	out = p.PermuteInt(in)
+	return out, weights.Bucket(out, int(p.n.Int64()))
+}
@@ -0,0 +1,76 @@
+package permutation
+
+import "testing"
+
+func TestPermuteBucketed(t *testing.T) {
+	const n, numBuckets = 100000, 7
+	p := NewNInt([]byte("foo"), n)
+	again := NewNInt([]byte("foo"), n)
+	counts := make([]int, numBuckets)
+	for i := range n {
+		out, bucket := p.PermuteBucketed(i, numBuckets)
+		if out != p.PermuteInt(i) || bucket != out%numBuckets {
+			t.Fatalf("PermuteBucketed(%d) = %d, %d", i, out, bucket)
+		}
+		if o, b := again.PermuteBucketed(i, numBuckets); o != out || b != bucket {
+			t.Fatalf("PermuteBucketed(%d) isn't deterministic", i)
+		}
+		counts[bucket]++
+	}
+	// Every output appears once, so the counts are exact.
+	for bucket, count := range counts {
+		if count < n/numBuckets || count > n/numBuckets+1 {
+			t.Errorf("bucket %d has %d values", bucket, count)
+		}
+	}
+
+	// Consecutive inputs spread across the buckets.
+	first := make([]int, numBuckets)
+	for i := range 700 {
+		_, bucket := p.PermuteBucketed(i, numBuckets)
+		first[bucket]++
+	}
+	for bucket, count := range first {
+		if count < 60 || count > 140 {
+			t.Errorf("bucket %d has %d of the first 700 inputs", bucket, count)
+		}
+	}
+}
+
+func TestPermuteWeighted(t *testing.T) {
+	const n = 100000
+	p := NewNInt([]byte("foo"), n)
+	weights := NewBucketWeights(1, 0, 3, 6)
+	counts := make([]int, 4)
+	for i := range n {
+		out, bucket := p.PermuteWeighted(i, weights)
+		if bucket != weights.Bucket(out, n) {
+			t.Fatalf("PermuteWeighted(%d) bucket %d doesn't match Bucket(%d)", i, bucket, out)
+		}
+		counts[bucket]++
+	}
+	for bucket, expected := range []int{10000, 0, 30000, 60000} {
+		if counts[bucket] != expected {
+			t.Errorf("bucket %d has %d values, expected %d", bucket, counts[bucket], expected)
+		}
+	}
+
+	for _, weights := range [][]int{nil, {0, 0}, {1, -1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for weights %v", weights)
+				}
+			}()
+			NewBucketWeights(weights...)
+		}()
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic for 0 buckets")
+			}
+		}()
+		p.PermuteBucketed(1, 0)
+	}()
+}
@@ -0,0 +1,170 @@
+package permutation
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+)
+
+// MinBytesFPELength is the shortest input that BytesFPE accepts by default: the smallest
+// length L for which 256^L is at least the 1,000,000 values that NIST SP 800-38G
+// requires of a format-preserving encryption domain.
+const MinBytesFPELength = 3
+
+// BytesFPE is format-preserving encryption of byte strings: each string of length L is
+// encrypted to another string of length L.  A string of L base-256 digits is interpreted
+// as a big-endian integer in [0, 256^L) = [0, 2^(8L)), which is exactly the domain of the
+// power-of-2 block permutations, so each length simply uses the one that NewN would
+// choose for that width.  Different lengths are independent.
+type BytesFPE struct {
+	key        []byte
+	blocks     map[int]Permutation
+	allowSmall bool
+	order      ByteOrder
+
+	// Scratch variables to avoid allocations.
+	v big.Int
+}
+
+func NewBytesFPE(key []byte) *BytesFPE {
+	return &BytesFPE{
+		key:    key,
+		blocks: map[int]Permutation{},
+	}
+}
+
+// AllowSmallDomain permits inputs shorter than MinBytesFPELength, whose domains are too
+// small to resist an attacker who can collect or guess a large fraction of the mapping.
+// Returns p as a convenience.
+func (p *BytesFPE) AllowSmallDomain() *BytesFPE {
+	p.allowSmall = true
+	return p
+}
+
+// WithByteOrder sets the byte order used to interpret inputs and outputs as integers.  The
+// default is BigEndian.  With LittleEndian, src's first byte is its least significant, so
+// an input and its byte-reversal under BigEndian encrypt to byte-reversals of each other.
+// Returns p as a convenience.
+func (p *BytesFPE) WithByteOrder(order ByteOrder) *BytesFPE {
+	p.order = order
+	return p
+}
+
+// Encrypt returns the encryption of src as a new slice of the same length.  It panics if
+// src is shorter than MinBytesFPELength and AllowSmallDomain hasn't been called.
+func (p *BytesFPE) Encrypt(src []byte, tweak []byte) []byte {
+	block := p.block(len(src))
+	if block == nil {
+		return []byte{}
+	}
+	p.setBytes(src)
+	return p.fillBytes(block.PermuteInPlace(&p.v, tweak), len(src))
+}
+
+// Decrypt is the inverse of Encrypt.
+func (p *BytesFPE) Decrypt(src []byte, tweak []byte) []byte {
+	block := p.block(len(src))
+	if block == nil {
+		return []byte{}
+	}
+	p.setBytes(src)
+	return p.fillBytes(block.InvertInPlace(&p.v, tweak), len(src))
+}
+
+// block returns the permutation for inputs of the given length, or nil for the empty
+// input, which maps to itself.
+func (p *BytesFPE) block(length int) Permutation {
+	if length < MinBytesFPELength && !p.allowSmall {
+		panic(fmt.Sprintf("input must be at least %v bytes, got: %v", MinBytesFPELength, length))
+	}
+	if length == 0 {
+		return nil
+	}
+	block, ok := p.blocks[length]
+	if !ok {
+		block = newBlockPermutation(p.key, 8*length)
+		p.blocks[length] = block
+	}
+	return block
+}
+
+func (p *BytesFPE) setBytes(src []byte) {
+	if p.order == LittleEndian {
+		src = slices.Clone(src)
+		slices.Reverse(src)
+	}
+	p.v.SetBytes(src)
+}
+
+func (p *BytesFPE) fillBytes(v *big.Int, length int) []byte {
+	out := v.FillBytes(make([]byte, length))
+	if p.order == LittleEndian {
+		slices.Reverse(out)
+	}
+	return out
+}
+
+// MaxStreamRecordLength is the longest record that TransformStream and InvertStream
+// accept, so that a corrupt length prefix can't make them allocate without bound.
+const MaxStreamRecordLength = 1 << 20
+
+// TransformStream reads records from src, each a 4-byte big-endian length followed by that
+// many bytes, encrypts each one with its 0-based index in the stream as the tweak, and
+// writes them to dst in the same format.  Using the index as the tweak, encoded as 8
+// big-endian bytes like NewPositional's, means equal records at different positions
+// encrypt independently, and a reordered record decrypts to garbage.  It streams, so src
+// can be arbitrarily long.  It
+// stops at the first record that is truncated, longer than MaxStreamRecordLength or, unless
+// AllowSmallDomain has been called, shorter than MinBytesFPELength, and returns an error
+// giving its index; the preceding records will already have been written.
+func (p *BytesFPE) TransformStream(dst io.Writer, src io.Reader) error {
+	return p.stream(dst, src, p.Encrypt)
+}
+
+// InvertStream is the inverse of TransformStream.
+func (p *BytesFPE) InvertStream(dst io.Writer, src io.Reader) error {
+	return p.stream(dst, src, p.Decrypt)
+}
+
+func (p *BytesFPE) stream(dst io.Writer, src io.Reader, step func(src, tweak []byte) []byte) error {
+	r := bufio.NewReader(src)
+	w := bufio.NewWriter(dst)
+	var header [4]byte
+	var tweak [8]byte
+	var record []byte
+	for index := uint64(0); ; index++ {
+		if _, err := io.ReadFull(r, header[:]); err == io.EOF {
+			return w.Flush()
+		} else if err != nil {
+			_ = w.Flush()
+			return fmt.Errorf("record %d: truncated length: %w", index, err)
+		}
+		length := binary.BigEndian.Uint32(header[:])
+		if length > MaxStreamRecordLength {
+			_ = w.Flush()
+			return errorf(ErrInvalidLength, "record %d: length %d is more than MaxStreamRecordLength", index, length)
+		}
+		if length < MinBytesFPELength && !p.allowSmall {
+			_ = w.Flush()
+			return errorf(ErrInvalidLength, "record %d: length %d is less than MinBytesFPELength", index, length)
+		}
+		record = slices.Grow(record[:0], int(length))[:length]
+		if _, err := io.ReadFull(r, record); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			_ = w.Flush()
+			return fmt.Errorf("record %d: truncated after %d-byte length: %w", index, length, err)
+		}
+		binary.BigEndian.PutUint64(tweak[:], index)
+		if _, err := w.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(step(record, tweak[:])); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package permutation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBytesFPERoundTrip(t *testing.T) {
+	p := NewBytesFPE([]byte("foo"))
+	for _, length := range []int{3, 4, 8, 15, 16, 17, 32, 100} {
+		for _, tweak := range [][]byte{nil, []byte("tweak"), []byte("other tweak")} {
+			t.Run(fmt.Sprintf("length %d tweak %q", length, tweak), func(t *testing.T) {
+				src := make([]byte, length)
+				for i := range src {
+					src[i] = byte(i * 7)
+				}
+				enc := p.Encrypt(src, tweak)
+				if len(enc) != length {
+					t.Fatalf("expected %d bytes, got %d", length, len(enc))
+				}
+				if bytes.Equal(enc, src) {
+					t.Fatalf("encryption is the identity")
+				}
+				if dec := p.Decrypt(enc, tweak); !bytes.Equal(dec, src) {
+					t.Fatalf("%x -> %x decrypted to %x", src, enc, dec)
+				}
+			})
+		}
+	}
+}
+
+func TestBytesFPETweak(t *testing.T) {
+	p := NewBytesFPE([]byte("foo"))
+	src := []byte("hello")
+	if bytes.Equal(p.Encrypt(src, []byte("a")), p.Encrypt(src, []byte("b"))) {
+		t.Fatal("different tweaks gave the same ciphertext")
+	}
+}
+
+func TestBytesFPESmallDomain(t *testing.T) {
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic for short input")
+			}
+		}()
+		NewBytesFPE([]byte("foo")).Encrypt([]byte{1, 2}, nil)
+	}()
+
+	p := NewBytesFPE([]byte("foo")).AllowSmallDomain()
+	if out := p.Encrypt(nil, nil); len(out) != 0 {
+		t.Fatalf("expected empty output, got %x", out)
+	}
+	seen := make(map[byte]bool)
+	for i := range 256 {
+		enc := p.Encrypt([]byte{byte(i)}, nil)
+		if seen[enc[0]] {
+			t.Fatalf("duplicate output %x", enc)
+		}
+		seen[enc[0]] = true
+		if dec := p.Decrypt(enc, nil); dec[0] != byte(i) {
+			t.Fatalf("%x -> %x decrypted to %x", i, enc, dec)
+		}
+	}
+}
+
+func TestBytesFPEByteOrder(t *testing.T) {
+	be := NewBytesFPE([]byte("foo"))
+	le := NewBytesFPE([]byte("foo")).WithByteOrder(LittleEndian)
+	for _, length := range []int{3, 8, 17} {
+		for i := range 20 {
+			in := make([]byte, length)
+			for j := range in {
+				in[j] = byte(i*31 + j*7)
+			}
+			orig := bytes.Clone(in)
+			enc := le.Encrypt(in, []byte("tweak"))
+			if !bytes.Equal(in, orig) {
+				t.Fatal("Encrypt modified its input")
+			}
+			if len(enc) != length {
+				t.Fatalf("expected %d bytes, got %d", length, len(enc))
+			}
+			dec := le.Decrypt(enc, []byte("tweak"))
+			if !bytes.Equal(dec, in) {
+				t.Fatalf("%x -> %x decrypted to %x", in, enc, dec)
+			}
+
+			// The little-endian encryption of in is the reversal of the big-endian
+			// encryption of in reversed.
+			reversed := bytes.Clone(in)
+			slices.Reverse(reversed)
+			beEnc := be.Encrypt(reversed, []byte("tweak"))
+			slices.Reverse(beEnc)
+			if !bytes.Equal(enc, beEnc) {
+				t.Fatalf("little-endian encryption %x of %x doesn't match reversed big-endian encryption %x", enc, in, beEnc)
+			}
+		}
+	}
+}
+
+// appendRecord appends a length-prefixed record in TransformStream's format.
+func appendRecord(buf, record []byte) []byte {
+	return append(binary.BigEndian.AppendUint32(buf, uint32(len(record))), record...)
+}
+
+func TestBytesFPEStream(t *testing.T) {
+	p := NewBytesFPE([]byte("foo"))
+	rng := rand.New(rand.NewPCG(1, 2))
+	var records [][]byte
+	var src []byte
+	for i := range 500 {
+		record := make([]byte, MinBytesFPELength+rng.IntN(40))
+		if i%10 == 0 {
+			record = []byte("repeated record")
+		} else {
+			for j := range record {
+				record[j] = byte(rng.Uint32())
+			}
+		}
+		records = append(records, record)
+		src = appendRecord(src, record)
+	}
+
+	var encrypted bytes.Buffer
+	if err := p.TransformStream(&encrypted, bytes.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	if encrypted.Len() != len(src) {
+		t.Fatalf("output is %d bytes, expected %d", encrypted.Len(), len(src))
+	}
+	// Each record is encrypted with its index as the tweak.
+	rest := encrypted.Bytes()
+	var tweak [8]byte
+	for i, record := range records {
+		length := binary.BigEndian.Uint32(rest)
+		if int(length) != len(record) {
+			t.Fatalf("record %d has length %d, expected %d", i, length, len(record))
+		}
+		binary.BigEndian.PutUint64(tweak[:], uint64(i))
+		if expected := p.Encrypt(record, tweak[:]); !bytes.Equal(rest[4:4+length], expected) {
+			t.Fatalf("record %d isn't encrypted with its index as the tweak", i)
+		}
+		rest = rest[4+length:]
+	}
+	// The repeated records at 0 and 10 encrypt differently.
+	offset := 0
+	for _, record := range records[:10] {
+		offset += 4 + len(record)
+	}
+	if n := len(records[0]); bytes.Equal(encrypted.Bytes()[4:4+n], encrypted.Bytes()[offset+4:offset+4+n]) {
+		t.Error("equal records at different positions encrypted the same")
+	}
+
+	var decrypted bytes.Buffer
+	if err := p.InvertStream(&decrypted, bytes.NewReader(encrypted.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), src) {
+		t.Fatal("InvertStream didn't undo TransformStream")
+	}
+
+	var empty bytes.Buffer
+	if err := p.TransformStream(&empty, bytes.NewReader(nil)); err != nil || empty.Len() != 0 {
+		t.Errorf("empty stream gave %d bytes, %v", empty.Len(), err)
+	}
+
+	good := appendRecord(appendRecord(nil, []byte("first")), []byte("second"))
+	for _, tc := range []struct {
+		name  string
+		src   []byte
+		index string
+		is    error
+	}{
+		{"truncated length", append(slices.Clone(good), 0, 0), "record 2", io.ErrUnexpectedEOF},
+		{"truncated record", appendRecord(slices.Clone(good), []byte("third"))[:len(good)+6], "record 2", io.ErrUnexpectedEOF},
+		{"missing record", binary.BigEndian.AppendUint32(slices.Clone(good), 5), "record 2", io.ErrUnexpectedEOF},
+		{"short record", appendRecord(slices.Clone(good), []byte("ab")), "record 2", ErrInvalidLength},
+		{"long record", binary.BigEndian.AppendUint32(slices.Clone(good), MaxStreamRecordLength+1), "record 2", ErrInvalidLength},
+	} {
+		var out bytes.Buffer
+		err := p.TransformStream(&out, bytes.NewReader(tc.src))
+		if !errors.Is(err, tc.is) || !strings.Contains(err.Error(), tc.index) {
+			t.Errorf("%s: got error %v, expected %v at %s", tc.name, err, tc.is, tc.index)
+		}
+		// The complete records before the bad one are written.
+		if out.Len() != len(good) {
+			t.Errorf("%s: wrote %d bytes before the error, expected %d", tc.name, out.Len(), len(good))
+		}
+	}
+
+	// With AllowSmallDomain, short and empty records are fine.
+	small := appendRecord(appendRecord(nil, nil), []byte("a"))
+	var out, back bytes.Buffer
+	q := NewBytesFPE([]byte("foo")).AllowSmallDomain()
+	if err := q.TransformStream(&out, bytes.NewReader(small)); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.InvertStream(&back, &out); err != nil || !bytes.Equal(back.Bytes(), small) {
+		t.Errorf("small records didn't round trip: %v", err)
+	}
+}
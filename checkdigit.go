@@ -0,0 +1,101 @@
+package permutation
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// CheckDigitFunc returns the check digit, in [0, radix), for the given payload digits,
+// most significant first.
+type CheckDigitFunc func(payload []int) int
+
+// CheckDigitPreserving permutes fixed-length strings over an alphabet that end in a check
+// digit, such as account numbers.  The payload, every character but the last, is permuted
+// over [0, radix^(length-1)) and the check digit is recomputed for the new payload, so
+// valid strings map to valid strings.
+type CheckDigitPreserving struct {
+	p          *ArbitraryN
+	alphabet   *alphabet
+	length     int
+	checkDigit CheckDigitFunc
+
+	// Scratch variables to avoid allocations.
+	v big.Int
+}
+
+// NewCheckDigitPreserving returns a CheckDigitPreserving for strings of length characters,
+// including the check digit, drawn from alphabet.  It panics if length is less than 2 or
+// alphabet has fewer than 2 characters or contains duplicates.
+func NewCheckDigitPreserving(key []byte, alphabet string, length int, checkDigit CheckDigitFunc) *CheckDigitPreserving {
+	a, err := newAlphabet([]rune(alphabet))
+	if err != nil {
+		panic(err)
+	}
+	if length < 2 {
+		panic(fmt.Sprintf("length must be at least 2, got: %v", length))
+	}
+	n := new(big.Int).Exp(&a.radix, big.NewInt(int64(length-1)), nil)
+	return &CheckDigitPreserving{
+		p:          NewN(key, n),
+		alphabet:   a,
+		length:     length,
+		checkDigit: checkDigit,
+	}
+}
+
+// Permute permutes the payload of s, which must have a valid check digit, and returns it
+// with its new check digit.
+func (c *CheckDigitPreserving) Permute(s string) (string, error) {
+	if err := c.parse(s); err != nil {
+		return "", err
+	}
+	return c.format(c.p.PermuteInPlace(&c.v, nil)), nil
+}
+
+// Invert is the inverse of Permute.  It verifies the check digit before inverting the
+// payload.
+func (c *CheckDigitPreserving) Invert(s string) (string, error) {
+	if err := c.parse(s); err != nil {
+		return "", err
+	}
+	return c.format(c.p.InvertInPlace(&c.v, nil)), nil
+}
+
+// parse stores the payload of s in c.v after verifying its check digit.
+func (c *CheckDigitPreserving) parse(s string) error {
+	runes := []rune(s)
+	if len(runes) != c.length {
+		return errorf(ErrInvalidLength, "input must be %v characters, got %v", c.length, len(runes))
+	}
+	payload := runes[:c.length-1]
+	if err := c.alphabet.decode(&c.v, string(payload), len(payload)); err != nil {
+		return err
+	}
+	last := runes[c.length-1]
+	digit, ok := c.alphabet.index[last]
+	if !ok {
+		return fmt.Errorf("character %q at index %d is not in the alphabet", last, c.length-1)
+	}
+	if expected := c.checkDigit(c.digits(payload)); digit != expected {
+		return fmt.Errorf("check digit %q doesn't match payload, expected %q", last, c.alphabet.runes[expected])
+	}
+	return nil
+}
+
+// format returns payload followed by its check digit.
+func (c *CheckDigitPreserving) format(payload *big.Int) string {
+	runes := []rune(c.alphabet.encode(payload, c.length-1))
+	check := c.checkDigit(c.digits(runes))
+	if check < 0 || check >= len(c.alphabet.runes) {
+		panic(fmt.Sprintf("check digit %v is outside [0, %v)", check, len(c.alphabet.runes)))
+	}
+	return string(append(runes, c.alphabet.runes[check]))
+}
+
+func (c *CheckDigitPreserving) digits(runes []rune) []int {
+	digits := make([]int, len(runes))
+	for i, r := range runes {
+		digits[i] = c.alphabet.index[r]
+	}
+	return digits
+}
@@ -0,0 +1,90 @@
+package permutation
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+func modRCheckDigit(radix int) CheckDigitFunc {
+	return func(payload []int) int {
+		sum := 0
+		for _, d := range payload {
+			sum += d
+		}
+		return sum % radix
+	}
+}
+
+func TestCheckDigitPreserving(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, tc := range []struct {
+		alphabet string
+		length   int
+	}{
+		{"0123456789", 4},
+		{"0123456789", 16},
+		{"0123456789abcdef", 3},
+		{"0123456789abcdef", 12},
+	} {
+		t.Run(fmt.Sprintf("radix %d length %d", len(tc.alphabet), tc.length), func(t *testing.T) {
+			radix := len(tc.alphabet)
+			checkDigit := modRCheckDigit(radix)
+			c := NewCheckDigitPreserving([]byte("foo"), tc.alphabet, tc.length, checkDigit)
+			seen := make(map[string]bool)
+			for range 500 {
+				payload := make([]int, tc.length-1)
+				in := make([]byte, 0, tc.length)
+				for i := range payload {
+					payload[i] = rng.IntN(radix)
+					in = append(in, tc.alphabet[payload[i]])
+				}
+				in = append(in, tc.alphabet[checkDigit(payload)])
+				if seen[string(in)] {
+					continue
+				}
+				seen[string(in)] = true
+
+				out, err := c.Permute(string(in))
+				if err != nil {
+					t.Fatal(err)
+				}
+				outDigits := make([]int, len(out))
+				for i := range out {
+					outDigits[i] = strings.IndexByte(tc.alphabet, out[i])
+				}
+				if len(out) != tc.length || outDigits[tc.length-1] != checkDigit(outDigits[:tc.length-1]) {
+					t.Fatalf("Permute(%q) = %q, which doesn't have a valid check digit", in, out)
+				}
+				inv, err := c.Invert(out)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if inv != string(in) {
+					t.Fatalf("Invert(%q) = %q, expected %q", out, inv, in)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckDigitPreservingErrors(t *testing.T) {
+	c := NewCheckDigitPreserving([]byte("foo"), "0123456789", 4, modRCheckDigit(10))
+	for _, tc := range []struct {
+		in, err string
+	}{
+		{"123", "input must be 4 characters, got 3"},
+		{"12345", "input must be 4 characters, got 5"},
+		{"1a36", "character 'a' at index 1 is not in the alphabet"},
+		{"123x", "character 'x' at index 3 is not in the alphabet"},
+		{"1237", "check digit '7' doesn't match payload, expected '6'"},
+	} {
+		if _, err := c.Permute(tc.in); err == nil || err.Error() != tc.err {
+			t.Errorf("Permute(%q) returned %v, expected %q", tc.in, err, tc.err)
+		}
+		if _, err := c.Invert(tc.in); err == nil || err.Error() != tc.err {
+			t.Errorf("Invert(%q) returned %v, expected %q", tc.in, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package permutation
+
+import (
+	"math/big"
+)
+
+// Codec maps values of type T to and from indexes in [0, n), the domain of a permutation.
+type Codec[T any] interface {
+	ToIndex(v T) (int, error)
+	FromIndex(i int) (T, error)
+}
+
+// TypedPermuter permutes values of type T by permuting their indexes under a Codec.
+type TypedPermuter[T any] struct {
+	p     Permutation
+	codec Codec[T]
+
+	// Scratch variables to avoid allocations.
+	v big.Int
+}
+
+// NewTypedPermuter returns a TypedPermuter that permutes the indexes given by codec with
+// p.  codec should map onto p's whole domain, so that every output index can be converted
+// back to a T.
+func NewTypedPermuter[T any](p Permutation, codec Codec[T]) *TypedPermuter[T] {
+	return &TypedPermuter[T]{p: p, codec: codec}
+}
+
+// Permute returns the value whose index is the permutation of v's index.
+func (t *TypedPermuter[T]) Permute(v T) (T, error) {
+	return t.apply(v, t.p.PermuteInPlace)
+}
+
+// Invert is the inverse of Permute.
+func (t *TypedPermuter[T]) Invert(v T) (T, error) {
+	return t.apply(v, t.p.InvertInPlace)
+}
+
+func (t *TypedPermuter[T]) apply(v T, step func(inOut *big.Int, tweak []byte) *big.Int) (T, error) {
+	i, err := t.codec.ToIndex(v)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	t.v.SetInt64(int64(i))
+	if !t.p.InDomain(&t.v) {
+		var zero T
+		return zero, errorf(ErrOutOfRange, "index %v of %v is outside the domain of the permutation", i, v)
+	}
+	return t.codec.FromIndex(int(step(&t.v, nil).Int64()))
+}
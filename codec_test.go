@@ -0,0 +1,101 @@
+package permutation
+
+import (
+	"fmt"
+	"testing"
+)
+
+type suit int
+
+const (
+	clubs suit = iota
+	diamonds
+	hearts
+	spades
+	numSuits
+)
+
+func (s suit) String() string {
+	return [...]string{"clubs", "diamonds", "hearts", "spades"}[s]
+}
+
+// suitCodec maps each suit to its value.
+type suitCodec struct{}
+
+func (suitCodec) ToIndex(s suit) (int, error) {
+	if s < 0 || s >= numSuits {
+		return 0, fmt.Errorf("invalid suit %d", int(s))
+	}
+	return int(s), nil
+}
+
+func (suitCodec) FromIndex(i int) (suit, error) {
+	if i < 0 || i >= int(numSuits) {
+		return 0, fmt.Errorf("invalid suit index %d", i)
+	}
+	return suit(i), nil
+}
+
+func ExampleTypedPermuter() {
+	p := NewTypedPermuter(NewNInt([]byte("mykey"), int(numSuits)), suitCodec{})
+	for s := range numSuits {
+		out, _ := p.Permute(s)
+		fmt.Println(s, "->", out)
+	}
+	// Output:
+	// clubs -> spades
+	// diamonds -> diamonds
+	// hearts -> clubs
+	// spades -> hearts
+}
+
+// stringCodec maps strings to their index in a fixed list.
+type stringCodec []string
+
+func (c stringCodec) ToIndex(s string) (int, error) {
+	for i, v := range c {
+		if v == s {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown value %q", s)
+}
+
+func (c stringCodec) FromIndex(i int) (string, error) {
+	if i < 0 || i >= len(c) {
+		return "", fmt.Errorf("index %d out of range", i)
+	}
+	return c[i], nil
+}
+
+func TestTypedPermuter(t *testing.T) {
+	values := stringCodec{"red", "orange", "yellow", "green", "blue", "indigo", "violet"}
+	p := NewTypedPermuter(NewNInt([]byte("foo"), len(values)), values)
+	seen := make(map[string]bool)
+	for _, v := range values {
+		out, err := p.Permute(v)
+		if err != nil {
+			t.Fatalf("Permute(%q) failed: %v", v, err)
+		}
+		if seen[out] {
+			t.Fatalf("duplicate output %q", out)
+		}
+		seen[out] = true
+		inv, err := p.Invert(out)
+		if err != nil {
+			t.Fatalf("Invert(%q) failed: %v", out, err)
+		}
+		if inv != v {
+			t.Fatalf("%q -> %q inverted to %q", v, out, inv)
+		}
+	}
+
+	if _, err := p.Permute("black"); err == nil {
+		t.Error("expected error for value the codec rejects")
+	}
+	// A codec with more values than the permutation's domain.
+	short := NewTypedPermuter(NewNInt([]byte("foo"), 3), values)
+	if _, err := short.Permute("violet"); err == nil {
+		t.Error("expected error for index outside the domain")
+	}
+}
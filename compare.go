@@ -0,0 +1,43 @@
+package permutation
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"math/big"
+)
+
+// ConstantTimeEqualInt reports whether a == b in time that doesn't depend on the values.
+// Use it when comparing a permuted value supplied by a user (for example, an obfuscated
+// ID from a URL) against a stored or recomputed one; a comparison that exits early can
+// leak, through its timing, how much of the guess was correct.
+func ConstantTimeEqualInt(a, b int) bool {
+	var aBytes, bBytes [8]byte
+	binary.BigEndian.PutUint64(aBytes[:], uint64(a))
+	binary.BigEndian.PutUint64(bBytes[:], uint64(b))
+	return subtle.ConstantTimeCompare(aBytes[:], bBytes[:]) == 1
+}
+
+// ConstantTimeEqualString is the equivalent of ConstantTimeEqualInt for the encoded
+// string form of permuted values.  The time taken depends on the lengths of the
+// strings but not on their contents.
+func ConstantTimeEqualString(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// VerifyMappings checks a batch of claimed (input, output) pairs under tweak, for example
+// when migrating stored values, and returns the index of the first pair whose input
+// doesn't permute to its output, with ok false, or -1 and true if they all do.  A pair
+// whose input is outside p's domain counts as a mismatch rather than panicking.  It reuses
+// one scratch value for the whole batch.
+func VerifyMappings(p Permutation, pairs [][2]int, tweak []byte) (badIndex int, ok bool) {
+	var v big.Int
+	for i, pair := range pairs {
+		if !p.InDomain(v.SetInt64(int64(pair[0]))) {
+			return i, false
+		}
+		if out := p.PermuteInPlace(&v, tweak); !out.IsInt64() || out.Int64() != int64(pair[1]) {
+			return i, false
+		}
+	}
+	return -1, true
+}
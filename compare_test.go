@@ -0,0 +1,70 @@
+package permutation
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestConstantTimeEqualInt(t *testing.T) {
+	values := []int{0, 1, -1, 2, 255, 256, min(1<<32, math.MaxInt), math.MaxInt, math.MinInt}
+	for _, a := range values {
+		for _, b := range values {
+			if got := ConstantTimeEqualInt(a, b); got != (a == b) {
+				t.Errorf("ConstantTimeEqualInt(%d, %d) = %v, expected %v", a, b, got, a == b)
+			}
+		}
+	}
+}
+
+func TestConstantTimeEqualString(t *testing.T) {
+	values := []string{"", "a", "b", "ab", "abc", "abd"}
+	for _, a := range values {
+		for _, b := range values {
+			if got := ConstantTimeEqualString(a, b); got != (a == b) {
+				t.Errorf("ConstantTimeEqualString(%q, %q) = %v, expected %v", a, b, got, a == b)
+			}
+		}
+	}
+}
+
+func TestVerifyMappings(t *testing.T) {
+	p := NewNInt([]byte("foo"), 1000)
+	tweak := []byte("tweak")
+	var pairs [][2]int
+	for i := range 100 {
+		pairs = append(pairs, [2]int{i, int(p.PermuteInPlace(big.NewInt(int64(i)), tweak).Int64())})
+	}
+	if bad, ok := VerifyMappings(p, pairs, tweak); !ok || bad != -1 {
+		t.Fatalf("VerifyMappings of correct pairs = %d, %v", bad, ok)
+	}
+	if bad, ok := VerifyMappings(p, nil, tweak); !ok || bad != -1 {
+		t.Fatalf("VerifyMappings of no pairs = %d, %v", bad, ok)
+	}
+	// Without the tweak, the claims are wrong.
+	if _, ok := VerifyMappings(p, pairs, nil); ok {
+		t.Error("expected a mismatch without the tweak")
+	}
+
+	for _, tc := range []struct {
+		index int
+		pair  [2]int
+	}{
+		{40, [2]int{40, (pairs[40][1] + 1) % 1000}},
+		{99, [2]int{99, -1}},
+		{0, [2]int{1000, 5}},
+		{7, [2]int{-3, 5}},
+		{12, [2]int{12, pairs[13][1]}},
+	} {
+		bad := make([][2]int, len(pairs))
+		copy(bad, pairs)
+		bad[tc.index] = tc.pair
+		// A later mismatch doesn't hide the first one.
+		if tc.index < 99 {
+			bad[99] = [2]int{99, -1}
+		}
+		if i, ok := VerifyMappings(p, bad, tweak); ok || i != tc.index {
+			t.Errorf("VerifyMappings with pair %v at %d = %d, %v", tc.pair, tc.index, i, ok)
+		}
+	}
+}
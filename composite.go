@@ -0,0 +1,109 @@
+package permutation
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Composite permutes tuples drawn from the product of several domains, [0, sizes[0]) ×
+// [0, sizes[1]) × ...  The tuple is read as a mixed-radix number, with the first value most
+// significant, and permuted as a whole, so every value of the output depends on every value
+// of the input.
+type Composite struct {
+	p     *ArbitraryN
+	sizes []big.Int
+
+	// Scratch variables to avoid allocations.
+	v, d, size big.Int
+}
+
+// NewComposite returns a Composite over the product of domains of the given sizes.  It
+// panics if there are no sizes or any of them isn't positive.
+func NewComposite(key []byte, sizes ...int) *Composite {
+	if len(sizes) == 0 {
+		panic("at least one size is required")
+	}
+	c := &Composite{sizes: make([]big.Int, len(sizes))}
+	n := big.NewInt(1)
+	for i, size := range sizes {
+		if size <= 0 {
+			panic(fmt.Sprintf("sizes must be positive, got: %v", sizes))
+		}
+		c.sizes[i].SetInt64(int64(size))
+		n.Mul(n, &c.sizes[i])
+	}
+	c.p = NewN(key, n)
+	return c
+}
+
+// Permute returns the tuple that values maps to.  It returns an error if values has the
+// wrong length or any value is outside its domain.
+func (c *Composite) Permute(values []int) ([]int, error) {
+	if err := c.pack(values); err != nil {
+		return nil, err
+	}
+	return c.unpack(c.p.PermuteInPlace(&c.v, nil)), nil
+}
+
+// Invert is the inverse of Permute.
+func (c *Composite) Invert(values []int) ([]int, error) {
+	if err := c.pack(values); err != nil {
+		return nil, err
+	}
+	return c.unpack(c.p.InvertInPlace(&c.v, nil)), nil
+}
+
+// pack stores the mixed-radix number represented by values in c.v.
+func (c *Composite) pack(values []int) error {
+	if len(values) != len(c.sizes) {
+		return errorf(ErrInvalidLength, "expected %v values, got %v", len(c.sizes), len(values))
+	}
+	c.v.SetInt64(0)
+	for i, v := range values {
+		c.d.SetInt64(int64(v))
+		if c.d.Sign() < 0 || c.d.Cmp(&c.sizes[i]) >= 0 {
+			return errorf(ErrOutOfRange, "value %v at index %d is outside range [0, %v)", v, i, &c.sizes[i])
+		}
+		c.v.Mul(&c.v, &c.sizes[i])
+		c.v.Add(&c.v, &c.d)
+	}
+	return nil
+}
+
+// unpack splits v into its mixed-radix digits.
+func (c *Composite) unpack(v *big.Int) []int {
+	out := make([]int, len(c.sizes))
+	for i := len(c.sizes) - 1; i >= 0; i-- {
+		v.QuoRem(v, &c.sizes[i], &c.d)
+		out[i] = int(c.d.Int64())
+	}
+	return out
+}
+
+// DayIDPermuter jointly permutes (day, id) pairs, so that the same id on different days
+// maps to unrelated pairs.  It is a Composite over [0, days) × [0, ids).
+type DayIDPermuter struct {
+	c *Composite
+}
+
+func NewDayIDPermuter(key []byte, days, ids int) *DayIDPermuter {
+	return &DayIDPermuter{c: NewComposite(key, days, ids)}
+}
+
+// Permute returns the pair that (day, id) maps to.  It panics if either is out of range.
+func (p *DayIDPermuter) Permute(day, id int) (int, int) {
+	out, err := p.c.Permute([]int{day, id})
+	if err != nil {
+		panic(err)
+	}
+	return out[0], out[1]
+}
+
+// Invert is the inverse of Permute.
+func (p *DayIDPermuter) Invert(day, id int) (int, int) {
+	out, err := p.c.Invert([]int{day, id})
+	if err != nil {
+		panic(err)
+	}
+	return out[0], out[1]
+}
@@ -0,0 +1,79 @@
+package permutation
+
+import (
+	"testing"
+)
+
+func TestComposite(t *testing.T) {
+	c := NewComposite([]byte("foo"), 3, 5, 7)
+	seen := make(map[[3]int]bool)
+	for a := range 3 {
+		for b := range 5 {
+			for d := range 7 {
+				in := []int{a, b, d}
+				out, err := c.Permute(in)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if out[0] >= 3 || out[1] >= 5 || out[2] >= 7 {
+					t.Fatalf("Permute(%v) = %v, which is out of range", in, out)
+				}
+				key := [3]int(out)
+				if seen[key] {
+					t.Fatalf("duplicate output %v", out)
+				}
+				seen[key] = true
+				inv, err := c.Invert(out)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if [3]int(inv) != [3]int(in) {
+					t.Fatalf("Invert(%v) = %v, expected %v", out, inv, in)
+				}
+			}
+		}
+	}
+}
+
+func TestCompositeErrors(t *testing.T) {
+	c := NewComposite([]byte("foo"), 3, 5)
+	for _, in := range [][]int{nil, {1}, {1, 2, 3}, {3, 0}, {0, 5}, {-1, 0}} {
+		if _, err := c.Permute(in); err == nil {
+			t.Errorf("Permute(%v) should fail", in)
+		}
+		if _, err := c.Invert(in); err == nil {
+			t.Errorf("Invert(%v) should fail", in)
+		}
+	}
+}
+
+func TestDayIDPermuter(t *testing.T) {
+	const days, ids = 7, 50
+	p := NewDayIDPermuter([]byte("foo"), days, ids)
+	seen := make(map[[2]int]bool)
+	sameID := 0
+	for day := range days {
+		for id := range ids {
+			outDay, outID := p.Permute(day, id)
+			if outDay < 0 || outDay >= days || outID < 0 || outID >= ids {
+				t.Fatalf("Permute(%d, %d) = (%d, %d), which is out of range", day, id, outDay, outID)
+			}
+			if seen[[2]int{outDay, outID}] {
+				t.Fatalf("duplicate output (%d, %d)", outDay, outID)
+			}
+			seen[[2]int{outDay, outID}] = true
+			if inDay, inID := p.Invert(outDay, outID); inDay != day || inID != id {
+				t.Fatalf("Invert(%d, %d) = (%d, %d), expected (%d, %d)", outDay, outID, inDay, inID, day, id)
+			}
+			if day > 0 {
+				if _, prevID := p.Permute(day-1, id); prevID == outID {
+					sameID++
+				}
+			}
+		}
+	}
+	// The same id on consecutive days should usually map to different ids.
+	if sameID > days*ids/10 {
+		t.Errorf("%d ids mapped to the same id on consecutive days", sameID)
+	}
+}
@@ -0,0 +1,56 @@
+package permutation
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Digits permutes fixed-width decimal strings, or equivalently values in [0, 10^width).
+// Leading zeros are significant: every input and output is exactly width digits long, so
+// "007" may permute to "420" and vice versa.
+type Digits struct {
+	p        *ArbitraryN
+	alphabet *alphabet
+	width    int
+
+	// Scratch variables to avoid allocations.
+	v big.Int
+}
+
+func NewDigits(key []byte, width int) *Digits {
+	if width <= 0 {
+		panic(fmt.Sprintf("width must be positive, got: %v", width))
+	}
+	a, err := newAlphabet([]rune("0123456789"))
+	if err != nil {
+		panic(err)
+	}
+	n := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(width)), nil)
+	return &Digits{
+		p:        NewN(key, n),
+		alphabet: a,
+		width:    width,
+	}
+}
+
+// Width returns the number of digits in every input and output.
+func (d *Digits) Width() int {
+	return d.width
+}
+
+// PermuteDigits permutes in, which must be exactly width decimal digits, and returns the
+// result formatted as width digits.
+func (d *Digits) PermuteDigits(in string) (string, error) {
+	if err := d.alphabet.decode(&d.v, in, d.width); err != nil {
+		return "", err
+	}
+	return d.alphabet.encode(d.p.PermuteInPlace(&d.v, nil), d.width), nil
+}
+
+// InvertDigits is the inverse of PermuteDigits.
+func (d *Digits) InvertDigits(in string) (string, error) {
+	if err := d.alphabet.decode(&d.v, in, d.width); err != nil {
+		return "", err
+	}
+	return d.alphabet.encode(d.p.InvertInPlace(&d.v, nil), d.width), nil
+}
@@ -0,0 +1,58 @@
+package permutation
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDigits(t *testing.T) {
+	for _, width := range []int{3, 6} {
+		t.Run(fmt.Sprint(width), func(t *testing.T) {
+			d := NewDigits([]byte("foo"), width)
+			if d.Width() != width {
+				t.Errorf("Width() = %d, expected %d", d.Width(), width)
+			}
+			n := 1
+			for range width {
+				n *= 10
+			}
+			// Checking the whole of the larger domain is slow; the round trip shows that the
+			// mapping is injective anyway.
+			n = min(n, 20000)
+			seen := make(map[string]bool, n)
+			for i := range n {
+				in := fmt.Sprintf("%0*d", width, i)
+				out, err := d.PermuteDigits(in)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(out) != width {
+					t.Fatalf("PermuteDigits(%q) = %q, expected %d digits", in, out, width)
+				}
+				if seen[out] {
+					t.Fatalf("duplicate output %q", out)
+				}
+				seen[out] = true
+				inv, err := d.InvertDigits(out)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if inv != in {
+					t.Fatalf("InvertDigits(%q) = %q, expected %q", out, inv, in)
+				}
+			}
+		})
+	}
+}
+
+func TestDigitsErrors(t *testing.T) {
+	d := NewDigits([]byte("foo"), 3)
+	for _, in := range []string{"", "07", "0007", "0a7", "-07", "+07", " 07"} {
+		if _, err := d.PermuteDigits(in); err == nil {
+			t.Errorf("PermuteDigits(%q) should fail", in)
+		}
+		if _, err := d.InvertDigits(in); err == nil {
+			t.Errorf("InvertDigits(%q) should fail", in)
+		}
+	}
+}
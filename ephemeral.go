@@ -0,0 +1,31 @@
+package permutation
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+// Ephemeral is an ArbitraryN with a random key generated at construction.  Its mapping is
+// stable for the lifetime of the value but, unless the key is saved and later passed to
+// NewN, permuted values can't be inverted (or reproduced) after a restart.
+type Ephemeral struct {
+	*ArbitraryN
+	key []byte
+}
+
+// ephemeralKeyLen is the length of the random keys generated by NewEphemeral.
+const ephemeralKeyLen = 32
+
+func NewEphemeral(n *big.Int) *Ephemeral {
+	key := make([]byte, ephemeralKeyLen)
+	_, _ = rand.Read(key)
+	return &Ephemeral{
+		ArbitraryN: NewN(key, n),
+		key:        key,
+	}
+}
+
+// Key returns the generated key.  NewN(e.Key(), n) reproduces the permutation.
+func (e *Ephemeral) Key() []byte {
+	return e.key
+}
@@ -0,0 +1,34 @@
+package permutation
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+func TestEphemeral(t *testing.T) {
+	n := big.NewInt(1 << 16)
+	e1 := NewEphemeral(n)
+	e2 := NewEphemeral(n)
+	if bytes.Equal(e1.Key(), e2.Key()) {
+		t.Fatal("two ephemeral permutations have the same key")
+	}
+	numCollisions := 0
+	for i := range 1 << 16 {
+		if e1.PermuteInt(i) == e2.PermuteInt(i) {
+			numCollisions++
+		}
+	}
+	t.Log("NumCollisions", numCollisions)
+	if numCollisions > 10 {
+		t.Fatal("Too many collisions")
+	}
+
+	// The key reproduces the permutation.
+	p := NewN(e1.Key(), n)
+	for i := range 1000 {
+		if p.PermuteInt(i) != e1.PermuteInt(i) {
+			t.Fatalf("permutation from saved key differs at %d", i)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package permutation
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors wrapped by the errors that this package returns, for use with
+// errors.Is.
+var (
+	// ErrOutOfRange is wrapped by errors for values outside the domain of a permutation,
+	// including values removed by ArbitraryN.WithForbidden.
+	ErrOutOfRange = errors.New("out of range")
+	// ErrInvalidLength is wrapped by errors for inputs of the wrong length, such as
+	// strings, byte slices and tokens.
+	ErrInvalidLength = errors.New("invalid length")
+	// ErrTweakTooLong is wrapped by errors for tweaks longer than the maximum set by
+	// WithTweakMaxLen.
+	ErrTweakTooLong = errors.New("tweak too long")
+	// ErrExhausted is wrapped by errors from Allocator.Next once every value in the domain
+	// has been allocated.
+	ErrExhausted = errors.New("domain exhausted")
+	// ErrWalkLimit is wrapped by errors from ArbitraryN.PermuteInPlaceN and InvertInPlaceN
+	// when the cycle walk doesn't find an in-range value within the iteration limit.
+	ErrWalkLimit = errors.New("walk limit reached")
+	// ErrInvalidParameter is wrapped by errors from NewFFXErr, NewPowerOf2Err and NewNErr
+	// for lengths and domains that the constructors don't support.
+	ErrInvalidParameter = errors.New("invalid parameter")
+)
+
+// wrappedError has its own message but unwraps to a sentinel error.
+type wrappedError struct {
+	msg      string
+	sentinel error
+}
+
+// errorf is fmt.Errorf for an error that wraps sentinel without including its text in the
+// message.
+func errorf(sentinel error, format string, args ...any) error {
+	return &wrappedError{msg: fmt.Sprintf(format, args...), sentinel: sentinel}
+}
+
+func (e *wrappedError) Error() string {
+	return e.msg
+}
+
+func (e *wrappedError) Unwrap() error {
+	return e.sentinel
+}
@@ -0,0 +1,126 @@
+package permutation
+
+import (
+	"errors"
+	"io"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	key := []byte("foo")
+	for _, tc := range []struct {
+		name     string
+		f        func() error
+		sentinel error
+	}{
+		{"ArbitraryN range", func() error {
+			_, err := NewNInt(key, 100).TryPermuteInPlace(big.NewInt(100), nil)
+			return err
+		}, ErrOutOfRange},
+		{"ArbitraryN forbidden", func() error {
+			_, err := NewNInt(key, 100).WithForbidden(big.NewInt(7)).TryInvertInPlace(big.NewInt(7), nil)
+			return err
+		}, ErrOutOfRange},
+		{"ArbitraryN string", func() error {
+			_, err := NewNInt(key, 100).PermuteString("100")
+			return err
+		}, ErrOutOfRange},
+		{"ArbitraryN many", func() error {
+			return NewNInt(key, 100).PermuteBigMany([]*big.Int{big.NewInt(1), big.NewInt(-1)}, nil)
+		}, ErrOutOfRange},
+		{"ArbitraryN tweak", func() error {
+			_, err := NewNInt(key, 100).WithTweakMaxLen(2).TryPermuteInPlace(big.NewInt(1), []byte("abc"))
+			return err
+		}, ErrTweakTooLong},
+		{"FFX range", func() error {
+			_, err := NewFFX(key, 8).TryPermuteInPlace(big.NewInt(256), nil)
+			return err
+		}, ErrOutOfRange},
+		{"FFX tweak", func() error {
+			_, err := NewFFX(key, 8).WithTweakMaxLen(0).TryInvertInPlace(big.NewInt(1), []byte("a"))
+			return err
+		}, ErrTweakTooLong},
+		{"FeistelSHAKE128 range", func() error {
+			_, err := NewPowerOf2(key, 4).TryPermuteInPlace(big.NewInt(16), nil)
+			return err
+		}, ErrOutOfRange},
+		{"FeistelSHAKE128 scratch", func() error {
+			_, err := NewPowerOf2(key, 16).PermuteInPlaceScratch(big.NewInt(1), nil, make([]byte, 1))
+			return err
+		}, ErrInvalidLength},
+		{"Tokenizer range", func() error {
+			_, err := NewTokenizer(key, 1).EncodeToken(big.NewInt(256))
+			return err
+		}, ErrOutOfRange},
+		{"Tokenizer signed range", func() error {
+			_, err := NewTokenizer(key, 1).WithSigned().EncodeToken(big.NewInt(128))
+			return err
+		}, ErrOutOfRange},
+		{"Tokenizer bytes", func() error {
+			_, err := NewTokenizer(key, 4).PermuteBytes([]byte{1})
+			return err
+		}, ErrInvalidLength},
+		{"Tokenizer token", func() error {
+			_, err := NewTokenizer(key, 4).DecodeToken("AA")
+			return err
+		}, ErrInvalidLength},
+		{"RadixStringPermuter length", func() error {
+			_, err := NewRadixStringPermuter(key, "0123456789", 6).Encrypt("123", nil)
+			return err
+		}, ErrInvalidLength},
+		{"CheckDigitPreserving length", func() error {
+			_, err := NewCheckDigitPreserving(key, "0123456789", 8, func(payload []int) int {
+				return len(payload) % 10
+			}).Permute("123")
+			return err
+		}, ErrInvalidLength},
+		{"Composite length", func() error {
+			_, err := NewComposite(key, 10, 20).Permute([]int{1})
+			return err
+		}, ErrInvalidLength},
+		{"Composite range", func() error {
+			_, err := NewComposite(key, 10, 20).Permute([]int{1, 20})
+			return err
+		}, ErrOutOfRange},
+		{"SetPermuter", func() error {
+			_, err := NewSetPermuter(key, []int{1, 5, 9}).Permute(2)
+			return err
+		}, ErrOutOfRange},
+		{"ShortCode", func() error {
+			_, err := NewShortCode(key, big.NewInt(100), "abcdefgh").Encode(100)
+			return err
+		}, ErrOutOfRange},
+		{"IDObfuscator", func() error {
+			_, err := NewIDObfuscator(key, big.NewInt(100), Base62()).Encode(100)
+			return err
+		}, ErrOutOfRange},
+		{"Tagged", func() error {
+			p := NewTagged(key, big.NewInt(100), 8)
+			_, err := p.InvertTagged(100, p.tag(100))
+			return err
+		}, ErrOutOfRange},
+	} {
+		err := tc.f()
+		if err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+			continue
+		}
+		if !errors.Is(err, tc.sentinel) {
+			t.Errorf("%s: error %q doesn't match %v", tc.name, err, tc.sentinel)
+		}
+		for _, other := range []error{ErrOutOfRange, ErrInvalidLength, ErrTweakTooLong} {
+			if other != tc.sentinel && errors.Is(err, other) {
+				t.Errorf("%s: error %q unexpectedly matches %v", tc.name, err, other)
+			}
+		}
+	}
+}
+
+func TestSentinelErrorsWrapped(t *testing.T) {
+	err := NewNInt([]byte("foo"), 100).PermuteLines(io.Discard, strings.NewReader("1\n100\n"))
+	if !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("PermuteLines error %q doesn't match ErrOutOfRange", err)
+	}
+}
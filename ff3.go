@@ -0,0 +1,325 @@
+package permutation
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"slices"
+)
+
+const AlgoFF3_1 = "FF3-1"
+
+// FF3TweakSize is the size in bytes of an FF3-1 tweak, which is 56 bits.
+const FF3TweakSize = 7
+
+// ff3Rounds is the fixed number of FF3-1 rounds.
+const ff3Rounds = 8
+
+// FF3_1 implements the FF3-1 format-preserving encryption mode of NIST SP 800-38G Rev. 1,
+// for interoperating with other FF3-1 implementations.  It permutes the strings of length
+// numerals in the given radix, where the string X[0] X[1] ... X[length-1] is the integer
+// X[0]*radix^(length-1) + ... + X[length-1], so the domain is [0, radix^length).
+//
+// As the standard requires, the key is the AES key itself, which must be 16, 24 or 32
+// bytes, rather than being derived with HKDF as the other constructors do.  The tweak must
+// be FF3TweakSize bytes; a nil or empty tweak is the all-zero tweak.
+//
+// The string is split into A, the first ceil(length/2) numerals, and B, the rest, and each
+// of the 8 rounds computes A, B = B, REV(STR(NUM(REV(A)) + F(i, B) mod radix^m)), where m
+// is the length of A and REV reverses the numerals.  F(i, B) is the integer value of
+// REVB(AES(REVB(P))), with AES keyed by REVB(key), REVB reversing the bytes and P being
+// the 4-byte W XOR i followed by NUM(REV(B)) in 12 big-endian bytes.  W is the tweak's
+// right 28 bits (and then 4 zero bits) in even rounds and its left 28 bits in odd ones,
+// the 56-bit split that distinguishes FF3-1 from FF3.
+type FF3_1 struct {
+	radix, length int
+	// u and v are the lengths of A and B, and modU and modV are radix^u and radix^v.
+	u, v       int
+	modU, modV big.Int
+	// n is the size of the domain, radix^length.
+	n        big.Int
+	radixBig big.Int
+	aes      cipher.Block
+
+	// Scratch variables to avoid allocations.
+	in, a, b, c, y, q, r big.Int
+	buf                  [aes.BlockSize]byte
+}
+
+// NewFF3_1 returns an FF3-1 permutation of the numeral strings of the given length in the
+// given radix, which the standard restricts to radix in [2, 2^16] and length in [2,
+// 2*floor(log_radix(2^96))] with radix^length at least a million.  It panics if they're
+// outside those bounds or the key isn't a valid AES key.
+func NewFF3_1(key []byte, radix, length int) *FF3_1 {
+	if radix < 2 || radix > 1<<16 {
+		panic(fmt.Sprintf("radix must be in [2, 65536], got: %v", radix))
+	}
+	p := &FF3_1{
+		radix:  radix,
+		length: length,
+		u:      (length + 1) / 2,
+		v:      length / 2,
+	}
+	p.radixBig.SetInt64(int64(radix))
+	if maxLen := 2 * ff3MaxHalf(&p.radixBig); length < 2 || length > maxLen {
+		panic(fmt.Sprintf("length must be in [2, %v] for radix %v, got: %v", maxLen, radix, length))
+	}
+	p.modU.Exp(&p.radixBig, big.NewInt(int64(p.u)), nil)
+	p.modV.Exp(&p.radixBig, big.NewInt(int64(p.v)), nil)
+	p.n.Mul(&p.modU, &p.modV)
+	if p.n.Cmp(big.NewInt(1000000)) < 0 {
+		panic(fmt.Sprintf("radix^length must be at least 1000000, got: %v", &p.n))
+	}
+	reversed := slices.Clone(key)
+	slices.Reverse(reversed)
+	var err error
+	p.aes, err = aes.NewCipher(reversed)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// ff3MaxHalf returns floor(log_radix(2^96)), the most numerals whose value is sure to fit in
+// the 12 bytes that P has for it.
+func ff3MaxHalf(radix *big.Int) int {
+	limit := new(big.Int).Lsh(big.NewInt(1), 96)
+	half := 0
+	for v := new(big.Int).Set(radix); v.Cmp(limit) <= 0; v.Mul(v, radix) {
+		half++
+	}
+	return half
+}
+
+// Clone returns an independent copy of p that shares its key-derived state but has its
+// own scratch, so that it can be used concurrently with p.
+func (p *FF3_1) Clone() Permutation {
+	c := &FF3_1{
+		radix:  p.radix,
+		length: p.length,
+		u:      p.u,
+		v:      p.v,
+		aes:    p.aes,
+	}
+	c.n.Set(&p.n)
+	c.modU.Set(&p.modU)
+	c.modV.Set(&p.modV)
+	c.radixBig.Set(&p.radixBig)
+	return c
+}
+
+// InDomain returns whether v is in [0, radix^length).
+func (p *FF3_1) InDomain(v *big.Int) bool {
+	return v.Sign() >= 0 && v.Cmp(&p.n) < 0
+}
+
+func (p *FF3_1) Rounds() int {
+	return ff3Rounds
+}
+
+func (p *FF3_1) Algorithm() string {
+	return AlgoFF3_1
+}
+
+func (p *FF3_1) PermuteInt(in int) int {
+	return p.PermuteIntTweak(in, nil)
+}
+
+func (p *FF3_1) PermuteIntTweak(in int, tweak []byte) int {
+	return int(p.PermuteInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+func (p *FF3_1) InvertInt(in int) int {
+	return p.InvertIntTweak(in, nil)
+}
+
+func (p *FF3_1) InvertIntTweak(in int, tweak []byte) int {
+	return int(p.InvertInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+func (p *FF3_1) PermuteUint64(in uint64) uint64 {
+	return stepUint64(p.PermuteInPlace, &p.in, in)
+}
+
+func (p *FF3_1) InvertUint64(in uint64) uint64 {
+	return stepUint64(p.InvertInPlace, &p.in, in)
+}
+
+func (p *FF3_1) Params() Params {
+	return Params{
+		Version:   AlgorithmVersion,
+		Algorithm: p.Algorithm(),
+		Rounds:    p.Rounds(),
+		Domain:    new(big.Int).Set(&p.n),
+	}
+}
+
+// ParamsHash returns a stable identifier for p's parameters; see FFX.ParamsHash.
+func (p *FF3_1) ParamsHash() [sha256.Size]byte {
+	return paramsHash(p)
+}
+
+func (p *FF3_1) appendParams(b *TweakBuilder) {
+	b.AddString(p.Algorithm()).AddUint64(uint64(p.radix)).AddUint64(uint64(p.length))
+}
+
+// TryPermuteInPlace is PermuteInPlace but returns an error, rather than panicking, if
+// inOut is outside [0, radix^length) or the tweak isn't FF3TweakSize bytes.
+func (p *FF3_1) TryPermuteInPlace(inOut *big.Int, tweak []byte) (*big.Int, error) {
+	if err := p.check(inOut, tweak); err != nil {
+		return nil, err
+	}
+	return p.PermuteInPlace(inOut, tweak), nil
+}
+
+// TryInvertInPlace is InvertInPlace but returns an error rather than panicking.
+func (p *FF3_1) TryInvertInPlace(inOut *big.Int, tweak []byte) (*big.Int, error) {
+	if err := p.check(inOut, tweak); err != nil {
+		return nil, err
+	}
+	return p.InvertInPlace(inOut, tweak), nil
+}
+
+// EncryptUint64Tweak encrypts the numeral string x, one numeral per byte, under the 56-bit
+// tweak given as an integer, which it encodes as FF3TweakSize big-endian bytes, as the
+// NIST test vectors write it.  The tweak's high 28 bits are then TL and its low 28 bits TR.
+// It returns the encrypted numerals, leaving x unchanged, or an error wrapping
+// ErrOutOfRange if the tweak doesn't fit in 56 bits or a numeral isn't less than the radix,
+// ErrInvalidLength if x isn't length numerals long, or ErrInvalidParameter if the radix is
+// more than 256, so that a numeral doesn't fit in a byte.
+func (p *FF3_1) EncryptUint64Tweak(x []byte, tweak uint64) ([]byte, error) {
+	return p.uint64TweakStep(p.TryPermuteInPlace, x, tweak)
+}
+
+// DecryptUint64Tweak is the inverse of EncryptUint64Tweak.
+func (p *FF3_1) DecryptUint64Tweak(x []byte, tweak uint64) ([]byte, error) {
+	return p.uint64TweakStep(p.TryInvertInPlace, x, tweak)
+}
+
+func (p *FF3_1) uint64TweakStep(step func(inOut *big.Int, tweak []byte) (*big.Int, error), x []byte, tweak uint64) ([]byte, error) {
+	if tweak>>(8*FF3TweakSize) != 0 {
+		return nil, errorf(ErrOutOfRange, "tweak %#x doesn't fit in %v bits", tweak, 8*FF3TweakSize)
+	}
+	if p.radix > 256 {
+		return nil, errorf(ErrInvalidParameter, "numerals of radix %v don't fit in a byte", p.radix)
+	}
+	if len(x) != p.length {
+		return nil, errorf(ErrInvalidLength, "input must be %v numerals, got %v", p.length, len(x))
+	}
+	v := p.in.SetInt64(0)
+	for i, d := range x {
+		if int(d) >= p.radix {
+			return nil, errorf(ErrOutOfRange, "numeral %v at index %v is not less than the radix %v", d, i, p.radix)
+		}
+		v.Mul(v, &p.radixBig).Add(v, p.r.SetInt64(int64(d)))
+	}
+	var t [8]byte
+	binary.BigEndian.PutUint64(t[:], tweak)
+	v, err := step(v, t[8-FF3TweakSize:])
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, p.length)
+	for i := len(out) - 1; i >= 0; i-- {
+		v.QuoRem(v, &p.radixBig, &p.r)
+		out[i] = byte(p.r.Int64())
+	}
+	return out, nil
+}
+
+func (p *FF3_1) check(in *big.Int, tweak []byte) error {
+	if !p.InDomain(in) {
+		return errorf(ErrOutOfRange, "input %v is outside range of permutation [0, %v^%v)", in, p.radix, p.length)
+	}
+	if len(tweak) != 0 && len(tweak) != FF3TweakSize {
+		return errorf(ErrInvalidLength, "tweak must be %v bytes, got %v", FF3TweakSize, len(tweak))
+	}
+	return nil
+}
+
+// PermuteInPlace encrypts inOut with FF3-1 and stores the result back into inOut.
+// Returns inOut as a convenience.
+func (p *FF3_1) PermuteInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	tl, tr := p.start(inOut, tweak)
+	a, b, c := &p.a, &p.b, &p.c
+	for i := range ff3Rounds {
+		mod, w := &p.modU, tr
+		if i%2 == 1 {
+			mod, w = &p.modV, tl
+		}
+		c.Add(a, p.roundFunc(i, w, b))
+		c.Mod(c, mod)
+		a, b, c = b, c, a
+	}
+	return p.finish(inOut, a, b)
+}
+
+// InvertInPlace decrypts inOut with FF3-1 and stores the result back into inOut.
+// Returns inOut as a convenience.
+func (p *FF3_1) InvertInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	tl, tr := p.start(inOut, tweak)
+	a, b, c := &p.a, &p.b, &p.c
+	for i := ff3Rounds - 1; i >= 0; i-- {
+		mod, w := &p.modU, tr
+		if i%2 == 1 {
+			mod, w = &p.modV, tl
+		}
+		c.Sub(b, p.roundFunc(i, w, a))
+		c.Mod(c, mod)
+		a, b, c = c, a, b
+	}
+	return p.finish(inOut, a, b)
+}
+
+// start splits in into NUM(REV(A)) and NUM(REV(B)) in p.a and p.b, and the tweak into its
+// left and right halves.  Working on the reversed values throughout means that the
+// numerals only need reversing here and in finish rather than in every round.
+func (p *FF3_1) start(in *big.Int, tweak []byte) (tl, tr [4]byte) {
+	if err := p.check(in, tweak); err != nil {
+		panic(err.Error())
+	}
+	var t [FF3TweakSize]byte
+	copy(t[:], tweak)
+	tl = [4]byte{t[0], t[1], t[2], t[3] & 0xf0}
+	tr = [4]byte{t[4], t[5], t[6], t[3] << 4}
+
+	p.q.QuoRem(in, &p.modV, &p.c)
+	p.reverse(&p.a, &p.q, p.u)
+	p.reverse(&p.b, &p.c, p.v)
+	return tl, tr
+}
+
+// finish stores NUM(A || B) in out given NUM(REV(A)) and NUM(REV(B)).
+func (p *FF3_1) finish(out, a, b *big.Int) *big.Int {
+	p.reverse(out, a, p.u)
+	out.Mul(out, &p.modV)
+	p.reverse(&p.y, b, p.v)
+	return out.Add(out, &p.y)
+}
+
+// reverse sets out to the value of the m numerals of v in reverse order.  It uses p.q and
+// p.r, and out must not be v.
+func (p *FF3_1) reverse(out, v *big.Int, m int) {
+	p.q.Set(v)
+	out.SetInt64(0)
+	for range m {
+		p.q.QuoRem(&p.q, &p.radixBig, &p.r)
+		out.Mul(out, &p.radixBig)
+		out.Add(out, &p.r)
+	}
+}
+
+// roundFunc returns F(i, B) given b = NUM(REV(B)).
+func (p *FF3_1) roundFunc(i int, w [4]byte, b *big.Int) *big.Int {
+	buf := p.buf[:]
+	copy(buf, w[:])
+	buf[3] ^= byte(i)
+	b.FillBytes(buf[4:])
+	slices.Reverse(buf)
+	p.aes.Encrypt(buf, buf)
+	slices.Reverse(buf)
+	return p.y.SetBytes(buf)
+}
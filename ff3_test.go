@@ -0,0 +1,333 @@
+package permutation
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// ff3Reference is FF3-1 exactly as SP 800-38G Rev. 1 specifies it, on numeral strings, for
+// checking FF3_1, which works on the reversed values of the halves instead.
+func ff3Reference(key []byte, radix int, tweak []byte, x []int, decrypt bool) []int {
+	n := len(x)
+	u, v := (n+1)/2, n/2
+	a, b := slices.Clone(x[:u]), slices.Clone(x[u:])
+	tl := []byte{tweak[0], tweak[1], tweak[2], tweak[3] & 0xf0}
+	tr := []byte{tweak[4], tweak[5], tweak[6], tweak[3] << 4}
+	revKey := slices.Clone(key)
+	slices.Reverse(revKey)
+	block, err := aes.NewCipher(revKey)
+	if err != nil {
+		panic(err)
+	}
+
+	r := big.NewInt(int64(radix))
+	rev := func(s []int) []int {
+		s = slices.Clone(s)
+		slices.Reverse(s)
+		return s
+	}
+	num := func(s []int) *big.Int {
+		v := new(big.Int)
+		for _, d := range s {
+			v.Mul(v, r).Add(v, big.NewInt(int64(d)))
+		}
+		return v
+	}
+	str := func(v *big.Int, m int) []int {
+		s := make([]int, m)
+		var d big.Int
+		v = new(big.Int).Set(v)
+		for i := m - 1; i >= 0; i-- {
+			v.QuoRem(v, r, &d)
+			s[i] = int(d.Int64())
+		}
+		return s
+	}
+	f := func(i int, w []byte, half []int) *big.Int {
+		p := make([]byte, aes.BlockSize)
+		copy(p, w)
+		p[3] ^= byte(i)
+		num(rev(half)).FillBytes(p[4:])
+		slices.Reverse(p)
+		block.Encrypt(p, p)
+		slices.Reverse(p)
+		return new(big.Int).SetBytes(p)
+	}
+	for round := range 8 {
+		i := round
+		if decrypt {
+			i = 7 - round
+		}
+		m, w := u, tr
+		if i%2 == 1 {
+			m, w = v, tl
+		}
+		mod := new(big.Int).Exp(r, big.NewInt(int64(m)), nil)
+		if decrypt {
+			c := new(big.Int).Sub(num(rev(b)), f(i, w, a))
+			a, b = rev(str(c.Mod(c, mod), m)), a
+		} else {
+			c := new(big.Int).Add(num(rev(a)), f(i, w, b))
+			a, b = b, rev(str(c.Mod(c, mod), m))
+		}
+	}
+	return append(a, b...)
+}
+
+// ff3Numerals converts s to its numerals in alphabet.
+func ff3Numerals(s, alphabet string) []int {
+	var x []int
+	for _, c := range s {
+		x = append(x, strings.IndexRune(alphabet, c))
+	}
+	return x
+}
+
+// ff3Value returns NUM(x), the value that FF3_1 permutes.
+func ff3Value(x []int, radix int) *big.Int {
+	v := new(big.Int)
+	for _, d := range x {
+		v.Mul(v, big.NewInt(int64(radix))).Add(v, big.NewInt(int64(d)))
+	}
+	return v
+}
+
+func TestFF3_1KnownAnswers(t *testing.T) {
+	// Samples from the NIST ACVP FF3-1 test vectors.
+	const lower = "abcdefghijklmnopqrstuvwxyz"
+	for _, tc := range []struct {
+		key, tweak            string
+		alphabet              string
+		plaintext, ciphertext string
+	}{
+		{"2DE79D232DF5585D68CE47882AE256D6", "CBD09280979564", "0123456789",
+			"3992520240", "8901801106"},
+		{"01C63017111438F7FC8E24EB16C71AB5", "C4E822DCD09F27", "0123456789",
+			"60761757463116869318437658042297305934914824457484538562",
+			"35637144092473838892796702739628394376915177448290847293"},
+		{"718385E6542534604419E83CE387A437", "B6F35084FA90E1", lower,
+			"wfmwlrorcd", "ywowehycyd"},
+		{"DB602DFF22ED7E84C8D8C865A941A238", "EBEFD63BCC2083", lower,
+			"kkuomenbzqvggfbteqdyanwpmhzdmoicekiihkrm", "belcfahcwwytwrckieymthabgjjfkxtxauipmjja"},
+	} {
+		t.Run(tc.plaintext, func(t *testing.T) {
+			key, err := hex.DecodeString(tc.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tweak, err := hex.DecodeString(tc.tweak)
+			if err != nil {
+				t.Fatal(err)
+			}
+			radix := len(tc.alphabet)
+			in := ff3Numerals(tc.plaintext, tc.alphabet)
+			expected := ff3Numerals(tc.ciphertext, tc.alphabet)
+			if ref := ff3Reference(key, radix, tweak, in, false); !slices.Equal(ref, expected) {
+				t.Fatalf("reference gave %v, expected %v", ref, expected)
+			}
+			p := NewFF3_1(key, radix, len(in))
+			out := p.PermuteInPlace(ff3Value(in, radix), tweak)
+			if out.Cmp(ff3Value(expected, radix)) != 0 {
+				t.Fatalf("PermuteInPlace gave %v, expected %v", out, ff3Value(expected, radix))
+			}
+			if inv := p.InvertInPlace(out, tweak); inv.Cmp(ff3Value(in, radix)) != 0 {
+				t.Fatalf("InvertInPlace gave %v, expected %v", inv, ff3Value(in, radix))
+			}
+		})
+	}
+}
+
+func TestFF3_1Uint64Tweak(t *testing.T) {
+	// The NIST ACVP FF3-1 vectors from TestFF3_1KnownAnswers, with the tweak as an integer.
+	const lower = "abcdefghijklmnopqrstuvwxyz"
+	for _, tc := range []struct {
+		key                   string
+		tweak                 uint64
+		alphabet              string
+		plaintext, ciphertext string
+	}{
+		{"2DE79D232DF5585D68CE47882AE256D6", 0xCBD09280979564, "0123456789",
+			"3992520240", "8901801106"},
+		{"718385E6542534604419E83CE387A437", 0xB6F35084FA90E1, lower,
+			"wfmwlrorcd", "ywowehycyd"},
+		{"DB602DFF22ED7E84C8D8C865A941A238", 0xEBEFD63BCC2083, lower,
+			"kkuomenbzqvggfbteqdyanwpmhzdmoicekiihkrm", "belcfahcwwytwrckieymthabgjjfkxtxauipmjja"},
+	} {
+		t.Run(tc.plaintext, func(t *testing.T) {
+			key, err := hex.DecodeString(tc.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			numerals := func(s string) []byte {
+				var x []byte
+				for _, d := range ff3Numerals(s, tc.alphabet) {
+					x = append(x, byte(d))
+				}
+				return x
+			}
+			in, expected := numerals(tc.plaintext), numerals(tc.ciphertext)
+			p := NewFF3_1(key, len(tc.alphabet), len(in))
+			out, err := p.EncryptUint64Tweak(in, tc.tweak)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(out, expected) {
+				t.Fatalf("EncryptUint64Tweak gave %v, expected %v", out, expected)
+			}
+			if !slices.Equal(in, numerals(tc.plaintext)) {
+				t.Error("EncryptUint64Tweak modified its input")
+			}
+			if dec, err := p.DecryptUint64Tweak(out, tc.tweak); err != nil || !slices.Equal(dec, in) {
+				t.Fatalf("DecryptUint64Tweak gave %v, %v, expected %v", dec, err, in)
+			}
+		})
+	}
+
+	p := NewFF3_1([]byte("0123456789abcdef"), 10, 6)
+	for _, tc := range []struct {
+		name  string
+		x     []byte
+		tweak uint64
+		err   error
+	}{
+		{"57-bit tweak", []byte{1, 2, 3, 4, 5, 6}, 1 << 56, ErrOutOfRange},
+		{"short", []byte{1, 2, 3, 4, 5}, 0, ErrInvalidLength},
+		{"numeral too large", []byte{1, 2, 3, 4, 5, 10}, 0, ErrOutOfRange},
+	} {
+		if _, err := p.EncryptUint64Tweak(tc.x, tc.tweak); !errors.Is(err, tc.err) {
+			t.Errorf("%s: got %v, expected %v", tc.name, err, tc.err)
+		}
+	}
+	if _, err := p.EncryptUint64Tweak([]byte{1, 2, 3, 4, 5, 6}, 1<<56-1); err != nil {
+		t.Errorf("56-bit tweak: %v", err)
+	}
+	wide := NewFF3_1([]byte("0123456789abcdef"), 1<<16, 2)
+	if _, err := wide.EncryptUint64Tweak([]byte{1, 2}, 0); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("radix 2^16: got %v, expected ErrInvalidParameter", err)
+	}
+}
+
+func TestFF3_1Reference(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, tc := range []struct{ radix, length, keyLen int }{
+		{2, 20, 16},
+		{2, 21, 24},
+		{2, 192, 32},
+		{10, 6, 16},
+		{10, 7, 16},
+		{10, 56, 24},
+		{26, 9, 32},
+		{36, 35, 16},
+		{1 << 16, 2, 16},
+		{1 << 16, 12, 32},
+	} {
+		t.Run(fmt.Sprintf("radix %d length %d", tc.radix, tc.length), func(t *testing.T) {
+			key := make([]byte, tc.keyLen)
+			for i := range key {
+				key[i] = byte(rng.Uint32())
+			}
+			p := NewFF3_1(key, tc.radix, tc.length)
+			for range 20 {
+				x := make([]int, tc.length)
+				for i := range x {
+					x[i] = rng.IntN(tc.radix)
+				}
+				tweak := make([]byte, FF3TweakSize)
+				for i := range tweak {
+					tweak[i] = byte(rng.Uint32())
+				}
+				for _, decrypt := range []bool{false, true} {
+					step := p.PermuteInPlace
+					if decrypt {
+						step = p.InvertInPlace
+					}
+					expected := ff3Value(ff3Reference(key, tc.radix, tweak, x, decrypt), tc.radix)
+					if out := step(ff3Value(x, tc.radix), tweak); out.Cmp(expected) != 0 {
+						t.Fatalf("decrypt %v of %v: got %v, expected %v", decrypt, x, out, expected)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFF3_1(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	p := NewFF3_1(key, 10, 6)
+	if p.Rounds() != 8 || p.Algorithm() != AlgoFF3_1 {
+		t.Errorf("Rounds() = %v, Algorithm() = %v", p.Rounds(), p.Algorithm())
+	}
+	if p.Params().Domain.Cmp(big.NewInt(1000000)) != 0 {
+		t.Errorf("domain is %v, expected 1000000", p.Params().Domain)
+	}
+	seen := make([]bool, 1000000)
+	for i := range 1000000 {
+		out := p.PermuteInt(i)
+		if out < 0 || out >= len(seen) || seen[out] {
+			t.Fatalf("PermuteInt(%d) = %d is out of range or a duplicate", i, out)
+		}
+		seen[out] = true
+		if i%1000 == 0 {
+			if inv := p.InvertInt(out); inv != i {
+				t.Fatalf("InvertInt(%d) = %d, expected %d", out, inv, i)
+			}
+		}
+	}
+
+	c := p.Clone()
+	for i := range 1000 {
+		if c.PermuteInt(i) != p.PermuteInt(i) {
+			t.Fatalf("clone maps %d to %d, expected %d", i, c.PermuteInt(i), p.PermuteInt(i))
+		}
+	}
+
+	// An empty tweak is the all-zero tweak, and other tweaks change the mapping.
+	zero := make([]byte, FF3TweakSize)
+	if a, b := p.PermuteInPlace(big.NewInt(123456), nil), p.PermuteInPlace(big.NewInt(123456), zero); a.Cmp(b) != 0 {
+		t.Errorf("nil tweak gave %v, zero tweak gave %v", a, b)
+	}
+	same := 0
+	for i := range int64(100) {
+		if p.PermuteInPlace(big.NewInt(i), []byte("tweak!!")).Int64() == int64(p.PermuteInt(int(i))) {
+			same++
+		}
+	}
+	if same > 5 {
+		t.Errorf("%d of 100 outputs unchanged by the tweak", same)
+	}
+
+	if _, err := p.TryPermuteInPlace(big.NewInt(1), []byte("tweak")); !errors.Is(err, ErrInvalidLength) {
+		t.Errorf("expected ErrInvalidLength for a short tweak, got %v", err)
+	}
+	if _, err := p.TryInvertInPlace(big.NewInt(1000000), nil); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("expected ErrOutOfRange, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		key           []byte
+		radix, length int
+	}{
+		{key, 1, 30},
+		{key, 1<<16 + 1, 2},
+		{key, 10, 5},  // 10^5 is below a million.
+		{key, 10, 57}, // Longer than 2*floor(log_10(2^96)).
+		{key, 2, 193},
+		{key[:15], 10, 6},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewFF3_1(%d-byte key, %d, %d) should panic", len(tc.key), tc.radix, tc.length)
+				}
+			}()
+			NewFF3_1(tc.key, tc.radix, tc.length)
+		}()
+	}
+}
@@ -7,55 +7,129 @@ import (
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash"
 	"math/big"
+	"slices"
 )
 
 // FFX implements a permutation over [0, 2^lengthBits) using the FFX-A2 construction over AES. Key derivation
 // uses HKDF, so the input key can be any length. Where needed, numbers are encoded in big-endian.
+//
+// FFX-A2 specifies lengths of 8 to 128 bits.  FFX also accepts 2 to 7 bits, with the same
+// construction and 36 rounds, but those lengths are outside the parameter set, so other
+// FFX-A2 implementations won't match them.  A domain that small has so few values that
+// seeing a handful of outputs reveals much of the mapping, whatever the cipher, so it is
+// for shuffling rather than secrecy.
 type FFX struct {
 	lengthBits int
 	rounds     int
 
-	// Pre-calculated values.
-	tweakLen      int
-	mask          *big.Int
-	p, encryptedP [aes.BlockSize]byte
-	q             []byte
+	// Pre-calculated values.  encryptedP is the encryption of encryptedPFor, which is
+	// compared against p to decide whether encryptedP needs to be recalculated.
+	mask                         *big.Int
+	p, encryptedP, encryptedPFor [aes.BlockSize]byte
+	encryptedPValid              bool
+	q                            []byte
 
 	// Scratch variables to avoid allocations.
 	in, masked        big.Int
 	inBytes, outBytes [aes.BlockSize]byte
 
-	aes cipher.Block
+	// aesKey is aes's key, for MarshalBinary, or nil if aes was passed in as a cipher.Block.
+	aes        cipher.Block
+	aesKey     []byte
+	specRound  bool
+	kdfInfo    string
+	kdfSalt    []byte
+	kdfHash    func() hash.Hash
+	kdf        kdfParams
+	tweakLimit tweakLimit
 }
 
+// NewFFX returns an FFX over [0, 2^lengthBits).  It panics if lengthBits is outside
+// [2, 128].
 func NewFFX(key []byte, lengthBits int) *FFX {
-	if lengthBits < 8 || lengthBits > 128 {
-		panic(fmt.Sprintf("lengthBits must be in [8, 128], got: %v", lengthBits))
+	p, err := NewFFXErr(key, lengthBits)
+	if err != nil {
+		panic(err.Error())
 	}
+	return p
+}
 
-	aesKey, err := hkdf.Key(sha256.New, key, nil, "permute.FFX", 16)
-	if err != nil {
-		panic(err)
+// NewFFXErr is NewFFX but returns an error, rather than panicking, if lengthBits is
+// outside [2, 128] or the AES key can't be derived, for lengths that come from
+// configuration or requests.  An invalid length gives an error wrapping
+// ErrInvalidParameter.
+func NewFFXErr(key []byte, lengthBits int) (*FFX, error) {
+	if err := checkFFXLength(lengthBits); err != nil {
+		return nil, err
 	}
-	a, err := aes.NewCipher(aesKey)
+	p := newFFXCipher(lengthBits, sha256.New, "permute.FFX")
+	aesKey, err := tryDeriveFFXKey(p.kdfHash, key, nil, p.kdfInfo)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	if err := p.trySetAESKey(aesKey); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
 
-	var rounds int
-	if lengthBits <= 9 {
-		rounds = 36
-	} else if lengthBits <= 13 {
-		rounds = 30
-	} else if lengthBits <= 19 {
-		rounds = 24
-	} else if lengthBits <= 31 {
-		rounds = 18
-	} else {
-		rounds = 12
+func checkFFXLength(lengthBits int) error {
+	if lengthBits < 2 || lengthBits > 128 {
+		return errorf(ErrInvalidParameter, "lengthBits must be in [2, 128], got: %v", lengthBits)
 	}
+	return nil
+}
+
+// DeriveKey returns the AES key that NewFFX derives from key with HKDF.  Passing it to
+// NewFFXFromAESKey for each length avoids repeating the derivation.
+func DeriveKey(key []byte) []byte {
+	return deriveFFXKey(sha256.New, key, nil, "permute.FFX")
+}
+
+// NewFFXFromAESKey is NewFFX with the AES key already derived by DeriveKey, so
+// NewFFXFromAESKey(DeriveKey(key), lengthBits) is the same permutation as
+// NewFFX(key, lengthBits).  aesKey must be 16, 24 or 32 bytes.
+//
+// Permutations of different lengths built from the same AES key, like those built by
+// NewFFX from the same key, are related: they share the AES key and are separated only by
+// the length encoded in each block that AES encrypts.  Use New with WithKDFInfo to derive
+// an independent key for each length instead.
+func NewFFXFromAESKey(aesKey []byte, lengthBits int) *FFX {
+	p := newFFXCipher(lengthBits, sha256.New, "permute.FFX")
+	p.setAESKey(aesKey)
+	return p
+}
+
+// NewFFXFromBlock is NewFFXFromAESKey with the AES cipher already constructed, for
+// example by a keystore that hands out cipher.Blocks rather than key bytes.  block must
+// have a 16-byte block size and is shared by p and its clones, so it must be safe for
+// concurrent use if they are, as crypto/aes ciphers are.
+func NewFFXFromBlock(block cipher.Block, lengthBits int) *FFX {
+	p := newFFXCipher(lengthBits, sha256.New, "permute.FFX")
+	p.setBlock(block)
+	return p
+}
+
+// newFFX is NewFFX with the given HKDF hash, salt and info string.
+func newFFX(key []byte, lengthBits int, kdfHash func() hash.Hash, kdfSalt []byte, kdfInfo string) *FFX {
+	p := newFFXCipher(lengthBits, kdfHash, kdfInfo)
+	p.kdfSalt = slices.Clone(kdfSalt)
+	p.kdf.salt = p.kdfSalt
+	p.Rekey(key)
+	return p
+}
+
+// newFFXCipher returns an FFX without its AES key.
+func newFFXCipher(lengthBits int, kdfHash func() hash.Hash, kdfInfo string) *FFX {
+	if err := checkFFXLength(lengthBits); err != nil {
+		panic(err.Error())
+	}
+
+	rounds := RecommendedRounds(lengthBits)
 
 	// Calculate mask for extracting B from the input.  The input is treated as a big-endian 0-padded bit sequence
 	// A || B.  We want B to end up with the larger split when the length is odd.
@@ -66,16 +140,19 @@ func NewFFX(key []byte, lengthBits int) *FFX {
 
 	p := &FFX{
 		lengthBits: lengthBits,
-		aes:        a,
 		rounds:     rounds,
 		mask:       mask,
-		tweakLen:   -1,
+		kdfInfo:    kdfInfo,
+		kdfHash:    kdfHash,
+		kdf:        newKDFParams(kdfInfo),
 	}
 
 	const (
-		vers     = 1
-		method   = 2 // Alternating Feistel
-		addition = 0 // Characterwise addition
+		vers   = 1
+		method = 2 // Alternating Feistel
+		// Characterwise addition, which for radix 2 is addition of each bit modulo 2,
+		// that is XOR, as PermuteInPlace uses to combine each round.
+		addition = 0
 		radix    = 2
 	)
 
@@ -91,24 +168,392 @@ func NewFFX(key []byte, lengthBits int) *FFX {
 	return p
 }
 
+// NewFFXString is equivalent to NewFFX with the UTF-8 bytes of key.
+func NewFFXString(key string, lengthBits int) *FFX {
+	return NewFFX([]byte(key), lengthBits)
+}
+
+// Rekey switches p to a new key, keeping its length, rounds and tweak limit and reusing
+// its buffers.  Afterwards p behaves exactly like a newly constructed FFX with the new key.
+// Returns p as a convenience.
+func (p *FFX) Rekey(key []byte) *FFX {
+	p.setAESKey(deriveFFXKey(p.kdfHash, key, p.kdfSalt, p.kdfInfo))
+	return p
+}
+
+// deriveFFXKey derives the AES key with HKDF.  As a guard against a broken KDF, it panics
+// if the derived key is all zeros, which HKDF produces with negligible probability.
+func deriveFFXKey(kdfHash func() hash.Hash, key, kdfSalt []byte, kdfInfo string) []byte {
+	aesKey, err := tryDeriveFFXKey(kdfHash, key, kdfSalt, kdfInfo)
+	if err != nil {
+		panic(err)
+	}
+	return aesKey
+}
+
+// tryDeriveFFXKey is deriveFFXKey but returns an error rather than panicking.
+func tryDeriveFFXKey(kdfHash func() hash.Hash, key, kdfSalt []byte, kdfInfo string) ([]byte, error) {
+	aesKey, err := hkdf.Key(kdfHash, key, kdfSalt, kdfInfo, 16)
+	if err != nil {
+		return nil, fmt.Errorf("deriving the AES key: %w", err)
+	}
+	if err := checkDerivedKey(aesKey); err != nil {
+		return nil, err
+	}
+	return aesKey, nil
+}
+
+func checkDerivedKey(aesKey []byte) error {
+	if subtle.ConstantTimeCompare(aesKey, make([]byte, len(aesKey))) == 1 {
+		return errors.New("derived AES key is all zeros")
+	}
+	return nil
+}
+
+func (p *FFX) setAESKey(aesKey []byte) {
+	if err := p.trySetAESKey(aesKey); err != nil {
+		panic(err)
+	}
+}
+
+// trySetAESKey is setAESKey but returns an error rather than panicking.
+func (p *FFX) trySetAESKey(aesKey []byte) error {
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return err
+	}
+	if err := p.trySetBlock(block); err != nil {
+		return err
+	}
+	p.aesKey = slices.Clone(aesKey)
+	return nil
+}
+
+func (p *FFX) setBlock(block cipher.Block) {
+	if err := p.trySetBlock(block); err != nil {
+		panic(err)
+	}
+}
+
+func (p *FFX) trySetBlock(block cipher.Block) error {
+	if block.BlockSize() != aes.BlockSize {
+		return fmt.Errorf("block size must be %v bytes, got: %v", aes.BlockSize, block.BlockSize())
+	}
+	if err := checkCipher(block); err != nil {
+		return err
+	}
+	p.aes = block
+	p.aesKey = nil
+	p.encryptedPValid = false
+	return nil
+}
+
+// checkCipher is a self-test that block changes a sample block and decrypts it again, to
+// catch a cipher that is broken rather than merely keyed differently.
+func checkCipher(block cipher.Block) error {
+	sample := [aes.BlockSize]byte{'p', 'e', 'r', 'm', 'u', 't', 'e', '.', 'F', 'F', 'X'}
+	var encrypted, decrypted [aes.BlockSize]byte
+	block.Encrypt(encrypted[:], sample[:])
+	block.Decrypt(decrypted[:], encrypted[:])
+	if encrypted == sample || decrypted != sample {
+		return errors.New("AES self-test failed")
+	}
+	return nil
+}
+
+// Clone returns an independent copy of p that shares its key-derived state but has its
+// own scratch, so that it can be used concurrently with p.
+func (p *FFX) Clone() Permutation {
+	c := *p
+	c.in, c.masked = big.Int{}, big.Int{}
+	c.inBytes, c.outBytes = [aes.BlockSize]byte{}, [aes.BlockSize]byte{}
+	c.q = nil
+	return &c
+}
+
+// setRounds overrides the recommended number of rounds, which must be in [1, 255].
+func (p *FFX) setRounds(rounds int) {
+	p.rounds = rounds
+	p.p[7] = byte(rounds)
+}
+
+// InDomain returns whether v is in [0, 2^lengthBits).
+func (p *FFX) InDomain(v *big.Int) bool {
+	return v.Sign() >= 0 && v.BitLen() <= p.lengthBits
+}
+
+func (p *FFX) Rounds() int {
+	return p.rounds
+}
+
+func (p *FFX) Algorithm() string {
+	return AlgoFFX
+}
+
 func (p *FFX) PermuteInt(in int) int {
+	return p.PermuteIntTweak(in, nil)
+}
+
+func (p *FFX) PermuteIntTweak(in int, tweak []byte) int {
+	if p.lengthBits <= 64 {
+		return int(p.permuteUint64(uint64(in), tweak))
+	}
 	p.in.SetInt64(int64(in))
-	out := int(p.PermuteInPlace(&p.in, nil).Int64())
+	out := int(p.PermuteInPlace(&p.in, tweak).Int64())
 	p.in.SetUint64(0)
 	return out
 }
 
+func (p *FFX) InvertInt(in int) int {
+	return p.InvertIntTweak(in, nil)
+}
+
+func (p *FFX) InvertIntTweak(in int, tweak []byte) int {
+	if p.lengthBits <= 64 {
+		return int(p.invertUint64(uint64(in), tweak))
+	}
+	p.in.SetInt64(int64(in))
+	out := int(p.InvertInPlace(&p.in, tweak).Int64())
+	p.in.SetUint64(0)
+	return out
+}
+
+// PermuteUint64 is PermuteInt for uint64 values.  It panics if p is more than 64 bits wide
+// or in is outside [0, 2^lengthBits).
+func (p *FFX) PermuteUint64(in uint64) uint64 {
+	p.checkUint64(in)
+	return p.permuteUint64(in, nil)
+}
+
+// InvertUint64 is the inverse of PermuteUint64.
+func (p *FFX) InvertUint64(in uint64) uint64 {
+	p.checkUint64(in)
+	return p.invertUint64(in, nil)
+}
+
+func (p *FFX) checkUint64(in uint64) {
+	checkUint64Width(p.lengthBits)
+	if p.lengthBits < 64 && in>>p.lengthBits != 0 {
+		panic(fmt.Sprintf("input %v is outside range of permutation [0, 2^%v)", in, p.lengthBits))
+	}
+}
+
+// WithSpecRoundByte makes the round function follow the FFX-A2 specification exactly by
+// putting the round index i in the round byte of Q, rather than 1; see RoundFunc.  This is
+// intended for interoperating with other FFX-A2 implementations, together with
+// NewFFXFromAESKey to use their AES key directly.  The tweak is already incorporated as the
+// specification requires, with its length in P and the tweak itself at the start of Q, so
+// the round byte is the only difference.  It changes the permutation.  Returns p as a
+// convenience.
+func (p *FFX) WithSpecRoundByte() *FFX {
+	p.specRound = true
+	return p
+}
+
+// PermuteInt128 permutes the value hi*2^64 + lo and returns the high and low 64 bits of
+// the result, for callers that store values as a pair of 64-bit columns.  FFX's A and B
+// halves each fit in 64 bits, so no big.Int arithmetic is needed.  It panics unless p is
+// more than 64 bits wide, or if the value is outside [0, 2^lengthBits).
+func (p *FFX) PermuteInt128(hi, lo uint64) (uint64, uint64) {
+	a, b := p.split128(hi, lo)
+	p.prepareTweak(nil)
+	return p.join128(p.feistel(false, a, b))
+}
+
+// InvertInt128 is the inverse of PermuteInt128.
+func (p *FFX) InvertInt128(hi, lo uint64) (uint64, uint64) {
+	a, b := p.split128(hi, lo)
+	p.prepareTweak(nil)
+	return p.join128(p.feistel(true, a, b))
+}
+
+// PermuteIntSlice replaces each value of in with PermuteInt of it and returns in as a
+// convenience.  The tweak-dependent state, such as the encrypted P block, is prepared
+// once for the whole slice rather than for each value, and no memory is allocated.
+func (p *FFX) PermuteIntSlice(in []int) []int {
+	return p.intSlice(in, false)
+}
+
+// InvertIntSlice is the inverse of PermuteIntSlice.
+func (p *FFX) InvertIntSlice(in []int) []int {
+	return p.intSlice(in, true)
+}
+
+func (p *FFX) intSlice(in []int, inverse bool) []int {
+	p.prepareTweak(nil)
+	for i, v := range in {
+		if p.lengthBits <= 64 {
+			a, b := p.splitUint64(uint64(v))
+			in[i] = int(p.finishUint64(p.feistel(inverse, a, b)))
+			continue
+		}
+		// As for PermuteInt, the output is truncated to an int.
+		a, b := p.split128(0, uint64(v))
+		_, lo := p.join128(p.feistel(inverse, a, b))
+		in[i] = int(lo)
+	}
+	return in
+}
+
+// PermuteInPlaceSlice permutes each of vals in place with the same tweak, as
+// PermuteInPlace would, and returns vals as a convenience.  As for PermuteIntSlice, the
+// tweak-dependent state is prepared once for the whole slice.
+func (p *FFX) PermuteInPlaceSlice(vals []*big.Int, tweak []byte) []*big.Int {
+	return p.bigSlice(vals, tweak, false)
+}
+
+// InvertInPlaceSlice is the inverse of PermuteInPlaceSlice.
+func (p *FFX) InvertInPlaceSlice(vals []*big.Int, tweak []byte) []*big.Int {
+	return p.bigSlice(vals, tweak, true)
+}
+
+func (p *FFX) bigSlice(vals []*big.Int, tweak []byte, inverse bool) []*big.Int {
+	p.prepareTweak(tweak)
+	for _, v := range vals {
+		a, b := p.split(v)
+		a, b = p.feistel(inverse, a, b)
+		p.finish(v, a, b)
+	}
+	return vals
+}
+
+// feistel runs the rounds of PermuteInPlace over A and B, or those of InvertInPlace if
+// inverse is set, using the state from the last call to prepareTweak.
+func (p *FFX) feistel(inverse bool, a, b uint64) (uint64, uint64) {
+	if inverse {
+		for i := p.rounds - 1; i >= 0; i-- {
+			a, b = b^p.roundFunc(i, a), a
+		}
+		return a, b
+	}
+	for i := range p.rounds {
+		a, b = b, a^p.roundFunc(i, b)
+	}
+	return a, b
+}
+
+// split128 splits the two-word value hi*2^64 + lo into A and B for lengthBits in
+// (64, 128].  Shifts of 64 or more give 0 in Go, which handles B being a whole word.
+func (p *FFX) split128(hi, lo uint64) (a, b uint64) {
+	if p.lengthBits <= 64 {
+		panic(fmt.Sprintf("PermuteInt128 requires an FFX of more than 64 bits, got %v bits", p.lengthBits))
+	}
+	if hi>>uint(p.lengthBits-64) != 0 {
+		panic(fmt.Sprintf("input %#x%016x is outside range of permutation [0, 2^%v)", hi, lo, p.lengthBits))
+	}
+	bBits := uint(p.lengthBits - p.lengthBits/2)
+	return lo>>bBits | hi<<(64-bBits), lo & (1<<bBits - 1)
+}
+
+// join128 is the inverse of split128.
+func (p *FFX) join128(a, b uint64) (hi, lo uint64) {
+	bBits := uint(p.lengthBits - p.lengthBits/2)
+	return a >> (64 - bBits), a<<bBits | b
+}
+
+// WithTweakMaxLen limits tweaks to at most max bytes; longer tweaks make the Try* methods
+// return an error and the other methods panic.  This bounds the size of the CBC-MAC input
+// when tweaks are derived from untrusted input.  By default there is no limit.
+// Returns p as a convenience.
+func (p *FFX) WithTweakMaxLen(max int) *FFX {
+	p.tweakLimit.setMax(max)
+	return p
+}
+
+// TryPermuteInPlace is PermuteInPlace but returns an error, rather than panicking, if
+// inOut is outside [0, 2^lengthBits) or the tweak is longer than the maximum set by
+// WithTweakMaxLen.
+func (p *FFX) TryPermuteInPlace(inOut *big.Int, tweak []byte) (*big.Int, error) {
+	if err := p.check(inOut, tweak); err != nil {
+		return nil, err
+	}
+	return p.PermuteInPlace(inOut, tweak), nil
+}
+
+// TryInvertInPlace is InvertInPlace but returns an error rather than panicking.
+func (p *FFX) TryInvertInPlace(inOut *big.Int, tweak []byte) (*big.Int, error) {
+	if err := p.check(inOut, tweak); err != nil {
+		return nil, err
+	}
+	return p.InvertInPlace(inOut, tweak), nil
+}
+
+func (p *FFX) check(in *big.Int, tweak []byte) error {
+	if !p.InDomain(in) {
+		return errorf(ErrOutOfRange, "input %v is outside range of permutation [0, 2^%v)", in, p.lengthBits)
+	}
+	return p.tweakLimit.check(tweak)
+}
+
 // PermuteInPlace calculates inOut's permutated value and stores it back into inOut.
 // Returns inOut as a convenience.
 func (p *FFX) PermuteInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	a, b := p.start(inOut, tweak)
+	a, b = p.feistel(false, a, b)
+	return p.finish(inOut, a, b)
+}
+
+// InvertInPlace is the inverse of PermuteInPlace; it runs the Feistel rounds in reverse to
+// recover the value that permutes to inOut and stores it back into inOut.
+// Returns inOut as a convenience.
+func (p *FFX) InvertInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	a, b := p.start(inOut, tweak)
+	a, b = p.feistel(true, a, b)
+	return p.finish(inOut, a, b)
+}
+
+// permuteUint64 is the equivalent of PermuteInPlace for lengthBits <= 64, without any
+// big.Int arithmetic.
+func (p *FFX) permuteUint64(in uint64, tweak []byte) uint64 {
+	a, b := p.startUint64(in, tweak)
+	a, b = p.feistel(false, a, b)
+	return p.finishUint64(a, b)
+}
+
+// invertUint64 is the equivalent of InvertInPlace for lengthBits <= 64.
+func (p *FFX) invertUint64(in uint64, tweak []byte) uint64 {
+	a, b := p.startUint64(in, tweak)
+	a, b = p.feistel(true, a, b)
+	return p.finishUint64(a, b)
+}
+
+func (p *FFX) startUint64(in uint64, tweak []byte) (a, b uint64) {
+	p.prepareTweak(tweak)
+	return p.splitUint64(in)
+}
+
+func (p *FFX) splitUint64(in uint64) (a, b uint64) {
+	bBits := uint(p.lengthBits - p.lengthBits/2)
+	return in >> bBits, in & (1<<bBits - 1)
+}
+
+func (p *FFX) finishUint64(a, b uint64) uint64 {
+	return a<<uint(p.lengthBits-p.lengthBits/2) | b
+}
+
+// start splits the input into its A and B halves and prepares the tweak-dependent state
+// used by RoundFunc.
+func (p *FFX) start(in *big.Int, tweak []byte) (a, b uint64) {
+	p.prepareTweak(tweak)
+	return p.split(in)
+}
+
+// split splits the input into its A and B halves.
+func (p *FFX) split(in *big.Int) (a, b uint64) {
 	split := p.lengthBits / 2
 
-	p.masked.And(inOut, p.mask)
-	b := p.masked.Uint64()
-	p.masked.Rsh(inOut, uint(p.lengthBits-split))
-	a := p.masked.Uint64()
+	p.masked.And(in, p.mask)
+	b = p.masked.Uint64()
+	p.masked.Rsh(in, uint(p.lengthBits-split))
+	a = p.masked.Uint64()
+	return
+}
 
-	p.calculateEncryptedP(split, len(tweak))
+// prepareTweak calculates the tweak-dependent state used by roundFunc: the encrypted P
+// block and the constant prefix of Q.
+func (p *FFX) prepareTweak(tweak []byte) {
+	p.tweakLimit.mustCheck(tweak)
+	p.calculateEncryptedP(len(tweak))
 
 	p.q = append(p.q[:0], tweak...)
 	for len(p.q)%16 != 7 {
@@ -118,35 +563,59 @@ func (p *FFX) PermuteInPlace(inOut *big.Int, tweak []byte) *big.Int {
 	for range 8 {
 		p.q = append(p.q, 0)
 	}
+}
 
-	var c uint64
-	for i := range p.rounds {
-		c = a ^ p.RoundFunc(i, b, nil)
-		a = b
-		b = c
-	}
-
-	inOut.SetUint64(a)
-	inOut.Lsh(inOut, uint(p.lengthBits-split))
+// finish stores A || B into out.
+func (p *FFX) finish(out *big.Int, a, b uint64) *big.Int {
+	split := p.lengthBits / 2
+	out.SetUint64(a)
+	out.Lsh(out, uint(p.lengthBits-split))
 	p.masked.SetUint64(b)
-	inOut.Or(inOut, &p.masked)
+	out.Or(out, &p.masked)
 	p.masked.SetUint64(0)
-	return inOut
+	return out
 }
 
-func (p *FFX) calculateEncryptedP(split int, tweakLen int) {
-	if tweakLen == p.tweakLen {
+// calculateEncryptedP stores the tweak length in P and then encrypts P, unless it is
+// unchanged since the last call.  Only the tweak length varies between calls but the
+// cache is keyed on the whole of P so that it can't go stale if that changes.
+func (p *FFX) calculateEncryptedP(tweakLen int) {
+	binary.BigEndian.PutUint64(p.p[8:16], uint64(tweakLen))
+	if p.encryptedPValid && p.p == p.encryptedPFor {
 		return // already calculated.
 	}
-	binary.BigEndian.PutUint64(p.p[8:16], uint64(tweakLen))
 	p.aes.Encrypt(p.encryptedP[:], p.p[:])
-	p.tweakLen = tweakLen
+	p.encryptedPFor = p.p
+	p.encryptedPValid = true
 }
 
+// RoundFunc returns the output of Feistel round i for round input B, which must fit in the
+// round's input width, under the given tweak.  It depends only on its arguments and the key,
+// so it can be used as a building block for other Feistel schedules:  PermuteInPlace
+// computes
+//
+//	for i := range rounds { A, B = B, A ^ RoundFunc(i, B, tweak) }
+//
+// over the input A || B, where B is the low lengthBits-lengthBits/2 bits.  Even rounds
+// return lengthBits/2 bits; odd rounds return the rest.
+//
+// The round function is the FFX-A2 CBC-MAC over P || Q except that the round byte of Q is
+// always 1 rather than i, so the round index only affects the output width.  This is
+// pinned by existing outputs and can't be changed without breaking them; WithSpecRoundByte
+// selects the specified round byte instead.
 func (p *FFX) RoundFunc(i int, B uint64, tweak []byte) uint64 {
+	p.prepareTweak(tweak)
+	return p.roundFunc(i, B)
+}
+
+// roundFunc is RoundFunc using the state from the last call to prepareTweak.
+func (p *FFX) roundFunc(i int, B uint64) uint64 {
 	split := p.lengthBits / 2
 
 	binary.BigEndian.PutUint64(p.q[len(p.q)-8:], B)
+	if p.specRound {
+		p.q[len(p.q)-9] = byte(i)
+	}
 
 	// CBC-MAC
 	inBytes := p.inBytes[:]
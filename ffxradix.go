@@ -0,0 +1,316 @@
+package permutation
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/bits"
+)
+
+const AlgoFFXRadix = "FFXRadix"
+
+// FFXRadix implements a permutation over [0, radix^length), the strings of length numerals
+// in the given radix, using FFX with blockwise addition over AES.  It preserves the
+// number of digits, for example permuting 6-digit decimal numbers among themselves, where
+// FFX, which is radix 2, would need to cycle-walk.  Key derivation uses HKDF, so the
+// input key can be any length.
+//
+// The value is split into A, its high length/2 numerals, and B, the rest, and each round
+// computes A, B = B, (A + F(i, B)) mod radix^m, where m is the length of A.  F(i, B) is the
+// AES-CBC-MAC of P || Q reduced modulo radix^m, where P encodes the radix, length, split,
+// rounds, blockwise addition and tweak length, as in FFX-A2, and Q is the tweak, zero
+// padding, the round index and B as 8 big-endian bytes.  Reducing 128 bits biases F by at
+// most 2^-64.  Each half must fit in 64 bits, so the longer half, B, must be less than
+// 2^64, which allows up to 38 decimal digits.
+type FFXRadix struct {
+	radix, length int
+	// split is the length of A; B has the other length-split numerals.
+	split  int
+	rounds int
+	// modA and modB are radix^split and radix^(length-split), and n is radix^length.
+	modA, modB uint64
+	n, modBBig big.Int
+
+	aes cipher.Block
+	p   [aes.BlockSize]byte
+	kdf kdfParams
+
+	// macState is the CBC-MAC state after P and all but the last block of Q for the tweak
+	// tweakFor, and lastPrefix is the part of the last block before the round index.
+	macState   [aes.BlockSize]byte
+	lastPrefix [7]byte
+	tweakFor   []byte
+	tweakValid bool
+
+	// Scratch variables to avoid allocations.
+	in, q, r big.Int
+	buf      [aes.BlockSize]byte
+}
+
+// NewFFXRadix returns an FFXRadix over [0, radix^length).  It panics unless radix is in
+// [2, 255], length is at least 2 and radix^(length - length/2) is less than 2^64.
+func NewFFXRadix(key []byte, radix, length int) *FFXRadix {
+	if radix < 2 || radix > 255 {
+		panic(fmt.Sprintf("radix must be in [2, 255], got: %v", radix))
+	}
+	if length < 2 {
+		panic(fmt.Sprintf("length must be at least 2, got: %v", length))
+	}
+	split := length / 2
+	modB, ok := radixPower(radix, length-split)
+	if !ok {
+		panic(fmt.Sprintf("length %v is too long for radix %v: each half must be less than 2^64", length, radix))
+	}
+	modA, _ := radixPower(radix, split)
+	p := &FFXRadix{
+		radix:  radix,
+		length: length,
+		split:  split,
+		modA:   modA,
+		modB:   modB,
+		kdf:    newKDFParams("permute.FFXRadix"),
+	}
+	p.modBBig.SetUint64(modB)
+	p.n.SetUint64(modA)
+	p.n.Mul(&p.n, &p.modBBig)
+	p.rounds = RecommendedRounds(domainBitLen(&p.n))
+
+	block, err := aes.NewCipher(deriveFFXKey(sha256.New, key, nil, "permute.FFXRadix"))
+	if err == nil {
+		err = checkCipher(block)
+	}
+	if err != nil {
+		panic(err)
+	}
+	p.aes = block
+
+	const (
+		vers     = 1
+		method   = 2 // Alternating Feistel
+		addition = 1 // Blockwise
+	)
+	binary.BigEndian.PutUint16(p.p[0:2], vers)
+	p.p[2] = method
+	p.p[3] = addition
+	p.p[4] = byte(radix)
+	p.p[5] = byte(length)
+	p.p[6] = byte(split)
+	p.p[7] = byte(p.rounds)
+	return p
+}
+
+// ffxRadixSupports returns whether NewFFXRadix accepts radix and length, for a radix other
+// than 2, which FFX covers.
+func ffxRadixSupports(radix, length int) bool {
+	if radix < 3 || radix > 255 || length < 2 {
+		return false
+	}
+	_, ok := radixPower(radix, length-length/2)
+	return ok
+}
+
+// radixPower returns radix^m and whether it is less than 2^64.
+func radixPower(radix, m int) (uint64, bool) {
+	v := uint64(1)
+	for range m {
+		hi, lo := bits.Mul64(v, uint64(radix))
+		if hi != 0 {
+			return 0, false
+		}
+		v = lo
+	}
+	return v, true
+}
+
+// Clone returns an independent copy of p that shares its key-derived state but has its
+// own scratch, so that it can be used concurrently with p.
+func (p *FFXRadix) Clone() Permutation {
+	c := &FFXRadix{
+		radix:  p.radix,
+		length: p.length,
+		split:  p.split,
+		rounds: p.rounds,
+		modA:   p.modA,
+		modB:   p.modB,
+		aes:    p.aes,
+		p:      p.p,
+		kdf:    p.kdf,
+	}
+	c.n.Set(&p.n)
+	c.modBBig.Set(&p.modBBig)
+	return c
+}
+
+// InDomain returns whether v is in [0, radix^length).
+func (p *FFXRadix) InDomain(v *big.Int) bool {
+	return v.Sign() >= 0 && v.Cmp(&p.n) < 0
+}
+
+func (p *FFXRadix) Rounds() int {
+	return p.rounds
+}
+
+func (p *FFXRadix) Algorithm() string {
+	return AlgoFFXRadix
+}
+
+func (p *FFXRadix) PermuteInt(in int) int {
+	return p.PermuteIntTweak(in, nil)
+}
+
+func (p *FFXRadix) PermuteIntTweak(in int, tweak []byte) int {
+	return int(p.PermuteInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+func (p *FFXRadix) InvertInt(in int) int {
+	return p.InvertIntTweak(in, nil)
+}
+
+func (p *FFXRadix) InvertIntTweak(in int, tweak []byte) int {
+	return int(p.InvertInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+func (p *FFXRadix) PermuteUint64(in uint64) uint64 {
+	return stepUint64(p.PermuteInPlace, &p.in, in)
+}
+
+func (p *FFXRadix) InvertUint64(in uint64) uint64 {
+	return stepUint64(p.InvertInPlace, &p.in, in)
+}
+
+func (p *FFXRadix) Params() Params {
+	return Params{
+		Version:   AlgorithmVersion,
+		Algorithm: p.Algorithm(),
+		Rounds:    p.Rounds(),
+		Domain:    new(big.Int).Set(&p.n),
+	}
+}
+
+// ParamsHash returns a stable identifier for p's parameters; see FFX.ParamsHash.
+func (p *FFXRadix) ParamsHash() [sha256.Size]byte {
+	return paramsHash(p)
+}
+
+func (p *FFXRadix) appendParams(b *TweakBuilder) {
+	b.AddString(p.Algorithm()).AddUint64(uint64(p.length)).AddUint64(uint64(p.rounds))
+	b.AddUint64(uint64(p.radix)).AddUint64(uint64(p.split))
+	p.kdf.append(b)
+}
+
+// TryPermuteInPlace is PermuteInPlace but returns an error, rather than panicking, if
+// inOut is outside [0, radix^length).
+func (p *FFXRadix) TryPermuteInPlace(inOut *big.Int, tweak []byte) (*big.Int, error) {
+	if err := p.check(inOut); err != nil {
+		return nil, err
+	}
+	return p.PermuteInPlace(inOut, tweak), nil
+}
+
+// TryInvertInPlace is InvertInPlace but returns an error rather than panicking.
+func (p *FFXRadix) TryInvertInPlace(inOut *big.Int, tweak []byte) (*big.Int, error) {
+	if err := p.check(inOut); err != nil {
+		return nil, err
+	}
+	return p.InvertInPlace(inOut, tweak), nil
+}
+
+func (p *FFXRadix) check(in *big.Int) error {
+	if !p.InDomain(in) {
+		return errorf(ErrOutOfRange, "input %v is outside range of permutation [0, %v^%v)", in, p.radix, p.length)
+	}
+	return nil
+}
+
+// PermuteInPlace calculates inOut's permutated value and stores it back into inOut.
+// Returns inOut as a convenience.
+func (p *FFXRadix) PermuteInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	a, b := p.start(inOut, tweak)
+	for i := range p.rounds {
+		mod := p.modA
+		if i%2 == 1 {
+			mod = p.modB
+		}
+		// a and F are less than mod, so a single subtraction reduces the sum, even if it
+		// overflowed.
+		c := a + p.roundFunc(i, b, mod)
+		if c < a || c >= mod {
+			c -= mod
+		}
+		a, b = b, c
+	}
+	return p.finish(inOut, a, b)
+}
+
+// InvertInPlace is the inverse of PermuteInPlace.  Returns inOut as a convenience.
+func (p *FFXRadix) InvertInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	a, b := p.start(inOut, tweak)
+	for i := p.rounds - 1; i >= 0; i-- {
+		mod := p.modA
+		if i%2 == 1 {
+			mod = p.modB
+		}
+		f := p.roundFunc(i, a, mod)
+		c := b - f
+		if b < f {
+			c += mod
+		}
+		a, b = c, a
+	}
+	return p.finish(inOut, a, b)
+}
+
+// start splits in into A and B and prepares the tweak-dependent MAC state.
+func (p *FFXRadix) start(in *big.Int, tweak []byte) (a, b uint64) {
+	if err := p.check(in); err != nil {
+		panic(err.Error())
+	}
+	if !p.tweakValid || !bytes.Equal(tweak, p.tweakFor) {
+		p.macTweak(tweak)
+		p.tweakFor = append(p.tweakFor[:0], tweak...)
+		p.tweakValid = true
+	}
+	p.q.QuoRem(in, &p.modBBig, &p.r)
+	return p.q.Uint64(), p.r.Uint64()
+}
+
+// finish stores A*radix^(length-split) + B into out.
+func (p *FFXRadix) finish(out *big.Int, a, b uint64) *big.Int {
+	out.SetUint64(a)
+	out.Mul(out, &p.modBBig)
+	return out.Add(out, p.r.SetUint64(b))
+}
+
+// macTweak calculates macState and lastPrefix for tweak.  Q is the tweak, zero-padded so
+// that the round index and B end the last block.
+func (p *FFXRadix) macTweak(tweak []byte) {
+	binary.BigEndian.PutUint64(p.p[8:16], uint64(len(tweak)))
+	p.aes.Encrypt(p.macState[:], p.p[:])
+
+	q := append([]byte(nil), tweak...)
+	for len(q)%aes.BlockSize != len(p.lastPrefix) {
+		q = append(q, 0)
+	}
+	for len(q) > len(p.lastPrefix) {
+		subtle.XORBytes(p.macState[:], p.macState[:], q[:aes.BlockSize])
+		p.aes.Encrypt(p.macState[:], p.macState[:])
+		q = q[aes.BlockSize:]
+	}
+	copy(p.lastPrefix[:], q)
+}
+
+// roundFunc returns F(i, B) in [0, mod).
+func (p *FFXRadix) roundFunc(i int, b, mod uint64) uint64 {
+	buf := p.buf[:]
+	copy(buf, p.lastPrefix[:])
+	buf[7] = byte(i)
+	binary.BigEndian.PutUint64(buf[8:], b)
+	subtle.XORBytes(buf, buf, p.macState[:])
+	p.aes.Encrypt(buf, buf)
+	return bits.Rem64(binary.BigEndian.Uint64(buf[:8]), binary.BigEndian.Uint64(buf[8:]), mod)
+}
@@ -0,0 +1,114 @@
+package permutation
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestFFXRadix(t *testing.T) {
+	p := NewFFXRadix([]byte("foo"), 10, 6)
+	if p.Algorithm() != AlgoFFXRadix || p.Rounds() != RecommendedRounds(20) {
+		t.Errorf("Algorithm() = %v, Rounds() = %v", p.Algorithm(), p.Rounds())
+	}
+	seen := make([]bool, 1000000)
+	for i := range 1000000 {
+		out := p.PermuteInt(i)
+		if out < 0 || out >= len(seen) || seen[out] {
+			t.Fatalf("PermuteInt(%d) = %d is out of range or a duplicate", i, out)
+		}
+		seen[out] = true
+		if inv := p.InvertInt(out); inv != i {
+			t.Fatalf("InvertInt(%d) = %d, expected %d", out, inv, i)
+		}
+	}
+
+	same, sameKey := 0, 0
+	other := NewFFXRadix([]byte("bar"), 10, 6)
+	for i := range 1000 {
+		out := p.PermuteInt(i)
+		if p.PermuteInPlace(big.NewInt(int64(i)), []byte("tweak")).Int64() == int64(out) {
+			same++
+		}
+		if other.PermuteInt(i) == out {
+			sameKey++
+		}
+	}
+	if same > 5 || sameKey > 5 {
+		t.Errorf("outputs unchanged: %d changing the tweak, %d changing the key", same, sameKey)
+	}
+
+	if _, err := p.TryPermuteInPlace(big.NewInt(1000000), nil); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("expected ErrOutOfRange, got %v", err)
+	}
+	if c := p.Clone(); c.PermuteInt(123456) != p.PermuteInt(123456) {
+		t.Error("clone gave a different mapping")
+	}
+}
+
+func TestFFXRadixRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, tc := range []struct{ radix, length int }{
+		{2, 2},
+		{2, 126},
+		{3, 9},
+		{10, 7},
+		{10, 16},
+		{10, 38},
+		{26, 13},
+		{255, 2},
+		{255, 15},
+	} {
+		t.Run(fmt.Sprintf("radix %d length %d", tc.radix, tc.length), func(t *testing.T) {
+			p := NewFFXRadix([]byte("foo"), tc.radix, tc.length)
+			n := new(big.Int).Exp(big.NewInt(int64(tc.radix)), big.NewInt(int64(tc.length)), nil)
+			if p.Params().Domain.Cmp(n) != 0 {
+				t.Fatalf("domain is %v, expected %v", p.Params().Domain, n)
+			}
+			buf := make([]byte, (n.BitLen()+7)/8+8)
+			for i := range 200 {
+				for j := range buf {
+					buf[j] = byte(rng.Uint32())
+				}
+				in := new(big.Int).SetBytes(buf)
+				in.Mod(in, n)
+				switch i {
+				case 0:
+					in.SetInt64(0)
+				case 1:
+					in.Sub(n, big.NewInt(1))
+				}
+				var tweak []byte
+				if i%2 == 1 {
+					tweak = []byte("a tweak that is longer than one block")
+				}
+				out := p.PermuteInPlace(new(big.Int).Set(in), tweak)
+				if !p.InDomain(out) {
+					t.Fatalf("%v permuted to %v, out of range", in, out)
+				}
+				if inv := p.InvertInPlace(out, tweak); inv.Cmp(in) != 0 {
+					t.Fatalf("%v inverted to %v", in, inv)
+				}
+			}
+		})
+	}
+
+	for _, tc := range []struct{ radix, length int }{
+		{1, 10},
+		{256, 4},
+		{10, 1},
+		{10, 39},
+		{2, 127},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewFFXRadix(%d, %d) should panic", tc.radix, tc.length)
+				}
+			}()
+			NewFFXRadix([]byte("foo"), tc.radix, tc.length)
+		}()
+	}
+}
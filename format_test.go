@@ -0,0 +1,55 @@
+package permutation
+
+import (
+	"errors"
+	"testing"
+)
+
+var cardNumber = Format{Alphabet: "0123456789", Length: 16, TweakRequired: true}
+
+func TestFormatPermuter(t *testing.T) {
+	p := NewFormatPermuter([]byte("foo"), cardNumber)
+	if p.Format() != cardNumber {
+		t.Errorf("Format() = %+v, expected %+v", p.Format(), cardNumber)
+	}
+	tweak := []byte("merchant 42")
+	for _, card := range []string{"4111111111111111", "0000000000000000", "9999999999999999", "5500000000000004"} {
+		enc, err := p.Encrypt(card, tweak)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(enc) != 16 || enc == card {
+			t.Errorf("Encrypt(%q) = %q", card, enc)
+		}
+		for _, r := range enc {
+			if r < '0' || r > '9' {
+				t.Fatalf("Encrypt(%q) = %q isn't all digits", card, enc)
+			}
+		}
+		if dec, err := p.Decrypt(enc, tweak); err != nil || dec != card {
+			t.Errorf("Decrypt(%q) = %q, %v, expected %q", enc, dec, err, card)
+		}
+		if expected, _ := NewRadixStringPermuter([]byte("foo"), cardNumber.Alphabet, 16).Encrypt(card, tweak); enc != expected {
+			t.Errorf("Encrypt(%q) = %q, RadixStringPermuter gives %q", card, enc, expected)
+		}
+	}
+
+	for _, tweak := range [][]byte{nil, {}} {
+		if _, err := p.Encrypt("4111111111111111", tweak); !errors.Is(err, errTweakRequired) {
+			t.Errorf("Encrypt with tweak %q: expected errTweakRequired, got %v", tweak, err)
+		}
+		if _, err := p.Decrypt("4111111111111111", tweak); !errors.Is(err, errTweakRequired) {
+			t.Errorf("Decrypt with tweak %q: expected errTweakRequired, got %v", tweak, err)
+		}
+	}
+	optional := NewFormatPermuter([]byte("foo"), Format{Alphabet: "0123456789", Length: 16})
+	if _, err := optional.Encrypt("4111111111111111", nil); err != nil {
+		t.Errorf("optional tweak: %v", err)
+	}
+
+	for _, bad := range []string{"411111111111111", "41111111111111112", "411111111111111x"} {
+		if _, err := p.Encrypt(bad, tweak); err == nil {
+			t.Errorf("expected an error encrypting %q", bad)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !permutedebug
+
+package permutation
+
+// guardEnabled is set by the permutedebug build tag, which makes ArbitraryN panic when
+// it detects concurrent use; see guard_debug.go.
+const guardEnabled = false
+
+// concurrencyGuard is empty without the permutedebug build tag, and costs nothing.
+type concurrencyGuard struct{}
+
+func (g *concurrencyGuard) enter() {}
+
+func (g *concurrencyGuard) exit() {}
@@ -0,0 +1,29 @@
+//go:build permutedebug
+
+package permutation
+
+import "sync/atomic"
+
+// guardEnabled is set by the permutedebug build tag.  With it, ArbitraryN's PermuteInt,
+// InvertInt, PermuteInPlace and InvertInPlace, and the methods that call them, mark the
+// permutation busy for the duration of each call and panic if it is already busy: an
+// ArbitraryN holds scratch state, so concurrent calls on one instance can silently
+// return wrong results.  The flag is only updated atomically, and a call that finds it
+// set panics before touching any other state, so builds with -race report the misuse as
+// this panic rather than as a data race inside the permutation.
+const guardEnabled = true
+
+// concurrencyGuard is the busy flag.
+type concurrencyGuard struct {
+	busy int32
+}
+
+func (g *concurrencyGuard) enter() {
+	if !atomic.CompareAndSwapInt32(&g.busy, 0, 1) {
+		panic("concurrent use of a single ArbitraryN detected; use a separate permutation per goroutine")
+	}
+}
+
+func (g *concurrencyGuard) exit() {
+	atomic.StoreInt32(&g.busy, 0)
+}
@@ -0,0 +1,67 @@
+//go:build permutedebug
+
+package permutation
+
+import (
+	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConcurrencyGuard(t *testing.T) {
+	p := NewNInt([]byte("foo"), 1<<40)
+	var detected, stop atomic.Bool
+	var wg sync.WaitGroup
+	for g := range 4 {
+		wg.Go(func() {
+			defer func() {
+				if r := recover(); r != nil {
+					if msg, ok := r.(string); !ok || !strings.Contains(msg, "concurrent use") {
+						t.Errorf("unexpected panic: %v", r)
+					}
+					detected.Store(true)
+					stop.Store(true)
+				}
+			}()
+			v := new(big.Int)
+			for i := 0; i < 1_000_000 && !stop.Load(); i++ {
+				if g%2 == 0 {
+					p.PermuteInt(i)
+				} else {
+					p.InvertInPlace(v.SetInt64(int64(i)), nil)
+				}
+			}
+		})
+	}
+	wg.Wait()
+	if !detected.Load() {
+		t.Fatal("concurrent use wasn't detected")
+	}
+	// The winning goroutine cleared the flag on its way out.
+	if p.guard.busy != 0 {
+		t.Error("guard left busy after the goroutines finished")
+	}
+
+	// Sequential use from several goroutines and a recovered panic don't trip it.
+	q := NewNInt([]byte("foo"), 1000)
+	var mu sync.Mutex
+	for range 4 {
+		wg.Go(func() {
+			for i := range 100 {
+				mu.Lock()
+				q.PermuteInt(i)
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	func() {
+		defer func() { recover() }()
+		q.PermuteInt(1000)
+	}()
+	if out := q.InvertInt(q.PermuteInt(5)); out != 5 {
+		t.Errorf("round trip after a recovered panic gave %d", out)
+	}
+}
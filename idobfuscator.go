@@ -0,0 +1,117 @@
+package permutation
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// IDEncoding is a string encoding for the permuted IDs produced by IDObfuscator.
+type IDEncoding interface {
+	encodeID(v uint64) string
+	decodeID(s string) (uint64, error)
+}
+
+const base62Digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+type base62Encoding struct{}
+
+// Base62 encodes IDs as variable-length base-62 strings using the digits 0-9, A-Z, a-z.
+func Base62() IDEncoding {
+	return base62Encoding{}
+}
+
+func (base62Encoding) encodeID(v uint64) string {
+	return string(sqidsAppendNumber(nil, v, []byte(base62Digits)))
+}
+
+func (base62Encoding) decodeID(s string) (uint64, error) {
+	v, err := sqidsToNumber(s, []byte(base62Digits))
+	if err != nil {
+		return 0, err
+	}
+	if s == "" || (base62Encoding{}).encodeID(v) != s {
+		return 0, fmt.Errorf("%q is not a canonical base-62 number", s)
+	}
+	return v, nil
+}
+
+type sqidsEncoding struct {
+	s *sqids
+}
+
+// Sqids encodes each ID as a single-number Sqids (https://sqids.org) string, which any
+// Sqids implementation configured with the same alphabet can decode.  An empty alphabet
+// selects SqidsDefaultAlphabet.  The Sqids minimum length and blocklist features aren't
+// supported.  It panics if the alphabet is invalid.
+func Sqids(alphabet string) IDEncoding {
+	if alphabet == "" {
+		alphabet = SqidsDefaultAlphabet
+	}
+	s, err := newSqids(alphabet)
+	if err != nil {
+		panic(err)
+	}
+	return sqidsEncoding{s: s}
+}
+
+func (e sqidsEncoding) encodeID(v uint64) string {
+	return e.s.encode([]uint64{v})
+}
+
+func (e sqidsEncoding) decodeID(s string) (uint64, error) {
+	numbers, err := e.s.decode(s)
+	if err != nil {
+		return 0, err
+	}
+	if len(numbers) != 1 {
+		return 0, fmt.Errorf("expected a single number, got %d", len(numbers))
+	}
+	if e.s.encode(numbers) != s {
+		return 0, errors.New("not a canonical sqids ID")
+	}
+	return numbers[0], nil
+}
+
+// IDObfuscator turns IDs in [0, n) into reversible, opaque strings by permuting them and
+// then encoding the result.
+type IDObfuscator struct {
+	p        *ArbitraryN
+	encoding IDEncoding
+
+	// Scratch variables to avoid allocations.
+	v big.Int
+}
+
+// NewIDObfuscator returns an IDObfuscator over [0, n), where n is at most 2^64.
+func NewIDObfuscator(key []byte, n *big.Int, encoding IDEncoding) *IDObfuscator {
+	if n.Sign() <= 0 || new(big.Int).Sub(n, big.NewInt(1)).BitLen() > 64 {
+		panic(fmt.Sprintf("n must be in (0, 2^64], got: %v", n))
+	}
+	return &IDObfuscator{
+		p:        NewN(key, n),
+		encoding: encoding,
+	}
+}
+
+// Encode permutes id and encodes the result.
+func (o *IDObfuscator) Encode(id uint64) (string, error) {
+	o.v.SetUint64(id)
+	if !o.p.InDomain(&o.v) {
+		return "", errorf(ErrOutOfRange, "id %v is outside range of permutation [0, %v)", id, &o.p.n)
+	}
+	return o.encoding.encodeID(o.p.PermuteInPlace(&o.v, nil).Uint64()), nil
+}
+
+// Decode is the inverse of Encode.
+func (o *IDObfuscator) Decode(s string) (uint64, error) {
+	v, err := o.encoding.decodeID(s)
+	if err != nil {
+		return 0, err
+	}
+	o.v.SetUint64(v)
+	if !o.p.InDomain(&o.v) {
+		return 0, errorf(ErrOutOfRange, "%q decodes to %v, outside range of permutation [0, %v)", s, v, &o.p.n)
+	}
+	return o.p.InvertInPlace(&o.v, nil).Uint64(), nil
+}
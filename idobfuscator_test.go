@@ -0,0 +1,79 @@
+package permutation
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestIDObfuscator(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		encoding IDEncoding
+	}{
+		{"base62", Base62()},
+		{"sqids default", Sqids("")},
+		{"sqids custom", Sqids("0123456789abcdef")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, n := range []*big.Int{big.NewInt(1000), new(big.Int).Lsh(big.NewInt(1), 64)} {
+				o := NewIDObfuscator([]byte("foo"), n, tc.encoding)
+				seen := make(map[string]bool)
+				for id := range uint64(1000) {
+					s, err := o.Encode(id)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if seen[s] {
+						t.Fatalf("duplicate encoding %q", s)
+					}
+					seen[s] = true
+					decoded, err := o.Decode(s)
+					if err != nil {
+						t.Fatalf("Decode(%q) failed: %v", s, err)
+					}
+					if decoded != id {
+						t.Fatalf("%d -> %q decoded to %d", id, s, decoded)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestIDObfuscatorSqidsInterop(t *testing.T) {
+	// The string must be the plain Sqids encoding of the permuted value.
+	s, err := newSqids(SqidsDefaultAlphabet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := NewIDObfuscator([]byte("foo"), big.NewInt(1000), Sqids(""))
+	p := NewNInt([]byte("foo"), 1000)
+	for id := range 100 {
+		encoded, err := o.Encode(uint64(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := s.encode([]uint64{uint64(p.PermuteInt(id))}); encoded != expected {
+			t.Fatalf("Encode(%d) = %q, expected %q", id, encoded, expected)
+		}
+	}
+}
+
+func TestIDObfuscatorErrors(t *testing.T) {
+	for _, encoding := range []IDEncoding{Base62(), Sqids("")} {
+		o := NewIDObfuscator([]byte("foo"), big.NewInt(1000), encoding)
+		if _, err := o.Encode(1000); err == nil {
+			t.Error("expected error encoding out-of-range id")
+		}
+		tooBig := encoding.encodeID(5000)
+		multi := Sqids("").(sqidsEncoding).s.encode([]uint64{1, 2})
+		// MaxUint64 is 15 mod 62, so appending "z" overflows in the addition alone.
+		wrapped := Base62().encodeID(math.MaxUint64/62) + "z"
+		for _, s := range []string{"", "!", "~~", tooBig, multi, "0" + encoding.encodeID(5), wrapped} {
+			if _, err := o.Decode(s); err == nil {
+				t.Errorf("expected error decoding %q", s)
+			}
+		}
+	}
+}
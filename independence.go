@@ -0,0 +1,67 @@
+package permutation
+
+import (
+	"fmt"
+	"math/bits"
+	"math/rand/v2"
+)
+
+// KeyIndependenceSamples is the largest number of inputs that KeyIndependence compares.
+const KeyIndependenceSamples = 1 << 16
+
+// KeyIndependence is a diagnostic for tests: it returns the number of inputs in [0, n)
+// that p1 and p2, typically the same construction under two keys, map to the same output.
+// For independent permutations the expected count is about 1, whereas identical ones
+// collide on every input.  If n is larger than KeyIndependenceSamples, it compares only
+// KeyIndependenceSamples evenly spaced inputs, for which the expected count for
+// independent permutations is KeyIndependenceSamples/n, so effectively 0.  n must be in
+// the domain of both permutations.
+func KeyIndependence(p1, p2 Permutation, n int) int {
+	if n <= 0 {
+		panic(fmt.Sprintf("n must be positive, got: %v", n))
+	}
+	samples, stride := n, 1
+	if n > KeyIndependenceSamples {
+		samples, stride = KeyIndependenceSamples, n/KeyIndependenceSamples
+	}
+	collisions := 0
+	for i := range samples {
+		if in := i * stride; p1.PermuteInt(in) == p2.PermuteInt(in) {
+			collisions++
+		}
+	}
+	return collisions
+}
+
+// MeasureAvalanche is a diagnostic of how well p mixes at its configured number of
+// rounds: for samples inputs in [0, n), chosen pseudo-randomly but reproducibly, it flips
+// each input bit in turn and returns the average fraction of the output bits, of the
+// bits.Len(n-1) needed for [0, n), that change.  A well-mixed permutation gives about 0.5;
+// too few rounds give noticeably less.  Flips that leave [0, n) are skipped, so n is
+// best a power of 2.  It measures diffusion only, not security against an adversary, so
+// it can justify fewer rounds only where there is none.  n must be at least 2 and in p's
+// domain.
+func MeasureAvalanche(p Permutation, n, samples int) float64 {
+	if n < 2 {
+		panic(fmt.Sprintf("n must be at least 2, got: %v", n))
+	}
+	if samples <= 0 {
+		panic(fmt.Sprintf("samples must be positive, got: %v", samples))
+	}
+	width := bits.Len(uint(n - 1))
+	rng := rand.New(rand.NewPCG(uint64(n), uint64(samples)))
+	changed, total := 0, 0
+	for range samples {
+		in := rng.IntN(n)
+		out := p.PermuteInt(in)
+		for bit := range width {
+			flipped := in ^ 1<<bit
+			if flipped >= n {
+				continue
+			}
+			changed += bits.OnesCount(uint(out ^ p.PermuteInt(flipped)))
+			total += width
+		}
+	}
+	return float64(changed) / float64(total)
+}
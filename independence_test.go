@@ -0,0 +1,62 @@
+package permutation
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestKeyIndependence(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		p1, p2 Permutation
+		n      int
+	}{
+		{"FeistelSHAKE128", NewPowerOf2([]byte("foo"), 12), NewPowerOf2([]byte("bar"), 12), 1 << 12},
+		{"ArbitraryN", NewNInt([]byte("foo"), 5000), NewNInt([]byte("bar"), 5000), 5000},
+		{"sampled", NewFFX([]byte("foo"), 40), NewFFX([]byte("bar"), 40), min(1<<40, math.MaxInt)},
+	} {
+		if collisions := KeyIndependence(tc.p1, tc.p2, tc.n); collisions > 10 {
+			t.Errorf("%s: %d collisions between unrelated keys", tc.name, collisions)
+		}
+		expected := min(tc.n, KeyIndependenceSamples)
+		if collisions := KeyIndependence(tc.p1, tc.p1, tc.n); collisions != expected {
+			t.Errorf("%s: %d collisions comparing a permutation with itself, expected %d", tc.name, collisions, expected)
+		}
+	}
+	same := KeyIndependence(NewNInt([]byte("foo"), 1000), NewNInt([]byte("foo"), 1000), 1000)
+	if same != 1000 {
+		t.Errorf("identical keys collided on %d of 1000 inputs", same)
+	}
+}
+
+func TestMeasureAvalanche(t *testing.T) {
+	n := 1 << 16
+	avalanche := func(algorithm string, rounds int) float64 {
+		opts := []Option{WithAlgorithm(algorithm)}
+		if rounds != 0 {
+			opts = append(opts, WithRounds(rounds))
+		}
+		p, err := New([]byte("foo"), big.NewInt(int64(n)), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return MeasureAvalanche(p, n, 500)
+	}
+	for _, algorithm := range []string{AlgoFFX, AlgoFeistelSHAKE128} {
+		few, some, recommended := avalanche(algorithm, 1), avalanche(algorithm, 3), avalanche(algorithm, 0)
+		if few > 0.4 {
+			t.Errorf("%s: 1 round gave avalanche %.3f, expected poor mixing", algorithm, few)
+		}
+		if !(few < some && some <= recommended+0.01) {
+			t.Errorf("%s: avalanche %.3f, %.3f, %.3f didn't improve with rounds", algorithm, few, some, recommended)
+		}
+		if recommended < 0.49 || recommended > 0.51 {
+			t.Errorf("%s: recommended rounds gave avalanche %.3f, expected about 0.5", algorithm, recommended)
+		}
+	}
+
+	if a := MeasureAvalanche(NewNInt([]byte("foo"), 1000), 1000, 200); a < 0.45 || a > 0.55 {
+		t.Errorf("ArbitraryN over 1000 gave avalanche %.3f", a)
+	}
+}
@@ -0,0 +1,49 @@
+package permutation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PermuteLines reads newline-delimited base-10 integers from src, permutes each one and
+// writes the results, one per line, to dst.  Blank lines are skipped, as is whitespace
+// around each integer.  It streams, so src can be arbitrarily long, but it stops at the
+// first line that isn't an integer in [0, n) and returns an error giving the line number;
+// the results for the preceding lines will already have been written.
+func (p *ArbitraryN) PermuteLines(dst io.Writer, src io.Reader) error {
+	return p.lines(dst, src, p.PermuteString)
+}
+
+// InvertLines is the inverse of PermuteLines.
+func (p *ArbitraryN) InvertLines(dst io.Writer, src io.Reader) error {
+	return p.lines(dst, src, p.InvertString)
+}
+
+func (p *ArbitraryN) lines(dst io.Writer, src io.Reader, step func(string) (string, error)) error {
+	scanner := bufio.NewScanner(src)
+	w := bufio.NewWriter(dst)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		out, err := step(line)
+		if err != nil {
+			_ = w.Flush()
+			return fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		if _, err := w.WriteString(out); err != nil {
+			return err
+		}
+		if err := w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		_ = w.Flush()
+		return err
+	}
+	return w.Flush()
+}
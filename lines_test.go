@@ -0,0 +1,66 @@
+package permutation
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPermuteLines(t *testing.T) {
+	p := NewNInt([]byte("foo"), 100000)
+	var src strings.Builder
+	var expected []string
+	for i := range 10000 {
+		fmt.Fprintf(&src, "%d\n", i*7)
+		if i%1000 == 0 {
+			src.WriteString("\n  \r\n")
+		}
+		expected = append(expected, fmt.Sprint(i*7))
+	}
+	src.WriteString(" 12345") // No trailing newline.
+	expected = append(expected, "12345")
+
+	var permuted bytes.Buffer
+	if err := p.PermuteLines(&permuted, strings.NewReader(src.String())); err != nil {
+		t.Fatal(err)
+	}
+	outLines := strings.Split(strings.TrimSuffix(permuted.String(), "\n"), "\n")
+	if len(outLines) != len(expected) {
+		t.Fatalf("got %d lines, expected %d", len(outLines), len(expected))
+	}
+	for i, line := range outLines {
+		if want, _ := p.PermuteString(expected[i]); line != want {
+			t.Fatalf("line %d = %q, expected %q", i, line, want)
+		}
+	}
+
+	var inverted bytes.Buffer
+	if err := p.InvertLines(&inverted, &permuted); err != nil {
+		t.Fatal(err)
+	}
+	if got := inverted.String(); got != strings.Join(expected, "\n")+"\n" {
+		t.Errorf("round trip didn't restore the input")
+	}
+}
+
+func TestPermuteLinesErrors(t *testing.T) {
+	p := NewNInt([]byte("foo"), 1000)
+	for _, tc := range []struct {
+		src, err string
+		lines    int
+	}{
+		{"1\n2\n\nfoo\n4\n", "line 4: input \"foo\" is not a base-10 integer", 2},
+		{"1\n1000\n", "line 2: input 1000 is outside range of permutation [0, 1000)", 1},
+		{"-1\n", "line 1: input -1 is outside range of permutation [0, 1000)", 0},
+	} {
+		var dst bytes.Buffer
+		err := p.PermuteLines(&dst, strings.NewReader(tc.src))
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("PermuteLines(%q) returned %v, expected %q", tc.src, err, tc.err)
+		}
+		if lines := strings.Count(dst.String(), "\n"); lines != tc.lines {
+			t.Errorf("PermuteLines(%q) wrote %d lines before failing, expected %d", tc.src, lines, tc.lines)
+		}
+	}
+}
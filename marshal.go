@@ -0,0 +1,318 @@
+package permutation
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// marshalVersion is the first byte of the encodings of MarshalBinary.  A change to the
+// format must bump it so that old decoders reject the new encoding rather than misreading
+// it.
+const marshalVersion = 1
+
+// maxMarshaledRounds bounds the rounds that UnmarshalBinary accepts, so that a corrupt
+// encoding can't make it allocate a huge number of round states.
+const maxMarshaledRounds = 1 << 16
+
+// MarshalBinary encodes p's derived AES key, length, rounds, radix, spec round byte
+// option and tweak limit, but not the key it was derived from or how, so that another
+// process can reconstruct p with UnmarshalBinary without the master key.  The encoding
+// starts with a version byte and the algorithm name.  It holds the AES key, so it must be
+// protected like one.  It returns an error for an FFX built by NewFFXFromBlock, which has
+// no key bytes to encode.
+func (p *FFX) MarshalBinary() ([]byte, error) {
+	if p.aesKey == nil {
+		return nil, errors.New("FFX built from a cipher.Block has no AES key to marshal")
+	}
+	b := appendMarshalHeader(nil, p.Algorithm())
+	b = binary.AppendUvarint(b, uint64(p.lengthBits))
+	b = binary.AppendUvarint(b, uint64(p.rounds))
+	b = binary.AppendUvarint(b, 2) // Radix.
+	b = binary.AppendUvarint(b, boolToUint64(p.specRound))
+	b = appendMarshaledTweakLimit(b, p.tweakLimit)
+	return appendMarshaledBytes(b, p.aesKey), nil
+}
+
+// UnmarshalBinary replaces p with the FFX encoded by MarshalBinary, which permutes exactly
+// as the original did.  Since the encoding only has the derived key, the result is as if
+// it had been built by NewFFXFromAESKey, so Rekey and ParamsHash assume the default key
+// derivation.  It returns an error, leaving p unchanged, if data has an unknown version,
+// is for another algorithm or is malformed.
+func (p *FFX) UnmarshalBinary(data []byte) error {
+	d, err := newMarshalDecoder(data, AlgoFFX)
+	if err != nil {
+		return err
+	}
+	lengthBits, rounds, radix := d.int(), d.int(), d.int()
+	specRound := d.bool()
+	limit := d.tweakLimit()
+	aesKey := d.bytes()
+	if err := d.finish(); err != nil {
+		return err
+	}
+	switch {
+	case lengthBits < 2 || lengthBits > 128:
+		return fmt.Errorf("lengthBits must be in [2, 128], got: %v", lengthBits)
+	case rounds < 1 || rounds > 255:
+		return fmt.Errorf("rounds must be in [1, 255], got: %v", rounds)
+	case radix != 2:
+		return fmt.Errorf("radix %v is not supported", radix)
+	case len(aesKey) != 16 && len(aesKey) != 24 && len(aesKey) != 32:
+		return fmt.Errorf("AES key must be 16, 24 or 32 bytes, got %v", len(aesKey))
+	}
+	if err := checkRoundParity(rounds, lengthBits/2, lengthBits); err != nil {
+		return err
+	}
+	q := newFFXCipher(lengthBits, sha256.New, "permute.FFX")
+	q.setAESKey(aesKey)
+	q.setRounds(rounds)
+	q.specRound = specRound
+	q.tweakLimit = limit
+	*p = *q
+	return nil
+}
+
+// MarshalBinary encodes p's key, length, rounds, split, domain label, pepper and tweak
+// limit, so that another process can reconstruct p with UnmarshalBinary.  The key is the
+// one that p absorbs in each round: the key passed to NewPowerOf2, or the key derived from
+// it if New used WithKDFInfo.  The encoding starts with a version byte and the algorithm
+// name.  It holds the key and pepper, so it must be protected like them.  It returns an
+// error for a FeistelPRF, whose PRF can't be encoded.
+func (p *FeistelSHAKE128) MarshalBinary() ([]byte, error) {
+	if p.prf != nil {
+		return nil, errors.New("FeistelPRF's PRF can't be marshaled")
+	}
+	b := appendMarshalHeader(nil, p.Algorithm())
+	b = binary.AppendUvarint(b, uint64(p.lengthBits))
+	b = binary.AppendUvarint(b, uint64(p.rounds))
+	b = binary.AppendUvarint(b, uint64(p.split))
+	b = binary.AppendUvarint(b, boolToUint64(p.labeled))
+	b = appendMarshaledBytes(b, []byte(p.label))
+	b = appendMarshaledBytes(b, p.pepper)
+	b = appendMarshaledTweakLimit(b, p.tweakLimit)
+	return appendMarshaledBytes(b, p.key), nil
+}
+
+// UnmarshalBinary replaces p with the FeistelSHAKE128 encoded by MarshalBinary, which
+// permutes exactly as the original did.  ParamsHash doesn't record whether the key was
+// derived with HKDF.  It returns an error, leaving p unchanged, if data has an unknown
+// version, is for another algorithm or is malformed.
+func (p *FeistelSHAKE128) UnmarshalBinary(data []byte) error {
+	d, err := newMarshalDecoder(data, AlgoFeistelSHAKE128)
+	if err != nil {
+		return err
+	}
+	lengthBits, rounds, split := d.int(), d.int(), d.int()
+	labeled := d.bool()
+	label, pepper := d.bytes(), d.bytes()
+	limit := d.tweakLimit()
+	key := d.bytes()
+	if err := d.finish(); err != nil {
+		return err
+	}
+	switch {
+	case lengthBits <= 1:
+		return fmt.Errorf("lengthBits must be >1, got: %v", lengthBits)
+	case rounds < 1 || rounds > maxMarshaledRounds:
+		return fmt.Errorf("rounds must be in [1, %v], got: %v", maxMarshaledRounds, rounds)
+	case split <= 0 || split >= lengthBits:
+		return fmt.Errorf("split must be in (0, %v), got: %v", lengthBits, split)
+	}
+	if err := checkRoundParity(rounds, split, lengthBits); err != nil {
+		return err
+	}
+	q := &FeistelSHAKE128{
+		key:        key,
+		lengthBits: lengthBits,
+		rounds:     rounds,
+		split:      split,
+		label:      string(label),
+		labeled:    labeled,
+		tweakLimit: limit,
+	}
+	if len(pepper) > 0 {
+		q.pepper = pepper
+	}
+	q.calculateRoundStates()
+	*p = *q
+	return nil
+}
+
+// maxMarshaledFrame bounds the frame that ReadFrom accepts, so that a corrupt length
+// prefix can't make it allocate a huge buffer.
+const maxMarshaledFrame = 1 << 24
+
+// WriteTo writes p's MarshalBinary encoding to w as a single frame, prefixed by its length
+// as a uvarint, so that ReadFrom can find where it ends in a longer stream.  It implements
+// io.WriterTo.
+func (p *FFX) WriteTo(w io.Writer) (int64, error) {
+	return writeMarshaledFrame(w, p.MarshalBinary)
+}
+
+// ReadFrom replaces p with the permutation in the next frame that WriteTo wrote to r,
+// reading no further than the end of the frame.  As with UnmarshalBinary, p is unchanged
+// if it returns an error.  It implements io.ReaderFrom.
+func (p *FFX) ReadFrom(r io.Reader) (int64, error) {
+	return readMarshaledFrame(r, p.UnmarshalBinary)
+}
+
+// WriteTo writes p's MarshalBinary encoding to w as a single length-prefixed frame; see
+// FFX.WriteTo.
+func (p *FeistelSHAKE128) WriteTo(w io.Writer) (int64, error) {
+	return writeMarshaledFrame(w, p.MarshalBinary)
+}
+
+// ReadFrom replaces p with the permutation in the next frame that WriteTo wrote to r; see
+// FFX.ReadFrom.
+func (p *FeistelSHAKE128) ReadFrom(r io.Reader) (int64, error) {
+	return readMarshaledFrame(r, p.UnmarshalBinary)
+}
+
+func writeMarshaledFrame(w io.Writer, marshal func() ([]byte, error)) (int64, error) {
+	data, err := marshal()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(appendMarshaledBytes(nil, data))
+	return int64(n), err
+}
+
+func readMarshaledFrame(r io.Reader, unmarshal func([]byte) error) (int64, error) {
+	// Read the length a byte at a time so as not to consume anything after the frame.
+	var read int64
+	var length uint64
+	var b [1]byte
+	for shift := uint(0); ; shift += 7 {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			if read > 0 && err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return read, err
+		}
+		read++
+		if shift > 63 {
+			return read, errorf(ErrInvalidLength, "frame length is not a valid uvarint")
+		}
+		length |= uint64(b[0]&0x7f) << shift
+		if b[0] < 0x80 {
+			break
+		}
+	}
+	if length > maxMarshaledFrame {
+		return read, errorf(ErrInvalidLength, "frame of %v bytes is longer than the maximum of %v", length, maxMarshaledFrame)
+	}
+	data := make([]byte, length)
+	n, err := io.ReadFull(r, data)
+	read += int64(n)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return read, err
+	}
+	return read, unmarshal(data)
+}
+
+func appendMarshalHeader(b []byte, algorithm string) []byte {
+	b = append(b, marshalVersion)
+	return appendMarshaledBytes(b, []byte(algorithm))
+}
+
+func appendMarshaledBytes(b, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendMarshaledTweakLimit(b []byte, l tweakLimit) []byte {
+	b = binary.AppendUvarint(b, boolToUint64(l.set))
+	return binary.AppendUvarint(b, uint64(l.max))
+}
+
+// marshalDecoder reads the fields written by MarshalBinary.  After the first error each
+// read returns a zero value, and finish reports the error.
+type marshalDecoder struct {
+	data []byte
+	err  error
+}
+
+// newMarshalDecoder checks the version byte and algorithm name at the start of data.
+func newMarshalDecoder(data []byte, algorithm string) (*marshalDecoder, error) {
+	if len(data) == 0 {
+		return nil, errorf(ErrInvalidLength, "encoding is empty")
+	}
+	if data[0] != marshalVersion {
+		return nil, fmt.Errorf("unsupported encoding version %v, expected %v", data[0], marshalVersion)
+	}
+	d := &marshalDecoder{data: data[1:]}
+	if got := string(d.bytes()); d.err == nil && got != algorithm {
+		return nil, fmt.Errorf("encoding is for algorithm %q, not %q", got, algorithm)
+	}
+	return d, d.err
+}
+
+func (d *marshalDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = errorf(ErrInvalidLength, "encoding is truncated or has an invalid integer")
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *marshalDecoder) int() int {
+	v := d.uvarint()
+	if v > math.MaxInt32 {
+		if d.err == nil {
+			d.err = fmt.Errorf("integer %v is out of range", v)
+		}
+		return 0
+	}
+	return int(v)
+}
+
+func (d *marshalDecoder) bool() bool {
+	switch v := d.uvarint(); v {
+	case 0, 1:
+		return v == 1
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("boolean has invalid value %v", v)
+		}
+		return false
+	}
+}
+
+func (d *marshalDecoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.data)) {
+		d.err = errorf(ErrInvalidLength, "encoding is truncated")
+		return nil
+	}
+	v := append([]byte(nil), d.data[:n]...)
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *marshalDecoder) tweakLimit() tweakLimit {
+	set := d.bool()
+	return tweakLimit{set: set, max: d.int()}
+}
+
+// finish returns the first error, or an error if there is data left over.
+func (d *marshalDecoder) finish() error {
+	if d.err == nil && len(d.data) > 0 {
+		d.err = errorf(ErrInvalidLength, "encoding has %v bytes of trailing data", len(d.data))
+	}
+	return d.err
+}
@@ -0,0 +1,258 @@
+package permutation
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"math/rand/v2"
+	"testing"
+)
+
+// checkSameMapping checks that a and b map a sample of [0, 2^lengthBits) identically, with
+// and without a tweak.
+func checkSameMapping(t *testing.T, a, b Permutation, lengthBits int, rng *rand.Rand) {
+	t.Helper()
+	buf := make([]byte, (lengthBits+7)/8)
+	n := new(big.Int).Lsh(big.NewInt(1), uint(lengthBits))
+	for i := range 20 {
+		for j := range buf {
+			buf[j] = byte(rng.Uint32())
+		}
+		in := new(big.Int).SetBytes(buf)
+		in.Mod(in, n)
+		var tweak []byte
+		if i%2 == 1 {
+			tweak = []byte("tweak")
+		}
+		out := a.PermuteInPlace(new(big.Int).Set(in), tweak)
+		if got := b.PermuteInPlace(new(big.Int).Set(in), tweak); got.Cmp(out) != 0 {
+			t.Fatalf("%d bits: %v permuted to %v, expected %v", lengthBits, in, got, out)
+		}
+		if inv := b.InvertInPlace(out, tweak); inv.Cmp(in) != 0 {
+			t.Fatalf("%d bits: %v inverted to %v, expected %v", lengthBits, out, inv, in)
+		}
+	}
+}
+
+func TestFFXMarshalBinary(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for lengthBits := 2; lengthBits <= 128; lengthBits++ {
+		p := NewFFX([]byte("foo"), lengthBits)
+		data, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var q FFX
+		if err := q.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%d bits: %v", lengthBits, err)
+		}
+		checkSameMapping(t, p, &q, lengthBits, rng)
+		if q.ParamsHash() != p.ParamsHash() {
+			t.Errorf("%d bits: ParamsHash changed", lengthBits)
+		}
+	}
+
+	// Options that change the mapping survive the round trip.
+	for name, p := range map[string]*FFX{
+		"rounds":     mustNewBlock(t, 40, WithRounds(20)).(*FFX),
+		"KDF info":   mustNewBlock(t, 40, WithKDFInfo("other")).(*FFX),
+		"spec round": NewFFX([]byte("foo"), 40).WithSpecRoundByte(),
+		"AES-256":    NewFFXFromAESKey([]byte("0123456789abcdef0123456789abcdef"), 40),
+	} {
+		data, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var q FFX
+		if err := q.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		checkSameMapping(t, p, &q, 40, rng)
+	}
+
+	p := NewFFX([]byte("foo"), 16).WithTweakMaxLen(4)
+	data, _ := p.MarshalBinary()
+	var q FFX
+	if err := q.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.TryPermuteInPlace(big.NewInt(1), []byte("tweak")); !errors.Is(err, ErrTweakTooLong) {
+		t.Errorf("tweak limit was lost: got %v", err)
+	}
+
+	block, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFFXFromBlock(block, 16).MarshalBinary(); err == nil {
+		t.Error("expected an error marshaling an FFX built from a cipher.Block")
+	}
+}
+
+func TestFeistelSHAKE128MarshalBinary(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, lengthBits := range []int{2, 3, 7, 8, 16, 31, 63, 64, 65, 100, 128, 129, 256, 1000} {
+		p := NewPowerOf2([]byte("foo"), lengthBits)
+		data, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var q FeistelSHAKE128
+		if err := q.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%d bits: %v", lengthBits, err)
+		}
+		checkSameMapping(t, p, &q, lengthBits, rng)
+		if q.ParamsHash() != p.ParamsHash() {
+			t.Errorf("%d bits: ParamsHash changed", lengthBits)
+		}
+	}
+
+	for name, p := range map[string]*FeistelSHAKE128{
+		"split":       NewPowerOf2([]byte("foo"), 40).WithSplit(7),
+		"label":       NewPowerOf2([]byte("foo"), 40).WithDomainLabel("label"),
+		"empty label": NewPowerOf2([]byte("foo"), 40).WithDomainLabel(""),
+		"pepper":      NewPowerOf2([]byte("foo"), 40).withPepper([]byte("pepper")),
+		"rounds":      mustNewBlock(t, 40, WithAlgorithm(AlgoFeistelSHAKE128), WithRounds(20)).(*FeistelSHAKE128),
+		"KDF info":    mustNewBlock(t, 40, WithAlgorithm(AlgoFeistelSHAKE128), WithKDFInfo("info")).(*FeistelSHAKE128),
+		"empty key":   NewPowerOf2(nil, 40),
+	} {
+		data, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var q FeistelSHAKE128
+		if err := q.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		checkSameMapping(t, p, &q, 40, rng)
+	}
+
+	prf := func(input []byte) []byte { return input }
+	if _, err := NewPowerOf2PRF(prf, 16).MarshalBinary(); err == nil {
+		t.Error("expected an error marshaling a FeistelPRF")
+	}
+}
+
+// mustNewBlock returns the block permutation that New builds for a 2^lengthBits domain.
+func mustNewBlock(t *testing.T, lengthBits int, opts ...Option) Permutation {
+	t.Helper()
+	p, err := New([]byte("foo"), new(big.Int).Lsh(big.NewInt(1), uint(lengthBits)), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.(*ArbitraryN).p
+}
+
+func TestUnmarshalBinaryErrors(t *testing.T) {
+	ffxData, err := NewFFX([]byte("foo"), 16).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	shakeData, err := NewPowerOf2([]byte("foo"), 16).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	withVersion := func(data []byte, version byte) []byte {
+		return append([]byte{version}, data[1:]...)
+	}
+	for _, tc := range []struct {
+		name string
+		data []byte
+		into encoding.BinaryUnmarshaler
+	}{
+		{"empty", nil, new(FFX)},
+		{"FFX version 0", withVersion(ffxData, 0), new(FFX)},
+		{"FFX version 2", withVersion(ffxData, 2), new(FFX)},
+		{"SHAKE version 2", withVersion(shakeData, 2), new(FeistelSHAKE128)},
+		{"FFX as SHAKE", ffxData, new(FeistelSHAKE128)},
+		{"SHAKE as FFX", shakeData, new(FFX)},
+		{"FFX truncated", ffxData[:len(ffxData)-1], new(FFX)},
+		{"SHAKE truncated", shakeData[:len(shakeData)-1], new(FeistelSHAKE128)},
+		{"FFX trailing data", append(ffxData[:len(ffxData):len(ffxData)], 0), new(FFX)},
+		{"FFX short key", append(ffxData[:len(ffxData)-17:len(ffxData)-17], append([]byte{15}, make([]byte, 15)...)...), new(FFX)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.into.UnmarshalBinary(tc.data); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	if err := new(FFX).UnmarshalBinary(withVersion(ffxData, 9)); err == nil || err.Error() != fmt.Sprintf("unsupported encoding version 9, expected %v", marshalVersion) {
+		t.Errorf("unexpected error for an unknown version: %v", err)
+	}
+
+	// A failed UnmarshalBinary leaves the permutation alone.
+	p := NewFFX([]byte("foo"), 16)
+	expected := p.PermuteInt(1234)
+	if err := p.UnmarshalBinary(shakeData); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := p.PermuteInt(1234); got != expected {
+		t.Errorf("failed UnmarshalBinary changed the mapping: %d, expected %d", got, expected)
+	}
+}
+
+func TestWriteToReadFrom(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	ffx := NewFFX([]byte("foo"), 40).WithTweakMaxLen(8)
+	shake := NewPowerOf2([]byte("foo"), 100).WithDomainLabel("label")
+
+	// Both frames go in one stream; each ReadFrom must stop at the end of its own.
+	var buf bytes.Buffer
+	n1, err := ffx.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n2, err := shake.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(n1+n2) != buf.Len() {
+		t.Errorf("WriteTo reported %v bytes, wrote %v", n1+n2, buf.Len())
+	}
+
+	var ffx2 FFX
+	if n, err := ffx2.ReadFrom(&buf); err != nil || n != n1 {
+		t.Fatalf("FFX ReadFrom = %v, %v, expected %v bytes", n, err, n1)
+	}
+	checkSameMapping(t, ffx, &ffx2, 40, rng)
+	var shake2 FeistelSHAKE128
+	if n, err := shake2.ReadFrom(&buf); err != nil || n != n2 {
+		t.Fatalf("FeistelSHAKE128 ReadFrom = %v, %v, expected %v bytes", n, err, n2)
+	}
+	checkSameMapping(t, shake, &shake2, 100, rng)
+	if buf.Len() != 0 {
+		t.Errorf("%v bytes left over", buf.Len())
+	}
+
+	// An empty stream is io.EOF; a truncated frame is io.ErrUnexpectedEOF.
+	if _, err := new(FFX).ReadFrom(&buf); err != io.EOF {
+		t.Errorf("empty stream: got %v, expected io.EOF", err)
+	}
+	ffx.WriteTo(&buf)
+	truncated := buf.Bytes()[:buf.Len()-1]
+	if _, err := new(FFX).ReadFrom(bytes.NewReader(truncated)); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated frame: got %v, expected io.ErrUnexpectedEOF", err)
+	}
+	huge := binary.AppendUvarint(nil, maxMarshaledFrame+1)
+	if _, err := new(FFX).ReadFrom(bytes.NewReader(huge)); !errors.Is(err, ErrInvalidLength) {
+		t.Errorf("oversized frame: got %v, expected ErrInvalidLength", err)
+	}
+	if _, err := new(FeistelSHAKE128).ReadFrom(&buf); err == nil {
+		t.Error("expected an error reading an FFX frame into a FeistelSHAKE128")
+	}
+
+	block, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := NewFFXFromBlock(block, 16).WriteTo(&buf); err == nil || n != 0 {
+		t.Errorf("WriteTo of an FFX built from a cipher.Block = %v, %v, expected an error", n, err)
+	}
+}
@@ -0,0 +1,282 @@
+package permutation
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+)
+
+const AlgoFeistelMixedRadix = "FeistelMixedRadix"
+
+// MaxCompactDomain is the largest domain for which NewNCompact can use a mixed-radix block.
+const MaxCompactDomain = 1 << 62
+
+// CompactThreshold is the expected number of block iterations per call, as reported by
+// Plan, above which NewNCompact switches from the power-of-2 block to a mixed-radix one.
+// Each iteration of the mixed-radix block costs about 1.4 iterations of FFX, so below the
+// threshold the extra walking of the power-of-2 block is cheaper than the slower block.
+const CompactThreshold = 1.5
+
+// mixedRadixFeistel is an alternating Feistel network over Z_a × Z_b, the domain
+// [0, a*b), in the style of FF1's numeric Feistel for radix a*b split unevenly.  The value
+// x*b + y is the pair (x, y); each round maps (x, y) in Z_p × Z_q to (y, x + F_r(y) mod p)
+// in Z_q × Z_p, so the moduli alternate and an even number of rounds returns to Z_a × Z_b.
+//
+// F_r(y) is AES of T XOR (r || y), reduced modulo p, where T is the AES-CBC-MAC of a
+// header that encodes a, b and the rounds, followed by the 8-byte big-endian length of the
+// tweak and the tweak, zero-padded to a whole number of blocks.  The header is a single
+// block with 4-byte factors when both fit, and otherwise a version block followed by a
+// block holding the full 8-byte factors.
+type mixedRadixFeistel struct {
+	a, b   uint64
+	rounds int
+	aes    cipher.Block
+
+	// tweakMAC is T for the tweak tweakFor.
+	tweakMAC   [aes.BlockSize]byte
+	tweakFor   []byte
+	tweakValid bool
+
+	// Scratch variables to avoid allocations.
+	in  big.Int
+	buf [aes.BlockSize]byte
+}
+
+// newMixedRadixFeistel returns a mixedRadixFeistel over [0, a*b), which must be at most
+// MaxCompactDomain.
+func newMixedRadixFeistel(key []byte, a, b uint64) *mixedRadixFeistel {
+	aesKey, err := hkdf.Key(sha256.New, key, nil, "permute.FeistelMixedRadix", 16)
+	if err != nil {
+		panic(err)
+	}
+	p := &mixedRadixFeistel{
+		a: a,
+		b: b,
+		// RecommendedRounds is always even, as required to end in Z_a × Z_b.
+		rounds: RecommendedRounds(bits.Len64(a*b - 1)),
+	}
+	p.aes, err = aes.NewCipher(aesKey)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// compactSplit returns a and b with a*b >= n and a*b - n < a, where a = ceil(sqrt(n)), so
+// that a*b exceeds n by a fraction of at most about 1/sqrt(n).
+func compactSplit(n uint64) (a, b uint64) {
+	a = uint64(math.Sqrt(float64(n)))
+	for a*a < n {
+		a++
+	}
+	for a > 1 && (a-1)*(a-1) >= n {
+		a--
+	}
+	return a, (n + a - 1) / a
+}
+
+// Clone returns an independent copy of p that shares its key-derived state but has its
+// own scratch, so that it can be used concurrently with p.
+func (p *mixedRadixFeistel) Clone() Permutation {
+	c := *p
+	c.tweakFor = bytes.Clone(p.tweakFor)
+	c.in = big.Int{}
+	c.buf = [aes.BlockSize]byte{}
+	return &c
+}
+
+// InDomain returns whether v is in [0, a*b).
+func (p *mixedRadixFeistel) InDomain(v *big.Int) bool {
+	return v.Sign() >= 0 && v.IsUint64() && v.Uint64() < p.a*p.b
+}
+
+func (p *mixedRadixFeistel) Rounds() int {
+	return p.rounds
+}
+
+func (p *mixedRadixFeistel) Algorithm() string {
+	return AlgoFeistelMixedRadix
+}
+
+func (p *mixedRadixFeistel) PermuteInt(in int) int {
+	return p.PermuteIntTweak(in, nil)
+}
+
+func (p *mixedRadixFeistel) PermuteIntTweak(in int, tweak []byte) int {
+	return int(p.PermuteInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+func (p *mixedRadixFeistel) InvertInt(in int) int {
+	return p.InvertIntTweak(in, nil)
+}
+
+func (p *mixedRadixFeistel) InvertIntTweak(in int, tweak []byte) int {
+	return int(p.InvertInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+func (p *mixedRadixFeistel) PermuteUint64(in uint64) uint64 {
+	return stepUint64(p.PermuteInPlace, &p.in, in)
+}
+
+func (p *mixedRadixFeistel) InvertUint64(in uint64) uint64 {
+	return stepUint64(p.InvertInPlace, &p.in, in)
+}
+
+// PermuteInPlace calculates inOut's permutated value and stores it back into inOut.
+// Returns inOut as a convenience.
+func (p *mixedRadixFeistel) PermuteInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	v := p.start(inOut, tweak)
+	x, y := v/p.b, v%p.b
+	for r := range p.rounds {
+		mod := p.a
+		if r%2 == 1 {
+			mod = p.b
+		}
+		x, y = y, (x+p.roundFunc(r, y, mod))%mod
+	}
+	return inOut.SetUint64(x*p.b + y)
+}
+
+// InvertInPlace is the inverse of PermuteInPlace.  Returns inOut as a convenience.
+func (p *mixedRadixFeistel) InvertInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	v := p.start(inOut, tweak)
+	x, y := v/p.b, v%p.b
+	for r := p.rounds - 1; r >= 0; r-- {
+		mod := p.a
+		if r%2 == 1 {
+			mod = p.b
+		}
+		x, y = (y+mod-p.roundFunc(r, x, mod))%mod, x
+	}
+	return inOut.SetUint64(x*p.b + y)
+}
+
+func (p *mixedRadixFeistel) start(in *big.Int, tweak []byte) uint64 {
+	if !p.InDomain(in) {
+		panic(fmt.Sprintf("input %v is outside range of permutation [0, %v)", in, p.a*p.b))
+	}
+	if !p.tweakValid || !bytes.Equal(tweak, p.tweakFor) {
+		p.macTweak(tweak)
+		p.tweakFor = append(p.tweakFor[:0], tweak...)
+		p.tweakValid = true
+	}
+	return in.Uint64()
+}
+
+// macTweak calculates T for tweak into p.tweakMAC.
+func (p *mixedRadixFeistel) macTweak(tweak []byte) {
+	mac := p.tweakMAC[:]
+	clear(mac)
+	mac[2] = byte(p.rounds)
+	var msg []byte
+	if p.a <= math.MaxUint32 && p.b <= math.MaxUint32 {
+		// Version 1 keeps the mappings from before wider factors were supported.
+		binary.BigEndian.PutUint16(mac[0:2], 1)
+		binary.BigEndian.PutUint32(mac[4:8], uint32(p.a))
+		binary.BigEndian.PutUint32(mac[8:12], uint32(p.b))
+	} else {
+		binary.BigEndian.PutUint16(mac[0:2], 2)
+		msg = binary.BigEndian.AppendUint64(msg, p.a)
+		msg = binary.BigEndian.AppendUint64(msg, p.b)
+	}
+	p.aes.Encrypt(mac, mac)
+
+	// The length comes before the tweak, so the message is prefix-free.
+	msg = binary.BigEndian.AppendUint64(msg, uint64(len(tweak)))
+	msg = append(msg, tweak...)
+	for len(msg) > 0 {
+		clear(p.buf[:])
+		n := copy(p.buf[:], msg)
+		msg = msg[n:]
+		subtle.XORBytes(mac, mac, p.buf[:])
+		p.aes.Encrypt(mac, mac)
+	}
+}
+
+// roundFunc returns F_r(y) in [0, mod).  Reducing the 128-bit AES output biases it by at
+// most mod/2^128.
+func (p *mixedRadixFeistel) roundFunc(r int, y, mod uint64) uint64 {
+	p.buf = p.tweakMAC
+	p.buf[0] ^= byte(r)
+	var yBytes [8]byte
+	binary.BigEndian.PutUint64(yBytes[:], y)
+	subtle.XORBytes(p.buf[8:], p.buf[8:], yBytes[:])
+	p.aes.Encrypt(p.buf[:], p.buf[:])
+	hi, lo := binary.BigEndian.Uint64(p.buf[:8]), binary.BigEndian.Uint64(p.buf[8:])
+	return bits.Rem64(hi, lo, mod)
+}
+
+// NewNCompact returns a permutation over [0, n), like NewN, that cycle-walks whichever
+// block needs fewer walks for its cost.  NewN's block covers the next power of 2, so for n
+// just above a power of 2, such as 2^20 + 1, almost every call walks twice.  When Plan(n)
+// expects more than CompactThreshold iterations and n is at most MaxCompactDomain,
+// NewNCompact instead uses a mixed-radix Feistel network over [0, a*b), where a =
+// ceil(sqrt(n)) and b = ceil(n/a), which exceeds n by less than a.  That cuts the expected
+// iterations to at most 1 + 1/floor(sqrt(n)), about 1.001 for 2^20 + 1.  Otherwise it
+// returns NewN(key, n).
+//
+// The two blocks give unrelated mappings, so the choice is fixed for each n and
+// NewNCompact's mapping never changes; NewN itself is unchanged.
+func NewNCompact(key []byte, n *big.Int) Permutation {
+	if n.Sign() <= 0 {
+		panic(fmt.Sprintf("n must be positive, got: %v", n))
+	}
+	if n.Cmp(big.NewInt(MaxCompactDomain)) > 0 || Plan(n).ExpectedIterations <= CompactThreshold {
+		return NewN(key, n)
+	}
+	a, b := compactSplit(n.Uint64())
+	return newArbitraryNBlock(newMixedRadixFeistel(key, a, b), new(big.Int).SetUint64(a*b), n)
+}
+
+// maxFactorSearch bounds the number of candidate factors that NewNFactored tries.
+const maxFactorSearch = 1 << 20
+
+// NewNFactored returns a permutation over exactly [0, n) that never cycle-walks, for
+// callers that need every call to take a single pass, when n factors nicely.  It looks for
+// n = a*b with b <= a and b^3 >= n, b as close to sqrt(n) as possible, and uses a
+// mixed-radix Feistel network over Z_a × Z_b, as NewNCompact does, which maps [0, n) onto
+// itself directly.  The lower bound on b keeps both halves of the network large enough to
+// mix well.
+//
+// If there is no such factorization, for example when n is prime or twice a prime, or if
+// none is found among the first 2^20 candidates, or n is more than MaxCompactDomain, it
+// falls back to NewNCompact(key, n), which cycle-walks.  Algorithm() reports
+// AlgoFeistelMixedRadix in both the single-pass case and when the fallback walks a
+// mixed-radix block; use FactorDomain to tell them apart.
+func NewNFactored(key []byte, n *big.Int) Permutation {
+	if n.Sign() <= 0 {
+		panic(fmt.Sprintf("n must be positive, got: %v", n))
+	}
+	a, b, ok := FactorDomain(n)
+	if !ok {
+		return NewNCompact(key, n)
+	}
+	return newArbitraryNBlock(newMixedRadixFeistel(key, a, b), n, n)
+}
+
+// FactorDomain returns the factorization n = a*b that NewNFactored uses, and whether it
+// found one; if not, NewNFactored cycle-walks.
+func FactorDomain(n *big.Int) (a, b uint64, ok bool) {
+	if n.Sign() <= 0 || n.Cmp(big.NewInt(MaxCompactDomain)) > 0 {
+		return 0, 0, false
+	}
+	v := n.Uint64()
+	b, _ = compactSplit(v)
+	if b*b > v {
+		b--
+	}
+	for tries := 0; b >= 2 && b*b >= (v+b-1)/b && tries < maxFactorSearch; b, tries = b-1, tries+1 {
+		if v%b == 0 {
+			return v / b, b, true
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,268 @@
+package permutation
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func TestCompactSplit(t *testing.T) {
+	for _, n := range []uint64{1, 2, 3, 4, 5, 99, 100, 101, 1<<20 + 1, 1<<40 - 1, MaxCompactDomain} {
+		a, b := compactSplit(n)
+		if a*b < n || a*b-n >= a {
+			t.Errorf("compactSplit(%d) = %d, %d: product %d", n, a, b, a*b)
+		}
+		if b > a {
+			t.Errorf("compactSplit(%d) = %d, %d: expected b <= a", n, a, b)
+		}
+	}
+}
+
+func TestMixedRadixFeistel(t *testing.T) {
+	for _, ab := range [][2]uint64{{1, 1}, {2, 1}, {2, 2}, {3, 2}, {17, 16}, {32, 31}} {
+		for _, tweak := range [][]byte{nil, []byte("tweak"), []byte("a tweak longer than one block")} {
+			t.Run(fmt.Sprintf("%dx%d/%q", ab[0], ab[1], tweak), func(t *testing.T) {
+				p := newMixedRadixFeistel([]byte("foo"), ab[0], ab[1])
+				n := int64(ab[0] * ab[1])
+				seen := make(map[int64]bool, n)
+				for i := range n {
+					out := p.PermuteInPlace(big.NewInt(i), tweak)
+					if !p.InDomain(out) {
+						t.Fatalf("output %v out of range", out)
+					}
+					if seen[out.Int64()] {
+						t.Fatalf("duplicate output %v", out)
+					}
+					seen[out.Int64()] = true
+					if inv := p.InvertInPlace(new(big.Int).Set(out), tweak); inv.Int64() != i {
+						t.Fatalf("InvertInPlace(%v) = %v, expected %d", out, inv, i)
+					}
+				}
+			})
+		}
+	}
+
+	p := newMixedRadixFeistel([]byte("foo"), 32, 31)
+	tweaked := newMixedRadixFeistel([]byte("foo"), 32, 31)
+	other := newMixedRadixFeistel([]byte("bar"), 32, 31)
+	sameTweak, sameKey := 0, 0
+	for i := range 32 * 31 {
+		out := p.PermuteInt(i)
+		if out == int(tweaked.PermuteInPlace(big.NewInt(int64(i)), []byte("tweak")).Int64()) {
+			sameTweak++
+		}
+		if out == other.PermuteInt(i) {
+			sameKey++
+		}
+	}
+	if sameTweak > 20 || sameKey > 20 {
+		t.Errorf("outputs unchanged: %d changing the tweak, %d changing the key", sameTweak, sameKey)
+	}
+}
+
+func TestMixedRadixFeistelWideFactors(t *testing.T) {
+	// The same b, with a values that differ only in bit 32: the header must tell them apart.
+	const b = 131071
+	narrow := newMixedRadixFeistel([]byte("foo"), 131143, b)
+	wide := newMixedRadixFeistel([]byte("foo"), 131143+1<<32, b)
+	for _, tweak := range [][]byte{nil, []byte("tweak")} {
+		narrow.macTweak(tweak)
+		wide.macTweak(tweak)
+		if narrow.tweakMAC == wide.tweakMAC {
+			t.Errorf("tweak %q: factors differing above bit 32 gave the same T", tweak)
+		}
+	}
+
+	same := 0
+	for i := range 1000 {
+		out := wide.PermuteUint64(uint64(i))
+		if inv := wide.InvertUint64(out); inv != uint64(i) {
+			t.Fatalf("InvertUint64(%d) = %d, expected %d", out, inv, i)
+		}
+		if out == narrow.PermuteUint64(uint64(i)) {
+			same++
+		}
+	}
+	if same > 20 {
+		t.Errorf("%d of 1000 outputs unchanged between the two domains", same)
+	}
+}
+
+func TestNewNCompact(t *testing.T) {
+	key := []byte("foo")
+	for _, tc := range []struct {
+		n         int64
+		algorithm string
+	}{
+		{1, AlgoFeistelMixedRadix},
+		{5, AlgoFeistelMixedRadix},
+		{1000, AlgoFFX},
+		{1<<10 + 1, AlgoFeistelMixedRadix},
+		{1 << 12, AlgoFFX},
+		{1<<12 + 1, AlgoFeistelMixedRadix},
+	} {
+		t.Run(fmt.Sprint(tc.n), func(t *testing.T) {
+			p := NewNCompact(key, big.NewInt(tc.n))
+			if p.Algorithm() != tc.algorithm {
+				t.Errorf("Algorithm() = %v, expected %v", p.Algorithm(), tc.algorithm)
+			}
+			naive := NewN(key, big.NewInt(tc.n))
+			seen := make(map[int]bool, tc.n)
+			for i := range int(tc.n) {
+				out := p.PermuteInt(i)
+				if out < 0 || out >= int(tc.n) || seen[out] {
+					t.Fatalf("PermuteInt(%d) = %d is out of range or a duplicate", i, out)
+				}
+				seen[out] = true
+				if inv := p.InvertInt(out); inv != i {
+					t.Fatalf("InvertInt(%d) = %d, expected %d", out, inv, i)
+				}
+				if tc.algorithm != AlgoFeistelMixedRadix && out != naive.PermuteInt(i) {
+					t.Fatalf("PermuteInt(%d) = %d, NewN gives %d", i, out, naive.PermuteInt(i))
+				}
+			}
+		})
+	}
+
+	// The compact block needs far fewer iterations than the power-of-2 block.
+	n := big.NewInt(1<<20 + 1)
+	count := func(p *ArbitraryN) int {
+		total := 0
+		p.WithWalkObserver(func(iterations int) { total += iterations })
+		for i := range 1000 {
+			p.PermuteInt(i)
+		}
+		return total
+	}
+	if compact, naive := count(NewNCompact(key, n).(*ArbitraryN)), count(NewN(key, n)); compact > 1010 || naive < 1800 {
+		t.Errorf("1000 calls took %d iterations compact, %d naive", compact, naive)
+	}
+
+	compact := NewNCompact(key, big.NewInt(1<<10+1)).(*ArbitraryN)
+	compact.ExtendDomain(big.NewInt(33 * 32))
+	if !compact.exact {
+		t.Error("expected extending to the block size to skip cycle-walking")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic extending beyond the mixed-radix block")
+			}
+		}()
+		compact.ExtendDomain(big.NewInt(33*32 + 1))
+	}()
+}
+
+func BenchmarkNewNCompact(b *testing.B) {
+	n := big.NewInt(1<<20 + 1)
+	for _, bc := range []struct {
+		name string
+		p    Permutation
+	}{
+		{"naive", NewN([]byte("foo"), n)},
+		{"compact", NewNCompact([]byte("foo"), n)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				bc.p.PermuteInt(i & (1<<20 - 1))
+			}
+		})
+	}
+}
+
+func TestNewNFactored(t *testing.T) {
+	key := []byte("foo")
+	for _, tc := range []struct {
+		n      int64
+		a, b   uint64
+		single bool
+	}{
+		{1, 0, 0, false},
+		{6, 3, 2, true},
+		{12, 4, 3, true},
+		{100, 10, 10, true},
+		{1000, 40, 25, true},
+		{1056, 33, 32, true},
+		{9999, 101, 99, true},
+		{1 << 16, 256, 256, true},
+		{1009, 0, 0, false},          // Prime.
+		{2 * 1000003, 0, 0, false},   // Twice a prime.
+		{1000003 * 101, 0, 0, false}, // Smaller factor below the cube root.
+	} {
+		t.Run(fmt.Sprint(tc.n), func(t *testing.T) {
+			n := big.NewInt(tc.n)
+			a, b, ok := FactorDomain(n)
+			if ok != tc.single || a != tc.a || b != tc.b {
+				t.Fatalf("FactorDomain(%d) = %d, %d, %v, expected %d, %d, %v", tc.n, a, b, ok, tc.a, tc.b, tc.single)
+			}
+			p := NewNFactored(key, n)
+			if !tc.single {
+				if p.Algorithm() != NewNCompact(key, n).Algorithm() {
+					t.Errorf("Algorithm() = %v, expected the NewNCompact fallback", p.Algorithm())
+				}
+				return
+			}
+			if p.Algorithm() != AlgoFeistelMixedRadix {
+				t.Errorf("Algorithm() = %v, expected %v", p.Algorithm(), AlgoFeistelMixedRadix)
+			}
+			maxIterations := 0
+			p.(*ArbitraryN).WithWalkObserver(func(iterations int) { maxIterations = max(maxIterations, iterations) })
+			seen := make(map[int]bool, tc.n)
+			for i := range int(tc.n) {
+				out := p.PermuteInt(i)
+				if out < 0 || out >= int(tc.n) || seen[out] {
+					t.Fatalf("PermuteInt(%d) = %d is out of range or a duplicate", i, out)
+				}
+				seen[out] = true
+				if inv := p.InvertInt(out); inv != i {
+					t.Fatalf("InvertInt(%d) = %d, expected %d", out, inv, i)
+				}
+			}
+			if maxIterations != 1 {
+				t.Errorf("took up to %d iterations, expected a single pass", maxIterations)
+			}
+		})
+	}
+}
+
+// worstCaseInput returns the input in [0, n) with the longest walk.
+func worstCaseInput(p *ArbitraryN, n int) (worst, iterations int) {
+	var last int
+	p.WithWalkObserver(func(i int) { last = i })
+	defer p.WithWalkObserver(nil)
+	for i := range n {
+		p.PermuteInt(i)
+		if last > iterations {
+			worst, iterations = i, last
+		}
+	}
+	return worst, iterations
+}
+
+func TestNewNFactoredWorstCase(t *testing.T) {
+	n := 1<<13 + 1<<12 // 128 * 96
+	if _, iterations := worstCaseInput(NewNInt([]byte("foo"), n), n); iterations < 5 {
+		t.Errorf("expected a long worst-case walk for ArbitraryN, got %d iterations", iterations)
+	}
+	if _, iterations := worstCaseInput(NewNFactored([]byte("foo"), big.NewInt(int64(n))).(*ArbitraryN), n); iterations != 1 {
+		t.Errorf("NewNFactored took up to %d iterations", iterations)
+	}
+}
+
+func BenchmarkNewNFactoredWorstCase(b *testing.B) {
+	n := 1<<13 + 1<<12
+	for _, bc := range []struct {
+		name string
+		p    *ArbitraryN
+	}{
+		{"ArbitraryN", NewNInt([]byte("foo"), n)},
+		{"factored", NewNFactored([]byte("foo"), big.NewInt(int64(n))).(*ArbitraryN)},
+	} {
+		in, _ := worstCaseInput(bc.p, n)
+		b.Run(bc.name, func(b *testing.B) {
+			for b.Loop() {
+				bc.p.PermuteInt(in)
+			}
+		})
+	}
+}
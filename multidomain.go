@@ -0,0 +1,88 @@
+package permutation
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"slices"
+)
+
+// MultiDomain permutes over domains [0, n) where n is chosen per call.  Each domain
+// gets an independent permutation: n is mixed into the tweak of the underlying
+// power-of-2 permutation, which is built once per bit length and then reused for
+// every n of that width.
+type MultiDomain struct {
+	key    []byte
+	blocks map[int]Permutation
+
+	// Scratch variables to avoid allocations.
+	in, n big.Int
+	tweak []byte
+}
+
+func NewMultiDomain(key []byte) *MultiDomain {
+	return &MultiDomain{
+		key:    key,
+		blocks: map[int]Permutation{},
+	}
+}
+
+// PermuteInt permutes in within the domain [0, n).
+func (p *MultiDomain) PermuteInt(n, in int) int {
+	if n <= 0 {
+		panic(fmt.Sprintf("n must be positive, got: %v", n))
+	}
+	p.n.SetInt64(int64(n))
+	return int(p.PermuteInPlace(&p.n, p.in.SetInt64(int64(in)), nil).Int64())
+}
+
+// PermuteInPlace calculates inOut's permutated value within [0, n) and stores it back
+// into inOut. Returns inOut as a convenience.
+func (p *MultiDomain) PermuteInPlace(n, inOut *big.Int, tweak []byte) *big.Int {
+	if inOut.Sign() < 0 || inOut.Cmp(n) >= 0 {
+		panic(fmt.Sprintf("input %v is outside range of permutation [0, %v)",
+			inOut, n))
+	}
+	out, _ := cycleWalk(p.block(n).PermuteInPlace, n, inOut, p.domainTweak(n, tweak))
+	return out
+}
+
+// InvertInt is the inverse of PermuteInt.
+func (p *MultiDomain) InvertInt(n, in int) int {
+	if n <= 0 {
+		panic(fmt.Sprintf("n must be positive, got: %v", n))
+	}
+	p.n.SetInt64(int64(n))
+	return int(p.InvertInPlace(&p.n, p.in.SetInt64(int64(in)), nil).Int64())
+}
+
+// InvertInPlace is the inverse of PermuteInPlace.
+func (p *MultiDomain) InvertInPlace(n, inOut *big.Int, tweak []byte) *big.Int {
+	if inOut.Sign() < 0 || inOut.Cmp(n) >= 0 {
+		panic(fmt.Sprintf("input %v is outside range of permutation [0, %v)",
+			inOut, n))
+	}
+	out, _ := cycleWalk(p.block(n).InvertInPlace, n, inOut, p.domainTweak(n, tweak))
+	return out
+}
+
+func (p *MultiDomain) block(n *big.Int) Permutation {
+	bitLen := domainBitLen(n)
+	block, ok := p.blocks[bitLen]
+	if !ok {
+		block = newBlockPermutation(p.key, bitLen)
+		p.blocks[bitLen] = block
+	}
+	return block
+}
+
+// domainTweak returns an unambiguous encoding of (n, tweak) to pass to the underlying
+// permutation:  len(n) || n || tweak.
+func (p *MultiDomain) domainTweak(n *big.Int, tweak []byte) []byte {
+	nLen := (n.BitLen() + 7) / 8
+	p.tweak = binary.BigEndian.AppendUint64(p.tweak[:0], uint64(nLen))
+	p.tweak = slices.Grow(p.tweak, nLen)[:8+nLen]
+	n.FillBytes(p.tweak[8:])
+	p.tweak = append(p.tweak, tweak...)
+	return p.tweak
+}
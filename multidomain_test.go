@@ -0,0 +1,56 @@
+package permutation
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMultiDomain(t *testing.T) {
+	p := NewMultiDomain([]byte("foo"))
+	for _, n := range []int{1, 2, 5, 200, 201, 256, 1000} {
+		t.Run(fmt.Sprintf("n=%d", n), func(t *testing.T) {
+			seen := make(map[int]int)
+			for i := 0; i < n; i++ {
+				out := p.PermuteInt(n, i)
+				if out < 0 || out >= n {
+					t.Fatalf("output %d is outside range of permutation [0, %d)", out, n)
+				}
+				if _, ok := seen[out]; ok {
+					t.Fatalf("found duplicate output %d", out)
+				}
+				seen[out] = i
+				if inv := p.InvertInt(n, out); inv != i {
+					t.Fatalf("%d -> %d inverted to %d", i, out, inv)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiDomainReproducible(t *testing.T) {
+	p1 := NewMultiDomain([]byte("foo"))
+	p2 := NewMultiDomain([]byte("foo"))
+	for _, n := range []int{200, 1000, 200} {
+		for i := 0; i < n; i++ {
+			if p1.PermuteInt(n, i) != p2.PermuteInt(n, i) {
+				t.Fatalf("n=%d: mapping of %d differs between instances", n, i)
+			}
+		}
+	}
+}
+
+func TestMultiDomainIndependent(t *testing.T) {
+	// 1000 and 1001 share the same underlying 10-bit permutation so only the tweak
+	// separates them.
+	p := NewMultiDomain([]byte("foo"))
+	numCollisions := 0
+	for i := 0; i < 1000; i++ {
+		if p.PermuteInt(1000, i) == p.PermuteInt(1001, i) {
+			numCollisions++
+		}
+	}
+	t.Log("NumCollisions", numCollisions)
+	if numCollisions > 10 {
+		t.Fatal("Too many collisions")
+	}
+}
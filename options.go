@@ -0,0 +1,555 @@
+package permutation
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"slices"
+)
+
+// Option configures the permutation returned by New.
+type Option func(*options)
+
+type options struct {
+	radix        int
+	rounds       int
+	split        int
+	algorithm    string
+	prf          PRF
+	kdfInfo      string
+	kdfInfoSet   bool
+	kdfSalt      []byte
+	kdfHash      func() hash.Hash
+	kdfHashName  string
+	pepper       []byte
+	defaultTweak []byte
+	preRotation  bool
+	affine       bool
+}
+
+// WithRadix selects the radix of the block permutation.  Radix 2, the default, uses the
+// binary algorithms.  A radix in [3, 255] selects AlgoFFXRadix over the fewest numerals
+// that cover the domain, at least 2, and cycle-walks it, taking fewer than radix
+// iterations on average.  AlgoFFXRadix doesn't support WithRounds, the KDF options or
+// WithPepper.
+func WithRadix(radix int) Option {
+	return func(o *options) { o.radix = radix }
+}
+
+// WithRounds overrides RecommendedRounds.  Changing the number of rounds changes the
+// permutation.  An odd number of rounds leaves the halves swapped, so New rejects it when
+// the halves differ in width, as they do for FFX over an odd number of bits.
+func WithRounds(rounds int) Option {
+	return func(o *options) { o.rounds = rounds }
+}
+
+// checkRoundParity returns an error if rounds is odd and a Feistel network over bitLen bits
+// split into halves of split and bitLen-split bits would end with the halves swapped.
+func checkRoundParity(rounds, split, bitLen int) error {
+	if rounds%2 == 1 && 2*split != bitLen {
+		return fmt.Errorf("halves of %v and %v bits need an even number of rounds, got: %v", split, bitLen-split, rounds)
+	}
+	return nil
+}
+
+// WithSplit sets the width of the low half of the Feistel network; see
+// FeistelSHAKE128.WithSplit.  It is only supported by FeistelSHAKE128 and FeistelPRF, so
+// it selects FeistelSHAKE128 unless another algorithm is chosen.
+func WithSplit(bits int) Option {
+	return func(o *options) { o.split = bits }
+}
+
+// WithAlgorithm selects the block permutation by its Algorithm() name: AlgoFFX,
+// AlgoFeistelSHAKE128, AlgoFeistelPRF or AlgoThreefish.  By default, New uses the same
+// algorithm as NewN.
+func WithAlgorithm(algorithm string) Option {
+	return func(o *options) { o.algorithm = algorithm }
+}
+
+// WithPRF delegates the keyed part of the round function to prf, as NewPowerOf2PRF does.
+// The key passed to New is ignored.  It selects AlgoFeistelPRF.
+func WithPRF(prf PRF) Option {
+	return func(o *options) { o.prf = prf }
+}
+
+// WithKDFInfo replaces the HKDF info string used to derive the block cipher key, giving a
+// permutation independent of the one derived with the default info.  FeistelSHAKE128
+// doesn't use a KDF by default; with this option its key is instead derived with HKDF.
+func WithKDFInfo(info string) Option {
+	return func(o *options) {
+		o.kdfInfo = info
+		o.kdfInfoSet = true
+	}
+}
+
+// WithKDFSalt sets the HKDF salt used to derive the block cipher key, which is otherwise
+// empty.  Along with WithKDFInfo it separates the permutations that callers sharing a
+// master key derive, for example per tenant or per column: the same key, salt and info
+// always give the same permutation, and changing either gives an independent one.  The
+// salt also feeds the keys derived by WithPreRotation and WithAffineFinalize.  As with
+// WithKDFHash, FeistelSHAKE128 requires WithKDFInfo too.  An empty salt is the same as none.
+func WithKDFSalt(salt []byte) Option {
+	salt = slices.Clone(salt)
+	return func(o *options) { o.kdfSalt = salt }
+}
+
+// WithKDFHash replaces SHA-256 as the hash used by HKDF to derive the block cipher key, for
+// example with sha512.New or sha3.New256 to follow a policy that mandates them.  The same
+// key and hash always give the same permutation, and a different hash gives an independent
+// one.  FeistelSHAKE128 only uses HKDF with WithKDFInfo, so it requires that option too.
+//
+// name identifies the hash in ParamsHash, where the default is "SHA-256", so it must be
+// non-empty and should be the hash's standard name, such as "SHA-512" or "SHA3-256": two
+// hashes given the same name give the same ParamsHash.
+func WithKDFHash(name string, h func() hash.Hash) Option {
+	return func(o *options) { o.kdfHashName, o.kdfHash = name, h }
+}
+
+// WithPepper mixes a secret pepper into the key, for example a static value compiled into
+// the binary while the key is kept elsewhere, so that neither alone reveals the mapping.
+// Changing the pepper gives an independent permutation.  For FFX and Threefish the pepper
+// is appended to the HKDF info; FeistelSHAKE128 and FeistelPRF absorb it in every round.
+// An empty pepper is the same as none.
+func WithPepper(pepper []byte) Option {
+	pepper = slices.Clone(pepper)
+	return func(o *options) { o.pepper = pepper }
+}
+
+// pepperedInfo appends pepper and its 8-byte big-endian length to the HKDF info string.
+func pepperedInfo(info string, pepper []byte) string {
+	if len(pepper) == 0 {
+		return info
+	}
+	return string(binary.BigEndian.AppendUint64(append([]byte(info), pepper...), uint64(len(pepper))))
+}
+
+// WithDefaultTweak sets the tweak used by PermuteInt and InvertInt, and by PermuteInPlace
+// and InvertInPlace when they are passed a nil tweak.  An explicit empty tweak still
+// means no tweak, so this is the only case where nil and empty tweaks differ: both sides
+// of a round trip must agree on which they pass.
+func WithDefaultTweak(tweak []byte) Option {
+	tweak = slices.Clone(tweak)
+	return func(o *options) { o.defaultTweak = tweak }
+}
+
+// WithPreRotation adds (in + offset) mod domain before the permutation, and subtracts it
+// again after the inverse, where the offset is derived from the key (and pepper) with
+// HKDF.  The rotation is a cheap extra layer that moves the permutation's fixed points
+// without changing the block cipher; it changes the permutation.  It is not supported by
+// FeistelPRF, which ignores the key.
+func WithPreRotation() Option {
+	return func(o *options) { o.preRotation = true }
+}
+
+// WithAffineFinalize maps each output x of the permutation to (a*x + b) mod domain, and
+// undoes it before the inverse, where a and b are derived from the key (and pepper) with
+// HKDF and a is coprime with domain, so the step is a bijection.  Like WithPreRotation, it
+// is cheap extra mixing on top of the block cipher and changes the permutation; the two
+// can be combined.  It is not supported by FeistelPRF, which ignores the key.
+func WithAffineFinalize() Option {
+	return func(o *options) { o.affine = true }
+}
+
+// New returns a permutation over [0, domain) configured by opts.  Unlike the specific
+// constructors, it returns an error rather than panicking if the options are invalid or
+// not supported by the chosen algorithm.
+func New(key []byte, domain *big.Int, opts ...Option) (Permutation, error) {
+	o := options{radix: 2}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if domain.Sign() <= 0 {
+		return nil, fmt.Errorf("domain must be positive, got: %v", domain)
+	}
+	if o.radix < 2 || o.radix > 255 {
+		return nil, fmt.Errorf("radix must be in [2, 255], got: %v", o.radix)
+	}
+	if (o.kdfHash == nil) != (o.kdfHashName == "") {
+		return nil, errors.New("WithKDFHash requires both a name and a hash function")
+	}
+	if o.rounds < 0 {
+		return nil, fmt.Errorf("rounds must be positive, got: %v", o.rounds)
+	}
+	bitLen := domainBitLen(domain)
+	if o.split != 0 && (o.split < 0 || o.split >= bitLen) {
+		return nil, fmt.Errorf("split must be in (0, %v), got: %v", bitLen, o.split)
+	}
+
+	if o.algorithm == "" {
+		switch {
+		case o.radix != 2:
+			o.algorithm = AlgoFFXRadix
+		case o.prf != nil:
+			o.algorithm = AlgoFeistelPRF
+		case o.split != 0 || bitLen < 8 || bitLen > 128:
+			o.algorithm = AlgoFeistelSHAKE128
+		default:
+			o.algorithm = AlgoFFX
+		}
+	}
+	if o.radix != 2 && o.algorithm != AlgoFFXRadix {
+		return nil, fmt.Errorf("WithRadix(%v) is not supported by %v", o.radix, o.algorithm)
+	}
+	if o.prf != nil && o.algorithm != AlgoFeistelPRF {
+		return nil, fmt.Errorf("WithPRF is not supported by %v", o.algorithm)
+	}
+	if o.split != 0 && o.algorithm != AlgoFeistelSHAKE128 && o.algorithm != AlgoFeistelPRF {
+		return nil, fmt.Errorf("WithSplit is not supported by %v", o.algorithm)
+	}
+	kdfHash, kdfHashName := o.kdfHash, o.kdfHashName
+	if kdfHash == nil {
+		kdfHash, kdfHashName = sha256.New, defaultKDFHashName
+	}
+
+	var block Permutation
+	// blockN is the size of block's domain if it isn't the next power of 2.
+	var blockN *big.Int
+	switch o.algorithm {
+	case AlgoFFX:
+		if bitLen > 128 {
+			return nil, fmt.Errorf("%v supports 2 to 128 bits but domain %v requires %v bits", AlgoFFX, domain, bitLen)
+		}
+		if o.rounds > 255 {
+			return nil, fmt.Errorf("%v supports at most 255 rounds, got: %v", AlgoFFX, o.rounds)
+		}
+		if err := checkRoundParity(o.rounds, bitLen/2, bitLen); err != nil {
+			return nil, err
+		}
+		info := "permute.FFX"
+		if o.kdfInfoSet {
+			info = o.kdfInfo
+		}
+		ffx := newFFX(key, bitLen, kdfHash, o.kdfSalt, pepperedInfo(info, o.pepper))
+		ffx.kdf.info, ffx.kdf.peppered, ffx.kdf.hash = info, len(o.pepper) > 0, kdfHashName
+		if o.rounds != 0 {
+			ffx.setRounds(o.rounds)
+		}
+		block = ffx
+	case AlgoFeistelSHAKE128, AlgoFeistelPRF:
+		var feistel *FeistelSHAKE128
+		if o.algorithm == AlgoFeistelPRF {
+			if o.prf == nil {
+				return nil, errors.New("FeistelPRF requires WithPRF")
+			}
+			if o.kdfInfoSet {
+				return nil, errors.New("WithKDFInfo is not supported by FeistelPRF")
+			}
+			if o.kdfHash != nil {
+				return nil, errors.New("WithKDFHash is not supported by FeistelPRF")
+			}
+			if len(o.kdfSalt) > 0 {
+				return nil, errors.New("WithKDFSalt is not supported by FeistelPRF")
+			}
+			feistel = NewPowerOf2PRF(o.prf, bitLen)
+		} else {
+			if o.kdfHash != nil && !o.kdfInfoSet {
+				return nil, errors.New("WithKDFHash requires WithKDFInfo for FeistelSHAKE128")
+			}
+			if len(o.kdfSalt) > 0 && !o.kdfInfoSet {
+				return nil, errors.New("WithKDFSalt requires WithKDFInfo for FeistelSHAKE128")
+			}
+			if o.kdfInfoSet {
+				derived, err := hkdf.Key(kdfHash, key, o.kdfSalt, o.kdfInfo, 32)
+				if err != nil {
+					return nil, err
+				}
+				key = derived
+			}
+			feistel = NewPowerOf2(key, bitLen)
+			if o.kdfInfoSet {
+				feistel.kdf = newKDFParams(o.kdfInfo)
+				feistel.kdf.hash = kdfHashName
+				feistel.kdf.salt = o.kdfSalt
+			}
+		}
+		if len(o.pepper) > 0 {
+			feistel.withPepper(o.pepper)
+		}
+		if o.split != 0 {
+			feistel.WithSplit(o.split)
+		}
+		if o.rounds != 0 {
+			if err := checkRoundParity(o.rounds, feistel.split, bitLen); err != nil {
+				return nil, err
+			}
+			feistel.setRounds(o.rounds)
+		}
+		block = feistel
+	case AlgoFFXRadix:
+		switch {
+		case o.rounds != 0:
+			return nil, fmt.Errorf("WithRounds is not supported by %v", AlgoFFXRadix)
+		case o.kdfInfoSet || o.kdfHash != nil || len(o.kdfSalt) > 0:
+			return nil, fmt.Errorf("the KDF options are not supported by %v", AlgoFFXRadix)
+		case len(o.pepper) > 0:
+			return nil, fmt.Errorf("WithPepper is not supported by %v", AlgoFFXRadix)
+		}
+		// The fewest numerals, at least 2, that cover the domain.
+		length, radix := 2, big.NewInt(int64(o.radix))
+		blockN = new(big.Int).Mul(radix, radix)
+		for blockN.Cmp(domain) < 0 {
+			length++
+			blockN.Mul(blockN, radix)
+		}
+		if !ffxRadixSupports(o.radix, length) {
+			return nil, fmt.Errorf("%v doesn't support radix %v with the %v numerals that domain %v requires", AlgoFFXRadix, o.radix, length, domain)
+		}
+		block = NewFFXRadix(key, o.radix, length)
+	case AlgoThreefish:
+		if bitLen != 256 && bitLen != 512 && bitLen != 1024 {
+			return nil, fmt.Errorf("%v supports 256, 512 or 1024 bits but domain %v requires %v bits", AlgoThreefish, domain, bitLen)
+		}
+		if o.rounds != 0 {
+			return nil, fmt.Errorf("WithRounds is not supported by %v", AlgoThreefish)
+		}
+		info := "permute.Threefish"
+		if o.kdfInfoSet {
+			info = o.kdfInfo
+		}
+		threefish := newThreefish(key, bitLen, kdfHash, o.kdfSalt, pepperedInfo(info, o.pepper))
+		threefish.kdf.info, threefish.kdf.peppered, threefish.kdf.hash = info, len(o.pepper) > 0, kdfHashName
+		block = threefish
+	default:
+		return nil, fmt.Errorf("unknown algorithm %q", o.algorithm)
+	}
+
+	var p Permutation
+	if blockN != nil {
+		p = newArbitraryNBlock(block, blockN, domain)
+	} else {
+		p = newArbitraryN(block, domain)
+	}
+	if o.preRotation {
+		if o.algorithm == AlgoFeistelPRF {
+			return nil, errors.New("WithPreRotation is not supported by FeistelPRF")
+		}
+		offset, err := deriveResidues(kdfHash, key, o.kdfSalt, pepperedInfo("permute.PreRotation", o.pepper), domain, 1)
+		if err != nil {
+			return nil, err
+		}
+		r := &rotatedPermutation{Permutation: p}
+		r.n.Set(domain)
+		r.offset.Set(&offset[0])
+		p = r
+	}
+	if o.affine {
+		if o.algorithm == AlgoFeistelPRF {
+			return nil, errors.New("WithAffineFinalize is not supported by FeistelPRF")
+		}
+		ab, err := deriveResidues(kdfHash, key, o.kdfSalt, pepperedInfo("permute.AffineFinalize", o.pepper), domain, 2)
+		if err != nil {
+			return nil, err
+		}
+		a := &affinePermutation{Permutation: p}
+		a.n.Set(domain)
+		a.a.Set(&ab[0])
+		a.b.Set(&ab[1])
+		// Step a up to the next value coprime with n, which exists since 1 is.
+		var gcd big.Int
+		for gcd.GCD(nil, nil, &a.a, &a.n).Cmp(big.NewInt(1)) != 0 {
+			a.a.Add(&a.a, big.NewInt(1))
+			if a.a.Cmp(&a.n) >= 0 {
+				a.a.SetInt64(1)
+			}
+		}
+		a.aInverse.ModInverse(&a.a, &a.n)
+		p = a
+	}
+	if o.defaultTweak != nil {
+		return &defaultTweakPermutation{Permutation: p, tweak: o.defaultTweak}, nil
+	}
+	return p, nil
+}
+
+// deriveResidues derives count values in [0, n) from key with HKDF.  Each is reduced from
+// 128 bits more than n needs, which makes the bias negligible.
+func deriveResidues(kdfHash func() hash.Hash, key, salt []byte, info string, n *big.Int, count int) ([]big.Int, error) {
+	size := (n.BitLen()+7)/8 + 16
+	derived, err := hkdf.Key(kdfHash, key, salt, info, size*count)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]big.Int, count)
+	for i := range values {
+		values[i].SetBytes(derived[i*size:(i+1)*size]).Mod(&values[i], n)
+	}
+	return values, nil
+}
+
+// rotatedPermutation adds offset modulo n to inputs before permuting them.
+type rotatedPermutation struct {
+	Permutation
+	n, offset big.Int
+
+	// Scratch variables to avoid allocations.
+	in big.Int
+}
+
+func (p *rotatedPermutation) PermuteInt(in int) int {
+	return p.PermuteIntTweak(in, nil)
+}
+
+func (p *rotatedPermutation) PermuteIntTweak(in int, tweak []byte) int {
+	return int(p.PermuteInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+func (p *rotatedPermutation) InvertInt(in int) int {
+	return p.InvertIntTweak(in, nil)
+}
+
+func (p *rotatedPermutation) InvertIntTweak(in int, tweak []byte) int {
+	return int(p.InvertInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+func (p *rotatedPermutation) PermuteUint64(in uint64) uint64 {
+	return stepUint64(p.PermuteInPlace, &p.in, in)
+}
+
+func (p *rotatedPermutation) InvertUint64(in uint64) uint64 {
+	return stepUint64(p.InvertInPlace, &p.in, in)
+}
+
+// PermuteInPlace leaves out-of-range inputs alone, so that the underlying permutation
+// reports them.
+func (p *rotatedPermutation) PermuteInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	if p.InDomain(inOut) {
+		inOut.Add(inOut, &p.offset)
+		if inOut.Cmp(&p.n) >= 0 {
+			inOut.Sub(inOut, &p.n)
+		}
+	}
+	return p.Permutation.PermuteInPlace(inOut, tweak)
+}
+
+func (p *rotatedPermutation) InvertInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	p.Permutation.InvertInPlace(inOut, tweak)
+	inOut.Sub(inOut, &p.offset)
+	if inOut.Sign() < 0 {
+		inOut.Add(inOut, &p.n)
+	}
+	return inOut
+}
+
+func (p *rotatedPermutation) Clone() Permutation {
+	c := &rotatedPermutation{Permutation: p.Permutation.Clone()}
+	c.n.Set(&p.n)
+	c.offset.Set(&p.offset)
+	return c
+}
+
+// defaultTweakPermutation substitutes tweak for nil tweaks.
+type defaultTweakPermutation struct {
+	Permutation
+	tweak []byte
+
+	// Scratch variables to avoid allocations.
+	in big.Int
+}
+
+func (p *defaultTweakPermutation) PermuteInt(in int) int {
+	return p.PermuteIntTweak(in, nil)
+}
+
+func (p *defaultTweakPermutation) PermuteIntTweak(in int, tweak []byte) int {
+	return int(p.PermuteInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+func (p *defaultTweakPermutation) InvertInt(in int) int {
+	return p.InvertIntTweak(in, nil)
+}
+
+func (p *defaultTweakPermutation) InvertIntTweak(in int, tweak []byte) int {
+	return int(p.InvertInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+func (p *defaultTweakPermutation) PermuteUint64(in uint64) uint64 {
+	return stepUint64(p.PermuteInPlace, &p.in, in)
+}
+
+func (p *defaultTweakPermutation) InvertUint64(in uint64) uint64 {
+	return stepUint64(p.InvertInPlace, &p.in, in)
+}
+
+func (p *defaultTweakPermutation) PermuteInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	if tweak == nil {
+		tweak = p.tweak
+	}
+	return p.Permutation.PermuteInPlace(inOut, tweak)
+}
+
+func (p *defaultTweakPermutation) InvertInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	if tweak == nil {
+		tweak = p.tweak
+	}
+	return p.Permutation.InvertInPlace(inOut, tweak)
+}
+
+func (p *defaultTweakPermutation) Clone() Permutation {
+	return &defaultTweakPermutation{Permutation: p.Permutation.Clone(), tweak: p.tweak}
+}
+
+// affinePermutation maps the outputs x of the permutation to (a*x + b) mod n; a is
+// coprime with n and aInverse is its inverse modulo n.
+type affinePermutation struct {
+	Permutation
+	n, a, aInverse, b big.Int
+
+	// Scratch variables to avoid allocations.
+	in big.Int
+}
+
+func (p *affinePermutation) PermuteInt(in int) int {
+	return p.PermuteIntTweak(in, nil)
+}
+
+func (p *affinePermutation) PermuteIntTweak(in int, tweak []byte) int {
+	return int(p.PermuteInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+func (p *affinePermutation) InvertInt(in int) int {
+	return p.InvertIntTweak(in, nil)
+}
+
+func (p *affinePermutation) InvertIntTweak(in int, tweak []byte) int {
+	return int(p.InvertInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+func (p *affinePermutation) PermuteUint64(in uint64) uint64 {
+	return stepUint64(p.PermuteInPlace, &p.in, in)
+}
+
+func (p *affinePermutation) InvertUint64(in uint64) uint64 {
+	return stepUint64(p.InvertInPlace, &p.in, in)
+}
+
+func (p *affinePermutation) PermuteInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	p.Permutation.PermuteInPlace(inOut, tweak)
+	inOut.Mul(inOut, &p.a)
+	inOut.Add(inOut, &p.b)
+	return inOut.Mod(inOut, &p.n)
+}
+
+// InvertInPlace leaves out-of-range inputs alone, so that the underlying permutation
+// reports them.
+func (p *affinePermutation) InvertInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	if p.InDomain(inOut) {
+		inOut.Sub(inOut, &p.b)
+		inOut.Mul(inOut, &p.aInverse)
+		inOut.Mod(inOut, &p.n)
+	}
+	return p.Permutation.InvertInPlace(inOut, tweak)
+}
+
+func (p *affinePermutation) Clone() Permutation {
+	c := &affinePermutation{Permutation: p.Permutation.Clone()}
+	c.n.Set(&p.n)
+	c.a.Set(&p.a)
+	c.aInverse.Set(&p.aInverse)
+	c.b.Set(&p.b)
+	return c
+}
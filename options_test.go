@@ -0,0 +1,627 @@
+package permutation
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"math/big"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	key := []byte("foo")
+	hmacPRF := func(input []byte) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+	newBlock := func(block Permutation, n int) Permutation {
+		return newArbitraryN(block, big.NewInt(int64(n)))
+	}
+	ffx20 := NewFFX(key, 10)
+	ffx20.setRounds(20)
+
+	for _, tc := range []struct {
+		name      string
+		n         int
+		opts      []Option
+		expected  Permutation
+		algorithm string
+		rounds    int
+	}{
+		{"default", 1000, nil, NewNInt(key, 1000), AlgoFFX, 30},
+		{"default small", 100, nil, NewNInt(key, 100), AlgoFeistelSHAKE128, 36},
+		{"radix 2", 1000, []Option{WithRadix(2)}, NewNInt(key, 1000), AlgoFFX, 30},
+		{"radix 10", 1000, []Option{WithRadix(10)}, NewRadixExp(key, 10, 3), AlgoFFXRadix, 30},
+		{
+			"radix 10 walked", 500, []Option{WithRadix(10)},
+			newArbitraryNBlock(NewFFXRadix(key, 10, 3), big.NewInt(1000), big.NewInt(500)), AlgoFFXRadix, 30,
+		},
+		{
+			"radix 36 short", 20, []Option{WithAlgorithm(AlgoFFXRadix), WithRadix(36)},
+			newArbitraryNBlock(NewFFXRadix(key, 36, 2), big.NewInt(36*36), big.NewInt(20)), AlgoFFXRadix, 30,
+		},
+		{
+			"FeistelSHAKE128", 1000, []Option{WithAlgorithm(AlgoFeistelSHAKE128)},
+			newBlock(NewPowerOf2(key, 10), 1000), AlgoFeistelSHAKE128, 30,
+		},
+		{
+			"split", 1000, []Option{WithSplit(3)},
+			newBlock(NewPowerOf2(key, 10).WithSplit(3), 1000), AlgoFeistelSHAKE128, 30,
+		},
+		{"FFX rounds", 1000, []Option{WithRounds(20)}, newBlock(ffx20, 1000), AlgoFFX, 20},
+		{
+			"PRF", 1000, []Option{WithPRF(hmacPRF), WithSplit(4)},
+			newBlock(NewPowerOf2PRF(hmacPRF, 10).WithSplit(4), 1000), AlgoFeistelPRF, 30,
+		},
+		{
+			"KDF info", 1000, []Option{WithKDFInfo("permute.FFX")},
+			NewNInt(key, 1000), AlgoFFX, 30,
+		},
+		{"KDF hash", 1000, []Option{WithKDFHash("SHA-256", sha256.New)}, NewNInt(key, 1000), AlgoFFX, 30},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := New(key, big.NewInt(int64(tc.n)), tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Algorithm() != tc.algorithm {
+				t.Errorf("Algorithm() = %v, expected %v", p.Algorithm(), tc.algorithm)
+			}
+			if p.Rounds() != tc.rounds {
+				t.Errorf("Rounds() = %v, expected %v", p.Rounds(), tc.rounds)
+			}
+			for i := range tc.n {
+				out := p.PermuteInt(i)
+				if expected := tc.expected.PermuteInt(i); out != expected {
+					t.Fatalf("PermuteInt(%d) = %d, expected %d", i, out, expected)
+				}
+				if inv := p.InvertInt(out); inv != i {
+					t.Fatalf("InvertInt(%d) = %d, expected %d", out, inv, i)
+				}
+			}
+		})
+	}
+}
+
+func TestNewChangesPermutation(t *testing.T) {
+	key := []byte("foo")
+	n := big.NewInt(1000)
+	base, err := New(key, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"rounds", []Option{WithRounds(20)}},
+		{"FFX KDF info", []Option{WithKDFInfo("other")}},
+		{"FeistelSHAKE128 KDF info", []Option{WithAlgorithm(AlgoFeistelSHAKE128), WithKDFInfo("other")}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := New(key, n, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			same := 0
+			seen := make(map[int]bool)
+			for i := range 1000 {
+				out := p.PermuteInt(i)
+				if out == base.PermuteInt(i) {
+					same++
+				}
+				if seen[out] {
+					t.Fatalf("duplicate output %d", out)
+				}
+				seen[out] = true
+			}
+			if same > 20 {
+				t.Errorf("%d of 1000 outputs unchanged", same)
+			}
+		})
+	}
+}
+
+func TestNewPepper(t *testing.T) {
+	hmacPRF := func(input []byte) []byte {
+		mac := hmac.New(sha256.New, []byte("foo"))
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+	n := big.NewInt(1000)
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"FFX", nil},
+		{"FeistelSHAKE128", []Option{WithAlgorithm(AlgoFeistelSHAKE128)}},
+		{"FeistelPRF", []Option{WithPRF(hmacPRF)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mustNew := func(key []byte, opts ...Option) Permutation {
+				p, err := New(key, n, append(opts, tc.opts...)...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return p
+			}
+			unpeppered := mustNew([]byte("foo"))
+			empty := mustNew([]byte("foo"), WithPepper(nil))
+			peppered := mustNew([]byte("foo"), WithPepper([]byte("pepper")))
+			again := mustNew([]byte("foo"), WithPepper([]byte("pepper")))
+			otherPepper := mustNew([]byte("foo"), WithPepper([]byte("pepper2")))
+			otherKey := mustNew([]byte("bar"), WithPepper([]byte("pepper")))
+
+			samePepper, sameKey, sameUnpeppered := 0, 0, 0
+			for i := range 1000 {
+				out := peppered.PermuteInt(i)
+				if out != again.PermuteInt(i) {
+					t.Fatalf("same key and pepper gave different outputs for %d", i)
+				}
+				if empty.PermuteInt(i) != unpeppered.PermuteInt(i) {
+					t.Fatalf("empty pepper changed the output for %d", i)
+				}
+				if out == otherPepper.PermuteInt(i) {
+					samePepper++
+				}
+				if out == otherKey.PermuteInt(i) && tc.name != "FeistelPRF" {
+					sameKey++
+				}
+				if out == unpeppered.PermuteInt(i) {
+					sameUnpeppered++
+				}
+			}
+			if samePepper > 20 || sameKey > 20 || sameUnpeppered > 20 {
+				t.Errorf("outputs unchanged: %d changing the pepper, %d changing the key, %d removing the pepper",
+					samePepper, sameKey, sameUnpeppered)
+			}
+		})
+	}
+}
+
+func TestNewKDFHash(t *testing.T) {
+	n := big.NewInt(1000)
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"FFX", nil},
+		{"FeistelSHAKE128", []Option{WithAlgorithm(AlgoFeistelSHAKE128), WithKDFInfo("info")}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mustNew := func(opts ...Option) Permutation {
+				p, err := New([]byte("foo"), n, append(opts, tc.opts...)...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return p
+			}
+			sha256Perm := mustNew(WithKDFHash("SHA-256", sha256.New))
+			sha512Perm := mustNew(WithKDFHash("SHA-512", sha512.New))
+			again := mustNew(WithKDFHash("SHA-512", sha512.New))
+
+			same := 0
+			for i := range 1000 {
+				out256, out512 := sha256Perm.PermuteInt(i), sha512Perm.PermuteInt(i)
+				if out512 != again.PermuteInt(i) {
+					t.Fatalf("same key and hash gave different outputs for %d", i)
+				}
+				if inv := sha256Perm.InvertInt(out256); inv != i {
+					t.Fatalf("SHA-256: InvertInt(%d) = %d, expected %d", out256, inv, i)
+				}
+				if inv := sha512Perm.InvertInt(out512); inv != i {
+					t.Fatalf("SHA-512: InvertInt(%d) = %d, expected %d", out512, inv, i)
+				}
+				if out256 == out512 {
+					same++
+				}
+			}
+			if same > 20 {
+				t.Errorf("%d outputs unchanged by switching from SHA-256 to SHA-512", same)
+			}
+		})
+	}
+}
+
+func TestNewCopiesSaltAndPepper(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		n    *big.Int
+		opts []Option
+	}{
+		{"FFX", big.NewInt(1 << 16), nil},
+		{"FeistelSHAKE128", big.NewInt(1 << 16), []Option{WithAlgorithm(AlgoFeistelSHAKE128), WithKDFInfo("info")}},
+		{"Threefish", new(big.Int).Lsh(big.NewInt(1), 256), []Option{WithAlgorithm(AlgoThreefish)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			type hasher interface{ ParamsHash() [sha256.Size]byte }
+			mustNew := func(opts ...Option) Permutation {
+				p, err := New([]byte("foo"), tc.n, append(opts, tc.opts...)...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return p
+			}
+			expected := mustNew(WithKDFSalt([]byte("salt")), WithPepper([]byte("pepper")))
+
+			salt, pepper := []byte("salt"), []byte("pepper")
+			opts := []Option{WithKDFSalt(salt), WithPepper(pepper)}
+			before := mustNew(opts...)
+			clear(salt)
+			clear(pepper)
+			// Neither the options nor a permutation built from them may see the change.
+			for name, p := range map[string]Permutation{"before": before, "after": mustNew(opts...)} {
+				if p.(hasher).ParamsHash() != expected.(hasher).ParamsHash() {
+					t.Errorf("%s: ParamsHash changed after the caller's salt and pepper were cleared", name)
+				}
+				for i := range 100 {
+					if p.PermuteInt(i) != expected.PermuteInt(i) {
+						t.Fatalf("%s: output for %d changed after the caller's salt and pepper were cleared", name, i)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewKDFSalt(t *testing.T) {
+	// As TestPermuteKey, but keeping the key and varying only the salt or info.
+	n := big.NewInt(1 << 16)
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"FFX", nil},
+		{"FeistelSHAKE128", []Option{WithAlgorithm(AlgoFeistelSHAKE128)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mustNew := func(salt []byte, info string) Permutation {
+				p, err := New([]byte("foo"), n, append(tc.opts, WithKDFSalt(salt), WithKDFInfo(info))...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return p
+			}
+			unsalted := mustNew(nil, "tenant 1")
+			empty := mustNew([]byte{}, "tenant 1")
+			salted := mustNew([]byte("salt"), "tenant 1")
+			again := mustNew([]byte("salt"), "tenant 1")
+			otherSalt := mustNew([]byte("salt2"), "tenant 1")
+			otherInfo := mustNew([]byte("salt"), "tenant 2")
+
+			sameSalt, sameInfo, sameUnsalted := 0, 0, 0
+			for i := range 1 << 16 {
+				out := salted.PermuteInt(i)
+				if out != again.PermuteInt(i) {
+					t.Fatalf("same key, salt and info gave different outputs for %d", i)
+				}
+				if empty.PermuteInt(i) != unsalted.PermuteInt(i) {
+					t.Fatalf("empty salt changed the output for %d", i)
+				}
+				if out == otherSalt.PermuteInt(i) {
+					sameSalt++
+				}
+				if out == otherInfo.PermuteInt(i) {
+					sameInfo++
+				}
+				if out == unsalted.PermuteInt(i) {
+					sameUnsalted++
+				}
+			}
+			if sameSalt > 10 || sameInfo > 10 || sameUnsalted > 10 {
+				t.Errorf("collisions: %d changing the salt, %d changing the info, %d removing the salt",
+					sameSalt, sameInfo, sameUnsalted)
+			}
+			if inv := salted.InvertInt(salted.PermuteInt(12345)); inv != 12345 {
+				t.Errorf("InvertInt gave %d, expected 12345", inv)
+			}
+		})
+	}
+}
+
+func TestNewThreefish(t *testing.T) {
+	n := new(big.Int).Lsh(big.NewInt(1), 256)
+	p, err := New([]byte("foo"), n, WithAlgorithm(AlgoThreefish))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Algorithm() != AlgoThreefish {
+		t.Errorf("Algorithm() = %v, expected %v", p.Algorithm(), AlgoThreefish)
+	}
+	expected := NewThreefish([]byte("foo"), 256)
+	for i := range 10 {
+		if out, exp := p.PermuteInt(i), expected.PermuteInt(i); out != exp {
+			t.Errorf("PermuteInt(%d) = %d, expected %d", i, out, exp)
+		}
+	}
+
+	peppered, err := New([]byte("foo"), n, WithAlgorithm(AlgoThreefish), WithPepper([]byte("pepper")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := big.NewInt(12345)
+	if peppered.PermuteInPlace(new(big.Int).Set(v), nil).Cmp(p.PermuteInPlace(new(big.Int).Set(v), nil)) == 0 {
+		t.Error("pepper didn't change the Threefish permutation")
+	}
+}
+
+func TestNewDefaultTweak(t *testing.T) {
+	key := []byte("foo")
+	n := big.NewInt(1000)
+	tweak := []byte("tweak")
+	p, err := New(key, n, WithDefaultTweak(tweak))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := NewNInt(key, 1000)
+	for i := range int64(1000) {
+		expected := plain.PermuteInPlace(big.NewInt(i), tweak).Int64()
+		if out := p.PermuteInt(int(i)); int64(out) != expected {
+			t.Fatalf("PermuteInt(%d) = %d, expected %d", i, out, expected)
+		}
+		if out := p.PermuteInPlace(big.NewInt(i), nil).Int64(); out != expected {
+			t.Fatalf("PermuteInPlace(%d, nil) = %d, expected %d", i, out, expected)
+		}
+		if inv := p.InvertInt(int(expected)); int64(inv) != i {
+			t.Fatalf("InvertInt(%d) = %d, expected %d", expected, inv, i)
+		}
+		// An explicit tweak overrides the default.
+		other := []byte{}
+		if out, exp := p.PermuteInPlace(big.NewInt(i), other), plain.PermuteInt(int(i)); out.Int64() != int64(exp) {
+			t.Fatalf("PermuteInPlace(%d, []) = %d, expected %d", i, out, exp)
+		}
+	}
+
+	// Changing the caller's slice afterwards must not change p, its clones or another
+	// permutation built from the same option.
+	opt := WithDefaultTweak(tweak)
+	before, err := New(key, n, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := before.Clone()
+	copy(tweak, "TWEAK")
+	after, err := New(key, n, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range int64(1000) {
+		expected := plain.PermuteInPlace(big.NewInt(i), []byte("tweak")).Int64()
+		for name, q := range map[string]Permutation{"p": p, "before": before, "clone": clone, "after": after} {
+			if out := q.PermuteInt(int(i)); int64(out) != expected {
+				t.Fatalf("%s: PermuteInt(%d) = %d after the caller's tweak changed, expected %d", name, i, out, expected)
+			}
+		}
+	}
+}
+
+func TestNewPreRotation(t *testing.T) {
+	key := []byte("foo")
+	const n = 1000
+	p, err := New(key, big.NewInt(n), WithPreRotation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := NewNInt(key, n)
+
+	// The rotation is the same for every input, so it can be recovered from one of them.
+	offset := plain.InvertInt(p.PermuteInt(0))
+	if offset == 0 {
+		t.Fatal("expected a non-zero offset")
+	}
+	seen := make(map[int]bool, n)
+	for i := range n {
+		out := p.PermuteInt(i)
+		if expected := plain.PermuteInt((i + offset) % n); out != expected {
+			t.Fatalf("PermuteInt(%d) = %d, expected %d", i, out, expected)
+		}
+		if seen[out] {
+			t.Fatalf("duplicate output %d", out)
+		}
+		seen[out] = true
+		if inv := p.InvertInt(out); inv != i {
+			t.Fatalf("InvertInt(%d) = %d, expected %d", out, inv, i)
+		}
+		tweak := []byte("tweak")
+		out = int(p.PermuteInPlace(big.NewInt(int64(i)), tweak).Int64())
+		if inv := p.InvertInPlace(big.NewInt(int64(out)), tweak).Int64(); inv != int64(i) {
+			t.Fatalf("InvertInPlace(%d) = %d, expected %d", out, inv, i)
+		}
+	}
+
+	// The offset depends on the key and the pepper.
+	other, _ := New([]byte("bar"), big.NewInt(n), WithPreRotation())
+	if NewNInt([]byte("bar"), n).InvertInt(other.PermuteInt(0)) == offset {
+		t.Error("expected a different offset for a different key")
+	}
+	peppered, _ := New(key, big.NewInt(n), WithPreRotation(), WithPepper([]byte("pepper")))
+	plainPeppered, _ := New(key, big.NewInt(n), WithPepper([]byte("pepper")))
+	if plainPeppered.InvertInt(peppered.PermuteInt(0)) == offset {
+		t.Error("expected a different offset with a pepper")
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic for an out-of-range input")
+			}
+		}()
+		p.PermuteInt(n)
+	}()
+	if _, err := New(key, big.NewInt(n), WithPreRotation(), WithPRF(func(in []byte) []byte { return in })); err == nil {
+		t.Error("expected an error for WithPreRotation with FeistelPRF")
+	}
+}
+
+func TestNewAffineFinalize(t *testing.T) {
+	key := []byte("foo")
+	for _, n := range []int64{1, 2, 10, 256, 1000, 1 << 12, 3 * 5 * 7 * 11 * 13} {
+		p, err := New(key, big.NewInt(n), WithAffineFinalize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		affine := p.(*affinePermutation)
+		if new(big.Int).GCD(nil, nil, &affine.a, big.NewInt(n)).Cmp(big.NewInt(1)) != 0 {
+			t.Fatalf("n=%d: a = %v isn't coprime with n", n, &affine.a)
+		}
+		plain := NewNInt(key, int(n))
+		seen := make(map[int64]bool, n)
+		for i := range n {
+			out := p.PermuteInPlace(big.NewInt(i), []byte("tweak"))
+			expected := int64(plain.PermuteInPlace(big.NewInt(i), []byte("tweak")).Int64())
+			expected = (affine.a.Int64()*expected + affine.b.Int64()) % n
+			if out.Int64() != expected {
+				t.Fatalf("n=%d: PermuteInPlace(%d) = %v, expected %d", n, i, out, expected)
+			}
+			if seen[out.Int64()] {
+				t.Fatalf("n=%d: duplicate output %v", n, out)
+			}
+			seen[out.Int64()] = true
+			if inv := p.InvertInPlace(out, []byte("tweak")); inv.Int64() != i {
+				t.Fatalf("n=%d: InvertInPlace gave %v, expected %d", n, inv, i)
+			}
+			if inv := p.InvertInt(p.PermuteInt(int(i))); inv != int(i) {
+				t.Fatalf("n=%d: InvertInt(PermuteInt(%d)) = %d", n, i, inv)
+			}
+		}
+	}
+
+	// The step is non-trivial for a typical domain, and combines with WithPreRotation.
+	p, _ := New(key, big.NewInt(1000), WithAffineFinalize())
+	if a := p.(*affinePermutation).a.Int64(); a == 1 {
+		t.Error("expected a multiplier other than 1")
+	}
+	both, err := New(key, big.NewInt(1000), WithAffineFinalize(), WithPreRotation(), WithDefaultTweak([]byte("t")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 1000 {
+		if inv := both.InvertInt(both.PermuteInt(i)); inv != i {
+			t.Fatalf("combined round trip of %d gave %d", i, inv)
+		}
+	}
+	if _, err := New(key, big.NewInt(1000), WithAffineFinalize(), WithPRF(func(in []byte) []byte { return in })); err == nil {
+		t.Error("expected an error for WithAffineFinalize with FeistelPRF")
+	}
+}
+
+func TestNewAlgorithmCoverage(t *testing.T) {
+	for _, tc := range []struct {
+		n         *big.Int
+		algorithm string
+		err       string
+	}{
+		{
+			new(big.Int).Lsh(big.NewInt(1), 200), AlgoFFX,
+			"FFX-A2 supports 2 to 128 bits but domain 1606938044258990275541962092341162602522202993782792835301376 requires 200 bits",
+		},
+		{big.NewInt(1 << 20), AlgoThreefish, "Threefish supports 256, 512 or 1024 bits but domain 1048576 requires 20 bits"},
+	} {
+		_, err := New([]byte("foo"), tc.n, WithAlgorithm(tc.algorithm))
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("New(%v, %v) returned error %v, expected %q", tc.n, tc.algorithm, err, tc.err)
+		}
+	}
+	// The limits themselves are accepted.
+	for _, bits := range []int{2, 7, 8, 128} {
+		n := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+		if _, err := New([]byte("foo"), n, WithAlgorithm(AlgoFFX)); err != nil {
+			t.Errorf("New(2^%d, FFX) failed: %v", bits, err)
+		}
+	}
+}
+
+func TestNewOddRounds(t *testing.T) {
+	for _, bits := range []int{8, 9, 10, 11} {
+		for _, rounds := range []int{7, 8, 11, 12} {
+			for _, opts := range [][]Option{
+				{WithAlgorithm(AlgoFFX)},
+				{WithAlgorithm(AlgoFeistelSHAKE128)},
+				{WithSplit(3)},
+			} {
+				opts = append(opts, WithRounds(rounds))
+				n := 1 << bits
+				p, err := New([]byte("foo"), big.NewInt(int64(n)), opts...)
+				if err != nil {
+					// Only an odd round count over unequal halves is rejected.
+					if rounds%2 == 0 {
+						t.Errorf("%d bits, %d rounds: %v", bits, rounds, err)
+					}
+					continue
+				}
+				if p.Rounds() != rounds {
+					t.Fatalf("%d bits: Rounds() = %d, expected %d", bits, p.Rounds(), rounds)
+				}
+				seen := make([]bool, n)
+				for i := range n {
+					out := p.PermuteInt(i)
+					if out < 0 || out >= n || seen[out] {
+						t.Fatalf("%d bits, %d rounds: PermuteInt(%d) = %d is out of range or a duplicate", bits, rounds, i, out)
+					}
+					seen[out] = true
+					if inv := p.InvertInt(out); inv != i {
+						t.Fatalf("%d bits, %d rounds: InvertInt(%d) = %d, expected %d", bits, rounds, out, inv, i)
+					}
+				}
+			}
+		}
+	}
+	if _, err := New([]byte("foo"), big.NewInt(1<<9), WithAlgorithm(AlgoFFX), WithRounds(7)); err == nil {
+		t.Error("expected an error for 7 rounds over 9 bits")
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	prf := func(input []byte) []byte { return input }
+	for _, tc := range []struct {
+		name string
+		n    *big.Int
+		opts []Option
+	}{
+		{"zero domain", big.NewInt(0), nil},
+		{"negative domain", big.NewInt(-5), nil},
+		{"radix 1", big.NewInt(1000), []Option{WithRadix(1)}},
+		{"radix 256", big.NewInt(1000), []Option{WithRadix(256)}},
+		{"radix with FFX", big.NewInt(1000), []Option{WithRadix(10), WithAlgorithm(AlgoFFX)}},
+		{"FFXRadix radix 2", big.NewInt(1000), []Option{WithAlgorithm(AlgoFFXRadix)}},
+		{"FFXRadix rounds", big.NewInt(1000), []Option{WithRadix(10), WithRounds(20)}},
+		{"FFXRadix KDF info", big.NewInt(1000), []Option{WithRadix(10), WithKDFInfo("info")}},
+		{"FFXRadix pepper", big.NewInt(1000), []Option{WithRadix(10), WithPepper([]byte("pepper"))}},
+		{"FFXRadix split", big.NewInt(1000), []Option{WithRadix(10), WithSplit(3)}},
+		{"FFXRadix too long", new(big.Int).Lsh(big.NewInt(1), 200), []Option{WithRadix(10)}},
+		{"negative rounds", big.NewInt(1000), []Option{WithRounds(-1)}},
+		{"FFX too many rounds", big.NewInt(1000), []Option{WithRounds(256)}},
+		{"split too large", big.NewInt(1000), []Option{WithSplit(10)}},
+		{"negative split", big.NewInt(1000), []Option{WithSplit(-1)}},
+		{"FFX split", big.NewInt(1000), []Option{WithAlgorithm(AlgoFFX), WithSplit(4)}},
+		{"FFX too large", new(big.Int).Lsh(big.NewInt(1), 129), []Option{WithAlgorithm(AlgoFFX)}},
+		{"FFX PRF", big.NewInt(1000), []Option{WithAlgorithm(AlgoFFX), WithPRF(prf)}},
+		{"FeistelPRF without PRF", big.NewInt(1000), []Option{WithAlgorithm(AlgoFeistelPRF)}},
+		{"FeistelPRF KDF info", big.NewInt(1000), []Option{WithPRF(prf), WithKDFInfo("x")}},
+		{"KDF hash without name", big.NewInt(1000), []Option{WithKDFHash("", sha512.New)}},
+		{"KDF hash without function", big.NewInt(1000), []Option{WithKDFHash("SHA-512", nil)}},
+		{"FeistelPRF KDF hash", big.NewInt(1000), []Option{WithPRF(prf), WithKDFHash("SHA-512", sha512.New)}},
+		{
+			"FeistelSHAKE128 KDF hash without info", big.NewInt(1000),
+			[]Option{WithAlgorithm(AlgoFeistelSHAKE128), WithKDFHash("SHA-512", sha512.New)},
+		},
+		{"FeistelPRF KDF salt", big.NewInt(1000), []Option{WithPRF(prf), WithKDFSalt([]byte("x"))}},
+		{
+			"FeistelSHAKE128 KDF salt without info", big.NewInt(1000),
+			[]Option{WithAlgorithm(AlgoFeistelSHAKE128), WithKDFSalt([]byte("x"))},
+		},
+		{"Threefish domain", big.NewInt(1000), []Option{WithAlgorithm(AlgoThreefish)}},
+		{
+			"Threefish rounds", new(big.Int).Lsh(big.NewInt(1), 256),
+			[]Option{WithAlgorithm(AlgoThreefish), WithRounds(10)},
+		},
+		{"unknown algorithm", big.NewInt(1000), []Option{WithAlgorithm("ROT13")}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if p, err := New([]byte("foo"), tc.n, tc.opts...); err == nil {
+				t.Errorf("expected an error, got %v", p)
+			}
+		})
+	}
+}
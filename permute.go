@@ -1,28 +1,255 @@
 package permutation
 
 import (
+	"context"
+	"crypto/subtle"
 	"fmt"
+	"math"
 	"math/big"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
 )
 
 type Permutation interface {
+	// PermuteInt permutes in with no tweak.  No construction special-cases any input, 0
+	// included: 0 is as likely as any other value to map to any output.  Values are limited
+	// to the range of int, which is only 32 bits on 386 and arm, so wider domains need
+	// PermuteUint64 or PermuteInPlace.
 	PermuteInt(in int) int
+	// PermuteIntTweak and InvertIntTweak are PermuteInt and InvertInt under tweak, as
+	// PermuteInPlace would permute in, but without needing a big.Int.
+	PermuteIntTweak(in int, tweak []byte) int
+	InvertIntTweak(in int, tweak []byte) int
+	// PermuteUint64 and InvertUint64 are PermuteInt and InvertInt for uint64 values, which
+	// are 64 bits on every platform.  Rather than wrap, they panic if the domain, or an
+	// output, doesn't fit in a uint64.
+	PermuteUint64(in uint64) uint64
+	InvertUint64(in uint64) uint64
+	// PermuteInPlace permutes inOut under tweak.  Every construction treats a nil tweak and
+	// an empty one identically, as no tweak, so callers may pass either.  The one exception
+	// is a permutation from New with WithDefaultTweak, where nil selects the default tweak.
 	PermuteInPlace(inOut *big.Int, tweak []byte) *big.Int
+	// InvertInt and InvertInPlace are the inverses of PermuteInt and PermuteInPlace.  The
+	// block ciphers compute them directly, by running their rounds (and any cycle walk) in
+	// reverse, so inverting one value costs the same as permuting it.  Wrappers may differ:
+	// TablePermutation looks untweaked inverses up in its inverse table, and an ArbitraryN
+	// with WithBoundedWalk consults its map of long walks.
+	InvertInt(in int) int
+	InvertInPlace(inOut *big.Int, tweak []byte) *big.Int
+	// InDomain returns whether v is a valid input (and hence output) of the permutation.
+	InDomain(v *big.Int) bool
+
+	// Rounds returns the number of Feistel rounds used by the underlying block cipher.
+	Rounds() int
+	// Algorithm returns the name of the underlying block cipher construction, one of the
+	// Algo* constants.
+	Algorithm() string
+
+	// Clone returns an independent copy with the same mapping.  A permutation holds scratch
+	// state, so it must not be used from several goroutines at once; give each goroutine
+	// its own clone instead.  Clones share the immutable key-derived state, such as the
+	// cipher and round keys, so cloning doesn't repeat the key derivation and is cheap.
+	Clone() Permutation
 }
 
+const (
+	AlgoFFX             = "FFX-A2"
+	AlgoFeistelSHAKE128 = "FeistelSHAKE128"
+	AlgoFeistelPRF      = "FeistelPRF"
+)
+
 // ArbitraryN builds on one of the block permutations to make a permutation over an arbitrary range.
 // The underlying power-of-2 permutation is iterated to find an in-range result resulting
 // in variable runtime.
+//
+// An ArbitraryN holds scratch state and must not be used from several goroutines at once.
+// Building with -tags permutedebug makes it panic when it detects concurrent calls.
 type ArbitraryN struct {
-	p     Permutation
+	p Permutation
+	// guard detects concurrent use in builds with the permutedebug tag.
+	guard concurrencyGuard
 	n, in big.Int
+	// start is scratch for a bounded walk to restore its input if it gives up.
+	start big.Int
+	// blockN is the size of p's domain, which is [0, blockN).
+	blockN big.Int
+
+	// exact is set when n is the size of p's domain, in which case every output of p is
+	// in range and there's no need to cycle-walk.
+	exact bool
+
+	walkObserver func(iterations int)
+	tweakLimit   tweakLimit
+	// forbidden values are excluded from both the domain and the range.
+	forbidden []big.Int
+	// parallelThreshold is the minimum number of values per goroutine in PermuteBigMany
+	// and InvertBigMany, or 0 to disable parallelism.
+	parallelThreshold int
+	outOfRange        OutOfRangeMode
+	// longWalks, if set by WithBoundedWalk, holds the results of the long walks.
+	longWalks *longWalks
+	// pool, if set by Get, is where Put returns the block.
+	pool *sync.Pool
 }
 
+// DefaultParallelThreshold is the default minimum number of values that PermuteBigMany and
+// InvertBigMany give to each goroutine.  Below twice this they don't start any goroutines.
+const DefaultParallelThreshold = 512
+
 func NewNInt(key []byte, n int) *ArbitraryN {
 	return NewN(key, big.NewInt(int64(n)))
 }
 
 func NewN(key []byte, n *big.Int) *ArbitraryN {
+	p, err := NewNErr(key, n)
+	if err != nil {
+		panic(err.Error())
+	}
+	return p
+}
+
+// NewNErr is NewN but returns an error, rather than panicking, if n isn't positive or the
+// block permutation can't be constructed, for domains that come from configuration or
+// requests.  An invalid n gives an error wrapping ErrInvalidParameter.
+func NewNErr(key []byte, n *big.Int) (*ArbitraryN, error) {
+	if n.Sign() <= 0 {
+		return nil, errorf(ErrInvalidParameter, "n must be positive, got: %v", n)
+	}
+	bitLen := domainBitLen(n)
+	var block Permutation
+	var err error
+	if blockAlgorithm(bitLen) == AlgoFFX {
+		block, err = NewFFXErr(key, bitLen)
+	} else {
+		block, err = NewPowerOf2Err(key, bitLen)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newArbitraryN(block, n), nil
+}
+
+// NewNWithBits is NewN with the block permutation over [0, 2^bits) rather than the
+// smallest power of 2 that covers n, for matching another system that fixes the block
+// width, for example at 32 bits.  With bits equal to the bit length of n - 1 (or 2 for
+// n <= 2) it is the same as NewN.  Each call takes 2^bits/n block iterations on average,
+// so bits may exceed that minimum by at most maxExtraBlockBits, bounding the average at
+// 2^maxExtraBlockBits.  It panics unless n is positive and bits is in that range.
+func NewNWithBits(key []byte, n *big.Int, bits int) *ArbitraryN {
+	if n.Sign() <= 0 {
+		panic(fmt.Sprintf("n must be positive, got: %v", n))
+	}
+	if min := domainBitLen(n); bits < min || bits > min+maxExtraBlockBits {
+		panic(fmt.Sprintf("bits must be in [%v, %v] for n = %v, got: %v", min, min+maxExtraBlockBits, n, bits))
+	}
+	return newArbitraryNBlock(newBlockPermutation(key, bits), new(big.Int).Lsh(big.NewInt(1), uint(bits)), n)
+}
+
+// maxExtraBlockBits is how many bits wider than the minimum NewNWithBits allows the block
+// permutation to be.
+const maxExtraBlockBits = 16
+
+// newArbitraryN returns a permutation over [0, n) that cycle-walks block, which must be a
+// permutation over [0, 2^domainBitLen(n)).
+func newArbitraryN(block Permutation, n *big.Int) *ArbitraryN {
+	return newArbitraryNBlock(block, new(big.Int).Lsh(big.NewInt(1), uint(domainBitLen(n))), n)
+}
+
+// newArbitraryNBlock returns a permutation over [0, n) that cycle-walks block, which must
+// be a permutation over [0, blockN) with blockN >= n.
+func newArbitraryNBlock(block Permutation, blockN, n *big.Int) *ArbitraryN {
+	p := &ArbitraryN{
+		p:                 block,
+		parallelThreshold: DefaultParallelThreshold,
+	}
+	p.n.Set(n)
+	p.blockN.Set(blockN)
+	p.exact = n.Cmp(blockN) == 0
+	return p
+}
+
+// NewNString is equivalent to NewN with the UTF-8 bytes of key.
+func NewNString(key string, n *big.Int) *ArbitraryN {
+	return NewN([]byte(key), n)
+}
+
+// NewNIntString is equivalent to NewNInt with the UTF-8 bytes of key.
+func NewNIntString(key string, n int) *ArbitraryN {
+	return NewNInt([]byte(key), n)
+}
+
+// NewRadixExp returns a permutation over [0, radix^exponent), for example 10^exponent for
+// decimal strings of exponent digits.  For a radix in [3, 255] and a length that
+// NewFFXRadix supports it uses FFXRadix, which covers the domain exactly without
+// cycle-walking.  Otherwise it is equivalent to NewN over the same domain; for radix 2
+// that is FFX, which is already FFX-A2 in radix 2.  It panics if radix is less than 2 or
+// exponent isn't positive.
+func NewRadixExp(key []byte, radix, exponent int) *ArbitraryN {
+	if radix < 2 {
+		panic(fmt.Sprintf("radix must be at least 2, got: %v", radix))
+	}
+	if exponent <= 0 {
+		panic(fmt.Sprintf("exponent must be positive, got: %v", exponent))
+	}
+	n := new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(exponent)), nil)
+	if ffxRadixSupports(radix, exponent) {
+		return newArbitraryNBlock(NewFFXRadix(key, radix, exponent), n, n)
+	}
+	return NewN(key, n)
+}
+
+// NewFromSamples returns a permutation over the smallest domain that covers samples,
+// [0, max(samples)+1), for example the IDs already in use.  It panics if samples is empty
+// or contains a negative value.
+func NewFromSamples(key []byte, samples []int) *ArbitraryN {
+	if len(samples) == 0 {
+		panic("samples must not be empty")
+	}
+	largest := 0
+	for _, s := range samples {
+		if s < 0 {
+			panic(fmt.Sprintf("samples must be non-negative, got: %v", s))
+		}
+		largest = max(largest, s)
+	}
+	return NewN(key, new(big.Int).Add(big.NewInt(int64(largest)), big.NewInt(1)))
+}
+
+// NewNFromShares is equivalent to NewN with the key share1 XOR share2, for keys held as
+// two shares under split knowledge.  The combined key is zeroed before returning, although
+// that can't remove copies the Go runtime may have made.  It panics if the shares have
+// different lengths.
+func NewNFromShares(share1, share2 []byte, n *big.Int) *ArbitraryN {
+	if len(share1) != len(share2) {
+		panic(fmt.Sprintf("key shares must be the same length, got: %v and %v", len(share1), len(share2)))
+	}
+	key := make([]byte, len(share1))
+	subtle.XORBytes(key, share1, share2)
+	defer clear(key)
+	return NewN(key, n)
+}
+
+// RecommendedRounds returns the number of Feistel rounds that FFX and FeistelSHAKE128 use
+// for a domain of lengthBits bits.  Smaller domains get more rounds.
+func RecommendedRounds(lengthBits int) int {
+	switch {
+	case lengthBits <= 9:
+		return 36
+	case lengthBits <= 13:
+		return 30
+	case lengthBits <= 19:
+		return 24
+	case lengthBits <= 31:
+		return 18
+	default:
+		return 12
+	}
+}
+
+// domainBitLen returns the width of the power-of-2 block permutation used to cover [0, n).
+func domainBitLen(n *big.Int) int {
 	var nMinus1 big.Int
 	nMinus1.Sub(n, big.NewInt(1))
 	bitLen := nMinus1.BitLen()
@@ -30,39 +257,726 @@ func NewN(key []byte, n *big.Int) *ArbitraryN {
 		// Feistel network requires at least 2 bits.
 		bitLen = 2
 	}
-	var p2n Permutation
+	return bitLen
+}
+
+// newBlockPermutation returns the preferred permutation over [0, 2^bitLen).
+func newBlockPermutation(key []byte, bitLen int) Permutation {
+	if blockAlgorithm(bitLen) == AlgoFFX {
+		return NewFFX(key, bitLen)
+	}
+	return NewPowerOf2(key, bitLen)
+}
+
+// blockAlgorithm returns the algorithm of the preferred permutation over [0, 2^bitLen).
+func blockAlgorithm(bitLen int) string {
 	if bitLen >= 8 && bitLen <= 128 {
-		// Faster but only supports certain ranges.
-		p2n = NewFFX(key, bitLen)
-	} else {
-		p2n = NewPowerOf2(key, bitLen)
+		// Faster but only supports certain ranges.  FFX also supports 2 to 7 bits, but
+		// those stay with FeistelSHAKE128 so that existing mappings don't change; use
+		// New with WithAlgorithm(AlgoFFX) for them.
+		return AlgoFFX
 	}
-	p := &ArbitraryN{
-		p: p2n,
+	return AlgoFeistelSHAKE128
+}
+
+// PermutePlan describes the permutation that NewN would construct for a domain.
+type PermutePlan struct {
+	// BitLen is the width of the block permutation that is cycle-walked.
+	BitLen    int
+	Algorithm string
+	Rounds    int
+	// ExpectedIterations is the average number of iterations of the block permutation per
+	// call, 2^BitLen / n.  This is in [1, 2) except for n < 3, since the block is at least
+	// 2 bits wide.
+	ExpectedIterations float64
+}
+
+// Plan returns the parameters that NewN would choose for [0, n) without deriving any keys.
+func Plan(n *big.Int) PermutePlan {
+	if n.Sign() <= 0 {
+		panic(fmt.Sprintf("n must be positive, got: %v", n))
+	}
+	bitLen := domainBitLen(n)
+	ratio, _ := new(big.Rat).SetFrac(new(big.Int).Lsh(big.NewInt(1), uint(bitLen)), n).Float64()
+	return PermutePlan{
+		BitLen:             bitLen,
+		Algorithm:          blockAlgorithm(bitLen),
+		Rounds:             RecommendedRounds(bitLen),
+		ExpectedIterations: ratio,
 	}
-	p.n.Set(n)
-	return p
 }
 
+// PermuteInt permutes in, which must be in [0, n).
+//
+// Like any permutation, p may map some inputs to themselves.  This can't be avoided by
+// applying p again when PermuteInt(in) == in, since a fixed point stays fixed however many
+// times p is applied.  More generally, any bijection that agrees with p everywhere else
+// must map p's fixed points to each other, so it can't move a sole fixed point at all.
+// Callers that need no fixed points must choose the key, or the tweak, so that there are
+// none over the inputs they use.
 func (p *ArbitraryN) PermuteInt(in int) int {
-	return int(p.PermuteInPlace(p.in.SetInt64(int64(in)), nil).Int64())
+	return p.PermuteIntTweak(in, nil)
+}
+
+func (p *ArbitraryN) PermuteIntTweak(in int, tweak []byte) int {
+	if guardEnabled {
+		p.guard.enter()
+		defer p.guard.exit()
+	}
+	out := p.permuteInPlace(p.in.SetInt64(int64(in)), tweak)
+	if out == nil {
+		return -1
+	}
+	return int(out.Int64())
+}
+
+func (p *ArbitraryN) InvertInt(in int) int {
+	return p.InvertIntTweak(in, nil)
+}
+
+func (p *ArbitraryN) InvertIntTweak(in int, tweak []byte) int {
+	if guardEnabled {
+		p.guard.enter()
+		defer p.guard.exit()
+	}
+	out := p.invertInPlace(p.in.SetInt64(int64(in)), tweak)
+	if out == nil {
+		return -1
+	}
+	return int(out.Int64())
+}
+
+// PermuteUint64 is PermuteInt for uint64 values.  It panics if n is more than 2^64, and, as
+// there's no value to report it with, for an invalid input whatever the OutOfRangeMode.
+func (p *ArbitraryN) PermuteUint64(in uint64) uint64 {
+	if guardEnabled {
+		p.guard.enter()
+		defer p.guard.exit()
+	}
+	p.checkUint64Domain()
+	return stepUint64(p.permuteInPlace, &p.in, in)
+}
+
+// InvertUint64 is the inverse of PermuteUint64.
+func (p *ArbitraryN) InvertUint64(in uint64) uint64 {
+	if guardEnabled {
+		p.guard.enter()
+		defer p.guard.exit()
+	}
+	p.checkUint64Domain()
+	return stepUint64(p.invertInPlace, &p.in, in)
+}
+
+func (p *ArbitraryN) checkUint64Domain() {
+	// n may be 2^64 itself, which is 65 bits long.
+	if p.n.BitLen() > 65 || (p.n.BitLen() == 65 && p.n.TrailingZeroBits() != 64) {
+		panic(fmt.Sprintf("domain [0, %v) doesn't fit in a uint64", &p.n))
+	}
+}
+
+// stepUint64 implements PermuteUint64 or InvertUint64 with step, the corresponding
+// PermuteInPlace or InvertInPlace, for permutations without a native 64-bit path.
+func stepUint64(step func(inOut *big.Int, tweak []byte) *big.Int, scratch *big.Int, in uint64) uint64 {
+	out := step(scratch.SetUint64(in), nil)
+	if out == nil {
+		panic(fmt.Sprintf("input %v is outside range of permutation", in))
+	}
+	if !out.IsUint64() {
+		panic(fmt.Sprintf("output %v doesn't fit in a uint64", out))
+	}
+	return out.Uint64()
+}
+
+// checkUint64Width panics unless a permutation over [0, 2^lengthBits) fits in a uint64.
+func checkUint64Width(lengthBits int) {
+	if lengthBits > 64 {
+		panic(fmt.Sprintf("PermuteUint64 requires a domain of at most 64 bits, got %v bits", lengthBits))
+	}
+}
+
+// Result is a permuted value along with the properties of its domain that are needed to
+// format it consistently.
+type Result struct {
+	Value int
+	// ByteWidth is the number of bytes needed to hold the largest value in the domain.
+	ByteWidth int
+	// DecimalWidth is the number of decimal digits in the largest value in the domain.
+	DecimalWidth int
+	Algorithm    string
+}
+
+// PermuteInfo is PermuteInt but also returns the domain's widths and the algorithm.
+func (p *ArbitraryN) PermuteInfo(in int) Result {
+	var largest big.Int
+	largest.Sub(&p.n, big.NewInt(1))
+	return Result{
+		Value:        p.PermuteInt(in),
+		ByteWidth:    max((largest.BitLen()+7)/8, 1),
+		DecimalWidth: len(largest.String()),
+		Algorithm:    p.Algorithm(),
+	}
+}
+
+// PermuteString parses in as a base-10 integer, permutes it and returns the result
+// formatted in base 10.
+func (p *ArbitraryN) PermuteString(in string) (string, error) {
+	if err := p.parseString(in); err != nil {
+		return "", err
+	}
+	return p.PermuteInPlace(&p.in, nil).String(), nil
+}
+
+// InvertString is the inverse of PermuteString.
+func (p *ArbitraryN) InvertString(in string) (string, error) {
+	if err := p.parseString(in); err != nil {
+		return "", err
+	}
+	return p.InvertInPlace(&p.in, nil).String(), nil
+}
+
+// PermuteHex permutes in and returns the result as lowercase hexadecimal, zero-padded to
+// the number of hex digits in n-1 so that every output has the same width.  Under
+// OutOfRangeError it returns "" for an out-of-range or forbidden input.
+func (p *ArbitraryN) PermuteHex(in int) string {
+	permuted := p.PermuteInPlace(p.in.SetInt64(int64(in)), nil)
+	if permuted == nil {
+		return ""
+	}
+	out := permuted.Text(16)
+	return strings.Repeat("0", p.hexWidth()-len(out)) + out
+}
+
+// InvertHex is the inverse of PermuteHex.  It accepts upper or lowercase digits but
+// returns an error unless in has exactly the width that PermuteHex produces.
+func (p *ArbitraryN) InvertHex(in string) (int, error) {
+	if len(in) != p.hexWidth() {
+		return 0, errorf(ErrInvalidLength, "input must be %v hex digits, got %v", p.hexWidth(), len(in))
+	}
+	if strings.ContainsAny(in, "+-") {
+		return 0, fmt.Errorf("input %q is not hexadecimal", in)
+	}
+	if _, ok := p.in.SetString(in, 16); !ok {
+		return 0, fmt.Errorf("input %q is not hexadecimal", in)
+	}
+	if !p.InDomain(&p.in) {
+		return 0, errorf(ErrOutOfRange, "input %v is outside range of permutation [0, %v)", in, &p.n)
+	}
+	return int(p.InvertInPlace(&p.in, nil).Int64()), nil
+}
+
+func (p *ArbitraryN) hexWidth() int {
+	var largest big.Int
+	largest.Sub(&p.n, big.NewInt(1))
+	return max((largest.BitLen()+3)/4, 1)
+}
+
+func (p *ArbitraryN) parseString(in string) error {
+	if _, ok := p.in.SetString(in, 10); !ok {
+		return fmt.Errorf("input %q is not a base-10 integer", in)
+	}
+	if p.in.Sign() < 0 || p.in.Cmp(&p.n) >= 0 {
+		return errorf(ErrOutOfRange, "input %v is outside range of permutation [0, %v)", in, &p.n)
+	}
+	if p.isForbidden(&p.in) {
+		return errorf(ErrOutOfRange, "input %v is forbidden", in)
+	}
+	return nil
+}
+
+// InDomain returns whether v is in [0, n) and not one of the values passed to
+// WithForbidden.
+func (p *ArbitraryN) InDomain(v *big.Int) bool {
+	return v.Sign() >= 0 && v.Cmp(&p.n) < 0 && !p.isForbidden(v)
+}
+
+func (p *ArbitraryN) Rounds() int {
+	return p.p.Rounds()
+}
+
+func (p *ArbitraryN) Algorithm() string {
+	return p.p.Algorithm()
 }
 
 // PermuteInPlace calculates inOut's permutated value and stores it back into inOut.
 // Returns inOut as a convenience.
 func (p *ArbitraryN) PermuteInPlace(inOut *big.Int, tweak []byte) *big.Int {
-	if inOut.Cmp(&p.n) >= 0 {
-		panic(fmt.Sprintf("input %v is outside range of permutation [0, %v)",
-			inOut, p.n))
+	if guardEnabled {
+		p.guard.enter()
+		defer p.guard.exit()
+	}
+	return p.permuteInPlace(inOut, tweak)
+}
+
+func (p *ArbitraryN) permuteInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	if !p.mustCheck(inOut) {
+		return nil
+	}
+	p.tweakLimit.mustCheck(tweak)
+	out, _ := p.walkN(false, inOut, tweak, math.MaxInt)
+	return out
+}
+
+// InvertInPlace is the inverse of PermuteInPlace; it calculates the value that permutes to
+// inOut and stores it back into inOut. Returns inOut as a convenience.  It cycle-walks the
+// block's own inverse, retracing the forward walk, so it takes exactly as many block
+// iterations as the PermuteInPlace call that produced inOut.
+func (p *ArbitraryN) InvertInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	if guardEnabled {
+		p.guard.enter()
+		defer p.guard.exit()
+	}
+	return p.invertInPlace(inOut, tweak)
+}
+
+func (p *ArbitraryN) invertInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	if !p.mustCheck(inOut) {
+		return nil
+	}
+	p.tweakLimit.mustCheck(tweak)
+	out, _ := p.walkN(true, inOut, tweak, math.MaxInt)
+	return out
+}
+
+// TryPermuteInPlace is PermuteInPlace but returns an error, rather than panicking, if
+// inOut is outside [0, n) or the tweak is longer than the maximum set by WithTweakMaxLen.
+func (p *ArbitraryN) TryPermuteInPlace(inOut *big.Int, tweak []byte) (*big.Int, error) {
+	if err := p.check(inOut, tweak); err != nil {
+		return nil, err
+	}
+	return p.PermuteInPlace(inOut, tweak), nil
+}
+
+// TryInvertInPlace is InvertInPlace but returns an error rather than panicking.
+func (p *ArbitraryN) TryInvertInPlace(inOut *big.Int, tweak []byte) (*big.Int, error) {
+	if err := p.check(inOut, tweak); err != nil {
+		return nil, err
+	}
+	return p.InvertInPlace(inOut, tweak), nil
+}
+
+func (p *ArbitraryN) check(in *big.Int, tweak []byte) error {
+	if p.isForbidden(in) {
+		return errorf(ErrOutOfRange, "input %v is forbidden", in)
+	}
+	if !p.InDomain(in) {
+		return errorf(ErrOutOfRange, "input %v is outside range of permutation [0, %v)", in, &p.n)
+	}
+	return p.tweakLimit.check(tweak)
+}
+
+// mustCheck handles an invalid input according to the OutOfRangeMode: it panics, returns
+// false, or reduces in modulo n.  It returns true if in may be permuted.
+func (p *ArbitraryN) mustCheck(in *big.Int) bool {
+	if in.Sign() < 0 || in.Cmp(&p.n) >= 0 {
+		switch p.outOfRange {
+		case OutOfRangeError:
+			return false
+		case OutOfRangeWrapMod:
+			in.Mod(in, &p.n)
+		default:
+			panic(fmt.Sprintf("input %v is outside range of permutation [0, %v)", in, &p.n))
+		}
+	}
+	if p.isForbidden(in) {
+		if p.outOfRange == OutOfRangeError {
+			return false
+		}
+		panic(fmt.Sprintf("input %v is forbidden", in))
+	}
+	return true
+}
+
+// OutOfRangeMode selects how PermuteInt, PermuteInPlace and their inverses handle inputs
+// outside [0, n); see WithOutOfRange.
+type OutOfRangeMode int
+
+const (
+	// OutOfRangePanic panics.
+	OutOfRangePanic OutOfRangeMode = iota
+	// OutOfRangeError makes PermuteInt and InvertInt return -1, and PermuteInPlace and
+	// InvertInPlace return nil without modifying their input.  Forbidden inputs are treated
+	// the same way.
+	OutOfRangeError
+	// OutOfRangeWrapMod reduces the input modulo n, into [0, n), before permuting it.
+	OutOfRangeWrapMod
+)
+
+// WithOutOfRange sets how out-of-range inputs are handled.  The default is
+// OutOfRangePanic.  With OutOfRangeWrapMod, in and in+n give the same output, so the
+// result is not a bijection over any range larger than [0, n), and inverting an output
+// only ever recovers the value in [0, n).  The Try* methods, PermuteBigMany and
+// InvertBigMany always return an error for out-of-range inputs.  Returns p as a
+// convenience.
+func (p *ArbitraryN) WithOutOfRange(mode OutOfRangeMode) *ArbitraryN {
+	if mode < OutOfRangePanic || mode > OutOfRangeWrapMod {
+		panic(fmt.Sprintf("unknown OutOfRangeMode %d", mode))
+	}
+	p.outOfRange = mode
+	return p
+}
+
+// WithForbidden removes values, which must be in [0, n), from the permutation's domain and
+// hence its range: the result is a permutation over the rest of [0, n) that never produces
+// a forbidden value, for example 0 if that means "null" downstream.  Passing a forbidden
+// value as an input panics, or is an error for the Try* methods.  Outputs that would have
+// been forbidden are cycle-walked one or more steps further, so existing outputs for inputs
+// that never reach a forbidden value are unchanged.  Returns p as a convenience.
+//
+// The values are checked linearly, so this is intended for a handful of values.  It
+// doesn't affect PermuteIntInDomain and InvertIntInDomain.
+func (p *ArbitraryN) WithForbidden(values ...*big.Int) *ArbitraryN {
+	var forbidden []big.Int
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		if v.Sign() < 0 || v.Cmp(&p.n) >= 0 {
+			panic(fmt.Sprintf("forbidden value %v is outside range of permutation [0, %v)", v, &p.n))
+		}
+		if !seen[v.String()] {
+			seen[v.String()] = true
+			forbidden = append(forbidden, *new(big.Int).Set(v))
+		}
+	}
+	if big.NewInt(int64(len(forbidden))).Cmp(&p.n) >= 0 {
+		panic("every value in the domain is forbidden")
+	}
+	p.forbidden = forbidden
+	if p.longWalks != nil {
+		p.buildLongWalks()
+	}
+	return p
+}
+
+func (p *ArbitraryN) isForbidden(v *big.Int) bool {
+	for i := range p.forbidden {
+		if v.Cmp(&p.forbidden[i]) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtendDomain grows the domain from [0, n) to [0, newN), keeping the same underlying
+// block permutation and simply accepting more of its outputs when cycle-walking.  newN must
+// be at least n and small enough to be covered by the same block, which for NewN means
+// domainBitLen(newN) == domainBitLen(n); growing beyond that would need a wider block and
+// would change every mapping.  Returns p as a convenience.
+//
+// The mapping of x in [0, n) is preserved exactly when none of the intermediate values
+// that its walk skipped are in [n, newN): in particular every x that needed a single
+// iteration keeps its output.  Other inputs now stop at the first skipped value in
+// [n, newN), and some of the new inputs in [n, newN) take over their old outputs.
+func (p *ArbitraryN) ExtendDomain(newN *big.Int) *ArbitraryN {
+	if newN.Cmp(&p.n) < 0 {
+		panic(fmt.Sprintf("new domain %v is smaller than %v", newN, &p.n))
+	}
+	if newN.Cmp(&p.blockN) > 0 {
+		panic(fmt.Sprintf("new domain %v is larger than the domain of the block permutation, %v", newN, &p.blockN))
+	}
+	p.n.Set(newN)
+	p.exact = newN.Cmp(&p.blockN) == 0
+	if p.longWalks != nil {
+		p.buildLongWalks()
+	}
+	return p
+}
+
+// WithTweakMaxLen limits tweaks to at most max bytes; longer tweaks make the Try* methods
+// return an error and the other methods panic.  This guards against unbounded work and
+// allocation when tweaks are derived from untrusted input.  By default there is no limit.
+// Returns p as a convenience.
+func (p *ArbitraryN) WithTweakMaxLen(max int) *ArbitraryN {
+	p.tweakLimit.setMax(max)
+	return p
+}
+
+// PermuteIntInDomain permutes in within the smaller domain [0, m), where 0 < m <= n, by
+// cycle walking the same underlying permutation until the result is below m.  This gives
+// a bijection over [0, m) from the same key, but one that's unrelated to the mapping over
+// [0, n).
+func (p *ArbitraryN) PermuteIntInDomain(m, in int) int {
+	return p.intInDomain(m, in, p.p.PermuteInPlace)
+}
+
+// InvertIntInDomain is the inverse of PermuteIntInDomain.
+func (p *ArbitraryN) InvertIntInDomain(m, in int) int {
+	return p.intInDomain(m, in, p.p.InvertInPlace)
+}
+
+func (p *ArbitraryN) intInDomain(m, in int, step func(inOut *big.Int, tweak []byte) *big.Int) int {
+	if guardEnabled {
+		p.guard.enter()
+		defer p.guard.exit()
+	}
+	var mBig big.Int
+	mBig.SetInt64(int64(m))
+	if m <= 0 || mBig.Cmp(&p.n) > 0 {
+		panic(fmt.Sprintf("domain %d is outside (0, %v]", m, &p.n))
+	}
+	if in < 0 || in >= m {
+		panic(fmt.Sprintf("input %v is outside range of permutation [0, %v)", in, m))
+	}
+	out, iterations := cycleWalk(step, &mBig, p.in.SetInt64(int64(in)), nil)
+	if p.walkObserver != nil {
+		p.walkObserver(iterations)
+	}
+	return int(out.Int64())
+}
+
+// PermuteBigMany permutes each of vals in place using the same tweak.  If any value is
+// outside [0, n) it returns an error without modifying vals.
+//
+// Large batches are split across up to GOMAXPROCS goroutines, each with its own copy
+// of the permutation and at least the number of values set by WithParallelThreshold.  vals
+// must not contain the same *big.Int twice, and any walk observer must be safe for
+// concurrent use.
+func (p *ArbitraryN) PermuteBigMany(vals []*big.Int, tweak []byte) error {
+	if err := p.checkMany(vals); err != nil {
+		return err
+	}
+	p.many(vals, tweak, (*ArbitraryN).PermuteInPlace)
+	return nil
+}
+
+// InvertBigMany is the inverse of PermuteBigMany.
+func (p *ArbitraryN) InvertBigMany(vals []*big.Int, tweak []byte) error {
+	if err := p.checkMany(vals); err != nil {
+		return err
 	}
+	p.many(vals, tweak, (*ArbitraryN).InvertInPlace)
+	return nil
+}
+
+// PermuteIntSlice replaces each value of in with PermuteInt of it and returns in as a
+// convenience.  It checks for concurrent use once for the whole slice and allocates
+// nothing.  For values too wide for an int, PermuteBigMany does the same for a slice of
+// *big.Int.
+func (p *ArbitraryN) PermuteIntSlice(in []int) []int {
+	return p.intSlice(in, p.permuteInPlace)
+}
+
+// InvertIntSlice is the inverse of PermuteIntSlice.
+func (p *ArbitraryN) InvertIntSlice(in []int) []int {
+	return p.intSlice(in, p.invertInPlace)
+}
+
+func (p *ArbitraryN) intSlice(in []int, step func(inOut *big.Int, tweak []byte) *big.Int) []int {
+	if guardEnabled {
+		p.guard.enter()
+		defer p.guard.exit()
+	}
+	for i, v := range in {
+		out := step(p.in.SetInt64(int64(v)), nil)
+		if out == nil {
+			in[i] = -1
+			continue
+		}
+		in[i] = int(out.Int64())
+	}
+	return in
+}
+
+// contextCheckInterval is the number of values that PermuteManyContext and
+// InvertManyContext process between checks of the context.
+const contextCheckInterval = 256
+
+// PermuteManyContext permutes in into out, which must be at least as long, using the same
+// tweak, and returns the number of values done.  It checks ctx every few hundred values
+// and, once ctx is done, stops and returns ctx.Err(); out[:done] then holds the results
+// for in[:done] and the rest of out is untouched.  Similarly, it stops with an
+// ErrOutOfRange error at the first value outside [0, n).
+func (p *ArbitraryN) PermuteManyContext(ctx context.Context, in, out []int, tweak []byte) (done int, err error) {
+	return p.manyContext(ctx, in, out, tweak, (*ArbitraryN).PermuteInPlace)
+}
+
+// InvertManyContext is the inverse of PermuteManyContext.
+func (p *ArbitraryN) InvertManyContext(ctx context.Context, in, out []int, tweak []byte) (done int, err error) {
+	return p.manyContext(ctx, in, out, tweak, (*ArbitraryN).InvertInPlace)
+}
+
+func (p *ArbitraryN) manyContext(ctx context.Context, in, out []int, tweak []byte, step func(*ArbitraryN, *big.Int, []byte) *big.Int) (int, error) {
+	if len(out) < len(in) {
+		panic(fmt.Sprintf("out has length %v, shorter than in's %v", len(out), len(in)))
+	}
+	for i, v := range in {
+		if i%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return i, err
+			}
+		}
+		if !p.InDomain(p.in.SetInt64(int64(v))) {
+			return i, errorf(ErrOutOfRange, "value %v at index %d is outside range of permutation [0, %v)", v, i, &p.n)
+		}
+		out[i] = int(step(p, p.in.SetInt64(int64(v)), tweak).Int64())
+	}
+	return len(in), nil
+}
+
+// WithParallelThreshold sets the minimum number of values that PermuteBigMany and
+// InvertBigMany give to each goroutine; 0 disables parallelism.  The default is
+// DefaultParallelThreshold.  Returns p as a convenience.
+func (p *ArbitraryN) WithParallelThreshold(threshold int) *ArbitraryN {
+	if threshold < 0 {
+		panic(fmt.Sprintf("threshold must not be negative, got: %v", threshold))
+	}
+	p.parallelThreshold = threshold
+	return p
+}
+
+func (p *ArbitraryN) many(vals []*big.Int, tweak []byte, step func(*ArbitraryN, *big.Int, []byte) *big.Int) {
+	workers := 0
+	if p.parallelThreshold > 0 {
+		workers = min(runtime.GOMAXPROCS(0), len(vals)/p.parallelThreshold)
+	}
+	if workers < 2 {
+		for _, v := range vals {
+			step(p, v, tweak)
+		}
+		return
+	}
+
+	chunk := (len(vals) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < len(vals); start += chunk {
+		c := p.Clone().(*ArbitraryN)
+		part := vals[start:min(start+chunk, len(vals))]
+		wg.Go(func() {
+			for _, v := range part {
+				step(c, v, tweak)
+			}
+		})
+	}
+	wg.Wait()
+}
 
-	// Iterate the underlying 2^n permutation until we find an in-range value. This is
-	// guaranteed to terminate because iterating a permutation must form a cycle.  If we're
-	// unlucky and the cycle is short we'll get back to the same value.
+// Clone returns an independent copy of p with a clone of its block, for use on another
+// goroutine.  The copy shares p's walk observer, which must then be safe for concurrent
+// use, and its bounded-walk table, which is read-only.  A clone of a permutation from Get
+// must not be passed to Put.
+func (p *ArbitraryN) Clone() Permutation {
+	c := &ArbitraryN{
+		p:                 p.p.Clone(),
+		exact:             p.exact,
+		walkObserver:      p.walkObserver,
+		tweakLimit:        p.tweakLimit,
+		forbidden:         slices.Clone(p.forbidden),
+		parallelThreshold: p.parallelThreshold,
+		outOfRange:        p.outOfRange,
+		longWalks:         p.longWalks,
+	}
+	c.n.Set(&p.n)
+	c.blockN.Set(&p.blockN)
+	return c
+}
+
+func (p *ArbitraryN) checkMany(vals []*big.Int) error {
+	for i, v := range vals {
+		if !p.InDomain(v) {
+			return errorf(ErrOutOfRange, "value %v at index %d is outside range of permutation [0, %v)", v, i, &p.n)
+		}
+	}
+	return nil
+}
+
+// WithWalkObserver registers a function that is called after each PermuteInPlace or
+// InvertInPlace (and hence each PermuteInt, InvertInt etc.) with the number of iterations of
+// the underlying permutation that were needed to find an in-range value.  This is at least
+// 1; the average is at most 2 since the underlying permutation is over less than 2n values.
+// Intended for exporting metrics.  Returns p as a convenience.
+func (p *ArbitraryN) WithWalkObserver(observer func(iterations int)) *ArbitraryN {
+	p.walkObserver = observer
+	return p
+}
+
+// walkN permutes inOut, or inverts it if inverse is set, looking up long walks and
+// reporting the iterations to the walk observer.  If the walk hasn't found a value after
+// maxIters iterations it restores inOut and returns an error wrapping ErrWalkLimit.
+func (p *ArbitraryN) walkN(inverse bool, inOut *big.Int, tweak []byte, maxIters int) (*big.Int, error) {
+	if p.longWalks.lookup(inverse, inOut, tweak) {
+		if p.walkObserver != nil {
+			p.walkObserver(1)
+		}
+		return inOut, nil
+	}
+	step := p.p.PermuteInPlace
+	if inverse {
+		step = p.p.InvertInPlace
+	}
+	if maxIters < math.MaxInt {
+		p.start.Set(inOut)
+	}
+	out, iterations := p.walk(step, inOut, tweak, maxIters)
+	if out == nil {
+		inOut.Set(&p.start)
+		return nil, errorf(ErrWalkLimit, "no value in range of permutation [0, %v) after %d iterations", &p.n, iterations)
+	}
+	if p.walkObserver != nil {
+		p.walkObserver(iterations)
+	}
+	return out, nil
+}
+
+// walk is cycleWalk over [0, n), skipping the range checks when n is a power of two and
+// skipping any forbidden values.  It gives up and returns nil after maxIters iterations.
+func (p *ArbitraryN) walk(step func(inOut *big.Int, tweak []byte) *big.Int, inOut *big.Int, tweak []byte, maxIters int) (*big.Int, int) {
+	if p.exact && len(p.forbidden) == 0 {
+		return step(inOut, tweak), 1
+	}
+	for iterations := 1; iterations <= maxIters; iterations++ {
+		inOut = step(inOut, tweak)
+		if p.acceptable(inOut) {
+			return inOut, iterations
+		}
+	}
+	return nil, maxIters
+}
+
+// PermuteTrace returns every value of the underlying block permutation that
+// PermuteInPlace(in, tweak) visits, for debugging an unexpected mapping: the values skipped
+// because they were out of range or forbidden, followed by the result.  It always walks,
+// even when WithBoundedWalk would look the result up, so that the walk itself can be
+// inspected.  in is not modified.  It returns an error if in or tweak is invalid.
+func (p *ArbitraryN) PermuteTrace(in *big.Int, tweak []byte) ([]*big.Int, error) {
+	return p.trace(p.p.PermuteInPlace, in, tweak)
+}
+
+// InvertTrace is PermuteTrace for InvertInPlace.
+func (p *ArbitraryN) InvertTrace(in *big.Int, tweak []byte) ([]*big.Int, error) {
+	return p.trace(p.p.InvertInPlace, in, tweak)
+}
+
+func (p *ArbitraryN) trace(step func(inOut *big.Int, tweak []byte) *big.Int, in *big.Int, tweak []byte) ([]*big.Int, error) {
+	if err := p.check(in, tweak); err != nil {
+		return nil, err
+	}
+	var values []*big.Int
+	v := new(big.Int).Set(in)
 	for {
-		inOut = p.p.PermuteInPlace(inOut, tweak)
-		if inOut.Cmp(&p.n) < 0 {
-			return inOut
+		// step modifies its argument, so each value gets its own copy.
+		v = step(new(big.Int).Set(v), tweak)
+		values = append(values, v)
+		if p.acceptable(v) {
+			return values, nil
+		}
+	}
+}
+
+// cycleWalk iterates the underlying 2^n permutation until we find a value in [0, n). This is
+// guaranteed to terminate because iterating a permutation must form a cycle.  If we're
+// unlucky and the cycle is short we'll get back to the same value.
+//
+// Walking the cycle in the reverse direction, using the inverse permutation, undoes the walk.
+//
+// Every step must use the same permutation, and so the same tweak.  If each step used a
+// different one, say by appending the iteration count to the tweak, the walk would no
+// longer follow a cycle and two inputs whose walks took different numbers of steps could
+// land on the same output, so the result wouldn't be a permutation.
+//
+// Returns the number of iterations taken along with the result.
+func cycleWalk(step func(inOut *big.Int, tweak []byte) *big.Int, n, inOut *big.Int, tweak []byte) (*big.Int, int) {
+	for iterations := 1; ; iterations++ {
+		inOut = step(inOut, tweak)
+		if inOut.Cmp(n) < 0 {
+			return inOut, iterations
 		}
 	}
 }
@@ -1,9 +1,24 @@
 package permutation
 
 import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"math"
 	"math/big"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func ExampleArbitraryN_PermuteInt() {
@@ -34,9 +49,376 @@ func TestPermute(t *testing.T) {
 					t.Fatalf("found duplicate output %d", out)
 				}
 				seen[out] = i
+				if inv := p.InvertInt(out); inv != i {
+					t.Fatalf("%d -> %d inverted to %d", i, out, inv)
+				}
+			}
+		})
+	}
+}
+
+func TestPowerOf2FastPath(t *testing.T) {
+	for _, n := range []int{2, 3, 5, 255, 257} {
+		if NewNInt([]byte("foo"), n).exact {
+			t.Errorf("n=%d shouldn't use the power-of-2 fast path", n)
+		}
+	}
+	for _, bits := range []int{2, 5, 8, 10} {
+		n := 1 << bits
+		fast := NewNInt([]byte("foo"), n)
+		if !fast.exact {
+			t.Fatalf("n=%d should use the power-of-2 fast path", n)
+		}
+		general := NewNInt([]byte("foo"), n)
+		general.exact = false
+		for i := range n {
+			out := fast.PermuteInt(i)
+			if expected := general.PermuteInt(i); out != expected {
+				t.Fatalf("n=%d: PermuteInt(%d) = %d, general path gives %d", n, i, out, expected)
+			}
+			if inv := fast.InvertInt(out); inv != i {
+				t.Fatalf("n=%d: InvertInt(%d) = %d, expected %d", n, out, inv, i)
+			}
+		}
+	}
+}
+
+func TestWalkObserver(t *testing.T) {
+	const n = 5
+	var observed []int
+	p := NewNInt([]byte("foo"), n).WithWalkObserver(func(iterations int) {
+		observed = append(observed, iterations)
+	})
+	block := NewPowerOf2([]byte("foo"), 3)
+	for i := range n {
+		// Count the walk directly on the underlying permutation.
+		expected := 0
+		for v := i; ; {
+			v = block.PermuteInt(v)
+			expected++
+			if v < n {
+				break
+			}
+		}
+		observed = observed[:0]
+		p.PermuteInt(i)
+		if len(observed) != 1 || observed[0] != expected {
+			t.Fatalf("PermuteInt(%d): observed %v, expected [%d]", i, observed, expected)
+		}
+	}
+	for i := range n {
+		expected := 0
+		for v := i; ; {
+			v = block.InvertInt(v)
+			expected++
+			if v < n {
+				break
+			}
+		}
+		observed = observed[:0]
+		p.InvertInt(i)
+		if len(observed) != 1 || observed[0] != expected {
+			t.Fatalf("InvertInt(%d): observed %v, expected [%d]", i, observed, expected)
+		}
+	}
+}
+
+func TestPermuteInfo(t *testing.T) {
+	for _, tc := range []struct {
+		n        int
+		expected Result
+	}{
+		{1, Result{ByteWidth: 1, DecimalWidth: 1, Algorithm: AlgoFeistelSHAKE128}},
+		{100, Result{ByteWidth: 1, DecimalWidth: 2, Algorithm: AlgoFeistelSHAKE128}},
+		{256, Result{ByteWidth: 1, DecimalWidth: 3, Algorithm: AlgoFFX}},
+		{257, Result{ByteWidth: 2, DecimalWidth: 3, Algorithm: AlgoFFX}},
+		{1000000, Result{ByteWidth: 3, DecimalWidth: 6, Algorithm: AlgoFFX}},
+	} {
+		p := NewNInt([]byte("foo"), tc.n)
+		in := tc.n / 2
+		tc.expected.Value = NewNInt([]byte("foo"), tc.n).PermuteInt(in)
+		if r := p.PermuteInfo(in); r != tc.expected {
+			t.Errorf("n=%d: PermuteInfo(%d) = %+v, expected %+v", tc.n, in, r, tc.expected)
+		}
+	}
+}
+
+func TestPermuteString(t *testing.T) {
+	p := NewNInt([]byte("foo"), 1000)
+	for i := range 1000 {
+		in := fmt.Sprint(i)
+		out, err := p.PermuteString(in)
+		if err != nil {
+			t.Fatalf("PermuteString(%q) failed: %v", in, err)
+		}
+		if expected := fmt.Sprint(p.PermuteInt(i)); out != expected {
+			t.Fatalf("PermuteString(%q) = %q, expected %q", in, out, expected)
+		}
+		inv, err := p.InvertString(out)
+		if err != nil {
+			t.Fatalf("InvertString(%q) failed: %v", out, err)
+		}
+		if inv != in {
+			t.Fatalf("InvertString(%q) = %q, expected %q", out, inv, in)
+		}
+	}
+	for _, in := range []string{"", "abc", "12x", "1.5", "-1", "1000", "99999999999999999999999"} {
+		if _, err := p.PermuteString(in); err == nil {
+			t.Errorf("PermuteString(%q) should have failed", in)
+		}
+		if _, err := p.InvertString(in); err == nil {
+			t.Errorf("InvertString(%q) should have failed", in)
+		}
+	}
+}
+
+func TestWithForbidden(t *testing.T) {
+	for _, tc := range []struct {
+		n         int
+		forbidden []int64
+	}{
+		{100, []int64{0}},
+		{100, []int64{0, 99, 42, 42}},
+		{256, []int64{0, 1, 2, 3}}, // Power of 2, so normally no walk.
+		{5, []int64{0, 1, 2, 3}},
+	} {
+		t.Run(fmt.Sprint(tc.n, tc.forbidden), func(t *testing.T) {
+			var values []*big.Int
+			forbidden := make(map[int]bool)
+			for _, v := range tc.forbidden {
+				values = append(values, big.NewInt(v))
+				forbidden[int(v)] = true
+			}
+			p := NewNInt([]byte("foo"), tc.n).WithForbidden(values...)
+			plain := NewNInt([]byte("foo"), tc.n)
+			seen := make(map[int]bool)
+			for i := range tc.n {
+				if forbidden[i] {
+					if p.InDomain(big.NewInt(int64(i))) {
+						t.Errorf("forbidden value %d is in the domain", i)
+					}
+					if _, err := p.TryPermuteInPlace(big.NewInt(int64(i)), nil); err == nil {
+						t.Errorf("TryPermuteInPlace(%d) should fail", i)
+					}
+					continue
+				}
+				out := p.PermuteInt(i)
+				if forbidden[out] || out < 0 || out >= tc.n {
+					t.Fatalf("PermuteInt(%d) = %d", i, out)
+				}
+				if seen[out] {
+					t.Fatalf("duplicate output %d", out)
+				}
+				seen[out] = true
+				if inv := p.InvertInt(out); inv != i {
+					t.Fatalf("InvertInt(%d) = %d, expected %d", out, inv, i)
+				}
+				if plainOut := plain.PermuteInt(i); !forbidden[plainOut] && plainOut != out {
+					t.Fatalf("PermuteInt(%d) = %d, but the unrestricted output %d was allowed", i, out, plainOut)
+				}
+			}
+			if len(seen) != tc.n-len(forbidden) {
+				t.Errorf("got %d outputs, expected %d", len(seen), tc.n-len(forbidden))
+			}
+		})
+	}
+
+	for _, f := range []func(){
+		func() { NewNInt([]byte("foo"), 100).WithForbidden(big.NewInt(100)) },
+		func() { NewNInt([]byte("foo"), 100).WithForbidden(big.NewInt(-1)) },
+		func() { NewNInt([]byte("foo"), 2).WithForbidden(big.NewInt(0), big.NewInt(1)) },
+		func() { NewNInt([]byte("foo"), 100).WithForbidden(big.NewInt(0)).PermuteInt(0) },
+		func() { NewNInt([]byte("foo"), 100).WithForbidden(big.NewInt(0)).InvertInt(0) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestNewNFromShares(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	share1 := []byte("a random share!!")
+	share2 := make([]byte, len(key))
+	for i := range key {
+		share2[i] = key[i] ^ share1[i]
+	}
+	for _, n := range []*big.Int{big.NewInt(100), big.NewInt(1000), new(big.Int).Lsh(big.NewInt(3), 200)} {
+		p := NewNFromShares(share1, share2, n)
+		expected := NewN(key, n)
+		for i := range int64(100) {
+			out := p.PermuteInPlace(big.NewInt(i), nil)
+			if exp := expected.PermuteInPlace(big.NewInt(i), nil); out.Cmp(exp) != 0 {
+				t.Fatalf("n=%v: PermuteInPlace(%d) = %v, expected %v", n, i, out, exp)
+			}
+		}
+	}
+	if string(share1) != "a random share!!" {
+		t.Error("share was modified")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("shares of different lengths should panic")
+		}
+	}()
+	NewNFromShares(share1, share2[1:], big.NewInt(1000))
+}
+
+func TestRekey(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		rekeyed, want Permutation
+	}{
+		{"FFX", NewFFX([]byte("old"), 16), NewFFX([]byte("new"), 16)},
+		{"FeistelSHAKE128", NewPowerOf2([]byte("old"), 12), NewPowerOf2([]byte("new"), 12)},
+		{
+			"FeistelSHAKE128 with options",
+			NewPowerOf2([]byte("old"), 12).WithSplit(5).WithDomainLabel("label"),
+			NewPowerOf2([]byte("new"), 12).WithSplit(5).WithDomainLabel("label"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Use the old key first so that any cached state is populated.
+			tc.rekeyed.PermuteInPlace(big.NewInt(1), []byte("tweak"))
+			tc.rekeyed.PermuteInt(1)
+			switch p := tc.rekeyed.(type) {
+			case *FFX:
+				p.Rekey([]byte("new"))
+			case *FeistelSHAKE128:
+				p.Rekey([]byte("new"))
+			}
+			for _, tweak := range [][]byte{nil, []byte("tweak")} {
+				for i := range int64(1000) {
+					out := tc.rekeyed.PermuteInPlace(big.NewInt(i), tweak)
+					if expected := tc.want.PermuteInPlace(big.NewInt(i), tweak); out.Cmp(expected) != 0 {
+						t.Fatalf("PermuteInPlace(%d, %q) = %v, expected %v", i, tweak, out, expected)
+					}
+				}
 			}
 		})
 	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("rekeying a PRF permutation should panic")
+		}
+	}()
+	NewPowerOf2PRF(func(in []byte) []byte { return in }, 12).Rekey([]byte("new"))
+}
+
+func TestStringKeyConstructors(t *testing.T) {
+	const key = "pässwörd"
+	for _, tc := range []struct {
+		name             string
+		fromBytes, fromS Permutation
+		n                int
+	}{
+		{"NewN", NewN([]byte(key), big.NewInt(1000)), NewNString(key, big.NewInt(1000)), 1000},
+		{"NewNInt", NewNInt([]byte(key), 1000), NewNIntString(key, 1000), 1000},
+		{"NewFFX", NewFFX([]byte(key), 10), NewFFXString(key, 10), 1 << 10},
+		{"NewPowerOf2", NewPowerOf2([]byte(key), 10), NewPowerOf2String(key, 10), 1 << 10},
+	} {
+		for i := range tc.n {
+			if tc.fromBytes.PermuteInt(i) != tc.fromS.PermuteInt(i) {
+				t.Fatalf("%s: mapping of %d differs between string and byte keys", tc.name, i)
+			}
+		}
+	}
+}
+
+func TestInDomain(t *testing.T) {
+	for _, tc := range []struct {
+		p       Permutation
+		in, out []int64
+	}{
+		{NewNInt([]byte("foo"), 1000), []int64{0, 1, 999}, []int64{-1, 1000, 1024}},
+		{NewFFX([]byte("foo"), 10), []int64{0, 1, 1023}, []int64{-1, 1024}},
+		{NewPowerOf2([]byte("foo"), 3), []int64{0, 7}, []int64{-1, 8}},
+		{NewRangeInclusive([]byte("foo"), big.NewInt(-5), big.NewInt(5)), []int64{-5, 0, 5}, []int64{-6, 6}},
+	} {
+		for _, v := range tc.in {
+			if !tc.p.InDomain(big.NewInt(v)) {
+				t.Errorf("%T: expected %d to be in domain", tc.p, v)
+			}
+		}
+		for _, v := range tc.out {
+			if tc.p.InDomain(big.NewInt(v)) {
+				t.Errorf("%T: expected %d to be outside domain", tc.p, v)
+			}
+		}
+	}
+}
+
+func TestRecommendedRounds(t *testing.T) {
+	for _, tc := range []struct{ lengthBits, rounds int }{
+		{2, 36},
+		{9, 36},
+		{10, 30},
+		{13, 30},
+		{14, 24},
+		{19, 24},
+		{20, 18},
+		{31, 18},
+		{32, 12},
+		{1024, 12},
+	} {
+		if r := RecommendedRounds(tc.lengthBits); r != tc.rounds {
+			t.Errorf("RecommendedRounds(%d) = %d, expected %d", tc.lengthBits, r, tc.rounds)
+		}
+	}
+}
+
+func TestConstructorRounds(t *testing.T) {
+	for _, tc := range []struct{ lengthBits, rounds int }{
+		{8, 36},
+		{9, 36},
+		{10, 30},
+		{13, 30},
+		{14, 24},
+		{19, 24},
+		{20, 18},
+		{31, 18},
+		{32, 12},
+		{128, 12},
+	} {
+		ffx := NewFFX([]byte("foo"), tc.lengthBits)
+		shake := NewPowerOf2([]byte("foo"), tc.lengthBits)
+		if ffx.rounds != tc.rounds {
+			t.Errorf("NewFFX(%d) uses %d rounds, expected %d", tc.lengthBits, ffx.rounds, tc.rounds)
+		}
+		if shake.rounds != tc.rounds {
+			t.Errorf("NewPowerOf2(%d) uses %d rounds, expected %d", tc.lengthBits, shake.rounds, tc.rounds)
+		}
+	}
+}
+
+func TestArbitraryNAlgorithm(t *testing.T) {
+	for _, tc := range []struct {
+		n         *big.Int
+		algorithm string
+		rounds    int
+	}{
+		{big.NewInt(1), AlgoFeistelSHAKE128, 36},
+		{big.NewInt(5), AlgoFeistelSHAKE128, 36},
+		{big.NewInt(128), AlgoFeistelSHAKE128, 36},
+		{big.NewInt(129), AlgoFFX, 36},
+		{big.NewInt(1000), AlgoFFX, 30},
+		{big.NewInt(1 << 20), AlgoFFX, 18},
+		{new(big.Int).Lsh(big.NewInt(1), 128), AlgoFFX, 12},
+		{new(big.Int).Lsh(big.NewInt(1), 150), AlgoFeistelSHAKE128, 12},
+	} {
+		p := NewN([]byte("foo"), tc.n)
+		if p.Algorithm() != tc.algorithm || p.Rounds() != tc.rounds {
+			t.Errorf("n=%v: got %v with %d rounds, expected %v with %d rounds",
+				tc.n, p.Algorithm(), p.Rounds(), tc.algorithm, tc.rounds)
+		}
+	}
 }
 
 func TestPermuteVeryLarge(t *testing.T) {
@@ -54,6 +436,364 @@ func TestPermuteVeryLarge(t *testing.T) {
 			t.Fatalf("found duplicate output %d", out)
 		}
 		seen[out.String()] = i
+		if inv := p.InvertInPlace(out, nil); inv.Cmp(big.NewInt(int64(i))) != 0 {
+			t.Fatalf("%d inverted to %v", i, inv)
+		}
+	}
+}
+
+func TestPermuteIntInDomain(t *testing.T) {
+	p := NewNInt([]byte("foo"), 1000)
+	for _, m := range []int{1, 2, 10, 500, 999, 1000} {
+		seen := make(map[int]int)
+		for i := range m {
+			out := p.PermuteIntInDomain(m, i)
+			if out < 0 || out >= m {
+				t.Fatalf("m=%d: output %d is outside range", m, out)
+			}
+			if other, ok := seen[out]; ok {
+				t.Fatalf("m=%d: %d and %d both map to %d", m, other, i, out)
+			}
+			seen[out] = i
+			if inv := p.InvertIntInDomain(m, out); inv != i {
+				t.Fatalf("m=%d: %d -> %d inverted to %d", m, i, out, inv)
+			}
+			if m == 1000 && out != p.PermuteInt(i) {
+				t.Fatalf("m=n should match PermuteInt")
+			}
+		}
+	}
+	for _, m := range []int{0, 1001} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for m=%d", m)
+				}
+			}()
+			p.PermuteIntInDomain(m, 0)
+		}()
+	}
+}
+
+func TestPermuteBigManyParallel(t *testing.T) {
+	// Make sure the parallel path runs even on a single CPU.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	prf := func(input []byte) []byte {
+		mac := hmac.New(sha256.New, []byte("foo"))
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+	for _, tc := range []struct {
+		name string
+		p    *ArbitraryN
+	}{
+		{"FFX", NewNInt([]byte("foo"), 100000)},
+		{"FeistelSHAKE128", NewNInt([]byte("foo"), 100)},
+		{"FeistelPRF", newArbitraryN(NewPowerOf2PRF(prf, 12), big.NewInt(3000))},
+		{"Threefish", newArbitraryN(NewThreefish([]byte("foo"), 256), new(big.Int).Lsh(big.NewInt(3), 254))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := tc.p.WithParallelThreshold(7)
+			tweak := []byte("tweak")
+			var vals []*big.Int
+			for i := range int64(100) {
+				vals = append(vals, big.NewInt(i))
+			}
+			if err := p.PermuteBigMany(vals, tweak); err != nil {
+				t.Fatal(err)
+			}
+			for i, v := range vals {
+				if expected := p.PermuteInPlace(big.NewInt(int64(i)), tweak); expected.Cmp(v) != 0 {
+					t.Fatalf("value %d: got %v, expected %v", i, v, expected)
+				}
+			}
+			if err := p.InvertBigMany(vals, tweak); err != nil {
+				t.Fatal(err)
+			}
+			for i, v := range vals {
+				if v.Int64() != int64(i) {
+					t.Fatalf("value %d inverted to %v", i, v)
+				}
+			}
+		})
+	}
+}
+
+func TestClone(t *testing.T) {
+	key := []byte("foo")
+	withOption := func(n int64, opt Option) Permutation {
+		p, err := New(key, big.NewInt(n), opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	for _, tc := range []struct {
+		name string
+		p    Permutation
+		n    int
+	}{
+		{"FFX", NewFFX(key, 12), 1 << 12},
+		{"FeistelSHAKE128", NewPowerOf2(key, 11), 1 << 11},
+		{"SwapOrNot", NewSwapOrNot(key, 1000), 1000},
+		{"ArbitraryN", NewNInt(key, 3000), 3000},
+		{"compact", NewNCompact(key, big.NewInt(1<<10+1)), 1<<10 + 1},
+		{"Range", NewRangeInclusive(key, big.NewInt(0), big.NewInt(2999)), 3000},
+		{"table", NewTablePermutation(NewNInt(key, 3000), 3000), 3000},
+		{"PreRotation", withOption(3000, WithPreRotation()), 3000},
+		{"DefaultTweak", withOption(3000, WithDefaultTweak([]byte("default"))), 3000},
+		{"AffineFinalize", withOption(3000, WithAffineFinalize()), 3000},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tweak := []byte("tweak")
+			expected := make([]int, tc.n)
+			for i := range expected {
+				expected[i] = int(tc.p.PermuteInPlace(big.NewInt(int64(i)), tweak).Int64())
+			}
+
+			const goroutines = 8
+			errs := make(chan error, goroutines)
+			var wg sync.WaitGroup
+			for range goroutines {
+				c := tc.p.Clone()
+				wg.Go(func() {
+					seen := make([]bool, tc.n)
+					for i := range tc.n {
+						out := int(c.PermuteInPlace(big.NewInt(int64(i)), tweak).Int64())
+						if out != expected[i] || seen[out] {
+							errs <- fmt.Errorf("clone mapped %d to %d, expected %d", i, out, expected[i])
+							return
+						}
+						seen[out] = true
+						if inv := c.InvertInt(c.PermuteInt(i)); inv != i {
+							errs <- fmt.Errorf("clone inverted %d to %d", i, inv)
+							return
+						}
+					}
+				})
+			}
+			// Keep using the original alongside its clones.
+			for i := range tc.n {
+				tc.p.PermuteInt(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Fatal(err)
+			}
+			if c := tc.p.Clone(); c == tc.p || c.Algorithm() != tc.p.Algorithm() || c.Rounds() != tc.p.Rounds() {
+				t.Errorf("Clone() = %v, expected a distinct copy", c)
+			}
+		})
+	}
+}
+
+func TestPermuteUint64(t *testing.T) {
+	key := []byte("foo")
+	withOption := func(n int64, opt Option) Permutation {
+		p, err := New(key, big.NewInt(n), opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	for _, tc := range []struct {
+		name string
+		p    Permutation
+		n    int
+	}{
+		{"FFX", NewFFX(key, 10), 1 << 10},
+		{"FeistelSHAKE128", NewPowerOf2(key, 10), 1 << 10},
+		{"SwapOrNot", NewSwapOrNot(key, 1000), 1000},
+		{"ArbitraryN", NewNInt(key, 1000), 1000},
+		{"compact", NewNCompact(key, big.NewInt(1<<10+1)), 1<<10 + 1},
+		{"Range", NewRangeInclusive(key, big.NewInt(0), big.NewInt(999)), 1000},
+		{"table", NewTablePermutation(NewNInt(key, 1000), 1000), 1000},
+		{"PreRotation", withOption(1000, WithPreRotation()), 1000},
+		{"DefaultTweak", withOption(1000, WithDefaultTweak([]byte("default"))), 1000},
+		{"AffineFinalize", withOption(1000, WithAffineFinalize()), 1000},
+	} {
+		for i := range tc.n {
+			out := tc.p.PermuteUint64(uint64(i))
+			if out != uint64(tc.p.PermuteInt(i)) {
+				t.Fatalf("%s: PermuteUint64(%d) = %d, PermuteInt gives %d", tc.name, i, out, tc.p.PermuteInt(i))
+			}
+			if inv := tc.p.InvertUint64(out); inv != uint64(i) {
+				t.Fatalf("%s: InvertUint64(%d) = %d, expected %d", tc.name, out, inv, i)
+			}
+		}
+	}
+
+	// Domains wider than 32 bits, as int is on 386 and arm: sample inputs across the
+	// domain, many of them above 2^32.
+	for _, tc := range []struct {
+		name string
+		p    Permutation
+		n    uint64 // 0 for 2^64.
+	}{
+		{"FFX", NewFFX(key, 40), 1 << 40},
+		{"FeistelSHAKE128", NewPowerOf2(key, 40), 1 << 40},
+		{"FeistelSHAKE128/64", NewPowerOf2(key, 64), 0},
+		{"ArbitraryN", NewN(key, big.NewInt(1<<40-12345)), 1<<40 - 12345},
+	} {
+		seen := make(map[uint64]bool)
+		for i := range uint64(1 << 14) {
+			in := i * 0x4000_0001
+			if tc.n != 0 {
+				in %= tc.n
+			} else {
+				in *= 0x9e37_79b9_7f4a_7c15
+			}
+			out := tc.p.PermuteUint64(in)
+			if tc.n != 0 && out >= tc.n {
+				t.Fatalf("%s: PermuteUint64(%d) = %d is out of range", tc.name, in, out)
+			}
+			if seen[out] {
+				t.Fatalf("%s: PermuteUint64(%d) = %d is a duplicate", tc.name, in, out)
+			}
+			seen[out] = true
+			if expected := tc.p.PermuteInPlace(new(big.Int).SetUint64(in), nil); !expected.IsUint64() || expected.Uint64() != out {
+				t.Fatalf("%s: PermuteUint64(%d) = %d, PermuteInPlace gives %v", tc.name, in, out, expected)
+			}
+			if inv := tc.p.InvertUint64(out); inv != in {
+				t.Fatalf("%s: InvertUint64(%d) = %d, expected %d", tc.name, out, inv, in)
+			}
+		}
+	}
+
+	twoTo64 := new(big.Int).Lsh(big.NewInt(1), 64)
+	full := NewN(key, twoTo64)
+	if out := full.PermuteUint64(1<<64 - 1); full.InvertUint64(out) != 1<<64-1 {
+		t.Errorf("round trip of 2^64 - 1 over [0, 2^64) failed")
+	}
+
+	for _, tc := range []struct {
+		name string
+		f    func()
+	}{
+		{"FFX 128 bits", func() { NewFFX(key, 128).PermuteUint64(1) }},
+		{"FFX out of range", func() { NewFFX(key, 40).InvertUint64(1 << 40) }},
+		{"FeistelSHAKE128 65 bits", func() { NewPowerOf2(key, 65).PermuteUint64(1) }},
+		{"Threefish", func() { NewThreefish(key, 256).PermuteUint64(1) }},
+		{"ArbitraryN 2^64 + 1", func() { NewN(key, new(big.Int).Add(twoTo64, big.NewInt(1))).PermuteUint64(1) }},
+		{"ArbitraryN out of range", func() { NewNInt(key, 1000).WithOutOfRange(OutOfRangeError).PermuteUint64(1000) }},
+		{"negative Range", func() { NewRangeInclusive(key, big.NewInt(-10), big.NewInt(-1)).PermuteUint64(1) }},
+		{"table out of range", func() { NewTablePermutation(NewNInt(key, 10), 10).PermuteUint64(1 << 63) }},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected a panic", tc.name)
+				}
+			}()
+			tc.f()
+		}()
+	}
+}
+
+func TestPermuteBigMany(t *testing.T) {
+	n := new(big.Int).Lsh(big.NewInt(1), 150)
+	n.Sub(n, big.NewInt(12345))
+	p := NewN([]byte("foo"), n)
+	tweak := []byte("tweak")
+	var vals []*big.Int
+	for i := range int64(100) {
+		vals = append(vals, big.NewInt(i))
+	}
+	vals = append(vals, new(big.Int).Sub(n, big.NewInt(1)))
+	if err := p.PermuteBigMany(vals, tweak); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for i, v := range vals {
+		expected := big.NewInt(int64(i))
+		if i == 100 {
+			expected.Sub(n, big.NewInt(1))
+		}
+		if p.PermuteInPlace(expected, tweak).Cmp(v) != 0 {
+			t.Fatalf("value %d: got %v, expected %v", i, v, expected)
+		}
+		if seen[v.String()] {
+			t.Fatalf("found duplicate output %v", v)
+		}
+		seen[v.String()] = true
+	}
+	if err := p.InvertBigMany(vals, tweak); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range vals[:100] {
+		if v.Int64() != int64(i) {
+			t.Fatalf("value %d inverted to %v", i, v)
+		}
+	}
+
+	bad := []*big.Int{big.NewInt(1), new(big.Int).Set(n), big.NewInt(2)}
+	if err := p.PermuteBigMany(bad, tweak); err == nil {
+		t.Fatal("expected error for out-of-range value")
+	}
+	if bad[0].Int64() != 1 || bad[2].Int64() != 2 {
+		t.Fatal("PermuteBigMany modified values despite returning an error")
+	}
+}
+
+func TestPermuteManyContext(t *testing.T) {
+	p := NewNInt([]byte("foo"), min(1<<40, math.MaxInt))
+	check := NewNInt([]byte("foo"), min(1<<40, math.MaxInt))
+	tweak := []byte("tweak")
+	in := make([]int, 1<<21)
+	for i := range in {
+		in[i] = i * 3
+	}
+	newOut := func() []int {
+		out := make([]int, len(in))
+		for i := range out {
+			out[i] = -1
+		}
+		return out
+	}
+
+	out := newOut()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	done, err := p.PermuteManyContext(ctx, in, out, tweak)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v after %d values", err, done)
+	}
+	if done == 0 || done == len(in) {
+		t.Fatalf("expected to stop part way, stopped after %d values", done)
+	}
+	for i, v := range out {
+		if i < done && v != int(check.PermuteInPlace(big.NewInt(int64(in[i])), tweak).Int64()) {
+			t.Fatalf("out[%d] = %d is wrong", i, v)
+		}
+		if i >= done && v != -1 {
+			t.Fatalf("out[%d] = %d was modified after cancellation", i, v)
+		}
+	}
+
+	// Run to completion and back.
+	in = in[:1000]
+	out = newOut()[:1000]
+	if done, err := p.PermuteManyContext(context.Background(), in, out, tweak); done != len(in) || err != nil {
+		t.Fatalf("PermuteManyContext = %d, %v", done, err)
+	}
+	inverted := make([]int, len(in))
+	if done, err := p.InvertManyContext(context.Background(), out, inverted, tweak); done != len(in) || err != nil {
+		t.Fatalf("InvertManyContext = %d, %v", done, err)
+	}
+	if !slices.Equal(inverted, in) {
+		t.Fatal("InvertManyContext didn't undo PermuteManyContext")
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if done, err := p.PermuteManyContext(cancelled, in, out, tweak); done != 0 || !errors.Is(err, context.Canceled) {
+		t.Errorf("PermuteManyContext with a cancelled context = %d, %v", done, err)
+	}
+	out = newOut()[:3]
+	if done, err := p.PermuteManyContext(context.Background(), []int{1, min(1<<40, math.MaxInt), 2}, out, tweak); done != 1 || !errors.Is(err, ErrOutOfRange) || out[1] != -1 || out[2] != -1 {
+		t.Errorf("expected ErrOutOfRange at index 1, got %d, %v", done, err)
 	}
 }
 
@@ -70,13 +810,55 @@ func TestPowerOf2PermuteLength(t *testing.T) {
 					t.Fatalf("Found duplicate (length %d) permute %d, %d -> %d", length, i, other, out)
 				}
 				seen[out] = i
+				if inv := p.InvertInt(out); inv != i {
+					t.Fatalf("(length %d) %d -> %d inverted to %d", length, i, out, inv)
+				}
+			}
+		})
+	}
+}
+
+func TestPowerOf2WithSplit(t *testing.T) {
+	for _, tc := range []struct{ length, split int }{
+		{2, 1},
+		{8, 1},
+		{8, 3},
+		{8, 7},
+		{13, 5},
+		{13, 8},
+	} {
+		t.Run(fmt.Sprintf("length %d split %d", tc.length, tc.split), func(t *testing.T) {
+			p := NewPowerOf2([]byte("foo"), tc.length).WithSplit(tc.split)
+			seen := make(map[int]int)
+			for i := 0; i < (1 << tc.length); i++ {
+				out := p.PermuteInt(i)
+				if out < 0 || out >= 1<<tc.length {
+					t.Fatalf("output %d out of range", out)
+				}
+				if other, ok := seen[out]; ok {
+					t.Fatalf("Found duplicate permute %d, %d -> %d", i, other, out)
+				}
+				seen[out] = i
+				if inv := p.InvertInt(out); inv != i {
+					t.Fatalf("%d -> %d inverted to %d", i, out, inv)
+				}
 			}
 		})
 	}
 }
 
+func TestPowerOf2WithSplitDefault(t *testing.T) {
+	p1 := NewPowerOf2([]byte("foo"), 11)
+	p2 := NewPowerOf2([]byte("foo"), 11).WithSplit(5)
+	for i := 0; i < 1<<11; i++ {
+		if p1.PermuteInt(i) != p2.PermuteInt(i) {
+			t.Fatalf("explicit default split changed mapping of %d", i)
+		}
+	}
+}
+
 func TestFFXPermuteLength(t *testing.T) {
-	for length := 8; length <= 18; length++ {
+	for length := 2; length <= 18; length++ {
 		t.Run(fmt.Sprintf("length %d", length), func(t *testing.T) {
 			t.Parallel()
 			t.Log("length", length)
@@ -88,35 +870,316 @@ func TestFFXPermuteLength(t *testing.T) {
 					t.Fatalf("Found duplicate (length %d) permute %d, %d -> %d", length, i, other, out)
 				}
 				seen[out] = i
+				if inv := p.InvertInt(out); inv != i {
+					t.Fatalf("(length %d) %d -> %d inverted to %d", length, i, out, inv)
+				}
 			}
 		})
 	}
 }
 
-func TestPermuteKey(t *testing.T) {
-	const length = 16
-	t.Log("length", length)
-	p1 := NewPowerOf2([]byte("foo"), length)
-	p2 := NewPowerOf2([]byte("bar"), length)
+func TestPowerOf2Golden(t *testing.T) {
+	// Pinned outputs; these must never change since callers may have stored permuted values.
+	for _, tc := range []struct {
+		lengthBits int
+		tweak      string
+		out        string
+	}{
+		{2, "", "3"},
+		{2, "tweak", "2"},
+		{5, "", "17"},
+		{5, "tweak", "20"},
+		{16, "", "46349"},
+		{16, "tweak", "48796"},
+		{33, "", "1446247898"},
+		{33, "tweak", "1931169996"},
+		{150, "", "1123948842106688435247573537232150720059564772"},
+		{150, "tweak", "1052761661989955490732550682920401289215995766"},
+	} {
+		p := NewPowerOf2([]byte("foo"), tc.lengthBits)
+		var tweak []byte
+		if tc.tweak != "" {
+			tweak = []byte(tc.tweak)
+		}
+		out := p.PermuteInPlace(big.NewInt(3), tweak)
+		if out.String() != tc.out {
+			t.Errorf("lengthBits=%d tweak=%q: got %v, expected %v", tc.lengthBits, tc.tweak, out, tc.out)
+		}
+	}
+}
+
+func TestFFXGolden(t *testing.T) {
+	// Pinned outputs; these must never change since callers may have stored permuted values.
+	for _, tc := range []struct {
+		lengthBits int
+		tweak      string
+		out        string
+	}{
+		{8, "", "21"},
+		{8, "tweak", "130"},
+		{8, "a tweak that is longer than sixteen bytes", "3"},
+		{9, "", "339"},
+		{9, "tweak", "383"},
+		{9, "a tweak that is longer than sixteen bytes", "127"},
+		{16, "", "4776"},
+		{16, "tweak", "6567"},
+		{16, "a tweak that is longer than sixteen bytes", "35991"},
+		{33, "", "7292972757"},
+		{33, "tweak", "7910262271"},
+		{33, "a tweak that is longer than sixteen bytes", "7935957351"},
+		{64, "", "15795449093543863438"},
+		{64, "tweak", "18373988388966645132"},
+		{64, "a tweak that is longer than sixteen bytes", "770586703048646374"},
+		{65, "", "19445175985802409396"},
+		{65, "tweak", "29737462776157870463"},
+		{65, "a tweak that is longer than sixteen bytes", "19387232435223067364"},
+		{100, "", "1212629888140402026479029185860"},
+		{100, "tweak", "651417819489494976497358401507"},
+		{100, "a tweak that is longer than sixteen bytes", "891403663742901363430985042677"},
+		{128, "", "283194021680599004791808018038638694825"},
+		{128, "tweak", "290134361801723924948830664718010739598"},
+		{128, "a tweak that is longer than sixteen bytes", "307804138606003383863945537586139762226"},
+	} {
+		p := NewFFX([]byte("foo"), tc.lengthBits)
+		var tweak []byte
+		if tc.tweak != "" {
+			tweak = []byte(tc.tweak)
+		}
+		out := p.PermuteInPlace(big.NewInt(3), tweak)
+		if out.String() != tc.out {
+			t.Errorf("lengthBits=%d tweak=%q: got %v, expected %v", tc.lengthBits, tc.tweak, out, tc.out)
+		}
+	}
+}
+
+func TestFFXTweakLengthCache(t *testing.T) {
+	// Interleave tweak lengths on one instance, which reuses encryptedP when the tweak
+	// length is unchanged, and check against a fresh instance every time.
+	tweaks := [][]byte{nil, []byte("a"), []byte("a"), nil, []byte("bb"), []byte("cc"),
+		[]byte("a"), make([]byte, 100), nil, []byte("d")}
+	p := NewFFX([]byte("foo"), 20)
+	for round := range 3 {
+		for i, tweak := range tweaks {
+			in := int64(round*len(tweaks) + i)
+			expected := NewFFX([]byte("foo"), 20).PermuteInPlace(big.NewInt(in), tweak)
+			if out := p.PermuteInPlace(big.NewInt(in), tweak); out.Cmp(expected) != 0 {
+				t.Fatalf("tweak %d: got %v, expected %v", i, out, expected)
+			}
+			if inv := p.InvertInPlace(expected, tweak); inv.Int64() != in {
+				t.Fatalf("tweak %d: inverted to %v, expected %d", i, inv, in)
+			}
+		}
+	}
+}
+
+func TestPowerOf2DomainLabel(t *testing.T) {
+	const length = 12
+	unlabeled := NewPowerOf2([]byte("foo"), length)
+	empty := NewPowerOf2([]byte("foo"), length).WithDomainLabel("")
+	a := NewPowerOf2([]byte("foo"), length).WithDomainLabel("a")
+	a2 := NewPowerOf2([]byte("foo"), length).WithDomainLabel("a")
+	b := NewPowerOf2([]byte("foo"), length).WithDomainLabel("b")
+	numCollisions := map[string]int{}
+	for i := 0; i < (1 << length); i++ {
+		out := a.PermuteInt(i)
+		if out != a2.PermuteInt(i) {
+			t.Fatalf("same label gave different mappings for %d", i)
+		}
+		if a.InvertInt(out) != i {
+			t.Fatalf("%d -> %d didn't invert", i, out)
+		}
+		if out == b.PermuteInt(i) {
+			numCollisions["a/b"]++
+		}
+		if out == unlabeled.PermuteInt(i) {
+			numCollisions["a/unlabeled"]++
+		}
+		if empty.PermuteInt(i) == unlabeled.PermuteInt(i) {
+			numCollisions["empty/unlabeled"]++
+		}
+	}
+	t.Log("NumCollisions", numCollisions)
+	for pair, n := range numCollisions {
+		if n > 10 {
+			t.Errorf("Too many collisions for %s: %d", pair, n)
+		}
+	}
+}
+
+func TestPowerOf2PRF(t *testing.T) {
+	// Mock HSM: the key is only visible inside the closure.
+	hsm := func(key []byte) PRF {
+		return func(input []byte) []byte {
+			mac := hmac.New(sha256.New, key)
+			mac.Write(input)
+			return mac.Sum(nil)
+		}
+	}
+	for _, length := range []int{2, 7, 12} {
+		p := NewPowerOf2PRF(hsm([]byte("secret")), length)
+		if p.key != nil {
+			t.Fatal("PRF-based permutation has a key")
+		}
+		if p.Algorithm() != AlgoFeistelPRF {
+			t.Fatalf("unexpected algorithm %v", p.Algorithm())
+		}
+		seen := make(map[int]int)
+		for i := 0; i < (1 << length); i++ {
+			out := p.PermuteInt(i)
+			if other, ok := seen[out]; ok {
+				t.Fatalf("Found duplicate (length %d) permute %d, %d -> %d", length, i, other, out)
+			}
+			seen[out] = i
+			if inv := p.InvertInt(out); inv != i {
+				t.Fatalf("(length %d) %d -> %d inverted to %d", length, i, out, inv)
+			}
+		}
+	}
+
+	// Different HSM keys give independent permutations.
+	const length = 12
+	p1 := NewPowerOf2PRF(hsm([]byte("secret")), length)
+	p2 := NewPowerOf2PRF(hsm([]byte("other")), length)
 	numCollisions := 0
 	for i := 0; i < (1 << length); i++ {
 		if p1.PermuteInt(i) == p2.PermuteInt(i) {
 			numCollisions++
-			t.Log("collision", i, "->", p2.PermuteInt(i))
 		}
 	}
-	t.Log("NumCollisions", numCollisions)
 	if numCollisions > 10 {
-		t.Fatal("Too many collisions")
+		t.Fatalf("Too many collisions: %d", numCollisions)
 	}
 }
 
-func BenchmarkPermutation_PermuteInt(b *testing.B) {
-	b.ReportAllocs()
-	p := NewPowerOf2([]byte("foobarbaz"), 16)
-	for b.Loop() {
-		p.PermuteInt(1234)
-	}
+func TestFFXRoundFunc(t *testing.T) {
+	for _, length := range []int{8, 9, 16, 33, 64, 65, 128} {
+		p := NewFFX([]byte("foo"), length)
+		other := NewFFX([]byte("foo"), length)
+		split := length / 2
+		for _, tweak := range [][]byte{nil, []byte("tweak"), make([]byte, 20)} {
+			in := big.NewInt(12345)
+			if length == 8 {
+				in.SetInt64(123)
+			}
+			var mask big.Int
+			mask.Lsh(big.NewInt(1), uint(length-split)).Sub(&mask, big.NewInt(1))
+			b := new(big.Int).And(in, &mask).Uint64()
+			a := new(big.Int).Rsh(in, uint(length-split)).Uint64()
+			for i := range p.Rounds() {
+				// Interleave calls with a different tweak, which mustn't affect the result.
+				p.RoundFunc(i, b, []byte("unrelated"))
+				a, b = b, a^p.RoundFunc(i, b, tweak)
+			}
+			out := new(big.Int).Lsh(new(big.Int).SetUint64(a), uint(length-split))
+			out.Or(out, new(big.Int).SetUint64(b))
+			expected := other.PermuteInPlace(in, tweak)
+			if out.Cmp(expected) != 0 {
+				t.Errorf("length %d tweak %q: RoundFunc schedule gave %v, PermuteInPlace gave %v",
+					length, tweak, out, expected)
+			}
+		}
+	}
+}
+
+func TestFFXUint64Path(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for length := 8; length <= 64; length++ {
+		p := NewFFX([]byte("foo"), length)
+		for range 100 {
+			in := rng.Uint64() >> (64 - length)
+			expected := p.PermuteInPlace(new(big.Int).SetUint64(in), nil)
+			if out := p.PermuteUint64(in); out != expected.Uint64() {
+				t.Fatalf("length %d: PermuteUint64(%d) = %d, big.Int path gives %v", length, in, out, expected)
+			}
+			if inv := p.InvertUint64(expected.Uint64()); inv != in {
+				t.Fatalf("length %d: InvertUint64(%v) = %d, expected %d", length, expected, inv, in)
+			}
+			// Values only fit in an int below its sign bit.
+			if length >= strconv.IntSize {
+				continue
+			}
+			if out := p.PermuteInt(int(in)); uint64(out) != expected.Uint64() {
+				t.Fatalf("length %d: PermuteInt(%d) = %d, big.Int path gives %v", length, in, out, expected)
+			}
+			if inv := p.InvertInt(int(expected.Uint64())); uint64(inv) != in {
+				t.Fatalf("length %d: InvertInt(%v) = %d, expected %d", length, expected, inv, in)
+			}
+		}
+	}
+}
+
+func TestPermuteKey(t *testing.T) {
+	const length = 16
+	t.Log("length", length)
+	p1 := NewPowerOf2([]byte("foo"), length)
+	p2 := NewPowerOf2([]byte("bar"), length)
+	numCollisions := 0
+	for i := 0; i < (1 << length); i++ {
+		if p1.PermuteInt(i) == p2.PermuteInt(i) {
+			numCollisions++
+			t.Log("collision", i, "->", p2.PermuteInt(i))
+		}
+	}
+	t.Log("NumCollisions", numCollisions)
+	if numCollisions > 10 {
+		t.Fatal("Too many collisions")
+	}
+}
+
+func BenchmarkPermutation_PermuteInt(b *testing.B) {
+	b.ReportAllocs()
+	p := NewPowerOf2([]byte("foobarbaz"), 16)
+	for b.Loop() {
+		p.PermuteInt(1234)
+	}
+}
+
+func BenchmarkPermutation_PermuteIntSmall(b *testing.B) {
+	b.ReportAllocs()
+	p := NewPowerOf2([]byte("foobarbaz"), 4)
+	for b.Loop() {
+		p.PermuteInt(5)
+	}
+}
+
+func BenchmarkArbitraryN_PermuteIntPowerOf2(b *testing.B) {
+	b.ReportAllocs()
+	p := NewNInt([]byte("foobarbaz"), 1<<16)
+	for b.Loop() {
+		p.PermuteInt(1234)
+	}
+}
+
+func BenchmarkArbitraryN_PermuteIntGeneral(b *testing.B) {
+	b.ReportAllocs()
+	// Same block permutation as above but without the power-of-2 fast path.
+	p := NewNInt([]byte("foobarbaz"), 1<<16)
+	p.exact = false
+	for b.Loop() {
+		p.PermuteInt(1234)
+	}
+}
+
+func BenchmarkArbitraryN_PermuteBigMany(b *testing.B) {
+	for _, size := range []int{64, 512, 4096, 32768} {
+		for _, threshold := range []int{0, DefaultParallelThreshold} {
+			b.Run(fmt.Sprintf("size=%d/threshold=%d", size, threshold), func(b *testing.B) {
+				p := NewNInt([]byte("foobarbaz"), 1000000).WithParallelThreshold(threshold)
+				vals := make([]*big.Int, size)
+				for i := range vals {
+					vals[i] = big.NewInt(int64(i))
+				}
+				for b.Loop() {
+					for i, v := range vals {
+						v.SetInt64(int64(i))
+					}
+					if err := p.PermuteBigMany(vals, nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
 }
 
 func BenchmarkFFX_PermuteInt(b *testing.B) {
@@ -126,3 +1189,1153 @@ func BenchmarkFFX_PermuteInt(b *testing.B) {
 		p.PermuteInt(1234)
 	}
 }
+
+func BenchmarkFFX_PermuteIntSlice(b *testing.B) {
+	b.ReportAllocs()
+	p := NewFFX([]byte("foobarbaz"), 16)
+	vals := make([]int, 1024)
+	for b.Loop() {
+		for i := range vals {
+			vals[i] = i
+		}
+		p.PermuteIntSlice(vals)
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(vals)), "ns/value")
+}
+
+func BenchmarkFFX_PermuteIntLoop(b *testing.B) {
+	b.ReportAllocs()
+	var p Permutation = NewFFX([]byte("foobarbaz"), 16)
+	vals := make([]int, 1024)
+	for b.Loop() {
+		for i := range vals {
+			vals[i] = p.PermuteInt(i)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(vals)), "ns/value")
+}
+
+func TestPermuteIntSlice(t *testing.T) {
+	for _, lengthBits := range []int{8, 20, 63, 64, 100} {
+		p := NewFFX([]byte("foo"), lengthBits)
+		vals := make([]int, 200)
+		for i := range vals {
+			vals[i] = i * 7919
+		}
+		out := p.PermuteIntSlice(slices.Clone(vals))
+		for i, v := range vals {
+			if expected := p.PermuteInt(v); out[i] != expected {
+				t.Fatalf("%d bits: PermuteIntSlice gave %d for %d, PermuteInt gives %d", lengthBits, out[i], v, expected)
+			}
+		}
+		if lengthBits < 63 {
+			if inv := p.InvertIntSlice(slices.Clone(out)); !slices.Equal(inv, vals) {
+				t.Fatalf("%d bits: InvertIntSlice didn't restore the values", lengthBits)
+			}
+		}
+
+		tweak := []byte("tweak")
+		bigVals := make([]*big.Int, len(vals))
+		for i, v := range vals {
+			bigVals[i] = big.NewInt(int64(v))
+		}
+		p.PermuteInPlaceSlice(bigVals, tweak)
+		for i, v := range vals {
+			if expected := p.PermuteInPlace(big.NewInt(int64(v)), tweak); bigVals[i].Cmp(expected) != 0 {
+				t.Fatalf("%d bits: PermuteInPlaceSlice gave %v for %d, expected %v", lengthBits, bigVals[i], v, expected)
+			}
+		}
+		p.InvertInPlaceSlice(bigVals, tweak)
+		for i, v := range vals {
+			if bigVals[i].Int64() != int64(v) {
+				t.Fatalf("%d bits: InvertInPlaceSlice gave %v, expected %d", lengthBits, bigVals[i], v)
+			}
+		}
+	}
+
+	for _, n := range []int{1000, 1<<20 + 1} {
+		p := NewNInt([]byte("foo"), n)
+		vals := make([]int, 500)
+		for i := range vals {
+			vals[i] = i * 997 % n
+		}
+		out := p.PermuteIntSlice(slices.Clone(vals))
+		for i, v := range vals {
+			if expected := p.PermuteInt(v); out[i] != expected {
+				t.Fatalf("n=%d: PermuteIntSlice gave %d for %d, PermuteInt gives %d", n, out[i], v, expected)
+			}
+		}
+		if inv := p.InvertIntSlice(out); !slices.Equal(inv, vals) {
+			t.Fatalf("n=%d: InvertIntSlice didn't restore the values", n)
+		}
+	}
+	p := NewNInt([]byte("foo"), 1000).WithOutOfRange(OutOfRangeError)
+	if out := p.PermuteIntSlice([]int{1, 1000, 2}); out[1] != -1 || out[0] != p.PermuteInt(1) || out[2] != p.PermuteInt(2) {
+		t.Errorf("PermuteIntSlice with an out-of-range value gave %v", out)
+	}
+
+	ffx := NewFFX([]byte("foo"), 20)
+	vals := make([]int, 4096)
+	if allocs := testing.AllocsPerRun(10, func() { ffx.PermuteIntSlice(vals) }); allocs != 0 {
+		t.Errorf("FFX.PermuteIntSlice made %v allocations", allocs)
+	}
+	n := NewNInt([]byte("foo"), 1<<20)
+	if allocs := testing.AllocsPerRun(10, func() { n.PermuteIntSlice(vals) }); allocs != 0 {
+		t.Errorf("ArbitraryN.PermuteIntSlice made %v allocations", allocs)
+	}
+}
+
+func TestConstructorErrors(t *testing.T) {
+	key := []byte("foo")
+	for _, tc := range []struct {
+		name string
+		new  func() error
+		// panics is the panicking constructor with the same arguments.
+		panics func()
+	}{
+		{"FFX 1 bit", func() error { _, err := NewFFXErr(key, 1); return err }, func() { NewFFX(key, 1) }},
+		{"FFX 129 bits", func() error { _, err := NewFFXErr(key, 129); return err }, func() { NewFFX(key, 129) }},
+		{"FFX -1 bits", func() error { _, err := NewFFXErr(key, -1); return err }, func() { NewFFX(key, -1) }},
+		{"PowerOf2 1 bit", func() error { _, err := NewPowerOf2Err(key, 1); return err }, func() { NewPowerOf2(key, 1) }},
+		{"PowerOf2 0 bits", func() error { _, err := NewPowerOf2Err(key, 0); return err }, func() { NewPowerOf2(key, 0) }},
+		{"N 0", func() error { _, err := NewNErr(key, big.NewInt(0)); return err }, func() { NewN(key, big.NewInt(0)) }},
+		{"N -5", func() error { _, err := NewNErr(key, big.NewInt(-5)); return err }, func() { NewNInt(key, -5) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.new()
+			if !errors.Is(err, ErrInvalidParameter) {
+				t.Fatalf("expected an error wrapping ErrInvalidParameter, got %v", err)
+			}
+			func() {
+				defer func() {
+					if r := recover(); r != err.Error() {
+						t.Errorf("panicking constructor gave %v, expected %q", r, err.Error())
+					}
+				}()
+				tc.panics()
+			}()
+		})
+	}
+
+	// Valid parameters give the same permutations as the panicking constructors.
+	ffx, err := NewFFXErr(key, 20)
+	if err != nil || ffx.PermuteInt(12345) != NewFFX(key, 20).PermuteInt(12345) {
+		t.Errorf("NewFFXErr: %v", err)
+	}
+	shake, err := NewPowerOf2Err(key, 5)
+	if err != nil || shake.PermuteInt(17) != NewPowerOf2(key, 5).PermuteInt(17) {
+		t.Errorf("NewPowerOf2Err: %v", err)
+	}
+	for _, n := range []int64{1, 5, 1000, 1 << 40} {
+		p, err := NewNErr(key, big.NewInt(n))
+		if err != nil {
+			t.Fatalf("NewNErr(%d): %v", n, err)
+		}
+		expected := NewN(key, big.NewInt(n))
+		if p.Algorithm() != expected.Algorithm() || p.PermuteInPlace(big.NewInt(0), nil).Cmp(expected.PermuteInPlace(big.NewInt(0), nil)) != 0 {
+			t.Errorf("NewNErr(%d) differs from NewN", n)
+		}
+	}
+}
+
+func TestNewNWithBits(t *testing.T) {
+	key := []byte("foo")
+	for _, tc := range []struct{ n, bits int }{{1, 2}, {2, 5}, {100, 7}, {100, 12}, {1000, 16}, {1 << 16, 16}, {50000, 20}} {
+		t.Run(fmt.Sprintf("%d/%d", tc.n, tc.bits), func(t *testing.T) {
+			n := big.NewInt(int64(tc.n))
+			p := NewNWithBits(key, n, tc.bits)
+			checkN := min(tc.n, 1000)
+			seen := make(map[int]bool, checkN)
+			for i := range checkN {
+				out := p.PermuteInt(i)
+				if out < 0 || out >= tc.n || seen[out] {
+					t.Fatalf("PermuteInt(%d) = %d is out of range or a duplicate", i, out)
+				}
+				seen[out] = true
+				if inv := p.InvertInt(out); inv != i {
+					t.Fatalf("InvertInt(%d) = %d, expected %d", out, inv, i)
+				}
+			}
+			// The minimum width is NewN; wider blocks give a different mapping that
+			// cycle-walks the wider block.
+			plain := NewN(key, n)
+			if tc.bits == domainBitLen(n) {
+				for i := range checkN {
+					if p.PermuteInt(i) != plain.PermuteInt(i) {
+						t.Fatalf("PermuteInt(%d) differs from NewN at the minimum width", i)
+					}
+				}
+			} else if tc.n >= 100 {
+				block := newBlockPermutation(key, tc.bits)
+				expected, _ := cycleWalk(block.PermuteInPlace, n, big.NewInt(7), nil)
+				if out := p.PermuteInt(7); out != int(expected.Int64()) {
+					t.Errorf("PermuteInt(7) = %d, expected %v from the %d-bit block", out, expected, tc.bits)
+				}
+			}
+		})
+	}
+	// At the widest allowed block only construction is checked; each call would take
+	// about 2^16 block iterations.
+	for _, tc := range []struct{ n, bits int }{{1, 2 + maxExtraBlockBits}, {100, 7 + maxExtraBlockBits}} {
+		if p := NewNWithBits(key, big.NewInt(int64(tc.n)), tc.bits); p.blockN.BitLen() != tc.bits+1 {
+			t.Errorf("n=%d, bits=%d: block covers %v values", tc.n, tc.bits, &p.blockN)
+		}
+	}
+	for _, tc := range []struct{ n, bits int }{
+		{0, 8}, {1, 1}, {100, 6}, {257, 8}, {1, 3 + maxExtraBlockBits}, {100, 8 + maxExtraBlockBits}, {100, 1 << 20},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for n=%d, bits=%d", tc.n, tc.bits)
+				}
+			}()
+			NewNWithBits(key, big.NewInt(int64(tc.n)), tc.bits)
+		}()
+	}
+}
+
+func TestNewRadixExp(t *testing.T) {
+	key := []byte("foo")
+	for _, tc := range []struct {
+		radix, exponent int
+		n               string
+		// radixBlock is whether NewRadixExp uses FFXRadix rather than NewN.
+		radixBlock bool
+	}{
+		{10, 3, "1000", true},
+		{10, 20, "100000000000000000000", true},
+		{2, 10, "1024", false},
+		{36, 5, "60466176", true},
+		{10, 1, "10", false},
+		{10, 60, "1" + strings.Repeat("0", 60), false},
+		{256, 3, "16777216", false},
+	} {
+		n, _ := new(big.Int).SetString(tc.n, 10)
+		p := NewRadixExp(key, tc.radix, tc.exponent)
+		var expected Permutation = NewN(key, n)
+		if tc.radixBlock {
+			expected = NewFFXRadix(key, tc.radix, tc.exponent)
+		}
+		if p.n.Cmp(n) != 0 {
+			t.Fatalf("NewRadixExp(%v, %v) has domain %v, expected %v", tc.radix, tc.exponent, &p.n, n)
+		}
+		if p.Algorithm() != expected.Algorithm() {
+			t.Errorf("NewRadixExp(%v, %v) uses %v, expected %v", tc.radix, tc.exponent, p.Algorithm(), expected.Algorithm())
+		}
+		for i := range int64(10) {
+			out := p.PermuteInPlace(big.NewInt(i), nil)
+			if e := expected.PermuteInPlace(big.NewInt(i), nil); out.Cmp(e) != 0 {
+				t.Fatalf("NewRadixExp(%v, %v) mapped %v to %v, expected %v", tc.radix, tc.exponent, i, out, e)
+			}
+			if inv := p.InvertInPlace(out, nil); inv.Int64() != i {
+				t.Fatalf("NewRadixExp(%v, %v) inverted %v to %v", tc.radix, tc.exponent, out, inv)
+			}
+		}
+	}
+
+	for _, args := range [][2]int{{1, 5}, {0, 5}, {-10, 5}, {10, 0}, {10, -1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for NewRadixExp(%v, %v)", args[0], args[1])
+				}
+			}()
+			NewRadixExp(key, args[0], args[1])
+		}()
+	}
+}
+
+func TestFeistelSHAKE128Uint64Path(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	prf := func(input []byte) []byte {
+		mac := hmac.New(sha256.New, []byte("foo"))
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+	for length := 2; length <= 64; length++ {
+		for _, p := range []*FeistelSHAKE128{
+			NewPowerOf2([]byte("foo"), length),
+			NewPowerOf2([]byte("foo"), length).WithSplit(1),
+			NewPowerOf2([]byte("foo"), length).WithDomainLabel("label"),
+			NewPowerOf2PRF(prf, length),
+		} {
+			for i := range 20 {
+				in := rng.Uint64() >> (64 - length)
+				var tweak []byte
+				if i%2 == 1 {
+					tweak = []byte("tweak")
+				}
+				expected := p.PermuteInPlace(new(big.Int).SetUint64(in), tweak)
+				if out := p.permuteUint64(in, tweak); out != expected.Uint64() {
+					t.Fatalf("length %d: permuteUint64(%d, %q) = %d, big.Int path gives %v", length, in, tweak, out, expected)
+				}
+				if inv := p.invertUint64(expected.Uint64(), tweak); inv != in {
+					t.Fatalf("length %d: invertUint64(%v, %q) = %d, expected %d", length, expected, tweak, inv, in)
+				}
+				if tweak == nil && p.PermuteUint64(in) != expected.Uint64() {
+					t.Fatalf("length %d: PermuteUint64(%d) = %d, big.Int path gives %v", length, in, p.PermuteUint64(in), expected)
+				}
+				// Values only fit in an int below its sign bit.
+				if length >= strconv.IntSize {
+					continue
+				}
+				if out := p.PermuteIntTweak(int(in), tweak); uint64(out) != expected.Uint64() {
+					t.Fatalf("length %d: PermuteIntTweak(%d, %q) = %d, big.Int path gives %v", length, in, tweak, out, expected)
+				}
+				if inv := p.InvertIntTweak(int(expected.Uint64()), tweak); uint64(inv) != in {
+					t.Fatalf("length %d: InvertIntTweak(%v, %q) = %d, expected %d", length, expected, tweak, inv, in)
+				}
+			}
+		}
+	}
+
+	p := NewPowerOf2([]byte("foobarbaz"), 16)
+	p.PermuteIntTweak(1234, []byte("tweak"))
+	if allocs := testing.AllocsPerRun(10, func() { p.PermuteInt(1234) }); allocs != 0 {
+		t.Errorf("PermuteInt allocated %v times", allocs)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { p.PermuteIntTweak(1234, []byte("tweak")) }); allocs != 0 {
+		t.Errorf("PermuteIntTweak allocated %v times", allocs)
+	}
+}
+
+func TestNewFromSamples(t *testing.T) {
+	p := NewFromSamples([]byte("foo"), []int{17, 999, 0, 3, 999, 512})
+	if p.n.Cmp(big.NewInt(1000)) != 0 {
+		t.Fatalf("expected domain 1000, got %v", &p.n)
+	}
+	seen := make(map[int]bool)
+	for i := range 1000 {
+		out := p.PermuteInt(i)
+		if out < 0 || out >= 1000 || seen[out] {
+			t.Fatalf("PermuteInt(%d) = %d is out of range or a duplicate", i, out)
+		}
+		seen[out] = true
+		if inv := p.InvertInt(out); inv != i {
+			t.Fatalf("%d -> %d inverted to %d", i, out, inv)
+		}
+	}
+	if p := NewFromSamples([]byte("foo"), []int{0}); p.n.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("expected domain 1 for samples {0}, got %v", &p.n)
+	}
+
+	for _, samples := range [][]int{nil, {}, {3, -1, 5}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for samples %v", samples)
+				}
+			}()
+			NewFromSamples([]byte("foo"), samples)
+		}()
+	}
+}
+
+func TestWithOutOfRange(t *testing.T) {
+	key := []byte("foo")
+	expectPanic := func(name string, f func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s: expected panic", name)
+			}
+		}()
+		f()
+	}
+
+	p := NewNInt(key, 1000)
+	expectPanic("default PermuteInt", func() { p.PermuteInt(1000) })
+	p.WithOutOfRange(OutOfRangePanic)
+	expectPanic("OutOfRangePanic PermuteInt", func() { p.PermuteInt(1000) })
+	expectPanic("OutOfRangePanic InvertInPlace", func() { p.InvertInPlace(big.NewInt(5000), nil) })
+	expectPanic("OutOfRangePanic negative PermuteInt", func() { p.PermuteInt(-1) })
+	expectPanic("OutOfRangePanic negative InvertInPlace", func() { p.InvertInPlace(big.NewInt(-5), nil) })
+
+	p = NewNInt(key, 1000).WithOutOfRange(OutOfRangeError)
+	if out := p.PermuteInt(1000); out != -1 {
+		t.Errorf("OutOfRangeError: PermuteInt(1000) = %d, expected -1", out)
+	}
+	if out := p.InvertInt(1234); out != -1 {
+		t.Errorf("OutOfRangeError: InvertInt(1234) = %d, expected -1", out)
+	}
+	if out := p.PermuteInt(-1); out != -1 {
+		t.Errorf("OutOfRangeError: PermuteInt(-1) = %d, expected -1", out)
+	}
+	if out := p.InvertInt(-1000); out != -1 {
+		t.Errorf("OutOfRangeError: InvertInt(-1000) = %d, expected -1", out)
+	}
+	in := big.NewInt(1000)
+	if out := p.PermuteInPlace(in, nil); out != nil || in.Int64() != 1000 {
+		t.Errorf("OutOfRangeError: PermuteInPlace(1000) = %v, input now %v", out, in)
+	}
+	if out, expected := p.PermuteInt(42), NewNInt(key, 1000).PermuteInt(42); out != expected {
+		t.Errorf("OutOfRangeError: PermuteInt(42) = %d, expected %d", out, expected)
+	}
+	p.WithForbidden(big.NewInt(7))
+	if out := p.PermuteInt(7); out != -1 {
+		t.Errorf("OutOfRangeError: PermuteInt of forbidden value = %d, expected -1", out)
+	}
+
+	p = NewNInt(key, 1000).WithOutOfRange(OutOfRangeWrapMod)
+	plain := NewNInt(key, 1000)
+	for _, in := range []int{0, 42, 999, 1000, 1042, 123456, -1, -958} {
+		wrapped := ((in % 1000) + 1000) % 1000
+		if out, expected := p.PermuteInt(in), plain.PermuteInt(wrapped); out != expected {
+			t.Errorf("OutOfRangeWrapMod: PermuteInt(%d) = %d, expected PermuteInt(%d) = %d", in, out, wrapped, expected)
+		}
+		if out := p.InvertInt(p.PermuteInt(in)); out != wrapped {
+			t.Errorf("OutOfRangeWrapMod: %d inverted to %d, expected %d", in, out, wrapped)
+		}
+	}
+	if _, err := p.TryPermuteInPlace(big.NewInt(1000), nil); err == nil {
+		t.Error("OutOfRangeWrapMod: expected TryPermuteInPlace to still return an error")
+	}
+
+	expectPanic("unknown mode", func() { NewNInt(key, 1000).WithOutOfRange(OutOfRangeMode(3)) })
+}
+
+// TestPowerOf2Long samples FeistelSHAKE128 at lengths far beyond those that can be tested
+// exhaustively, including odd lengths and splits that need the final-byte mask.
+func TestPowerOf2Long(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, length := range []int{129, 256, 257, 511, 512, 1023, 1024, 4099} {
+		for _, p := range []*FeistelSHAKE128{
+			NewPowerOf2([]byte("foo"), length),
+			NewPowerOf2([]byte("foo"), length).WithSplit(3),
+		} {
+			limit := new(big.Int).Lsh(big.NewInt(1), uint(length))
+			inputs := []*big.Int{big.NewInt(0), new(big.Int).Sub(limit, big.NewInt(1))}
+			for range 50 {
+				buf := make([]byte, (length+7)/8)
+				for i := range buf {
+					buf[i] = byte(rng.Uint32())
+				}
+				inputs = append(inputs, new(big.Int).Mod(new(big.Int).SetBytes(buf), limit))
+			}
+			seen := make(map[string]bool)
+			for _, in := range inputs {
+				for _, tweak := range [][]byte{nil, []byte("tweak")} {
+					out := p.PermuteInPlace(new(big.Int).Set(in), tweak)
+					if out.Sign() < 0 || out.Cmp(limit) >= 0 {
+						t.Fatalf("length %d: output %v out of range", length, out)
+					}
+					if seen[string(tweak)+out.String()] {
+						t.Fatalf("length %d: duplicate output %v", length, out)
+					}
+					seen[string(tweak)+out.String()] = true
+					if inv := p.InvertInPlace(new(big.Int).Set(out), tweak); inv.Cmp(in) != 0 {
+						t.Fatalf("length %d: %v -> %v inverted to %v", length, in, out, inv)
+					}
+				}
+			}
+			// The output depends on the top and bottom bits of the input.
+			base := p.PermuteInPlace(big.NewInt(0), nil)
+			for _, bit := range []int{0, length - 1} {
+				if p.PermuteInPlace(new(big.Int).SetBit(new(big.Int), bit, 1), nil).Cmp(base) == 0 {
+					t.Fatalf("length %d: flipping bit %d didn't change the output", length, bit)
+				}
+			}
+
+			// Memory use is bounded: after the first call there are no allocations beyond
+			// the big.Int's own words.
+			v := new(big.Int).Set(inputs[2])
+			allocs := testing.AllocsPerRun(20, func() {
+				p.PermuteInPlace(v, []byte("tweak"))
+				p.InvertInPlace(v, []byte("tweak"))
+			})
+			if allocs > 0 {
+				t.Errorf("length %d: %v allocations per round trip", length, allocs)
+			}
+		}
+	}
+}
+
+func TestFeistelSHAKE128Scratch(t *testing.T) {
+	for _, length := range []int{2, 16, 17, 100} {
+		p := NewPowerOf2([]byte("foo"), length)
+		if p.ScratchLen() != (length+7)/8 {
+			t.Fatalf("length %d: ScratchLen() = %d", length, p.ScratchLen())
+		}
+		scratch := make([]byte, p.ScratchLen())
+		for i := range int64(50) {
+			expected := p.PermuteInPlace(big.NewInt(i), []byte("tweak"))
+			out, err := p.PermuteInPlaceScratch(big.NewInt(i), []byte("tweak"), scratch)
+			if err != nil {
+				t.Fatalf("length %d: PermuteInPlaceScratch failed: %v", length, err)
+			}
+			if out.Cmp(expected) != 0 {
+				t.Fatalf("length %d: PermuteInPlaceScratch(%d) = %v, expected %v", length, i, out, expected)
+			}
+			inv, err := p.InvertInPlaceScratch(out, []byte("tweak"), scratch)
+			if err != nil {
+				t.Fatalf("length %d: InvertInPlaceScratch failed: %v", length, err)
+			}
+			if inv.Int64() != i {
+				t.Fatalf("length %d: %d inverted to %v", length, i, inv)
+			}
+		}
+		if len(p.roundScratch) != 0 && &p.roundScratch[0] == &scratch[0] {
+			t.Fatalf("length %d: caller's scratch buffer was retained", length)
+		}
+
+		// A panicking call (here, an over-long tweak) must still restore p's own buffer.
+		limited := p.WithTweakMaxLen(1)
+		for _, f := range []func(*big.Int, []byte, []byte) (*big.Int, error){limited.PermuteInPlaceScratch, limited.InvertInPlaceScratch} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Fatalf("length %d: expected a panic for an over-long tweak", length)
+					}
+				}()
+				_, _ = f(big.NewInt(1), []byte("tweak"), scratch)
+			}()
+			if len(limited.roundScratch) != 0 && &limited.roundScratch[0] == &scratch[0] {
+				t.Fatalf("length %d: caller's scratch buffer was retained after a panic", length)
+			}
+		}
+
+		short := make([]byte, p.ScratchLen()-1)
+		if _, err := p.PermuteInPlaceScratch(big.NewInt(1), nil, short); err == nil {
+			t.Errorf("length %d: expected error for short scratch buffer", length)
+		}
+		if _, err := p.InvertInPlaceScratch(big.NewInt(1), nil, short); err == nil {
+			t.Errorf("length %d: expected error for short scratch buffer", length)
+		}
+	}
+}
+
+func TestFeistelSHAKE128PermuteTrace(t *testing.T) {
+	join := func(p *FeistelSHAKE128, halves [2]*big.Int) *big.Int {
+		v := new(big.Int).Lsh(halves[0], uint(p.split))
+		return v.Or(v, halves[1])
+	}
+	for _, p := range []*FeistelSHAKE128{
+		NewPowerOf2([]byte("foo"), 16),
+		NewPowerOf2([]byte("foo"), 13).WithSplit(4),
+		NewPowerOf2([]byte("foo"), 200),
+	} {
+		for _, tweak := range [][]byte{nil, []byte("tweak")} {
+			for i := range int64(20) {
+				in := big.NewInt(i * 7919 % (1 << 13))
+				trace := p.PermuteTrace(in, tweak)
+				if len(trace) != p.Rounds()+1 {
+					t.Fatalf("length %d: trace has %d entries, expected %d", p.lengthBits, len(trace), p.Rounds()+1)
+				}
+				if first := join(p, trace[0]); first.Cmp(in) != 0 {
+					t.Fatalf("length %d: first trace entry recombines to %v, expected %v", p.lengthBits, first, in)
+				}
+				expected := p.PermuteInPlace(new(big.Int).Set(in), tweak)
+				if last := join(p, trace[len(trace)-1]); last.Cmp(expected) != 0 {
+					t.Fatalf("length %d: last trace entry recombines to %v, expected %v", p.lengthBits, last, expected)
+				}
+
+				// Undo each round in turn and check it gives the previous entry.
+				for r := p.Rounds() - 1; r >= 0; r-- {
+					a, b := trace[r+1][0], trace[r+1][1]
+					f := p.RoundFunc(r, a, new(big.Int), tweak)
+					prevA, prevB := f.Xor(b, f), a
+					if prevA.Cmp(trace[r][0]) != 0 || prevB.Cmp(trace[r][1]) != 0 {
+						t.Fatalf("length %d: undoing round %d of %v gave (%v, %v), trace has (%v, %v)",
+							p.lengthBits, r, in, prevA, prevB, trace[r][0], trace[r][1])
+					}
+				}
+				if inv := p.InvertInPlace(expected, tweak); inv.Cmp(in) != 0 {
+					t.Fatalf("length %d: %v inverted to %v", p.lengthBits, in, inv)
+				}
+			}
+		}
+	}
+}
+
+func TestExtendDomain(t *testing.T) {
+	key := []byte("foo")
+	const n, newN = 600, 900
+	old := NewNInt(key, n)
+	p := NewNInt(key, n).ExtendDomain(big.NewInt(newN))
+	block := old.p
+
+	seen := make(map[int]bool)
+	preserved := 0
+	for x := range newN {
+		out := p.PermuteInt(x)
+		if out < 0 || out >= newN || seen[out] {
+			t.Fatalf("PermuteInt(%d) = %d is out of range or a duplicate", x, out)
+		}
+		seen[out] = true
+		if inv := p.InvertInt(out); inv != x {
+			t.Fatalf("%d -> %d inverted to %d", x, out, inv)
+		}
+		if x >= n {
+			continue
+		}
+
+		// Replay the original walk to predict whether the mapping survives.
+		stable := true
+		v := big.NewInt(int64(x))
+		for block.PermuteInPlace(v, nil); v.Int64() >= n; block.PermuteInPlace(v, nil) {
+			if v.Int64() < newN {
+				stable = false
+			}
+		}
+		if changed := out != old.PermuteInt(x); changed == stable {
+			t.Fatalf("%d: stable prediction %v but old output %d, new output %d", x, stable, old.PermuteInt(x), out)
+		}
+		if stable {
+			preserved++
+		}
+	}
+	if preserved == 0 || preserved == n {
+		t.Errorf("expected some but not all mappings to be preserved, got %d of %d", preserved, n)
+	}
+
+	if p := NewNInt(key, 600).ExtendDomain(big.NewInt(1024)); !p.exact {
+		t.Error("expected extending to the block size to enable the power-of-2 fast path")
+	}
+	for _, bad := range []int64{599, 1025} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic extending to %d", bad)
+				}
+			}()
+			NewNInt(key, 600).ExtendDomain(big.NewInt(bad))
+		}()
+	}
+}
+
+func TestNewFFXFromAESKey(t *testing.T) {
+	key := []byte("foo")
+	aesKey := DeriveKey(key)
+	if len(aesKey) != 16 {
+		t.Fatalf("expected a 16-byte AES key, got %d bytes", len(aesKey))
+	}
+	for _, length := range []int{8, 20, 64, 128} {
+		p := NewFFXFromAESKey(aesKey, length)
+		expected := NewFFX(key, length)
+		for i := range int64(100) {
+			out := p.PermuteInPlace(big.NewInt(i), []byte("tweak"))
+			if e := expected.PermuteInPlace(big.NewInt(i), []byte("tweak")); out.Cmp(e) != 0 {
+				t.Fatalf("length %d: NewFFXFromAESKey mapped %d to %v, NewFFX mapped it to %v", length, i, out, e)
+			}
+		}
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic for a 10-byte AES key")
+			}
+		}()
+		NewFFXFromAESKey(make([]byte, 10), 16)
+	}()
+}
+
+func TestNewFFXFromBlock(t *testing.T) {
+	aesKey := DeriveKey([]byte("foo"))
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, length := range []int{8, 20, 64, 128} {
+		p := NewFFXFromBlock(block, length)
+		expected := NewFFXFromAESKey(aesKey, length)
+		for i := range int64(100) {
+			out := p.PermuteInPlace(big.NewInt(i), []byte("tweak"))
+			if e := expected.PermuteInPlace(big.NewInt(i), []byte("tweak")); out.Cmp(e) != 0 {
+				t.Fatalf("length %d: NewFFXFromBlock mapped %d to %v, NewFFXFromAESKey mapped it to %v", length, i, out, e)
+			}
+			if inv := p.InvertInPlace(out, []byte("tweak")); inv.Int64() != i {
+				t.Fatalf("length %d: InvertInPlace gave %v, expected %d", length, inv, i)
+			}
+		}
+	}
+
+	desBlock, err := des.NewCipher(make([]byte, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, block := range map[string]cipher.Block{"8-byte block": desBlock, "broken cipher": identityCipher{}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for %s", name)
+				}
+			}()
+			NewFFXFromBlock(block, 16)
+		}()
+	}
+}
+
+// identityCipher is a broken cipher.Block that leaves every block unchanged.
+type identityCipher struct{}
+
+func (identityCipher) BlockSize() int          { return aes.BlockSize }
+func (identityCipher) Encrypt(dst, src []byte) { copy(dst, src) }
+func (identityCipher) Decrypt(dst, src []byte) { copy(dst, src) }
+
+func TestFFXKeyChecks(t *testing.T) {
+	if err := checkDerivedKey(make([]byte, 16)); err == nil {
+		t.Error("expected an error for an all-zero derived key")
+	}
+	if err := checkDerivedKey(DeriveKey(nil)); err != nil {
+		t.Errorf("key derived from an empty key rejected: %v", err)
+	}
+
+	if err := checkCipher(identityCipher{}); err == nil {
+		t.Error("expected the self-test to catch a cipher that doesn't encrypt")
+	}
+	block, err := aes.NewCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkCipher(block); err != nil {
+		t.Errorf("self-test failed for AES with an all-zero key: %v", err)
+	}
+}
+
+func BenchmarkNewFFX(b *testing.B) {
+	b.ReportAllocs()
+	key := []byte("foobarbaz")
+	for b.Loop() {
+		for length := 8; length <= 64; length += 8 {
+			NewFFX(key, length)
+		}
+	}
+}
+
+func BenchmarkNewFFXFromAESKey(b *testing.B) {
+	b.ReportAllocs()
+	key := []byte("foobarbaz")
+	for b.Loop() {
+		aesKey := DeriveKey(key)
+		for length := 8; length <= 64; length += 8 {
+			NewFFXFromAESKey(aesKey, length)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	for _, n := range []*big.Int{
+		big.NewInt(1), big.NewInt(2), big.NewInt(5), big.NewInt(100), big.NewInt(1000), big.NewInt(1 << 16),
+		new(big.Int).Lsh(big.NewInt(1), 128), new(big.Int).Lsh(big.NewInt(1), 200),
+	} {
+		plan := Plan(n)
+		p := NewN([]byte("foo"), n)
+		if plan.Algorithm != p.Algorithm() || plan.Rounds != p.Rounds() || plan.BitLen != domainBitLen(n) {
+			t.Errorf("Plan(%v) = %+v, but NewN built %v with %v rounds", n, plan, p.Algorithm(), p.Rounds())
+		}
+		if n.Cmp(big.NewInt(3)) >= 0 && (plan.ExpectedIterations < 1 || plan.ExpectedIterations >= 2) {
+			t.Errorf("Plan(%v).ExpectedIterations = %v, expected [1, 2)", n, plan.ExpectedIterations)
+		}
+	}
+	if plan := Plan(big.NewInt(1000)); plan.ExpectedIterations != 1.024 {
+		t.Errorf("Plan(1000).ExpectedIterations = %v, expected 1.024", plan.ExpectedIterations)
+	}
+	if plan := Plan(big.NewInt(1)); plan.ExpectedIterations != 4 {
+		t.Errorf("Plan(1).ExpectedIterations = %v, expected 4", plan.ExpectedIterations)
+	}
+	if plan := Plan(big.NewInt(1 << 16)); plan.ExpectedIterations != 1 {
+		t.Errorf("Plan(2^16).ExpectedIterations = %v, expected 1", plan.ExpectedIterations)
+	}
+}
+
+func TestPermuteHex(t *testing.T) {
+	for _, tc := range []struct {
+		n, width int
+	}{
+		{1, 1}, {16, 1}, {17, 2}, {256, 2}, {1000, 3}, {1 << 13, 4}, {1<<13 + 1, 4}, {70000, 5},
+	} {
+		p := NewNInt([]byte("foo"), tc.n)
+		seen := make(map[string]bool)
+		for i := range min(tc.n, 2000) {
+			out := p.PermuteHex(i)
+			if len(out) != tc.width {
+				t.Fatalf("n=%d: PermuteHex(%d) = %q, expected %d digits", tc.n, i, out, tc.width)
+			}
+			if seen[out] {
+				t.Fatalf("n=%d: duplicate output %q", tc.n, out)
+			}
+			seen[out] = true
+			if expected := fmt.Sprintf("%0*x", tc.width, p.PermuteInt(i)); out != expected {
+				t.Fatalf("n=%d: PermuteHex(%d) = %q, expected %q", tc.n, i, out, expected)
+			}
+			inv, err := p.InvertHex(out)
+			if err != nil {
+				t.Fatalf("n=%d: InvertHex(%q) failed: %v", tc.n, out, err)
+			}
+			if inv != i {
+				t.Fatalf("n=%d: %d -> %q inverted to %d", tc.n, i, out, inv)
+			}
+		}
+	}
+
+	p := NewNInt([]byte("foo"), 1000)
+	if inv, err := p.InvertHex(strings.ToUpper(p.PermuteHex(500))); err != nil || inv != 500 {
+		t.Errorf("InvertHex of uppercase = %d, %v, expected 500", inv, err)
+	}
+	for _, in := range []string{"", "12", "1234", "3e8", "fff", "xyz", "-12", "+12", "1_2"} {
+		if _, err := p.InvertHex(in); err == nil {
+			t.Errorf("expected error for %q", in)
+		}
+	}
+
+	p.WithOutOfRange(OutOfRangeError)
+	for _, in := range []int{-1, 1000} {
+		if out := p.PermuteHex(in); out != "" {
+			t.Errorf("PermuteHex(%d) = %q under OutOfRangeError, expected \"\"", in, out)
+		}
+	}
+}
+
+func TestPermuteInPlaceRepresentation(t *testing.T) {
+	key := []byte("foo")
+	huge := new(big.Int).Lsh(big.NewInt(1), 2000)
+	for _, p := range []Permutation{
+		NewFFX(key, 8),
+		NewFFX(key, 100),
+		NewPowerOf2(key, 5),
+		NewPowerOf2(key, 300),
+		NewThreefish(key, 256),
+		NewNInt(key, 1000),
+		NewN(key, new(big.Int).Lsh(big.NewInt(3), 150)),
+		NewSwapOrNot(key, 1000),
+	} {
+		for _, v := range []int64{0, 1, 2, 7, 255, 999} {
+			in := big.NewInt(v)
+			if !p.InDomain(in) {
+				continue
+			}
+			for _, tweak := range [][]byte{nil, []byte("tweak")} {
+				expected := p.PermuteInPlace(big.NewInt(v), tweak)
+				representations := map[string]*big.Int{
+					"NewInt": big.NewInt(v),
+					// SetBytes with leading zeros.
+					"SetBytes": new(big.Int).SetBytes(append(make([]byte, 37), big.NewInt(v).Bytes()...)),
+					// Spare capacity left over from a much larger value.
+					"capacity": new(big.Int).Set(huge).SetInt64(v),
+					// The result of arithmetic that shrinks the value.
+					"arithmetic": new(big.Int).Sub(new(big.Int).Add(huge, big.NewInt(v)), huge),
+					"SetString":  func() *big.Int { i, _ := new(big.Int).SetString("0000000000"+big.NewInt(v).String(), 10); return i }(),
+				}
+				for name, r := range representations {
+					if out := p.PermuteInPlace(r, tweak); out.Cmp(expected) != 0 {
+						t.Errorf("%v: PermuteInPlace(%v via %s, %q) = %v, expected %v", p.Algorithm(), v, name, tweak, out, expected)
+					}
+					if out := p.InvertInPlace(r, tweak); out.Int64() != v {
+						t.Errorf("%v: InvertInPlace via %s gave %v, expected %v", p.Algorithm(), name, out, v)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestInvertMatchesPermute(t *testing.T) {
+	key := []byte("foo")
+	hmacPRF := func(input []byte) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+	for _, tc := range []struct {
+		name string
+		p    Permutation
+		n    int
+	}{
+		{"FFX", NewFFX(key, 8), 1 << 8},
+		{"FeistelSHAKE128", NewPowerOf2(key, 6), 1 << 6},
+		{"FeistelSHAKE128 split", NewPowerOf2(key, 7).WithSplit(2), 1 << 7},
+		{"FeistelPRF", NewPowerOf2PRF(hmacPRF, 5), 1 << 5},
+		{"ArbitraryN", NewNInt(key, 300), 300},
+		{"SwapOrNot", NewSwapOrNot(key, 50), 50},
+		{"Table", NewTablePermutation(NewNInt(key, 100), 100), 100},
+	} {
+		// Build the inverse table by brute force and check InvertInt agrees with it.
+		inverse := make(map[int]int, tc.n)
+		for i := range tc.n {
+			inverse[tc.p.PermuteInt(i)] = i
+		}
+		if len(inverse) != tc.n {
+			t.Fatalf("%s: PermuteInt isn't a bijection", tc.name)
+		}
+		for out, in := range inverse {
+			if inv := tc.p.InvertInt(out); inv != in {
+				t.Fatalf("%s: InvertInt(%d) = %d, brute force gives %d", tc.name, out, inv, in)
+			}
+		}
+	}
+
+	// Cycle-walking retraces the same walk backwards, so inverting costs as many block
+	// iterations as permuting did.
+	p := NewNInt(key, 300)
+	var iterations int
+	p.WithWalkObserver(func(i int) { iterations = i })
+	for i := range 300 {
+		out := p.PermuteInt(i)
+		forward := iterations
+		p.InvertInt(out)
+		if iterations != forward {
+			t.Fatalf("PermuteInt(%d) took %d iterations, InvertInt(%d) took %d", i, forward, out, iterations)
+		}
+	}
+}
+
+func TestFFXPermuteInt128(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, length := range []int{65, 96, 120, 128} {
+		p := NewFFX([]byte("foo"), length)
+		seen := make(map[[2]uint64]bool)
+		for range 1000 {
+			hi, lo := rng.Uint64()>>(128-length), rng.Uint64()
+			outHi, outLo := p.PermuteInt128(hi, lo)
+			if outHi>>(length-64) != 0 {
+				t.Fatalf("length %d: output %#x%016x out of range", length, outHi, outLo)
+			}
+			if seen[[2]uint64{outHi, outLo}] {
+				t.Fatalf("length %d: duplicate output %#x%016x", length, outHi, outLo)
+			}
+			seen[[2]uint64{outHi, outLo}] = true
+			if invHi, invLo := p.InvertInt128(outHi, outLo); invHi != hi || invLo != lo {
+				t.Fatalf("length %d: InvertInt128(%#x, %#x) = %#x, %#x, expected %#x, %#x", length, outHi, outLo, invHi, invLo, hi, lo)
+			}
+		}
+	}
+
+	p := NewFFX([]byte("foo"), 128)
+	for range 1000 {
+		hi, lo := rng.Uint64(), rng.Uint64()
+		outHi, outLo := p.PermuteInt128(hi, lo)
+
+		in := new(big.Int).SetUint64(hi)
+		in.Lsh(in, 64).Or(in, new(big.Int).SetUint64(lo))
+		expected := p.PermuteInPlace(in, nil)
+		var expectedLo big.Int
+		expectedLo.And(expected, new(big.Int).SetUint64(math.MaxUint64))
+		if outHi != new(big.Int).Rsh(expected, 64).Uint64() || outLo != expectedLo.Uint64() {
+			t.Fatalf("PermuteInt128(%#x, %#x) = %#x, %#x, big.Int path gives %#x", hi, lo, outHi, outLo, expected)
+		}
+		if invHi, invLo := p.InvertInt128(outHi, outLo); invHi != hi || invLo != lo {
+			t.Fatalf("InvertInt128(%#x, %#x) = %#x, %#x, expected %#x, %#x", outHi, outLo, invHi, invLo, hi, lo)
+		}
+	}
+
+	for _, f := range []func(){
+		func() { NewFFX([]byte("foo"), 64).PermuteInt128(0, 0) },
+		func() { NewFFX([]byte("foo"), 96).PermuteInt128(1<<32, 0) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func BenchmarkFFX_PermuteInt128(b *testing.B) {
+	p := NewFFX([]byte("foo"), 96)
+	b.Run("PermuteInt128", func(b *testing.B) {
+		b.ReportAllocs()
+		hi, lo := uint64(12345), uint64(67890)
+		for b.Loop() {
+			hi, lo = p.PermuteInt128(hi, lo)
+		}
+	})
+	b.Run("PermuteInPlace", func(b *testing.B) {
+		b.ReportAllocs()
+		v := new(big.Int).Lsh(big.NewInt(12345), 64)
+		for b.Loop() {
+			p.PermuteInPlace(v, nil)
+		}
+	})
+}
+
+func TestPermuteTrace(t *testing.T) {
+	p := NewNInt([]byte("foo"), 600).WithForbidden(big.NewInt(7))
+	longest := 0
+	for i := range int64(600) {
+		if i == 7 {
+			continue
+		}
+		for _, inverse := range []bool{false, true} {
+			trace, expected := p.PermuteTrace, p.PermuteInPlace
+			if inverse {
+				trace, expected = p.InvertTrace, p.InvertInPlace
+			}
+			in := big.NewInt(i)
+			values, err := trace(in, []byte("tweak"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if in.Int64() != i {
+				t.Fatalf("trace modified its input to %v", in)
+			}
+			last := values[len(values)-1]
+			if out := expected(big.NewInt(i), []byte("tweak")); last.Cmp(out) != 0 {
+				t.Fatalf("trace of %d (inverse %v) ends at %v, expected %v", i, inverse, last, out)
+			}
+			for _, v := range values[:len(values)-1] {
+				if v.Int64() < 600 && v.Int64() != 7 {
+					t.Fatalf("trace of %d (inverse %v) skipped in-range value %v", i, inverse, v)
+				}
+			}
+			longest = max(longest, len(values))
+		}
+	}
+	if longest < 2 {
+		t.Error("expected some walks to skip values")
+	}
+
+	for _, bad := range []int64{-1, 7, 600} {
+		if _, err := p.PermuteTrace(big.NewInt(bad), nil); err == nil {
+			t.Errorf("expected an error tracing %d", bad)
+		}
+	}
+}
+
+// TestZeroInput checks that 0 round-trips and stays in range like any other input.
+func TestZeroInput(t *testing.T) {
+	const keys = 200
+	for _, tc := range []struct {
+		name string
+		new  func(key []byte) Permutation
+	}{
+		{"FFX", func(key []byte) Permutation { return NewFFX(key, 20) }},
+		{"FFX/128", func(key []byte) Permutation { return NewFFX(key, 128) }},
+		{"FeistelSHAKE128", func(key []byte) Permutation { return NewPowerOf2(key, 20) }},
+		{"FeistelSHAKE128/300", func(key []byte) Permutation { return NewPowerOf2(key, 300) }},
+		{"ArbitraryN", func(key []byte) Permutation { return NewNInt(key, 1000003) }},
+		{"ArbitraryN/big", func(key []byte) Permutation { return NewN(key, new(big.Int).Lsh(big.NewInt(1), 200)) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for k := range keys {
+				p := tc.new(fmt.Appendf(nil, "key %d", k))
+				for _, tweak := range [][]byte{nil, []byte("tweak")} {
+					out := p.PermuteInPlace(big.NewInt(0), tweak)
+					if !p.InDomain(out) {
+						t.Fatalf("0 mapped to %v, out of range", out)
+					}
+					if inv := p.InvertInPlace(new(big.Int).Set(out), tweak); inv.Sign() != 0 {
+						t.Fatalf("0 mapped to %v, which inverted to %v", out, inv)
+					}
+					// 0 is also a valid output, with its own preimage.
+					if pre := p.InvertInPlace(big.NewInt(0), tweak); p.PermuteInPlace(pre, tweak).Sign() != 0 {
+						t.Fatal("the preimage of 0 didn't map back to 0")
+					}
+				}
+			}
+		})
+	}
+
+	// Domain where 0 is the only value.
+	if p := NewNInt([]byte("foo"), 1); p.PermuteInt(0) != 0 || p.InvertInt(0) != 0 {
+		t.Error("expected 0 to map to itself over [0, 1)")
+	}
+}
+
+// TestNilAndEmptyTweak pins that every construction treats nil and empty tweaks the same.
+func TestNilAndEmptyTweak(t *testing.T) {
+	key := []byte("foo")
+	hmacPRF := func(input []byte) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+	for _, tc := range []struct {
+		name string
+		p    Permutation
+	}{
+		{"FFX", NewFFX(key, 16)},
+		{"FeistelSHAKE128", NewPowerOf2(key, 10)},
+		{"FeistelSHAKE128 wide", NewPowerOf2(key, 70)},
+		{"FeistelPRF", NewPowerOf2PRF(hmacPRF, 10)},
+		{"Threefish", NewThreefish(key, 256)},
+		{"SwapOrNot", NewSwapOrNot(key, 100)},
+		{"ArbitraryN", NewNInt(key, 100)},
+		{"mixed radix", NewNCompact(key, big.NewInt(1025))},
+		{"Table", NewTablePermutation(NewNInt(key, 100), 100)},
+	} {
+		for i := range int64(100) {
+			withNil := tc.p.PermuteInPlace(big.NewInt(i), nil)
+			withEmpty := tc.p.PermuteInPlace(big.NewInt(i), []byte{})
+			if withNil.Cmp(withEmpty) != 0 {
+				t.Fatalf("%s: %d maps to %v with a nil tweak but %v with an empty one", tc.name, i, withNil, withEmpty)
+			}
+			if inv := tc.p.InvertInPlace(withNil, []byte{}); inv.Int64() != i {
+				t.Fatalf("%s: inverting with an empty tweak gave %v, expected %d", tc.name, inv, i)
+			}
+		}
+	}
+
+	p, err := New(key, big.NewInt(100), WithDefaultTweak([]byte("default")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := NewNInt(key, 100)
+	for i := range int64(100) {
+		if p.PermuteInPlace(big.NewInt(i), []byte{}).Cmp(base.PermuteInPlace(big.NewInt(i), nil)) != 0 {
+			t.Fatalf("WithDefaultTweak: an empty tweak should mean no tweak for %d", i)
+		}
+	}
+}
+
+func TestPermuteIntTweak(t *testing.T) {
+	key := []byte("foo")
+	for name, tc := range map[string]struct {
+		p Permutation
+		n int
+	}{
+		"FFX":             {NewFFX(key, 10), 1 << 10},
+		"FeistelSHAKE128": {NewPowerOf2(key, 10), 1 << 10},
+		"ArbitraryN":      {NewN(key, big.NewInt(1000)), 1000},
+		"table":           {NewTablePermutation(NewN(key, big.NewInt(1000)), 1000), 1000},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := tc.p
+			differ := 0
+			seen := map[string][]bool{"a": make([]bool, tc.n), "bc": make([]bool, tc.n)}
+			for i := range tc.n {
+				if got, expected := p.PermuteIntTweak(i, nil), p.PermuteInt(i); got != expected {
+					t.Fatalf("PermuteIntTweak(%d, nil) = %d, PermuteInt gave %d", i, got, expected)
+				}
+				if a, b := p.PermuteIntTweak(i, []byte{}), p.PermuteIntTweak(i, nil); a != b {
+					t.Fatalf("empty tweak gave %d, nil tweak gave %d", a, b)
+				}
+				// Alternate the tweak length so that FFX can't reuse its encrypted P.
+				var outs []int
+				for _, tweak := range []string{"a", "bc"} {
+					out := p.PermuteIntTweak(i, []byte(tweak))
+					if out < 0 || out >= tc.n || seen[tweak][out] {
+						t.Fatalf("tweak %q: PermuteIntTweak(%d) = %d is out of range or a duplicate", tweak, i, out)
+					}
+					seen[tweak][out] = true
+					if expected := p.PermuteInPlace(big.NewInt(int64(i)), []byte(tweak)); expected.Int64() != int64(out) {
+						t.Fatalf("tweak %q: PermuteIntTweak(%d) = %d, PermuteInPlace gave %v", tweak, i, out, expected)
+					}
+					if inv := p.InvertIntTweak(out, []byte(tweak)); inv != i {
+						t.Fatalf("tweak %q: InvertIntTweak(%d) = %d, expected %d", tweak, out, inv, i)
+					}
+					outs = append(outs, out)
+				}
+				if outs[0] != outs[1] {
+					differ++
+				}
+			}
+			if differ < tc.n*9/10 {
+				t.Errorf("only %d of %d outputs differ between the tweaks", differ, tc.n)
+			}
+		})
+	}
+
+	ffx, n := NewFFX(key, 20), NewN(key, big.NewInt(1000000))
+	tweaks := [][]byte{[]byte("a"), []byte("bc")}
+	for name, p := range map[string]Permutation{"FFX": ffx, "ArbitraryN": n} {
+		p.PermuteIntTweak(1, tweaks[1])
+		i := 0
+		if allocs := testing.AllocsPerRun(10, func() { p.PermuteIntTweak(i, tweaks[i%2]); i++ }); allocs != 0 {
+			t.Errorf("%s: PermuteIntTweak allocated %v times", name, allocs)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package permutation
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// pools maps a poolKey to the *sync.Pool of idle block permutations for that key and n.
+var pools sync.Map
+
+// poolKey identifies the parameters of pooled permutations.  The key is hashed so that
+// the map doesn't hold key material.
+type poolKey struct {
+	keyHash [sha256.Size]byte
+	n       int
+}
+
+// Get returns a permutation over [0, n) equivalent to NewNInt(key, n), recycling one
+// returned by Put if there is one, to save repeating the HKDF and AES setup on every
+// request in high-concurrency servers.  The result has the default configuration whether
+// or not it was recycled, and belongs to the caller until it is passed to Put.  Get is
+// safe for concurrent use.
+//
+// Each distinct key and n has its own pool, which is kept for the life of the process, so
+// Get suits a bounded set of keys rather than one per user.
+func Get(key []byte, n int) *ArbitraryN {
+	if n <= 0 {
+		panic(fmt.Sprintf("n must be positive, got: %v", n))
+	}
+	k := poolKey{keyHash: sha256.Sum256(key), n: n}
+	pool, ok := pools.Load(k)
+	if !ok {
+		pool, _ = pools.LoadOrStore(k, &sync.Pool{})
+	}
+	bigN := big.NewInt(int64(n))
+	block, _ := pool.(*sync.Pool).Get().(Permutation)
+	if block == nil {
+		block = newBlockPermutation(key, domainBitLen(bigN))
+	}
+	p := newArbitraryN(block, bigN)
+	p.pool = pool.(*sync.Pool)
+	return p
+}
+
+// Put returns p, which must have come from Get, to its pool.  p's scratch state, which
+// may hold its last input, isn't recycled: the pool keeps a clone of the block with fresh
+// scratch, and p itself is cleared, so it must not be used again.
+func Put(p *ArbitraryN) {
+	if p.pool == nil {
+		panic("Put of a permutation that didn't come from Get")
+	}
+	pool, block := p.pool, p.p.Clone()
+	*p = ArbitraryN{}
+	pool.Put(block)
+}
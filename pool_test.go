@@ -0,0 +1,94 @@
+package permutation
+
+import (
+	"crypto/aes"
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	type params struct {
+		key string
+		n   int
+	}
+	cases := []params{{"foo", 1000}, {"bar", 1000}, {"foo", 1001}, {"foo", 1 << 20}}
+	expected := make(map[params][]int)
+	for _, c := range cases {
+		p := NewNInt([]byte(c.key), c.n)
+		for i := range 100 {
+			expected[c] = append(expected[c], p.PermuteInt(i))
+		}
+	}
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Go(func() {
+			for iter := range 200 {
+				c := cases[(g+iter)%len(cases)]
+				p := Get([]byte(c.key), c.n)
+				for i, e := range expected[c] {
+					if out := p.PermuteInt(i); out != e {
+						t.Errorf("%v: Get(...).PermuteInt(%d) = %d, expected %d", c, i, out, e)
+						return
+					}
+				}
+				if iter%2 == 0 {
+					// Configuration mustn't carry over to the next Get.
+					p.WithForbidden(big.NewInt(int64(expected[c][0])))
+				}
+				Put(p)
+			}
+		})
+	}
+	wg.Wait()
+
+	// Whether or not it's recycled, an instance from Get has clear scratch.
+	p := Get([]byte("foo"), 1000)
+	p.PermuteInt(123)
+	Put(p)
+	if p.p != nil || p.pool != nil || p.n.Sign() != 0 {
+		t.Error("expected Put to clear the instance")
+	}
+	p = Get([]byte("foo"), 1000)
+	block := p.p.(*FFX)
+	if block.in.Sign() != 0 || block.masked.Sign() != 0 || block.inBytes != [aes.BlockSize]byte{} || block.outBytes != [aes.BlockSize]byte{} {
+		t.Error("expected a recycled block to have clear scratch")
+	}
+	Put(p)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic putting a permutation that didn't come from Get")
+			}
+		}()
+		Put(NewNInt([]byte("foo"), 1000))
+	}()
+}
+
+// BenchmarkPool compares constructing a permutation per request with Get and Put.  Run it
+// with -race to check the pool under contention as well.
+func BenchmarkPool(b *testing.B) {
+	key := []byte("foo")
+	for _, n := range []int{1000, min(1<<40, math.MaxInt)} {
+		b.Run(fmt.Sprintf("n=%d/NewNInt", n), func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					NewNInt(key, n).PermuteInt(i % 1000)
+				}
+			})
+		})
+		b.Run(fmt.Sprintf("n=%d/Get", n), func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					p := Get(key, n)
+					p.PermuteInt(i % 1000)
+					Put(p)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package permutation
+
+import (
+	"encoding/binary"
+	"math/big"
+)
+
+// PositionalPermuter permutes a stream of values, using each value's position in the
+// stream as its tweak so that equal values at different positions permute independently.
+type PositionalPermuter struct {
+	p        Permutation
+	position uint64
+
+	// Scratch variables to avoid allocations.
+	in    big.Int
+	tweak [8]byte
+}
+
+func NewPositional(p Permutation) *PositionalPermuter {
+	return &PositionalPermuter{p: p}
+}
+
+// PermuteNext permutes in using the current position as the tweak and then advances the
+// position.
+func (p *PositionalPermuter) PermuteNext(in int) int {
+	out := p.PermuteAt(p.position, in)
+	p.position++
+	return out
+}
+
+// PermuteAt permutes in as if it were at the given position in the stream.  It doesn't
+// change the current position.
+func (p *PositionalPermuter) PermuteAt(position uint64, in int) int {
+	p.in.SetInt64(int64(in))
+	return int(p.p.PermuteInPlace(&p.in, p.positionTweak(position)).Int64())
+}
+
+// InvertAt is the inverse of PermuteAt; it recovers the value that was permuted to out at
+// the given position.
+func (p *PositionalPermuter) InvertAt(position uint64, out int) int {
+	p.in.SetInt64(int64(out))
+	return int(p.p.InvertInPlace(&p.in, p.positionTweak(position)).Int64())
+}
+
+// Position returns the position that the next call to PermuteNext will use.
+func (p *PositionalPermuter) Position() uint64 {
+	return p.position
+}
+
+// Reset restarts the stream at position 0.
+func (p *PositionalPermuter) Reset() {
+	p.position = 0
+}
+
+func (p *PositionalPermuter) positionTweak(position uint64) []byte {
+	binary.BigEndian.PutUint64(p.tweak[:], position)
+	return p.tweak[:]
+}
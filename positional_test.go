@@ -0,0 +1,43 @@
+package permutation
+
+import (
+	"testing"
+)
+
+func TestPositionalPermuter(t *testing.T) {
+	for _, p := range []Permutation{
+		NewFFX([]byte("foo"), 16),
+		NewPowerOf2([]byte("foo"), 16),
+		NewNInt([]byte("foo"), 1000),
+	} {
+		t.Run(p.Algorithm(), func(t *testing.T) {
+			pp := NewPositional(p)
+			const in = 123
+			var outs []int
+			numCollisions := 0
+			for pos := range 100 {
+				out := pp.PermuteNext(in)
+				if inv := pp.InvertAt(uint64(pos), out); inv != in {
+					t.Fatalf("position %d: %d -> %d inverted to %d", pos, in, out, inv)
+				}
+				if pos > 0 && out == outs[pos-1] {
+					numCollisions++
+				}
+				outs = append(outs, out)
+			}
+			if numCollisions > 2 {
+				t.Fatalf("Too many collisions between adjacent positions: %d", numCollisions)
+			}
+			if pp.Position() != 100 {
+				t.Fatalf("expected position 100, got %d", pp.Position())
+			}
+
+			pp.Reset()
+			for pos := range 100 {
+				if out := pp.PermuteNext(in); out != outs[pos] {
+					t.Fatalf("position %d: got %d after Reset, expected %d", pos, out, outs[pos])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package permutation
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// MinRadixStringDomain is the smallest domain, radix^length, that NewRadixStringPermuter
+// accepts: the 1,000,000 values that NIST SP 800-38G requires of a format-preserving
+// encryption domain.
+const MinRadixStringDomain = 1_000_000
+
+// RadixStringPermuter is tweakable, length-preserving format-preserving encryption of
+// fixed-length strings over an alphabet.  A string of length digits is interpreted as a
+// big-endian integer in [0, radix^length), where the first character of the alphabet is
+// the zero digit, and permuted with the ArbitraryN that NewN would choose for that domain.
+// Each character is a rune, however many bytes it takes in UTF-8, so alphabets such as
+// base58 or emoji work by rune index.
+type RadixStringPermuter struct {
+	p        *ArbitraryN
+	alphabet *alphabet
+	length   int
+
+	// Scratch variables to avoid allocations.
+	v big.Int
+}
+
+// NewRadixStringPermuter returns a RadixStringPermuter for strings of length characters
+// drawn from alphabet.  It panics if alphabet has fewer than 2 characters or contains
+// duplicates, or if the domain is smaller than MinRadixStringDomain.
+func NewRadixStringPermuter(key []byte, alphabet string, length int) *RadixStringPermuter {
+	a, err := newAlphabet([]rune(alphabet))
+	if err != nil {
+		panic(err)
+	}
+	if length <= 0 {
+		panic(fmt.Sprintf("length must be positive, got: %v", length))
+	}
+	n := new(big.Int).Exp(&a.radix, big.NewInt(int64(length)), nil)
+	if n.Cmp(big.NewInt(MinRadixStringDomain)) < 0 {
+		panic(fmt.Sprintf("domain %v^%v = %v is smaller than %v", &a.radix, length, n, MinRadixStringDomain))
+	}
+	return &RadixStringPermuter{
+		p:        NewN(key, n),
+		alphabet: a,
+		length:   length,
+	}
+}
+
+// Len returns the length, in characters, of every input and output.
+func (p *RadixStringPermuter) Len() int {
+	return p.length
+}
+
+// Encrypt returns the encryption of s, which must be exactly Len() characters from the
+// alphabet, under the given tweak.
+func (p *RadixStringPermuter) Encrypt(s string, tweak []byte) (string, error) {
+	if err := p.alphabet.decode(&p.v, s, p.length); err != nil {
+		return "", err
+	}
+	return p.alphabet.encode(p.p.PermuteInPlace(&p.v, tweak), p.length), nil
+}
+
+// Decrypt is the inverse of Encrypt.
+func (p *RadixStringPermuter) Decrypt(s string, tweak []byte) (string, error) {
+	if err := p.alphabet.decode(&p.v, s, p.length); err != nil {
+		return "", err
+	}
+	return p.alphabet.encode(p.p.InvertInPlace(&p.v, tweak), p.length), nil
+}
@@ -0,0 +1,157 @@
+package permutation
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+const (
+	radix10Alphabet = "0123456789"
+	radix16Alphabet = "0123456789abcdef"
+	radix62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+func TestRadixStringPermuterRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, tc := range []struct {
+		alphabet string
+		length   int
+	}{
+		{radix10Alphabet, 6},
+		{radix10Alphabet, 16},
+		{radix16Alphabet, 5},
+		{radix16Alphabet, 32},
+		{radix62Alphabet, 4},
+		{radix62Alphabet, 22},
+	} {
+		for _, tweak := range [][]byte{[]byte("tweak"), []byte("other tweak")} {
+			t.Run(fmt.Sprintf("radix %d length %d tweak %q", len(tc.alphabet), tc.length, tweak), func(t *testing.T) {
+				p := NewRadixStringPermuter([]byte("foo"), tc.alphabet, tc.length)
+				if p.Len() != tc.length {
+					t.Errorf("Len() = %d, expected %d", p.Len(), tc.length)
+				}
+				for range 100 {
+					var sb strings.Builder
+					for range tc.length {
+						sb.WriteByte(tc.alphabet[rng.IntN(len(tc.alphabet))])
+					}
+					in := sb.String()
+					enc, err := p.Encrypt(in, tweak)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(enc) != tc.length {
+						t.Fatalf("Encrypt(%q) = %q, expected %d characters", in, enc, tc.length)
+					}
+					if strings.Trim(enc, tc.alphabet) != "" {
+						t.Fatalf("Encrypt(%q) = %q, which isn't in the alphabet", in, enc)
+					}
+					dec, err := p.Decrypt(enc, tweak)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if dec != in {
+						t.Fatalf("%q -> %q decrypted to %q", in, enc, dec)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestRadixStringPermuterTweak(t *testing.T) {
+	p := NewRadixStringPermuter([]byte("foo"), radix10Alphabet, 16)
+	a, err := p.Encrypt("4111111111111111", []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := p.Encrypt("4111111111111111", []byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Errorf("different tweaks gave the same ciphertext %q", a)
+	}
+}
+
+func TestRadixStringPermuterErrors(t *testing.T) {
+	p := NewRadixStringPermuter([]byte("foo"), radix10Alphabet, 6)
+	for _, tc := range []struct {
+		in, err string
+	}{
+		{"12345", "input must be 6 characters, got 5"},
+		{"1234567", "input must be 6 characters, got 7"},
+		{"12a456", `character 'a' at index 2 is not in the alphabet`},
+		{"12345é", `character 'é' at index 5 is not in the alphabet`},
+	} {
+		if _, err := p.Encrypt(tc.in, nil); err == nil || err.Error() != tc.err {
+			t.Errorf("Encrypt(%q) returned error %v, expected %q", tc.in, err, tc.err)
+		}
+		if _, err := p.Decrypt(tc.in, nil); err == nil || err.Error() != tc.err {
+			t.Errorf("Decrypt(%q) returned error %v, expected %q", tc.in, err, tc.err)
+		}
+	}
+}
+
+func TestRadixStringPermuterPanics(t *testing.T) {
+	for _, tc := range []struct {
+		alphabet string
+		length   int
+	}{
+		{radix10Alphabet, 5}, // 10^5 is below the minimum domain.
+		{radix10Alphabet, 0},
+		{"0", 30},
+		{"00123456789", 6},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewRadixStringPermuter(%q, %d) should panic", tc.alphabet, tc.length)
+				}
+			}()
+			NewRadixStringPermuter([]byte("foo"), tc.alphabet, tc.length)
+		}()
+	}
+}
+
+func TestRadixStringPermuterMultiByteAlphabet(t *testing.T) {
+	// Every rune takes 4 bytes in UTF-8, but each is one position.
+	const alphabet = "😀😁😂😃😄😅😆😇😈😉"
+	const length = 6
+	p := NewRadixStringPermuter([]byte("foo"), alphabet, length)
+	a, err := newAlphabet([]rune(alphabet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool, MinRadixStringDomain)
+	var v big.Int
+	for i := range int64(MinRadixStringDomain) {
+		in := a.encode(v.SetInt64(i), length)
+		enc, err := p.Encrypt(in, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if utf8.RuneCountInString(enc) != length || strings.Trim(enc, alphabet) != "" {
+			t.Fatalf("Encrypt(%q) = %q, expected %d runes from the alphabet", in, enc, length)
+		}
+		if seen[enc] {
+			t.Fatalf("Encrypt(%q) = %q is a duplicate", in, enc)
+		}
+		seen[enc] = true
+		if i%1000 == 0 {
+			if dec, err := p.Decrypt(enc, nil); err != nil || dec != in {
+				t.Fatalf("%q -> %q decrypted to %q, %v", in, enc, dec, err)
+			}
+		}
+	}
+
+	for _, in := range []string{"😀😁😂😃😄", "😀😁😂😃😄😅😆", "😀😁😂😃😄a", "😀😁😂😃😄🙂"} {
+		if _, err := p.Encrypt(in, nil); err == nil {
+			t.Errorf("Encrypt(%q) should fail", in)
+		}
+	}
+}
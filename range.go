@@ -0,0 +1,139 @@
+package permutation
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Range is a permutation over [min, max), which may include negative values.  It offsets
+// an ArbitraryN over [0, max-min).
+type Range struct {
+	p        *ArbitraryN
+	min, max big.Int
+
+	// Scratch variables to avoid allocations.
+	in big.Int
+}
+
+// NewRange returns a permutation over [min, max), such as the IDs [1000000, 2000000), so
+// that values needn't be offset by hand.  min may be negative.  It panics unless max is
+// greater than min.
+func NewRange(key []byte, min, max *big.Int) *Range {
+	if max.Cmp(min) <= 0 {
+		panic(fmt.Sprintf("max must be > min, got: [%v, %v)", min, max))
+	}
+	return newRange(key, min, max)
+}
+
+// NewRangeInclusive returns a permutation over [lo, hi].
+func NewRangeInclusive(key []byte, lo, hi *big.Int) *Range {
+	if hi.Cmp(lo) < 0 {
+		panic(fmt.Sprintf("hi must be >= lo, got: [%v, %v]", lo, hi))
+	}
+	var max big.Int
+	max.Add(hi, big.NewInt(1))
+	return newRange(key, lo, &max)
+}
+
+func newRange(key []byte, min, max *big.Int) *Range {
+	var n big.Int
+	n.Sub(max, min)
+	p := &Range{
+		p: NewN(key, &n),
+	}
+	p.min.Set(min)
+	p.max.Set(max)
+	return p
+}
+
+func (p *Range) PermuteInt(in int) int {
+	return p.PermuteIntTweak(in, nil)
+}
+
+func (p *Range) PermuteIntTweak(in int, tweak []byte) int {
+	return int(p.PermuteInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+func (p *Range) InvertInt(in int) int {
+	return p.InvertIntTweak(in, nil)
+}
+
+func (p *Range) InvertIntTweak(in int, tweak []byte) int {
+	return int(p.InvertInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+func (p *Range) PermuteUint64(in uint64) uint64 {
+	return stepUint64(p.PermuteInPlace, &p.in, in)
+}
+
+func (p *Range) InvertUint64(in uint64) uint64 {
+	return stepUint64(p.InvertInPlace, &p.in, in)
+}
+
+// PermuteInPlace calculates inOut's permutated value and stores it back into inOut.
+// Returns inOut as a convenience.
+func (p *Range) PermuteInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	p.checkRange(inOut)
+	inOut.Sub(inOut, &p.min)
+	inOut = p.p.PermuteInPlace(inOut, tweak)
+	return inOut.Add(inOut, &p.min)
+}
+
+// InvertInPlace is the inverse of PermuteInPlace.
+func (p *Range) InvertInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	p.checkRange(inOut)
+	inOut.Sub(inOut, &p.min)
+	inOut = p.p.InvertInPlace(inOut, tweak)
+	return inOut.Add(inOut, &p.min)
+}
+
+// TryPermuteInPlace is PermuteInPlace but returns an error, rather than panicking, if
+// inOut is outside [min, max).
+func (p *Range) TryPermuteInPlace(inOut *big.Int, tweak []byte) (*big.Int, error) {
+	if err := p.check(inOut); err != nil {
+		return nil, err
+	}
+	return p.PermuteInPlace(inOut, tweak), nil
+}
+
+// TryInvertInPlace is InvertInPlace but returns an error rather than panicking.
+func (p *Range) TryInvertInPlace(inOut *big.Int, tweak []byte) (*big.Int, error) {
+	if err := p.check(inOut); err != nil {
+		return nil, err
+	}
+	return p.InvertInPlace(inOut, tweak), nil
+}
+
+// InDomain returns whether v is in [min, max).
+func (p *Range) InDomain(v *big.Int) bool {
+	return v.Cmp(&p.min) >= 0 && v.Cmp(&p.max) < 0
+}
+
+// Clone returns an independent copy of p for use on another goroutine.
+func (p *Range) Clone() Permutation {
+	c := &Range{p: p.p.Clone().(*ArbitraryN)}
+	c.min.Set(&p.min)
+	c.max.Set(&p.max)
+	return c
+}
+
+func (p *Range) checkRange(in *big.Int) {
+	if err := p.check(in); err != nil {
+		panic(err.Error())
+	}
+}
+
+func (p *Range) check(in *big.Int) error {
+	if !p.InDomain(in) {
+		return errorf(ErrOutOfRange, "input %v is outside range of permutation [%v, %v)", in, &p.min, &p.max)
+	}
+	return nil
+}
+
+func (p *Range) Rounds() int {
+	return p.p.Rounds()
+}
+
+func (p *Range) Algorithm() string {
+	return p.p.Algorithm()
+}
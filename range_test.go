@@ -0,0 +1,109 @@
+package permutation
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestRangeInclusive(t *testing.T) {
+	const lo, hi = 1000, 1999
+	p := NewRangeInclusive([]byte("foo"), big.NewInt(lo), big.NewInt(hi))
+	seen := make(map[int]int)
+	for i := lo; i <= hi; i++ {
+		out := p.PermuteInt(i)
+		if out < lo || out > hi {
+			t.Fatalf("output %d is outside range of permutation [%d, %d]", out, lo, hi)
+		}
+		if _, ok := seen[out]; ok {
+			t.Fatalf("found duplicate output %d", out)
+		}
+		seen[out] = i
+		if inv := p.InvertInt(out); inv != i {
+			t.Fatalf("%d -> %d inverted to %d", i, out, inv)
+		}
+	}
+}
+
+func TestRangeInclusiveSingleElement(t *testing.T) {
+	p := NewRangeInclusive([]byte("foo"), big.NewInt(42), big.NewInt(42))
+	if out := p.PermuteInt(42); out != 42 {
+		t.Fatalf("expected identity, got 42 -> %d", out)
+	}
+	if out := p.InvertInt(42); out != 42 {
+		t.Fatalf("expected identity, got 42 -> %d", out)
+	}
+}
+
+func TestRangeInclusiveInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for hi < lo")
+		}
+	}()
+	NewRangeInclusive([]byte("foo"), big.NewInt(1), big.NewInt(0))
+}
+
+func TestRangeOutOfRange(t *testing.T) {
+	p := NewRangeInclusive([]byte("foo"), big.NewInt(10), big.NewInt(20))
+	for _, in := range []int{9, 21} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected panic for input %d", in)
+				}
+			}()
+			p.PermuteInt(in)
+		}()
+	}
+}
+
+func TestRange(t *testing.T) {
+	for _, tc := range []struct{ min, max int64 }{
+		{1000000, 1001000},
+		{-500, 500},
+		{-2000, -1000},
+		{-7, -6},
+	} {
+		min, max := big.NewInt(tc.min), big.NewInt(tc.max)
+		p := NewRange([]byte("foo"), min, max)
+		plain := NewN([]byte("foo"), new(big.Int).Sub(max, min))
+		seen := make(map[int64]bool)
+		for i := tc.min; i < tc.max; i++ {
+			out := p.PermuteInPlace(big.NewInt(i), []byte("tweak"))
+			if !p.InDomain(out) || seen[out.Int64()] {
+				t.Fatalf("[%d, %d): %d permuted to %v, out of range or a duplicate", tc.min, tc.max, i, out)
+			}
+			seen[out.Int64()] = true
+			expected := plain.PermuteInPlace(big.NewInt(i-tc.min), []byte("tweak"))
+			if out.Int64()-tc.min != expected.Int64() {
+				t.Fatalf("[%d, %d): %d permuted to %v, expected the offset of %v", tc.min, tc.max, i, out, expected)
+			}
+			if inv := p.InvertInPlace(out, []byte("tweak")); inv.Int64() != i {
+				t.Fatalf("[%d, %d): %v inverted to %v, expected %d", tc.min, tc.max, out, inv, i)
+			}
+		}
+		if !p.InDomain(min) || p.InDomain(max) || p.InDomain(new(big.Int).Sub(min, big.NewInt(1))) {
+			t.Errorf("[%d, %d): InDomain has the wrong bounds", tc.min, tc.max)
+		}
+		for _, in := range []*big.Int{max, new(big.Int).Sub(min, big.NewInt(1))} {
+			if _, err := p.TryPermuteInPlace(new(big.Int).Set(in), nil); !errors.Is(err, ErrOutOfRange) {
+				t.Errorf("[%d, %d): TryPermuteInPlace(%v) gave %v, expected ErrOutOfRange", tc.min, tc.max, in, err)
+			}
+			if _, err := p.TryInvertInPlace(new(big.Int).Set(in), nil); !errors.Is(err, ErrOutOfRange) {
+				t.Errorf("[%d, %d): TryInvertInPlace(%v) gave %v, expected ErrOutOfRange", tc.min, tc.max, in, err)
+			}
+		}
+	}
+
+	for _, bounds := range [][2]int64{{5, 5}, {5, 4}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewRange(%d, %d) should panic", bounds[0], bounds[1])
+				}
+			}()
+			NewRange([]byte("foo"), big.NewInt(bounds[0]), big.NewInt(bounds[1]))
+		}()
+	}
+}
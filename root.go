@@ -0,0 +1,38 @@
+package permutation
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"math/big"
+)
+
+// Root derives independent child permutations from a single parent key, so that a service
+// with many permutation domains only has to manage one key.  Each child's key is derived
+// with HKDF-Expand from the parent's pseudorandom key, with the label in the info, so
+// children with different labels are independent of each other and of NewN with the
+// parent key, and each is reproducible from the parent key and its label alone.
+type Root struct {
+	prk []byte
+}
+
+// NewRoot returns a Root for the parent key.  The HKDF-Extract step happens once here, so
+// each Child only costs one HKDF-Expand on top of constructing the permutation.
+func NewRoot(key []byte) *Root {
+	prk, err := hkdf.Extract(sha256.New, key, nil)
+	if err != nil {
+		panic(err)
+	}
+	return &Root{prk: prk}
+}
+
+// Child returns the permutation over [0, n) for label; it is NewN with the derived key.
+// The key depends only on the label, so children with the same label and different n are
+// related in the same way as NewN with the same key and different n: use a distinct label
+// for each domain.
+func (r *Root) Child(label string, n *big.Int) *ArbitraryN {
+	key, err := hkdf.Expand(sha256.New, r.prk, "permute.Root "+label, 32)
+	if err != nil {
+		panic(err)
+	}
+	return NewN(key, n)
+}
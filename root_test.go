@@ -0,0 +1,52 @@
+package permutation
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestRoot(t *testing.T) {
+	n := big.NewInt(1000)
+	root := NewRoot([]byte("parent"))
+	users := root.Child("users", n)
+	again := NewRoot([]byte("parent")).Child("users", n)
+	orders := root.Child("orders", n)
+	otherParent := NewRoot([]byte("other")).Child("users", n)
+	direct := NewN([]byte("parent"), n)
+
+	sameLabel, sameParent, sameDirect := 0, 0, 0
+	for i := range 1000 {
+		out := users.PermuteInt(i)
+		if out != again.PermuteInt(i) {
+			t.Fatalf("same parent and label gave different outputs for %d", i)
+		}
+		if inv := users.InvertInt(out); inv != i {
+			t.Fatalf("InvertInt(%d) = %d, expected %d", out, inv, i)
+		}
+		if out == orders.PermuteInt(i) {
+			sameLabel++
+		}
+		if out == otherParent.PermuteInt(i) {
+			sameParent++
+		}
+		if out == direct.PermuteInt(i) {
+			sameDirect++
+		}
+	}
+	if sameLabel > 20 || sameParent > 20 || sameDirect > 20 {
+		t.Errorf("outputs unchanged: %d changing the label, %d changing the parent, %d using the parent key directly",
+			sameLabel, sameParent, sameDirect)
+	}
+
+	// A label that is a prefix of another still gives an independent child.
+	prefix, longer := root.Child("user", n), root.Child("users", n)
+	same := 0
+	for i := range 1000 {
+		if prefix.PermuteInt(i) == longer.PermuteInt(i) {
+			same++
+		}
+	}
+	if same > 20 {
+		t.Errorf("%d outputs shared by labels user and users", same)
+	}
+}
@@ -0,0 +1,95 @@
+package permutation
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"unicode"
+)
+
+// RunesFPE is tweakable, length-preserving format-preserving encryption of strings of any
+// length over an alphabet of runes.  Each rune is one position, however many bytes it
+// takes in UTF-8.  A string of length runes is interpreted as a big-endian integer in
+// [0, radix^length), as for RadixStringPermuter, and permuted with the ArbitraryN that NewN
+// would choose for that domain.
+//
+// Short strings have small domains: the 2-rune strings over a 10-rune alphabet have only
+// 100 possible encryptions, so RunesFPE gives little protection to them.
+type RunesFPE struct {
+	key      []byte
+	alphabet *alphabet
+	// single is the only rune of a one-rune alphabet, for which every string encrypts to
+	// itself.  alphabet is nil in that case.
+	single rune
+	// perms caches the permutation for each length seen so far.
+	perms map[int]*ArbitraryN
+
+	// Scratch variables to avoid allocations.
+	v big.Int
+}
+
+// NewRunesFPE returns a RunesFPE over alphabet.  It panics if alphabet is empty, contains
+// duplicates or contains combining characters (Unicode category M), which can't stand
+// alone as a position.
+func NewRunesFPE(key []byte, alphabet []rune) *RunesFPE {
+	if len(alphabet) == 0 {
+		panic("alphabet must not be empty")
+	}
+	for _, r := range alphabet {
+		if unicode.Is(unicode.M, r) {
+			panic(fmt.Sprintf("alphabet contains combining character %q", r))
+		}
+	}
+	p := &RunesFPE{key: key, perms: make(map[int]*ArbitraryN)}
+	if len(alphabet) == 1 {
+		p.single = alphabet[0]
+		return p
+	}
+	a, err := newAlphabet(slices.Clone(alphabet))
+	if err != nil {
+		panic(err)
+	}
+	p.alphabet = a
+	return p
+}
+
+// Encrypt returns the encryption of s under the given tweak: a new slice of the same
+// length.  It returns an error if s contains a combining character or a rune outside the
+// alphabet.  The empty string encrypts to itself.
+func (p *RunesFPE) Encrypt(s []rune, tweak []byte) ([]rune, error) {
+	return p.apply(s, tweak, (*ArbitraryN).PermuteInPlace)
+}
+
+// Decrypt is the inverse of Encrypt.
+func (p *RunesFPE) Decrypt(s []rune, tweak []byte) ([]rune, error) {
+	return p.apply(s, tweak, (*ArbitraryN).InvertInPlace)
+}
+
+func (p *RunesFPE) apply(s []rune, tweak []byte, step func(*ArbitraryN, *big.Int, []byte) *big.Int) ([]rune, error) {
+	for i, r := range s {
+		if unicode.Is(unicode.M, r) {
+			return nil, fmt.Errorf("combining character %q at index %d is not supported", r, i)
+		}
+		if p.alphabet == nil && r != p.single {
+			return nil, fmt.Errorf("character %q at index %d is not in the alphabet", r, i)
+		}
+	}
+	if p.alphabet == nil || len(s) == 0 {
+		return slices.Clone(s), nil
+	}
+	if err := p.alphabet.decode(&p.v, string(s), len(s)); err != nil {
+		return nil, err
+	}
+	return []rune(p.alphabet.encode(step(p.perm(len(s)), &p.v, tweak), len(s))), nil
+}
+
+// perm returns the permutation over strings of length runes.
+func (p *RunesFPE) perm(length int) *ArbitraryN {
+	if perm, ok := p.perms[length]; ok {
+		return perm
+	}
+	n := new(big.Int).Exp(&p.alphabet.radix, big.NewInt(int64(length)), nil)
+	perm := NewN(p.key, n)
+	p.perms[length] = perm
+	return perm
+}
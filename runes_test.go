@@ -0,0 +1,101 @@
+package permutation
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestRunesFPE(t *testing.T) {
+	// Latin, Greek, Cyrillic, CJK, Devanagari and an emoji outside the BMP.
+	alphabet := []rune("aβж\u00e9中文न😀")
+	p := NewRunesFPE([]byte("foo"), alphabet)
+
+	for _, length := range []int{1, 2, 3, 8, 30} {
+		for _, tweak := range [][]byte{nil, []byte("tweak")} {
+			t.Run(fmt.Sprintf("%d/%q", length, tweak), func(t *testing.T) {
+				for i := range 50 {
+					in := make([]rune, length)
+					for j := range in {
+						in[j] = alphabet[(i*7+j*3)%len(alphabet)]
+					}
+					out, err := p.Encrypt(in, tweak)
+					if err != nil {
+						t.Fatalf("Encrypt(%q) failed: %v", string(in), err)
+					}
+					if len(out) != length {
+						t.Fatalf("Encrypt(%q) = %q has %d runes, expected %d", string(in), string(out), len(out), length)
+					}
+					for _, r := range out {
+						if !slices.Contains(alphabet, r) {
+							t.Fatalf("Encrypt(%q) = %q contains %q, which isn't in the alphabet", string(in), string(out), r)
+						}
+					}
+					dec, err := p.Decrypt(out, tweak)
+					if err != nil {
+						t.Fatalf("Decrypt(%q) failed: %v", string(out), err)
+					}
+					if string(dec) != string(in) {
+						t.Fatalf("%q -> %q decrypted to %q", string(in), string(out), string(dec))
+					}
+				}
+			})
+		}
+	}
+
+	// Every 2-rune string maps to a distinct 2-rune string.
+	outputs := make(map[string]bool)
+	for _, a := range alphabet {
+		for _, b := range alphabet {
+			out, err := p.Encrypt([]rune{a, b}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if outputs[string(out)] {
+				t.Fatalf("duplicate output %q", string(out))
+			}
+			outputs[string(out)] = true
+		}
+	}
+}
+
+func TestRunesFPEEdgeCases(t *testing.T) {
+	p := NewRunesFPE([]byte("foo"), []rune("abc\u00e9"))
+	for _, in := range [][]rune{nil, {}} {
+		out, err := p.Encrypt(in, nil)
+		if err != nil || len(out) != 0 {
+			t.Errorf("Encrypt(%q) = %q, %v, expected empty string", string(in), string(out), err)
+		}
+	}
+	// "e\u0301" is e followed by a combining acute accent.
+	for _, in := range []string{"abx", "ab\u0301", "e\u0301"} {
+		if _, err := p.Encrypt([]rune(in), nil); err == nil {
+			t.Errorf("expected error encrypting %q", in)
+		}
+		if _, err := p.Decrypt([]rune(in), nil); err == nil {
+			t.Errorf("expected error decrypting %q", in)
+		}
+	}
+
+	single := NewRunesFPE([]byte("foo"), []rune("中"))
+	for _, in := range []string{"", "中", "中中中中中"} {
+		out, err := single.Encrypt([]rune(in), []byte("tweak"))
+		if err != nil || string(out) != in {
+			t.Errorf("single-rune alphabet: Encrypt(%q) = %q, %v, expected identity", in, string(out), err)
+		}
+	}
+	if _, err := single.Encrypt([]rune("中a"), nil); err == nil {
+		t.Error("single-rune alphabet: expected error for rune outside the alphabet")
+	}
+
+	for _, alphabet := range []string{"", "abca", "ab\u0301"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for alphabet %q", alphabet)
+				}
+			}()
+			NewRunesFPE([]byte("foo"), []rune(alphabet))
+		}()
+	}
+}
@@ -0,0 +1,68 @@
+package permutation
+
+import (
+	"fmt"
+	"slices"
+)
+
+// SetPermuter permutes a finite set of integers, mapping every member of the set to a
+// member of the set.  The members are indexed in ascending order and the indices are
+// permuted with an ArbitraryN, so the mapping doesn't depend on the order that the values
+// are passed to NewSetPermuter.
+type SetPermuter struct {
+	p      *ArbitraryN
+	values []int
+	index  map[int]int
+}
+
+// NewSetPermuter returns a SetPermuter over values.  It panics if values is empty or
+// contains duplicates.
+func NewSetPermuter(key []byte, values []int) *SetPermuter {
+	if len(values) == 0 {
+		panic("values must not be empty")
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	index := make(map[int]int, len(sorted))
+	for i, v := range sorted {
+		if _, ok := index[v]; ok {
+			panic(fmt.Sprintf("values contains duplicate %v", v))
+		}
+		index[v] = i
+	}
+	return &SetPermuter{
+		p:      NewNInt(key, len(sorted)),
+		values: sorted,
+		index:  index,
+	}
+}
+
+// Len returns the number of values in the set.
+func (s *SetPermuter) Len() int {
+	return len(s.values)
+}
+
+// Contains returns whether v is in the set.
+func (s *SetPermuter) Contains(v int) bool {
+	_, ok := s.index[v]
+	return ok
+}
+
+// Permute returns the member of the set that v maps to.  It returns an error if v isn't in
+// the set.
+func (s *SetPermuter) Permute(v int) (int, error) {
+	i, ok := s.index[v]
+	if !ok {
+		return 0, errorf(ErrOutOfRange, "value %v is not in the set", v)
+	}
+	return s.values[s.p.PermuteInt(i)], nil
+}
+
+// Invert is the inverse of Permute.
+func (s *SetPermuter) Invert(v int) (int, error) {
+	i, ok := s.index[v]
+	if !ok {
+		return 0, errorf(ErrOutOfRange, "value %v is not in the set", v)
+	}
+	return s.values[s.p.InvertInt(i)], nil
+}
@@ -0,0 +1,73 @@
+package permutation
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestSetPermuter(t *testing.T) {
+	var values []int
+	for v := -1000; v < 5000; v += 2 {
+		values = append(values, v)
+	}
+	values = append(values, min(1<<40, math.MaxInt), 7, 12345)
+	s := NewSetPermuter([]byte("foo"), values)
+	if s.Len() != len(values) {
+		t.Errorf("Len() = %d, expected %d", s.Len(), len(values))
+	}
+	seen := make(map[int]bool, len(values))
+	for _, v := range values {
+		out, err := s.Permute(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !s.Contains(out) {
+			t.Fatalf("Permute(%d) = %d, which isn't in the set", v, out)
+		}
+		if seen[out] {
+			t.Fatalf("duplicate output %d", out)
+		}
+		seen[out] = true
+		inv, err := s.Invert(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inv != v {
+			t.Fatalf("Invert(%d) = %d, expected %d", out, inv, v)
+		}
+	}
+	// The order of the values doesn't matter.
+	reversed := slices.Clone(values)
+	slices.Reverse(reversed)
+	r := NewSetPermuter([]byte("foo"), reversed)
+	for _, v := range values {
+		a, _ := s.Permute(v)
+		b, _ := r.Permute(v)
+		if a != b {
+			t.Fatalf("Permute(%d) depends on the order of the values: %d != %d", v, a, b)
+		}
+	}
+}
+
+func TestSetPermuterErrors(t *testing.T) {
+	s := NewSetPermuter([]byte("foo"), []int{2, 4, 6, 8})
+	for _, v := range []int{-2, 0, 1, 3, 10} {
+		if _, err := s.Permute(v); err == nil {
+			t.Errorf("Permute(%d) should fail", v)
+		}
+		if _, err := s.Invert(v); err == nil {
+			t.Errorf("Invert(%d) should fail", v)
+		}
+	}
+	for _, values := range [][]int{nil, {1, 2, 1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewSetPermuter(%v) should panic", values)
+				}
+			}()
+			NewSetPermuter([]byte("foo"), values)
+		}()
+	}
+}
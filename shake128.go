@@ -5,65 +5,328 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math/big"
+	"slices"
 )
 
 // FeistelSHAKE128 implements a variable-length block cipher to generate a key-dependent
 // permutation over [0, 2^n - 1].  It uses a Feistel construction with SHAKE128 as the PRF
 // for the round function.  This allows for arbitrarily-long inputs/outputs.
+//
+// The input is split into A || B, where B is the low lengthBits/2 bits, and each round
+// computes A, B = B, A ^ F(i, B).  F(i, B) is the first ceil(w/8) bytes read from SHAKE128
+// after absorbing
+//
+//	len(key) || key || w || i || [len(tweak) || tweak] || B
+//
+// where w is the width in bits of the round's output (and of A), the integers len(key), w,
+// i and len(tweak) are 8-byte little-endian, the tweak and its length are only absorbed
+// when the tweak is non-empty, and B is big-endian in ceil(width(B)/8) bytes.  The bytes
+// read are interpreted as a big-endian integer, with the high bits of the first byte
+// cleared to leave w bits.  testdata/feistel_shake128_vectors.json has test vectors.
+//
+// The construction is frozen, as AlgorithmVersion describes, and its outputs depend on
+// nothing but SHAKE128 itself, which is fixed by FIPS 202.  The tests check crypto/sha3
+// against the standard's examples as well as pinning vectors, so that any change that
+// would stop stored values decoding is caught.
 type FeistelSHAKE128 struct {
 	key        []byte
 	lengthBits int
 	rounds     int
+	// split is the width of the low half, B, of the input.
+	split int
+	// label, if labeled is set, is the user's domain separation label.
+	label   string
+	labeled bool
+	// pepper, if non-empty, is a secret mixed in alongside the key.
+	pepper []byte
+	// prf, if set, replaces the keyed part of the round function.
+	prf        PRF
+	tweakLimit tweakLimit
+	// kdf is set when New derived the key with HKDF.
+	kdf kdfParams
+
+	// Pre-calculated values.  roundStates[i] is the SHAKE128 state after absorbing the
+	// parts of round i's input that don't vary between calls: label and pepper (if any), key length,
+	// key, output length and round index.
+	roundStates []sha3.SHAKE
 
 	// Scratch variables to avoid allocations.
 	in, a, b, c, f, mask big.Int
 	roundScratch         []byte
+	prfInput             []byte
 
-	h *sha3.SHAKE
+	h sha3.SHAKE
 }
 
 func NewPowerOf2(key []byte, lengthBits int) *FeistelSHAKE128 {
-	if lengthBits <= 1 {
-		panic(fmt.Sprintf("lengthBits must be >1, got: %v", lengthBits))
+	p, err := NewPowerOf2Err(key, lengthBits)
+	if err != nil {
+		panic(err.Error())
 	}
-	var rounds int
-	if lengthBits <= 9 {
-		rounds = 36
-	} else if lengthBits <= 13 {
-		rounds = 30
-	} else if lengthBits <= 19 {
-		rounds = 24
-	} else if lengthBits <= 31 {
-		rounds = 18
-	} else {
-		rounds = 12
+	return p
+}
+
+// NewPowerOf2Err is NewPowerOf2 but returns an error wrapping ErrInvalidParameter, rather
+// than panicking, if lengthBits is less than 2.
+func NewPowerOf2Err(key []byte, lengthBits int) (*FeistelSHAKE128, error) {
+	if lengthBits <= 1 {
+		return nil, errorf(ErrInvalidParameter, "lengthBits must be >1, got: %v", lengthBits)
 	}
-	return &FeistelSHAKE128{
+	rounds := RecommendedRounds(lengthBits)
+	p := &FeistelSHAKE128{
 		key:        key,
 		lengthBits: lengthBits,
-		h:          sha3.NewSHAKE128(),
 		rounds:     rounds,
+		split:      lengthBits / 2,
+	}
+	p.calculateRoundStates()
+	return p, nil
+}
+
+// PRF is a keyed pseudo-random function, for example HMAC-SHA256 computed by a hardware
+// security module that holds the key.  It must be deterministic and should return at
+// least 16 bytes.
+type PRF func(input []byte) []byte
+
+// NewPowerOf2PRF returns a FeistelSHAKE128 whose round function delegates the keyed step
+// to prf, so the key need never be seen by this package.  Each round calls prf once with
+// an encoding of the round index, output length, tweak and round input, and then expands
+// its output to the required length with (unkeyed) SHAKE128.
+func NewPowerOf2PRF(prf PRF, lengthBits int) *FeistelSHAKE128 {
+	if lengthBits <= 1 {
+		panic(fmt.Sprintf("lengthBits must be >1, got: %v", lengthBits))
+	}
+	p := &FeistelSHAKE128{
+		lengthBits: lengthBits,
+		rounds:     RecommendedRounds(lengthBits),
+		split:      lengthBits / 2,
+		prf:        prf,
+	}
+	p.calculateRoundStates()
+	return p
+}
+
+// NewPowerOf2String is equivalent to NewPowerOf2 with the UTF-8 bytes of key.
+func NewPowerOf2String(key string, lengthBits int) *FeistelSHAKE128 {
+	return NewPowerOf2([]byte(key), lengthBits)
+}
+
+// WithSplit moves the boundary between the two halves of the Feistel network so that the
+// low half, B, of the input is bits wide and the high half, A, has the remaining
+// lengthBits-bits bits.  The default is an even split, with B taking the smaller half when
+// lengthBits is odd.  Returns p as a convenience.
+//
+// For research only: the number of rounds is chosen for a balanced network.  In an
+// unbalanced network each round only mixes the narrower half's worth of bits into the other
+// half, so more rounds are needed for the same diffusion and the security margin shrinks as
+// the split becomes more extreme.  Changing the split changes the permutation.
+func (p *FeistelSHAKE128) WithSplit(bits int) *FeistelSHAKE128 {
+	if bits <= 0 || bits >= p.lengthBits {
+		panic(fmt.Sprintf("split must be in (0, %v), got: %v", p.lengthBits, bits))
+	}
+	p.split = bits
+	p.calculateRoundStates()
+	return p
+}
+
+// setRounds overrides the recommended number of rounds.
+func (p *FeistelSHAKE128) setRounds(rounds int) {
+	p.rounds = rounds
+	p.calculateRoundStates()
+}
+
+// feistelSHAKE128Label is absorbed ahead of the user's label by WithDomainLabel.  Changing it
+// would change the output of every labeled permutation, so that may only be done behind a
+// new constructor.
+const feistelSHAKE128Label = "permute.FeistelSHAKE128.v1"
+
+// WithDomainLabel separates this permutation from others with the same key and length:
+// permutations with different labels are independent.  Returns p as a convenience.
+//
+// Each round absorbs a fixed algorithm/version label and then the user's label ahead of
+// the key.  A permutation without a label absorbs neither, so that NewPowerOf2's output
+// is unchanged from before labels existed; it can't collide with a labeled one because
+// the first 8 bytes it absorbs are the key length.
+func (p *FeistelSHAKE128) WithDomainLabel(label string) *FeistelSHAKE128 {
+	p.label = label
+	p.labeled = true
+	p.calculateRoundStates()
+	return p
+}
+
+// feistelSHAKE128PepperLabel is absorbed ahead of the pepper by withPepper.
+const feistelSHAKE128PepperLabel = "permute.FeistelSHAKE128.pepper.v1"
+
+// withPepper mixes a secret pepper into every round alongside the key.  Each round absorbs
+// a fixed label, the pepper's length and then the pepper after the domain label (if any)
+// and ahead of the key.  It's a no-op for an empty pepper.  Returns p as a convenience.
+func (p *FeistelSHAKE128) withPepper(pepper []byte) *FeistelSHAKE128 {
+	p.pepper = slices.Clone(pepper)
+	p.calculateRoundStates()
+	return p
+}
+
+// Rekey switches p to a new key, keeping its length, rounds, split, label, pepper and
+// tweak limit and reusing its buffers.  Afterwards p behaves exactly like a newly
+// constructed FeistelSHAKE128 with the new key and the same options.  It panics for a
+// FeistelPRF, which has no key.  Returns p as a convenience.
+func (p *FeistelSHAKE128) Rekey(key []byte) *FeistelSHAKE128 {
+	if p.prf != nil {
+		panic("can't rekey a PRF-based permutation")
+	}
+	p.key = key
+	p.calculateRoundStates()
+	return p
+}
+
+// Clone returns an independent copy of p that shares its key-derived state but has its
+// own scratch, so that it can be used concurrently with p.  If p uses a PRF, the PRF must
+// be safe for concurrent use.
+func (p *FeistelSHAKE128) Clone() Permutation {
+	c := *p
+	c.roundStates = slices.Clone(p.roundStates)
+	c.in, c.a, c.b, c.c, c.f, c.mask = big.Int{}, big.Int{}, big.Int{}, big.Int{}, big.Int{}, big.Int{}
+	c.roundScratch, c.prfInput = nil, nil
+	c.h = sha3.SHAKE{}
+	return &c
+}
+
+func (p *FeistelSHAKE128) calculateRoundStates() {
+	if len(p.roundStates) != p.rounds {
+		p.roundStates = make([]sha3.SHAKE, p.rounds)
 	}
+	var buf [8]byte
+	for round := range p.rounds {
+		_, outLenBits := p.roundLens(round)
+		h := &p.roundStates[round]
+		*h = *sha3.NewSHAKE128()
+		if p.labeled {
+			_, _ = h.Write([]byte(feistelSHAKE128Label))
+			binary.LittleEndian.PutUint64(buf[:], uint64(len(p.label)))
+			_, _ = h.Write(buf[:])
+			_, _ = h.Write([]byte(p.label))
+		}
+		if len(p.pepper) > 0 {
+			_, _ = h.Write([]byte(feistelSHAKE128PepperLabel))
+			binary.LittleEndian.PutUint64(buf[:], uint64(len(p.pepper)))
+			_, _ = h.Write(buf[:])
+			_, _ = h.Write(p.pepper)
+		}
+		if p.prf != nil {
+			// The keyed part of the round happens in the PRF; the state is only used to
+			// expand its output.
+			continue
+		}
+		binary.LittleEndian.PutUint64(buf[:], uint64(len(p.key)))
+		_, _ = h.Write(buf[:])
+		_, _ = h.Write(p.key)
+		binary.LittleEndian.PutUint64(buf[:], uint64(outLenBits))
+		_, _ = h.Write(buf[:])
+		binary.LittleEndian.PutUint64(buf[:], uint64(round))
+		_, _ = h.Write(buf[:])
+	}
+}
+
+// InDomain returns whether v is in [0, 2^lengthBits).
+func (p *FeistelSHAKE128) InDomain(v *big.Int) bool {
+	return v.Sign() >= 0 && v.BitLen() <= p.lengthBits
+}
+
+func (p *FeistelSHAKE128) Rounds() int {
+	return p.rounds
+}
+
+func (p *FeistelSHAKE128) Algorithm() string {
+	if p.prf != nil {
+		return AlgoFeistelPRF
+	}
+	return AlgoFeistelSHAKE128
 }
 
 func (p *FeistelSHAKE128) PermuteInt(in int) int {
-	return int(p.PermuteInPlace(p.in.SetInt64(int64(in)), nil).Int64())
+	return p.PermuteIntTweak(in, nil)
+}
+
+func (p *FeistelSHAKE128) PermuteIntTweak(in int, tweak []byte) int {
+	if p.lengthBits <= 63 {
+		return int(p.permuteUint64(uint64(in), tweak))
+	}
+	return int(p.PermuteInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+func (p *FeistelSHAKE128) InvertInt(in int) int {
+	return p.InvertIntTweak(in, nil)
+}
+
+func (p *FeistelSHAKE128) InvertIntTweak(in int, tweak []byte) int {
+	if p.lengthBits <= 63 {
+		return int(p.invertUint64(uint64(in), tweak))
+	}
+	return int(p.InvertInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+// PermuteUint64 is PermuteInt for uint64 values.  It panics if p is more than 64 bits wide
+// or in is outside [0, 2^lengthBits).
+func (p *FeistelSHAKE128) PermuteUint64(in uint64) uint64 {
+	p.checkUint64(in)
+	return p.permuteUint64(in, nil)
+}
+
+// InvertUint64 is the inverse of PermuteUint64.
+func (p *FeistelSHAKE128) InvertUint64(in uint64) uint64 {
+	p.checkUint64(in)
+	return p.invertUint64(in, nil)
+}
+
+func (p *FeistelSHAKE128) checkUint64(in uint64) {
+	checkUint64Width(p.lengthBits)
+	if p.lengthBits < 64 && in>>p.lengthBits != 0 {
+		panic(fmt.Sprintf("input %v is outside range of permutation [0, 2^%v)", in, p.lengthBits))
+	}
+}
+
+// WithTweakMaxLen limits tweaks to at most max bytes; longer tweaks make the Try* methods
+// return an error and the other methods panic.  This bounds the hashing work when tweaks
+// are derived from untrusted input.  By default there is no limit.
+// Returns p as a convenience.
+func (p *FeistelSHAKE128) WithTweakMaxLen(max int) *FeistelSHAKE128 {
+	p.tweakLimit.setMax(max)
+	return p
+}
+
+// TryPermuteInPlace is PermuteInPlace but returns an error, rather than panicking, if
+// inOut is outside [0, 2^lengthBits) or the tweak is longer than the maximum set by
+// WithTweakMaxLen.
+func (p *FeistelSHAKE128) TryPermuteInPlace(inOut *big.Int, tweak []byte) (*big.Int, error) {
+	if err := p.check(inOut, tweak); err != nil {
+		return nil, err
+	}
+	return p.PermuteInPlace(inOut, tweak), nil
+}
+
+// TryInvertInPlace is InvertInPlace but returns an error rather than panicking.
+func (p *FeistelSHAKE128) TryInvertInPlace(inOut *big.Int, tweak []byte) (*big.Int, error) {
+	if err := p.check(inOut, tweak); err != nil {
+		return nil, err
+	}
+	return p.InvertInPlace(inOut, tweak), nil
+}
+
+func (p *FeistelSHAKE128) check(in *big.Int, tweak []byte) error {
+	if !p.InDomain(in) {
+		return errorf(ErrOutOfRange, "input %v is outside range of permutation [0, 2^%v)", in, p.lengthBits)
+	}
+	return p.tweakLimit.check(tweak)
 }
 
 // PermuteInPlace calculates inOut's permutated value and stores it back into inOut.
 // Returns inOut as a convenience.
 func (p *FeistelSHAKE128) PermuteInPlace(inOut *big.Int, tweak []byte) *big.Int {
-	split := p.lengthBits / 2
-	mask := &p.mask
-	mask.SetInt64(1)
-	mask.Lsh(mask, uint(split))
-	mask.Sub(mask, big.NewInt(1))
-	a := &p.a
-	b := &p.b
+	p.tweakLimit.mustCheck(tweak)
+	split := p.split
+	a, b := p.start(inOut, split)
 	c := &p.c
 	f := &p.f
-	b.And(inOut, mask)
-	a.Rsh(inOut, uint(split))
 	for i := range p.rounds {
 		f = p.RoundFunc(i, b, f, tweak)
 		c.Xor(a, f)
@@ -74,38 +337,179 @@ func (p *FeistelSHAKE128) PermuteInPlace(inOut *big.Int, tweak []byte) *big.Int
 	return out
 }
 
-func (p *FeistelSHAKE128) RoundFunc(round int, b, out *big.Int, tweak []byte) *big.Int {
-	var inLenBits, outLenBits int
+// InvertInPlace is the inverse of PermuteInPlace; it runs the Feistel rounds in reverse to
+// recover the value that permutes to inOut and stores it back into inOut.
+// Returns inOut as a convenience.
+func (p *FeistelSHAKE128) InvertInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	p.tweakLimit.mustCheck(tweak)
+	split := p.split
+	a, b := p.start(inOut, split)
+	c := &p.c
+	f := &p.f
+	for i := p.rounds - 1; i >= 0; i-- {
+		f = p.RoundFunc(i, a, f, tweak)
+		c.Xor(b, f)
+		a, b, c = c, a, b
+	}
+	out := inOut.Lsh(a, uint(split))
+	out.Or(out, b)
+	return out
+}
+
+// PermuteTrace runs PermuteInPlace on a copy of in and returns the (A, B) halves before
+// the first round and after each round, so the result has Rounds()+1 entries; B is the low
+// half.  The last entry recombines to PermuteInPlace's output.  Each half is a fresh
+// big.Int.  It is for testing and teaching: it allocates per round and is not used by
+// PermuteInPlace.
+func (p *FeistelSHAKE128) PermuteTrace(in *big.Int, tweak []byte) [][2]*big.Int {
+	p.tweakLimit.mustCheck(tweak)
+	a, b := p.start(in, p.split)
+	trace := make([][2]*big.Int, 0, p.rounds+1)
+	trace = append(trace, [2]*big.Int{new(big.Int).Set(a), new(big.Int).Set(b)})
+	for i := range p.rounds {
+		prev := trace[i]
+		f := p.RoundFunc(i, prev[1], new(big.Int), tweak)
+		trace = append(trace, [2]*big.Int{new(big.Int).Set(prev[1]), f.Xor(prev[0], f)})
+	}
+	return trace
+}
+
+// ScratchLen returns the minimum length of the scratch buffer accepted by
+// PermuteInPlaceScratch and InvertInPlaceScratch.
+func (p *FeistelSHAKE128) ScratchLen() int {
+	return (p.lengthBits + 7) / 8
+}
+
+// PermuteInPlaceScratch is PermuteInPlace but uses scratch, which must be at least
+// ScratchLen bytes, for the round function's input and output instead of a buffer owned by
+// p, so that buffers can be pooled by the caller.  It returns an error if scratch is too
+// short.  The contents of scratch are overwritten.
+func (p *FeistelSHAKE128) PermuteInPlaceScratch(inOut *big.Int, tweak, scratch []byte) (*big.Int, error) {
+	if err := p.checkScratch(scratch); err != nil {
+		return nil, err
+	}
+	saved := p.roundScratch
+	p.roundScratch = scratch
+	defer func() { p.roundScratch = saved }()
+	return p.PermuteInPlace(inOut, tweak), nil
+}
+
+// InvertInPlaceScratch is InvertInPlace with a caller-supplied scratch buffer; see
+// PermuteInPlaceScratch.
+func (p *FeistelSHAKE128) InvertInPlaceScratch(inOut *big.Int, tweak, scratch []byte) (*big.Int, error) {
+	if err := p.checkScratch(scratch); err != nil {
+		return nil, err
+	}
+	saved := p.roundScratch
+	p.roundScratch = scratch
+	defer func() { p.roundScratch = saved }()
+	return p.InvertInPlace(inOut, tweak), nil
+}
+
+func (p *FeistelSHAKE128) checkScratch(scratch []byte) error {
+	if len(scratch) < p.ScratchLen() {
+		return errorf(ErrInvalidLength, "scratch buffer must be at least %v bytes, got %v", p.ScratchLen(), len(scratch))
+	}
+	return nil
+}
+
+// permuteUint64 is the equivalent of PermuteInPlace for lengthBits <= 64, without any
+// big.Int arithmetic.
+func (p *FeistelSHAKE128) permuteUint64(in uint64, tweak []byte) uint64 {
+	p.tweakLimit.mustCheck(tweak)
+	split := uint(p.split)
+	a, b := in>>split, in&(1<<split-1)
+	for i := range p.rounds {
+		a, b = b, a^p.roundFuncUint64(i, b, tweak)
+	}
+	return a<<split | b
+}
+
+// invertUint64 is the equivalent of InvertInPlace for lengthBits <= 64.
+func (p *FeistelSHAKE128) invertUint64(in uint64, tweak []byte) uint64 {
+	p.tweakLimit.mustCheck(tweak)
+	split := uint(p.split)
+	a, b := in>>split, in&(1<<split-1)
+	for i := p.rounds - 1; i >= 0; i-- {
+		a, b = b^p.roundFuncUint64(i, a, tweak), a
+	}
+	return a<<split | b
+}
+
+// start splits in into its A and B halves, where B is the low split bits.
+func (p *FeistelSHAKE128) start(in *big.Int, split int) (a, b *big.Int) {
+	mask := &p.mask
+	mask.SetInt64(1)
+	mask.Lsh(mask, uint(split))
+	mask.Sub(mask, big.NewInt(1))
+	a = &p.a
+	b = &p.b
+	b.And(in, mask)
+	a.Rsh(in, uint(split))
+	return
+}
+
+// roundLens returns the widths, in bits, of the input and output of the given round.
+func (p *FeistelSHAKE128) roundLens(round int) (inLenBits, outLenBits int) {
 	if round&1 == 0 {
-		inLenBits = p.lengthBits / 2
+		inLenBits = p.split
 		outLenBits = p.lengthBits - inLenBits
 	} else {
-		outLenBits = p.lengthBits / 2
+		outLenBits = p.split
 		inLenBits = p.lengthBits - outLenBits
 	}
+	return
+}
+
+func (p *FeistelSHAKE128) RoundFunc(round int, b, out *big.Int, tweak []byte) *big.Int {
+	inLenBits, _ := p.roundLens(round)
+	scratch := p.roundInput(inLenBits)
+	b.FillBytes(scratch)
+	out.SetBytes(p.roundOutput(round, scratch, tweak))
+	return out
+}
+
+// roundFuncUint64 is the equivalent of RoundFunc for lengthBits <= 64.
+func (p *FeistelSHAKE128) roundFuncUint64(round int, b uint64, tweak []byte) uint64 {
+	inLenBits, _ := p.roundLens(round)
+	scratch := p.roundInput(inLenBits)
+	for i := len(scratch) - 1; i >= 0; i-- {
+		scratch[i] = byte(b)
+		b >>= 8
+	}
+	var out uint64
+	for _, c := range p.roundOutput(round, scratch, tweak) {
+		out = out<<8 | uint64(c)
+	}
+	return out
+}
 
+// roundInput returns the scratch buffer to hold the big-endian encoding of a round input
+// of inLenBits bits.
+func (p *FeistelSHAKE128) roundInput(inLenBits int) []byte {
 	if len(p.roundScratch) < (p.lengthBits+7)/8 {
 		p.roundScratch = make([]byte, (p.lengthBits+7)/8)
 	}
-	h := p.h
-	h.Reset()
-	var buf [8]byte
-	binary.LittleEndian.PutUint64(buf[:], uint64(len(p.key)))
-	_, _ = h.Write(buf[:])
-	_, _ = h.Write(p.key)
-	binary.LittleEndian.PutUint64(buf[:], uint64(outLenBits))
-	_, _ = h.Write(buf[:])
-	binary.LittleEndian.PutUint64(buf[:], uint64(round))
-	_, _ = h.Write(buf[:])
-	if len(tweak) > 0 {
-		binary.LittleEndian.PutUint64(buf[:], uint64(len(tweak)))
-		_, _ = h.Write(buf[:])
-		_, _ = h.Write(tweak)
+	return p.roundScratch[:(inLenBits+7)/8]
+}
+
+// roundOutput absorbs the tweak and the encoded round input, in, and returns the round's
+// output bytes with the excess high bits cleared.  The result overwrites in.
+func (p *FeistelSHAKE128) roundOutput(round int, in, tweak []byte) []byte {
+	_, outLenBits := p.roundLens(round)
+	h := &p.h
+	*h = p.roundStates[round]
+	if p.prf != nil {
+		_, _ = h.Write(p.callPRF(round, outLenBits, tweak, in))
+	} else {
+		var buf [8]byte
+		if len(tweak) > 0 {
+			binary.LittleEndian.PutUint64(buf[:], uint64(len(tweak)))
+			_, _ = h.Write(buf[:])
+			_, _ = h.Write(tweak)
+		}
+		_, _ = h.Write(in)
 	}
-	inLenBytes := (inLenBits + 7) / 8
-	scratch := p.roundScratch[:inLenBytes]
-	b.FillBytes(scratch)
-	_, _ = h.Write(scratch)
 
 	outLenBytes := (outLenBits + 7) / 8
 	outBytes := p.roundScratch[:outLenBytes]
@@ -115,6 +519,18 @@ func (p *FeistelSHAKE128) RoundFunc(round int, b, out *big.Int, tweak []byte) *b
 		mask := 0xff >> (8 - rem)
 		outBytes[0] = outBytes[0] & byte(mask)
 	}
-	out.SetBytes(outBytes)
-	return out
+	return outBytes
+}
+
+// callPRF calls the PRF with outLenBits || round || len(tweak) || tweak || b, where the
+// integers are encoded as 8-byte little-endian values.
+func (p *FeistelSHAKE128) callPRF(round, outLenBits int, tweak, b []byte) []byte {
+	in := p.prfInput[:0]
+	in = binary.LittleEndian.AppendUint64(in, uint64(outLenBits))
+	in = binary.LittleEndian.AppendUint64(in, uint64(round))
+	in = binary.LittleEndian.AppendUint64(in, uint64(len(tweak)))
+	in = append(in, tweak...)
+	in = append(in, b...)
+	p.prfInput = in
+	return p.prf(in)
 }
@@ -0,0 +1,88 @@
+package permutation
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// ShortCode maps IDs in [0, n) to permuted, fixed-length codes over an alphabet.  The code
+// length is the minimum that can represent every value in [0, n), and codes are padded
+// with the alphabet's first character, so every code has the same length and distinct IDs
+// always get distinct codes.
+type ShortCode struct {
+	p        *ArbitraryN
+	alphabet *alphabet
+	width    int
+
+	// Scratch variables to avoid allocations.
+	v big.Int
+}
+
+// NewShortCode returns a ShortCode over [0, n).  It panics if alphabet has fewer than 2
+// characters or contains duplicates.
+func NewShortCode(key []byte, n *big.Int, alphabet string) *ShortCode {
+	a, err := newAlphabet([]rune(alphabet))
+	if err != nil {
+		panic(err)
+	}
+	return &ShortCode{
+		p:        NewN(key, n),
+		alphabet: a,
+		width:    a.width(n),
+	}
+}
+
+// Len returns the length, in characters, of every code.
+func (c *ShortCode) Len() int {
+	return c.width
+}
+
+// Encode returns the code for id.
+func (c *ShortCode) Encode(id int) (string, error) {
+	c.v.SetInt64(int64(id))
+	if !c.p.InDomain(&c.v) {
+		return "", errorf(ErrOutOfRange, "id %v is outside range of permutation [0, %v)", id, &c.p.n)
+	}
+	return c.alphabet.encode(c.p.PermuteInPlace(&c.v, nil), c.width), nil
+}
+
+// Decode is the inverse of Encode.
+func (c *ShortCode) Decode(code string) (int, error) {
+	if err := c.alphabet.decode(&c.v, code, c.width); err != nil {
+		return 0, err
+	}
+	if !c.p.InDomain(&c.v) {
+		return 0, errorf(ErrOutOfRange, "code %q is outside range of permutation [0, %v)", code, &c.p.n)
+	}
+	return int(c.p.InvertInPlace(&c.v, nil).Int64()), nil
+}
+
+// MaxDomainForWidth returns alphabetSize^width, the largest n for which NewShortCode, with
+// an alphabet of alphabetSize characters, makes codes of at most width characters.  Any n
+// above alphabetSize^(width-1), up to this, gives codes of exactly width characters.  It
+// panics if alphabetSize is less than 2 or width is less than 1.
+func MaxDomainForWidth(alphabetSize, width int) *big.Int {
+	checkAlphabetSize(alphabetSize)
+	if width < 1 {
+		panic(fmt.Sprintf("width must be at least 1, got: %v", width))
+	}
+	radix := big.NewInt(int64(alphabetSize))
+	return radix.Exp(radix, big.NewInt(int64(width)), nil)
+}
+
+// WidthForDomain returns the length of the codes that NewShortCode makes for [0, n) with
+// an alphabet of alphabetSize characters: the minimum that can represent every value,
+// which is at least 1.  It panics if alphabetSize is less than 2 or n isn't positive.
+func WidthForDomain(alphabetSize int, n *big.Int) int {
+	checkAlphabetSize(alphabetSize)
+	if n.Sign() <= 0 {
+		panic(fmt.Sprintf("n must be positive, got: %v", n))
+	}
+	return digitWidth(big.NewInt(int64(alphabetSize)), n)
+}
+
+func checkAlphabetSize(alphabetSize int) {
+	if alphabetSize < 2 {
+		panic(fmt.Sprintf("alphabet must have at least 2 characters, got %d", alphabetSize))
+	}
+}
@@ -0,0 +1,131 @@
+package permutation
+
+import (
+	"math/big"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestShortCode(t *testing.T) {
+	for _, tc := range []struct {
+		n        int64
+		alphabet string
+		width    int
+	}{
+		{1, "01", 1},
+		{2, "01", 1},
+		{3, "01", 2},
+		{1000, "0123456789", 3},
+		{1001, "0123456789", 4},
+		{5000, "abcdefghijklmnopqrstuvwxyz", 3},
+		{100, "αβγδεζηθικ", 2},
+	} {
+		c := NewShortCode([]byte("foo"), big.NewInt(tc.n), tc.alphabet)
+		if c.Len() != tc.width {
+			t.Errorf("n=%d alphabet %q: expected width %d, got %d", tc.n, tc.alphabet, tc.width, c.Len())
+		}
+		seen := make(map[string]bool)
+		for id := range int(tc.n) {
+			code, err := c.Encode(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if utf8.RuneCountInString(code) != tc.width {
+				t.Fatalf("code %q for %d has the wrong length", code, id)
+			}
+			if seen[code] {
+				t.Fatalf("duplicate code %q", code)
+			}
+			seen[code] = true
+			decoded, err := c.Decode(code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded != id {
+				t.Fatalf("%d -> %q decoded to %d", id, code, decoded)
+			}
+		}
+	}
+}
+
+func TestShortCodeErrors(t *testing.T) {
+	c := NewShortCode([]byte("foo"), big.NewInt(500), "0123456789")
+	if _, err := c.Encode(500); err == nil {
+		t.Error("expected error encoding out-of-range id")
+	}
+	if _, err := c.Encode(-1); err == nil {
+		t.Error("expected error encoding negative id")
+	}
+	for _, code := range []string{"", "12", "1234", "12a", "999"} {
+		if _, err := c.Decode(code); err == nil {
+			t.Errorf("expected error decoding %q", code)
+		}
+	}
+	for _, alphabet := range []string{"", "a", "abca"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for alphabet %q", alphabet)
+				}
+			}()
+			NewShortCode([]byte("foo"), big.NewInt(500), alphabet)
+		}()
+	}
+}
+
+func TestMaxDomainForWidth(t *testing.T) {
+	const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	const base32 = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+	for _, tc := range []struct {
+		alphabet string
+		width    int
+		max      string
+	}{
+		{base62, 1, "62"},
+		{base62, 4, "14776336"},
+		{base62, 8, "218340105584896"},
+		{base62, 11, "52036560683837093888"},
+		{base32, 1, "32"},
+		{base32, 6, "1073741824"},
+		{base32, 13, "36893488147419103232"},
+	} {
+		size := len(tc.alphabet)
+		max := MaxDomainForWidth(size, tc.width)
+		if max.String() != tc.max {
+			t.Errorf("MaxDomainForWidth(%d, %d) = %v, expected %v", size, tc.width, max, tc.max)
+		}
+		if w := WidthForDomain(size, max); w != tc.width {
+			t.Errorf("WidthForDomain(%d, %v) = %d, expected %d", size, max, w, tc.width)
+		}
+		above := new(big.Int).Add(max, big.NewInt(1))
+		if w := WidthForDomain(size, above); w != tc.width+1 {
+			t.Errorf("WidthForDomain(%d, %v) = %d, expected %d", size, above, w, tc.width+1)
+		}
+		if c := NewShortCode([]byte("foo"), max, tc.alphabet); c.Len() != tc.width {
+			t.Errorf("ShortCode over [0, %v) has length %d, expected %d", max, c.Len(), tc.width)
+		}
+		code, err := NewShortCode([]byte("foo"), max, tc.alphabet).Encode(0)
+		if err != nil || len(code) != tc.width {
+			t.Errorf("code %q, err %v, expected width %d", code, err, tc.width)
+		}
+	}
+	if w := WidthForDomain(62, big.NewInt(1)); w != 1 {
+		t.Errorf("WidthForDomain(62, 1) = %d, expected 1", w)
+	}
+
+	for _, f := range []func(){
+		func() { MaxDomainForWidth(1, 4) },
+		func() { MaxDomainForWidth(62, 0) },
+		func() { WidthForDomain(1, big.NewInt(10)) },
+		func() { WidthForDomain(62, big.NewInt(0)) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
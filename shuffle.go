@@ -0,0 +1,73 @@
+package permutation
+
+import "fmt"
+
+// ShuffleInterface shuffles n elements using a keyed permutation.  It mirrors
+// math/rand.Shuffle: swap swaps the elements with indexes i and j.  The element that
+// starts at index i ends up at index NewNInt(key, n).PermuteInt(i).  Unshuffle reverses
+// the shuffle.
+func ShuffleInterface(key []byte, n int, swap func(i, j int)) {
+	if n <= 1 {
+		return
+	}
+	p := NewNInt(key, n)
+	applyPermutation(n, p.InvertInt, swap)
+}
+
+// Shuffle reorders s in place with a keyed permutation, as ShuffleInterface does: the
+// element that starts at index i ends up at index NewNInt(key, len(s)).PermuteInt(i).
+// Unlike a shuffle driven by math/rand, the order depends only on the key and the length,
+// so it is the same on every platform and Go version.  Slices of fewer than two elements
+// are left alone.
+func Shuffle[T any](key []byte, s []T) {
+	ShuffleInterface(key, len(s), func(i, j int) { s[i], s[j] = s[j], s[i] })
+}
+
+// ShuffleIndex returns the order in which Shuffle arranges n elements: element i of the
+// result is the original index of the element that Shuffle moves to index i, so
+// shuffled[i] = s[ShuffleIndex(key, len(s))[i]].  It panics if n is negative.
+func ShuffleIndex(key []byte, n int) []int {
+	if n < 0 {
+		panic(fmt.Sprintf("n must not be negative, got: %v", n))
+	}
+	out := make([]int, n)
+	if n <= 1 {
+		return out
+	}
+	p := NewNInt(key, n)
+	for i := range out {
+		out[i] = p.InvertInt(i)
+	}
+	return out
+}
+
+// Unshuffle reverses a call to ShuffleInterface with the same key and n.
+func Unshuffle(key []byte, n int, swap func(i, j int)) {
+	if n <= 1 {
+		return
+	}
+	p := NewNInt(key, n)
+	applyPermutation(n, p.PermuteInt, swap)
+}
+
+// applyPermutation moves the element at index source(i) to index i for each i using at
+// most n-1 swaps.
+func applyPermutation(n int, source func(i int) int, swap func(i, j int)) {
+	// at[i] is the original index of the element now at index i; where is its inverse.
+	at := make([]int, n)
+	where := make([]int, n)
+	for i := range n {
+		at[i] = i
+		where[i] = i
+	}
+	for i := range n {
+		j := where[source(i)]
+		if j == i {
+			continue
+		}
+		swap(i, j)
+		at[i], at[j] = at[j], at[i]
+		where[at[i]] = i
+		where[at[j]] = j
+	}
+}
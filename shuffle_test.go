@@ -0,0 +1,70 @@
+package permutation
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestShuffleInterface(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 5, 100, 1000} {
+		t.Run(fmt.Sprintf("n=%d", n), func(t *testing.T) {
+			s := make([]int, n)
+			for i := range s {
+				s[i] = i
+			}
+			swap := func(i, j int) { s[i], s[j] = s[j], s[i] }
+			ShuffleInterface([]byte("foo"), n, swap)
+			if n > 1 {
+				p := NewNInt([]byte("foo"), n)
+				for i := range n {
+					if s[p.PermuteInt(i)] != i {
+						t.Fatalf("element %d is not at index %d", i, p.PermuteInt(i))
+					}
+				}
+			}
+			Unshuffle([]byte("foo"), n, swap)
+			for i := range s {
+				if s[i] != i {
+					t.Fatalf("Unshuffle didn't restore index %d, got %d", i, s[i])
+				}
+			}
+		})
+	}
+}
+
+func TestShuffle(t *testing.T) {
+	// The order must not change between platforms or releases.
+	if order := ShuffleIndex([]byte("foo"), 10); !slices.Equal(order, []int{9, 8, 7, 6, 4, 1, 3, 5, 2, 0}) {
+		t.Errorf("ShuffleIndex gave %v", order)
+	}
+
+	for _, n := range []int{0, 1, 2, 10, 1000} {
+		t.Run(fmt.Sprintf("n=%d", n), func(t *testing.T) {
+			s := make([]string, n)
+			for i := range s {
+				s[i] = fmt.Sprint("card ", i)
+			}
+			shuffled := slices.Clone(s)
+			Shuffle([]byte("foo"), shuffled)
+			order := ShuffleIndex([]byte("foo"), n)
+			if len(order) != n {
+				t.Fatalf("ShuffleIndex returned %d indexes", len(order))
+			}
+			for i := range shuffled {
+				if shuffled[i] != s[order[i]] {
+					t.Fatalf("index %d holds %q, ShuffleIndex gives %q", i, shuffled[i], s[order[i]])
+				}
+			}
+
+			ints := make([]int, n)
+			for i := range ints {
+				ints[i] = i
+			}
+			ShuffleInterface([]byte("foo"), n, func(i, j int) { ints[i], ints[j] = ints[j], ints[i] })
+			if !slices.Equal(ints, order) {
+				t.Fatalf("ShuffleInterface gave %v, ShuffleIndex gave %v", ints, order)
+			}
+		})
+	}
+}
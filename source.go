@@ -0,0 +1,42 @@
+package permutation
+
+// Source is a math/rand Source64, and a math/rand/v2 Source, whose stream is a 64-bit FFX
+// permutation of a counter: the i-th value after seeding with s is the permutation of s+i.
+// Driving rand.New(src).Shuffle or Perm with it gives shuffles that are reproducible from
+// the key, and the counter behind any value can be recovered with Counter.
+//
+// Source is for reproducibility, not for cryptographic randomness: its output never
+// repeats within 2^64 values, so it is distinguishable from random once enough values have
+// been seen, and math/rand's algorithms aren't designed for secret streams anyway.  Use
+// ShuffleInterface for a keyed shuffle that can be reversed directly.
+type Source struct {
+	p       *FFX
+	counter uint64
+}
+
+// NewSource returns a Source for the key with its counter at 0.
+func NewSource(key []byte) *Source {
+	return &Source{p: NewFFX(key, 64)}
+}
+
+// Seed resets the counter to seed, for compatibility with math/rand.Source.
+func (s *Source) Seed(seed int64) {
+	s.counter = uint64(seed)
+}
+
+// Uint64 returns the permutation of the counter and then increments it.
+func (s *Source) Uint64() uint64 {
+	out := s.p.permuteUint64(s.counter, nil)
+	s.counter++
+	return out
+}
+
+// Int63 returns the top 63 bits of Uint64.
+func (s *Source) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// Counter returns the counter value that Uint64 permuted to produce v.
+func (s *Source) Counter(v uint64) uint64 {
+	return s.p.invertUint64(v, nil)
+}
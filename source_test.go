@@ -0,0 +1,47 @@
+package permutation
+
+import (
+	"math/rand"
+	randv2 "math/rand/v2"
+	"slices"
+	"testing"
+)
+
+var (
+	_ rand.Source64 = (*Source)(nil)
+	_ randv2.Source = (*Source)(nil)
+)
+
+func TestSource(t *testing.T) {
+	shuffle := func(key string) []int {
+		s := make([]int, 100)
+		for i := range s {
+			s[i] = i
+		}
+		rand.New(NewSource([]byte(key))).Shuffle(len(s), func(i, j int) { s[i], s[j] = s[j], s[i] })
+		return s
+	}
+	first := shuffle("foo")
+	if again := shuffle("foo"); !slices.Equal(first, again) {
+		t.Error("same key gave a different shuffle")
+	}
+	if other := shuffle("bar"); slices.Equal(first, other) {
+		t.Error("different key gave the same shuffle")
+	}
+	if slices.IsSorted(first) {
+		t.Error("shuffle left the slice in order")
+	}
+
+	src := NewSource([]byte("foo"))
+	src.Seed(1000)
+	for i := range uint64(10) {
+		v := src.Uint64()
+		if c := src.Counter(v); c != 1000+i {
+			t.Errorf("Counter(%d) = %d, expected %d", v, c, 1000+i)
+		}
+	}
+	src.Seed(1000)
+	if v := src.Int63(); v < 0 || uint64(v) != NewFFX([]byte("foo"), 64).permuteUint64(1000, nil)>>1 {
+		t.Errorf("Int63 after reseeding = %d", v)
+	}
+}
@@ -0,0 +1,129 @@
+package permutation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// SqidsDefaultAlphabet is the default alphabet of the Sqids (https://sqids.org) encoding.
+const SqidsDefaultAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// sqids implements the Sqids encoding, without a minimum length or blocklist.  IDs it
+// produces decode with any Sqids implementation using the same alphabet.
+type sqids struct {
+	alphabet []byte
+}
+
+func newSqids(alphabet string) (*sqids, error) {
+	if len(alphabet) < 3 {
+		return nil, fmt.Errorf("sqids alphabet must have at least 3 characters, got %d", len(alphabet))
+	}
+	for i := range len(alphabet) {
+		if alphabet[i] >= 0x80 {
+			return nil, errors.New("sqids alphabet must be ASCII")
+		}
+		if strings.IndexByte(alphabet[i+1:], alphabet[i]) >= 0 {
+			return nil, fmt.Errorf("sqids alphabet contains duplicate character %q", alphabet[i])
+		}
+	}
+	a := []byte(alphabet)
+	sqidsShuffle(a)
+	return &sqids{alphabet: a}, nil
+}
+
+func sqidsShuffle(chars []byte) {
+	for i, j := 0, len(chars)-1; j > 0; i, j = i+1, j-1 {
+		r := (i*j + int(chars[i]) + int(chars[j])) % len(chars)
+		chars[i], chars[r] = chars[r], chars[i]
+	}
+}
+
+func (s *sqids) encode(numbers []uint64) string {
+	n := uint64(len(s.alphabet))
+	offset := uint64(len(numbers))
+	for i, v := range numbers {
+		offset += uint64(s.alphabet[v%n]) + uint64(i)
+	}
+	offset %= n
+
+	alphabet := append(slices.Clone(s.alphabet[offset:]), s.alphabet[:offset]...)
+	prefix := alphabet[0]
+	slices.Reverse(alphabet)
+
+	id := []byte{prefix}
+	for i, v := range numbers {
+		id = sqidsAppendNumber(id, v, alphabet[1:])
+		if i < len(numbers)-1 {
+			id = append(id, alphabet[0])
+			sqidsShuffle(alphabet)
+		}
+	}
+	return string(id)
+}
+
+func sqidsAppendNumber(id []byte, v uint64, alphabet []byte) []byte {
+	start := len(id)
+	n := uint64(len(alphabet))
+	for {
+		id = append(id, alphabet[v%n])
+		v /= n
+		if v == 0 {
+			break
+		}
+	}
+	slices.Reverse(id[start:])
+	return id
+}
+
+func (s *sqids) decode(id string) ([]uint64, error) {
+	if id == "" {
+		return nil, errors.New("empty sqids ID")
+	}
+	for i := range len(id) {
+		if slices.Index(s.alphabet, id[i]) < 0 {
+			return nil, fmt.Errorf("character %q at index %d is not in the alphabet", id[i], i)
+		}
+	}
+	offset := slices.Index(s.alphabet, id[0])
+	alphabet := append(slices.Clone(s.alphabet[offset:]), s.alphabet[:offset]...)
+	slices.Reverse(alphabet)
+
+	var numbers []uint64
+	rest := id[1:]
+	for len(rest) > 0 {
+		separator := alphabet[0]
+		chunk, after, found := strings.Cut(rest, string(separator))
+		if chunk == "" {
+			break
+		}
+		v, err := sqidsToNumber(chunk, alphabet[1:])
+		if err != nil {
+			return nil, err
+		}
+		numbers = append(numbers, v)
+		if found {
+			sqidsShuffle(alphabet)
+		}
+		rest = after
+	}
+	return numbers, nil
+}
+
+func sqidsToNumber(chunk string, alphabet []byte) (uint64, error) {
+	n := uint64(len(alphabet))
+	var v uint64
+	for i := range len(chunk) {
+		digit := slices.Index(alphabet, chunk[i])
+		if digit < 0 {
+			return 0, fmt.Errorf("character %q is not valid here", chunk[i])
+		}
+		if v > (math.MaxUint64-uint64(digit))/n {
+			return 0, errors.New("sqids number overflows uint64")
+		}
+		v = v*n + uint64(digit)
+	}
+	return v, nil
+}
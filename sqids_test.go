@@ -0,0 +1,57 @@
+package permutation
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestSqidsVectors(t *testing.T) {
+	s, err := newSqids(SqidsDefaultAlphabet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		numbers []uint64
+		id      string
+	}{
+		{[]uint64{1, 2, 3}, "86Rf07"},
+		{[]uint64{0}, "bM"},
+		{[]uint64{1}, "Uk"},
+		{[]uint64{2}, "gb"},
+	} {
+		if id := s.encode(tc.numbers); id != tc.id {
+			t.Errorf("encode(%v) = %q, expected %q", tc.numbers, id, tc.id)
+		}
+		numbers, err := s.decode(tc.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(numbers, tc.numbers) {
+			t.Errorf("decode(%q) = %v, expected %v", tc.id, numbers, tc.numbers)
+		}
+	}
+
+	s, err = newSqids("0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := s.encode([]uint64{1, 2, 3}); id != "489158" {
+		t.Errorf("custom alphabet: encode([1 2 3]) = %q, expected %q", id, "489158")
+	}
+}
+
+func TestSqidsToNumberOverflow(t *testing.T) {
+	alphabet := []byte(base62Digits)
+	maxID := string(sqidsAppendNumber(nil, math.MaxUint64, alphabet))
+	if v, err := sqidsToNumber(maxID, alphabet); err != nil || v != math.MaxUint64 {
+		t.Fatalf("sqidsToNumber(%q) = %v, %v, expected MaxUint64", maxID, v, err)
+	}
+	// The first overflows in the multiplication; the second only in the addition, since
+	// MaxUint64 is 15 mod 62.
+	for _, chunk := range []string{maxID + "0", string(sqidsAppendNumber(nil, math.MaxUint64/62, alphabet)) + "z"} {
+		if v, err := sqidsToNumber(chunk, alphabet); err == nil {
+			t.Errorf("sqidsToNumber(%q) = %v, expected an overflow error", chunk, v)
+		}
+	}
+}
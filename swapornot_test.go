@@ -0,0 +1,113 @@
+package permutation
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func TestBitStreamGolden(t *testing.T) {
+	bitString := func(s *bitStream, round int) string {
+		var out []byte
+		for i := range uint64(16) {
+			if s.bit(round, i) {
+				out = append(out, '1')
+			} else {
+				out = append(out, '0')
+			}
+		}
+		return string(out)
+	}
+
+	s := newBitStream("permute.SwapOrNot", []byte("foo"))
+	if bits := bitString(s, 0); bits != "1111010000011001" {
+		t.Errorf("round 0 bits = %s", bits)
+	}
+	if bits := bitString(s, 1); bits != "0110000011101000" {
+		t.Errorf("round 1 bits = %s", bits)
+	}
+	for round, expected := range []uint64{234, 209, 436} {
+		if v := s.intN(round, 0, 1000); v != expected {
+			t.Errorf("intN(%d, 0, 1000) = %d, expected %d", round, v, expected)
+		}
+	}
+	s.setTweak([]byte("tweak"))
+	if bits := bitString(s, 0); bits != "0000000110110111" {
+		t.Errorf("tweaked round 0 bits = %s", bits)
+	}
+	// Clearing the tweak restores the untweaked stream.
+	s.setTweak(nil)
+	if bits := bitString(s, 0); bits != "1111010000011001" {
+		t.Errorf("round 0 bits after resetting tweak = %s", bits)
+	}
+}
+
+func TestSwapOrNotGolden(t *testing.T) {
+	p := NewSwapOrNot([]byte("foo"), 10)
+	expected := []int{2, 4, 9, 0, 3, 5, 7, 6, 1, 8}
+	for i, exp := range expected {
+		if out := p.PermuteInt(i); out != exp {
+			t.Errorf("PermuteInt(%d) = %d, expected %d", i, out, exp)
+		}
+	}
+}
+
+func TestSwapOrNot(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 10, 257, 1000} {
+		for _, tweak := range [][]byte{nil, []byte("tweak")} {
+			t.Run(fmt.Sprintf("%d/%q", n, tweak), func(t *testing.T) {
+				p := NewSwapOrNot([]byte("foo"), n)
+				seen := make(map[int64]bool, n)
+				for i := range int64(n) {
+					out := p.PermuteInPlace(big.NewInt(i), tweak)
+					if !p.InDomain(out) {
+						t.Fatalf("output %v out of range", out)
+					}
+					if seen[out.Int64()] {
+						t.Fatalf("duplicate output %v", out)
+					}
+					seen[out.Int64()] = true
+					if inv := p.InvertInPlace(new(big.Int).Set(out), tweak); inv.Int64() != i {
+						t.Fatalf("InvertInPlace(%v) = %v, expected %d", out, inv, i)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestNewNSecure(t *testing.T) {
+	key := []byte("foo")
+	for _, n := range []int64{1, 10, 1000} {
+		p := NewNSecure(key, big.NewInt(n))
+		if p.Algorithm() != AlgoSwapOrNot {
+			t.Fatalf("n=%d: Algorithm() = %v, expected %v", n, p.Algorithm(), AlgoSwapOrNot)
+		}
+		seen := make(map[int]bool)
+		for i := range int(n) {
+			out := p.PermuteInt(i)
+			if seen[out] {
+				t.Fatalf("n=%d: duplicate output %d", n, out)
+			}
+			seen[out] = true
+			if inv := p.InvertInt(out); inv != i {
+				t.Fatalf("n=%d: %d -> %d inverted to %d", n, i, out, inv)
+			}
+		}
+	}
+
+	large := big.NewInt(int64(SmallDomainThreshold))
+	p := NewNSecure(key, large)
+	if p.Algorithm() != AlgoFFX {
+		t.Fatalf("n=%v: Algorithm() = %v, expected %v", large, p.Algorithm(), AlgoFFX)
+	}
+	if out, expected := p.PermuteInt(12345), NewN(key, large).PermuteInt(12345); out != expected {
+		t.Errorf("n=%v: PermuteInt(12345) = %d, NewN gives %d", large, out, expected)
+	}
+
+	defer func(old int) { SmallDomainThreshold = old }(SmallDomainThreshold)
+	SmallDomainThreshold = 100
+	if p := NewNSecure(key, big.NewInt(1000)); p.Algorithm() != AlgoFFX {
+		t.Errorf("with threshold 100, n=1000 gave %v, expected %v", p.Algorithm(), AlgoFFX)
+	}
+}
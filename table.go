@@ -0,0 +1,179 @@
+package permutation
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// MaxTableSize is the largest domain that NewTablePermutation accepts.  A table uses 8
+// bytes per element, so this limits the tables to 8MiB.
+const MaxTableSize = 1 << 20
+
+// TablePermutation serves a permutation over [0, n) from precomputed forward and inverse
+// tables, so untweaked calls need no cryptography at all.  Tweaked calls are passed through
+// to the underlying permutation.
+type TablePermutation struct {
+	p                Permutation
+	forward, inverse []uint32
+}
+
+// NewTablePermutation precomputes the tables for p, which must be a permutation over
+// [0, n).  It panics if n is not in [1, MaxTableSize] or p isn't a permutation over [0, n).
+func NewTablePermutation(p Permutation, n int) *TablePermutation {
+	if n <= 0 || n > MaxTableSize {
+		panic(fmt.Sprintf("n must be in [1, %v], got: %v", MaxTableSize, n))
+	}
+	if !p.InDomain(big.NewInt(int64(n-1))) || p.InDomain(big.NewInt(int64(n))) {
+		panic(fmt.Sprintf("permutation's domain is not [0, %v)", n))
+	}
+	t := &TablePermutation{
+		p:       p,
+		forward: make([]uint32, n),
+		inverse: make([]uint32, n),
+	}
+	filled := make([]bool, n)
+	for i := range n {
+		out := p.PermuteInt(i)
+		if filled[out] {
+			panic(fmt.Sprintf("permutation maps two inputs to %v", out))
+		}
+		filled[out] = true
+		t.forward[i] = uint32(out)
+		t.inverse[out] = uint32(i)
+	}
+	return t
+}
+
+// InDomain returns whether v is in [0, n).
+func (t *TablePermutation) InDomain(v *big.Int) bool {
+	return v.Sign() >= 0 && v.Cmp(big.NewInt(int64(len(t.forward)))) < 0
+}
+
+// Clone returns a copy of t that shares its read-only tables and has a clone of the
+// underlying permutation for tweaked calls.
+func (t *TablePermutation) Clone() Permutation {
+	return &TablePermutation{p: t.p.Clone(), forward: t.forward, inverse: t.inverse}
+}
+
+func (t *TablePermutation) Rounds() int {
+	return t.p.Rounds()
+}
+
+func (t *TablePermutation) Algorithm() string {
+	return t.p.Algorithm()
+}
+
+func (t *TablePermutation) PermuteInt(in int) int {
+	t.mustCheck(in)
+	return int(t.forward[in])
+}
+
+// PermuteIntTweak uses the table when tweak is empty and otherwise the permutation the table
+// was built from.
+func (t *TablePermutation) PermuteIntTweak(in int, tweak []byte) int {
+	if len(tweak) > 0 {
+		return t.p.PermuteIntTweak(in, tweak)
+	}
+	return t.PermuteInt(in)
+}
+
+func (t *TablePermutation) InvertInt(in int) int {
+	t.mustCheck(in)
+	return int(t.inverse[in])
+}
+
+// InvertIntTweak uses the table when tweak is empty and otherwise the permutation the table
+// was built from.
+func (t *TablePermutation) InvertIntTweak(in int, tweak []byte) int {
+	if len(tweak) > 0 {
+		return t.p.InvertIntTweak(in, tweak)
+	}
+	return t.InvertInt(in)
+}
+
+func (t *TablePermutation) PermuteUint64(in uint64) uint64 {
+	t.mustCheckUint64(in)
+	return uint64(t.forward[in])
+}
+
+func (t *TablePermutation) InvertUint64(in uint64) uint64 {
+	t.mustCheckUint64(in)
+	return uint64(t.inverse[in])
+}
+
+// PermuteInPlace calculates inOut's permutated value and stores it back into inOut.
+// Returns inOut as a convenience.
+func (t *TablePermutation) PermuteInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	if len(tweak) > 0 {
+		return t.p.PermuteInPlace(inOut, tweak)
+	}
+	t.mustCheckBig(inOut)
+	return inOut.SetUint64(uint64(t.forward[inOut.Uint64()]))
+}
+
+// InvertInPlace is the inverse of PermuteInPlace.  Returns inOut as a convenience.
+func (t *TablePermutation) InvertInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	if len(tweak) > 0 {
+		return t.p.InvertInPlace(inOut, tweak)
+	}
+	t.mustCheckBig(inOut)
+	return inOut.SetUint64(uint64(t.inverse[inOut.Uint64()]))
+}
+
+func (t *TablePermutation) mustCheck(in int) {
+	if in < 0 || in >= len(t.forward) {
+		panic(fmt.Sprintf("input %v is outside range of permutation [0, %v)", in, len(t.forward)))
+	}
+}
+
+func (t *TablePermutation) mustCheckUint64(in uint64) {
+	if in >= uint64(len(t.forward)) {
+		panic(fmt.Sprintf("input %v is outside range of permutation [0, %v)", in, len(t.forward)))
+	}
+}
+
+func (t *TablePermutation) mustCheckBig(in *big.Int) {
+	if !in.IsInt64() {
+		panic(fmt.Sprintf("input %v is outside range of permutation [0, %v)", in, len(t.forward)))
+	}
+	t.mustCheck(int(in.Int64()))
+}
+
+// MaxMaterializeSize is the largest domain that Materialize accepts, to stop a mistaken n
+// from allocating a huge slice.  At 8 bytes per element its result is at most 128MiB.
+const MaxMaterializeSize = 1 << 24
+
+// Materialize returns the whole permutation p over [0, n) as a slice, with out[i] equal to
+// p.PermuteInt(i), for shuffling a deck or building a test fixture: lookups are then a
+// slice index and the outputs can be iterated in input order.  PermuteInt reuses p's own
+// scratch, so only the slice is allocated.  Unlike NewTablePermutation it doesn't build an
+// inverse or check that the outputs are distinct.  It returns an error if n is not in
+// [0, MaxMaterializeSize] or p's domain is not [0, n); an ArbitraryN with forbidden values
+// has holes in its domain, so use its PermutePage instead.
+func Materialize(p Permutation, n int) ([]int, error) {
+	if n < 0 || n > MaxMaterializeSize {
+		return nil, errorf(ErrOutOfRange, "n must be in [0, %v], got: %v", MaxMaterializeSize, n)
+	}
+	last := big.NewInt(int64(n - 1))
+	if (n > 0 && !p.InDomain(last)) || p.InDomain(last.SetInt64(int64(n))) {
+		return nil, errorf(ErrOutOfRange, "permutation's domain is not [0, %v)", n)
+	}
+	out := make([]int, n)
+	for i := range out {
+		out[i] = p.PermuteInt(i)
+	}
+	return out, nil
+}
+
+// NewAuto returns a permutation over [0, n) that is served from a TablePermutation if n is
+// at most tableThreshold (and MaxTableSize), and otherwise computed on the fly by the
+// ArbitraryN that NewN returns.  Either way the mapping is the same.  The tables cost 8
+// bytes per element, so a threshold of 2^16 uses at most 512KiB, and building them costs
+// one permutation of every value in the domain up front.
+func NewAuto(key []byte, n *big.Int, tableThreshold int) Permutation {
+	p := NewN(key, n)
+	if n.IsInt64() && n.Int64() <= int64(min(tableThreshold, MaxTableSize)) {
+		return NewTablePermutation(p, int(n.Int64()))
+	}
+	return p
+}
@@ -0,0 +1,154 @@
+package permutation
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestTablePermutation(t *testing.T) {
+	for _, n := range []int{1, 2, 100, 1000, 4096} {
+		p := NewNInt([]byte("foo"), n)
+		table := NewTablePermutation(NewNInt([]byte("foo"), n), n)
+		if table.Algorithm() != p.Algorithm() || table.Rounds() != p.Rounds() {
+			t.Errorf("n=%d: table reports %v/%d, expected %v/%d",
+				n, table.Algorithm(), table.Rounds(), p.Algorithm(), p.Rounds())
+		}
+		for i := range n {
+			out := table.PermuteInt(i)
+			if expected := p.PermuteInt(i); out != expected {
+				t.Fatalf("n=%d: PermuteInt(%d) = %d, expected %d", n, i, out, expected)
+			}
+			if inv := table.InvertInt(out); inv != i {
+				t.Fatalf("n=%d: InvertInt(%d) = %d, expected %d", n, out, inv, i)
+			}
+			if out2 := table.PermuteInPlace(big.NewInt(int64(i)), nil); out2.Int64() != int64(out) {
+				t.Fatalf("n=%d: PermuteInPlace(%d) = %v, expected %d", n, i, out2, out)
+			}
+			if inv := table.InvertInPlace(big.NewInt(int64(out)), []byte{}); inv.Int64() != int64(i) {
+				t.Fatalf("n=%d: InvertInPlace(%d) = %v, expected %d", n, out, inv, i)
+			}
+		}
+	}
+}
+
+func TestMaterialize(t *testing.T) {
+	for _, tc := range []struct {
+		p Permutation
+		n int
+	}{
+		{NewNInt([]byte("foo"), 52), 52},
+		{NewNInt([]byte("foo"), 100000), 100000},
+		{NewPowerOf2([]byte("foo"), 12), 1 << 12},
+		{NewTablePermutation(NewNInt([]byte("foo"), 1000), 1000), 1000},
+	} {
+		p, n := tc.p, tc.n
+		out, err := Materialize(p, n)
+		if err != nil {
+			t.Fatalf("n=%d: %v", n, err)
+		}
+		if len(out) != n {
+			t.Fatalf("n=%d: got %d values", n, len(out))
+		}
+		seen := make([]bool, n)
+		for i, v := range out {
+			if v < 0 || v >= n || seen[v] {
+				t.Fatalf("n=%d: out[%d] = %d is out of range or a duplicate", n, i, v)
+			}
+			seen[v] = true
+			if expected := p.PermuteInt(i); v != expected {
+				t.Fatalf("n=%d: out[%d] = %d, PermuteInt gives %d", n, i, v, expected)
+			}
+		}
+	}
+
+	empty, err := Materialize(NewNInt([]byte("foo"), 1), 0)
+	if err == nil || empty != nil {
+		t.Errorf("n doesn't match the domain: got %v, %v", empty, err)
+	}
+	for _, n := range []int{-1, 999, 1001, MaxMaterializeSize + 1} {
+		if _, err := Materialize(NewNInt([]byte("foo"), 1000), n); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("n=%d: expected ErrOutOfRange, got %v", n, err)
+		}
+	}
+}
+
+func TestTablePermutationTweak(t *testing.T) {
+	p := NewNInt([]byte("foo"), 1000)
+	table := NewTablePermutation(NewNInt([]byte("foo"), 1000), 1000)
+	tweak := []byte("tweak")
+	for i := range int64(1000) {
+		out := table.PermuteInPlace(big.NewInt(i), tweak)
+		if expected := p.PermuteInPlace(big.NewInt(i), tweak); out.Cmp(expected) != 0 {
+			t.Fatalf("PermuteInPlace(%d, %q) = %v, expected %v", i, tweak, out, expected)
+		}
+		if inv := table.InvertInPlace(out, tweak); inv.Int64() != i {
+			t.Fatalf("InvertInPlace = %v, expected %d", inv, i)
+		}
+	}
+}
+
+func TestTablePermutationBounds(t *testing.T) {
+	table := NewTablePermutation(NewNInt([]byte("foo"), 100), 100)
+	for _, v := range []int64{-1, 0, 99, 100} {
+		expected := v >= 0 && v < 100
+		if table.InDomain(big.NewInt(v)) != expected {
+			t.Errorf("InDomain(%d) = %v, expected %v", v, !expected, expected)
+		}
+	}
+	for _, f := range []func(){
+		func() { table.PermuteInt(100) },
+		func() { table.InvertInt(-1) },
+		func() { table.PermuteInPlace(new(big.Int).Lsh(big.NewInt(1), 70), nil) },
+		func() { NewTablePermutation(NewNInt([]byte("foo"), 100), 99) },
+		func() { NewTablePermutation(NewNInt([]byte("foo"), 100), 101) },
+		func() { NewTablePermutation(NewPowerOf2([]byte("foo"), 21), 1<<21) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func BenchmarkTablePermutation_PermuteInt(b *testing.B) {
+	b.ReportAllocs()
+	p := NewTablePermutation(NewNInt([]byte("foobarbaz"), 5000), 5000)
+	for b.Loop() {
+		p.PermuteInt(1234)
+	}
+}
+
+func BenchmarkTablePermutation_PermuteIntUncached(b *testing.B) {
+	b.ReportAllocs()
+	p := NewNInt([]byte("foobarbaz"), 5000)
+	for b.Loop() {
+		p.PermuteInt(1234)
+	}
+}
+
+func TestNewAuto(t *testing.T) {
+	const threshold = 1000
+	for _, n := range []int{threshold - 1, threshold, threshold + 1} {
+		p := NewAuto([]byte("foo"), big.NewInt(int64(n)), threshold)
+		_, isTable := p.(*TablePermutation)
+		if isTable != (n <= threshold) {
+			t.Errorf("n=%d: got %T", n, p)
+		}
+		expected := NewNInt([]byte("foo"), n)
+		for i := range n {
+			if out, exp := p.PermuteInt(i), expected.PermuteInt(i); out != exp {
+				t.Fatalf("n=%d: PermuteInt(%d) = %d, expected %d", n, i, out, exp)
+			}
+		}
+	}
+	// The threshold is capped at MaxTableSize.
+	p := NewAuto([]byte("foo"), big.NewInt(MaxTableSize+1), MaxTableSize*2)
+	if _, isTable := p.(*TablePermutation); isTable {
+		t.Error("domain above MaxTableSize got a table")
+	}
+}
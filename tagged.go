@@ -0,0 +1,117 @@
+package permutation
+
+import (
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Tagged pairs an ArbitraryN with a truncated HMAC-SHA256 tag over each permuted value so
+// that forged values can be rejected before inverting them.  The MAC key is derived from
+// the permutation key with HKDF, so only one key needs to be managed.
+type Tagged struct {
+	p      *ArbitraryN
+	macKey []byte
+	tagLen int
+
+	// Scratch variables to avoid allocations.
+	v big.Int
+}
+
+var errBadTag = errors.New("tag doesn't match value")
+
+// NewTagged returns a tagged permutation over [0, n) with tags of tagLen bytes, which must
+// be in [1, 32].  Shorter tags are easier to forge by guessing: a forger succeeds with
+// probability 2^-(8*tagLen) per attempt, so tagLen should be at least 8 unless guesses are
+// rate-limited.
+func NewTagged(key []byte, n *big.Int, tagLen int) *Tagged {
+	if tagLen < 1 || tagLen > sha256.Size {
+		panic(fmt.Sprintf("tagLen must be in [1, %v], got: %v", sha256.Size, tagLen))
+	}
+	macKey, err := hkdf.Key(sha256.New, key, nil, "permute.Tagged", sha256.Size)
+	if err != nil {
+		panic(err)
+	}
+	return &Tagged{
+		p:      NewN(key, n),
+		macKey: macKey,
+		tagLen: tagLen,
+	}
+}
+
+// PermuteTagged permutes in and returns the result along with its tag.
+func (t *Tagged) PermuteTagged(in int) (out int, tag []byte) {
+	out = t.p.PermuteInt(in)
+	return out, t.tag(out)
+}
+
+// InvertTagged checks the tag in constant time and, if it's valid, returns the value that
+// permutes to out.
+func (t *Tagged) InvertTagged(out int, tag []byte) (int, error) {
+	if !hmac.Equal(tag, t.tag(out)) {
+		return 0, errBadTag
+	}
+	t.v.SetInt64(int64(out))
+	if !t.p.InDomain(&t.v) {
+		return 0, errorf(ErrOutOfRange, "value %v is outside range of permutation [0, %v)", out, &t.p.n)
+	}
+	return t.p.InvertInt(out), nil
+}
+
+// Belongs reports whether tag is the tag of out from PermuteTagged, checking it in constant
+// time without inverting out, so that forged values can be rejected cheaply before doing
+// any other work.  It also rejects values outside [0, n).
+func (t *Tagged) Belongs(out int, tag []byte) bool {
+	t.v.SetInt64(int64(out))
+	return t.p.InDomain(&t.v) && hmac.Equal(tag, t.tag(out))
+}
+
+// PermuteChecked permutes in with the given tweak and returns the result along with a tag
+// over both the result and the tweak.  A mismatched tweak would otherwise go unnoticed,
+// since inverting with the wrong tweak still gives a value in range; InvertChecked
+// detects it.  PermuteTagged and the methods of ArbitraryN remain tag-free with respect to
+// the tweak.
+func (t *Tagged) PermuteChecked(in int, tweak []byte) (out int, tag []byte) {
+	t.v.SetInt64(int64(in))
+	out = int(t.p.PermuteInPlace(&t.v, tweak).Int64())
+	return out, t.tweakedTag(out, tweak)
+}
+
+// InvertChecked is the inverse of PermuteChecked.  It returns an error if the tag doesn't
+// match out and tweak, which includes the case where tweak differs from the one passed to
+// PermuteChecked.
+func (t *Tagged) InvertChecked(out int, tag, tweak []byte) (int, error) {
+	if !hmac.Equal(tag, t.tweakedTag(out, tweak)) {
+		return 0, errBadTag
+	}
+	t.v.SetInt64(int64(out))
+	if !t.p.InDomain(&t.v) {
+		return 0, errorf(ErrOutOfRange, "value %v is outside range of permutation [0, %v)", out, &t.p.n)
+	}
+	return int(t.p.InvertInPlace(&t.v, tweak).Int64()), nil
+}
+
+func (t *Tagged) tag(out int) []byte {
+	return t.macSum(out, nil, false)
+}
+
+// tweakedTag is the tag over out || len(tweak) || tweak, with the length as 8 bytes
+// little-endian.  It's longer than the input of tag so the two can't collide.
+func (t *Tagged) tweakedTag(out int, tweak []byte) []byte {
+	return t.macSum(out, tweak, true)
+}
+
+func (t *Tagged) macSum(out int, tweak []byte, tweaked bool) []byte {
+	mac := hmac.New(sha256.New, t.macKey)
+	t.v.SetInt64(int64(out))
+	_, _ = mac.Write(t.v.FillBytes(make([]byte, 8)))
+	if tweaked {
+		_, _ = mac.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(tweak))))
+		_, _ = mac.Write(tweak)
+	}
+	return mac.Sum(nil)[:t.tagLen]
+}
@@ -0,0 +1,113 @@
+package permutation
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+func TestTagged(t *testing.T) {
+	p := NewTagged([]byte("foo"), big.NewInt(1000), 8)
+	for i := range 1000 {
+		out, tag := p.PermuteTagged(i)
+		if len(tag) != 8 {
+			t.Fatalf("expected 8-byte tag, got %d bytes", len(tag))
+		}
+		if out != p.p.PermuteInt(i) {
+			t.Fatalf("tagged permutation of %d differs from untagged", i)
+		}
+		inv, err := p.InvertTagged(out, tag)
+		if err != nil {
+			t.Fatalf("InvertTagged(%d, %x) failed: %v", out, tag, err)
+		}
+		if inv != i {
+			t.Fatalf("%d -> %d inverted to %d", i, out, inv)
+		}
+	}
+}
+
+func TestTaggedRejectsTampering(t *testing.T) {
+	p := NewTagged([]byte("foo"), big.NewInt(1000), 8)
+	out, tag := p.PermuteTagged(42)
+
+	tampered := bytes.Clone(tag)
+	tampered[0] ^= 1
+	if _, err := p.InvertTagged(out, tampered); err == nil {
+		t.Error("expected error for tampered tag")
+	}
+	if _, err := p.InvertTagged((out+1)%1000, tag); err == nil {
+		t.Error("expected error for tampered value")
+	}
+	if _, err := p.InvertTagged(out, tag[:4]); err == nil {
+		t.Error("expected error for truncated tag")
+	}
+	if _, err := p.InvertTagged(out, nil); err == nil {
+		t.Error("expected error for missing tag")
+	}
+	other := NewTagged([]byte("bar"), big.NewInt(1000), 8)
+	if _, err := other.InvertTagged(out, tag); err == nil {
+		t.Error("expected error for tag from a different key")
+	}
+}
+
+func TestTaggedChecked(t *testing.T) {
+	p := NewTagged([]byte("foo"), big.NewInt(1000), 8)
+	tweak := []byte("service A")
+	for i := range 1000 {
+		out, tag := p.PermuteChecked(i, tweak)
+		inv, err := p.InvertChecked(out, tag, tweak)
+		if err != nil {
+			t.Fatalf("InvertChecked(%d, %x) failed: %v", out, tag, err)
+		}
+		if inv != i {
+			t.Fatalf("%d -> %d inverted to %d", i, out, inv)
+		}
+	}
+
+	out, tag := p.PermuteChecked(42, tweak)
+	if expected := int(p.p.PermuteInPlace(big.NewInt(42), tweak).Int64()); out != expected {
+		t.Errorf("PermuteChecked gave %d, tweaked permutation gives %d", out, expected)
+	}
+	for _, wrong := range [][]byte{nil, []byte(""), []byte("service B"), []byte("service A ")} {
+		if inv, err := p.InvertChecked(out, tag, wrong); err == nil {
+			t.Errorf("expected error inverting with tweak %q, got %d", wrong, inv)
+		}
+	}
+	if _, err := p.InvertTagged(out, tag); err == nil {
+		t.Error("expected PermuteChecked's tag to be rejected by InvertTagged")
+	}
+	plainOut, plainTag := p.PermuteTagged(42)
+	if _, err := p.InvertChecked(plainOut, plainTag, nil); err == nil {
+		t.Error("expected PermuteTagged's tag to be rejected by InvertChecked")
+	}
+}
+
+func TestTaggedBelongs(t *testing.T) {
+	p := NewTagged([]byte("foo"), big.NewInt(1000), 8)
+	other := NewTagged([]byte("bar"), big.NewInt(1000), 8)
+	for i := range 1000 {
+		out, tag := p.PermuteTagged(i)
+		if !p.Belongs(out, tag) {
+			t.Fatalf("genuine value %d with tag %x rejected", out, tag)
+		}
+		if other.Belongs(out, tag) {
+			t.Fatalf("value %d with tag %x accepted under a different key", out, tag)
+		}
+		forged := bytes.Clone(tag)
+		forged[len(forged)-1] ^= 0x80
+		if p.Belongs(out, forged) {
+			t.Fatalf("forged tag %x accepted for %d", forged, out)
+		}
+		if p.Belongs((out+1)%1000, tag) {
+			t.Fatalf("tag of %d accepted for %d", out, (out+1)%1000)
+		}
+	}
+
+	out, tag := p.PermuteTagged(42)
+	if p.Belongs(out, tag[:4]) || p.Belongs(out, nil) {
+		t.Error("truncated tag accepted")
+	}
+	if p.Belongs(-1, tag) || p.Belongs(1000, tag) {
+		t.Error("out-of-range value accepted")
+	}
+}
@@ -0,0 +1,264 @@
+package permutation
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math/big"
+	"math/bits"
+	"slices"
+)
+
+const AlgoThreefish = "Threefish"
+
+// Threefish implements a permutation over [0, 2^lengthBits) for lengthBits of 256, 512 or
+// 1024 using the Threefish tweakable block cipher from the Skein hash function family.
+// Unlike the Feistel constructions, each value is permuted by a single pass of the block
+// cipher.  Key derivation uses HKDF, so the input key can be any length.  The tweak may be
+// any length; a non-empty tweak is compressed to Threefish's 128-bit tweak with SHA-256.
+type Threefish struct {
+	lengthBits int
+	numWords   int
+	rounds     int
+
+	// Pre-calculated values.
+	ks          [17]uint64
+	rotations   *[8][8]uint
+	permutation []int
+	kdf         kdfParams
+
+	// Scratch variables to avoid allocations.
+	in    big.Int
+	v, e  [16]uint64
+	block [128]byte
+}
+
+const threefishC240 = 0x1BD11BDAA9FC1A22
+
+var (
+	threefish256Rotations = [8][8]uint{
+		{14, 16}, {52, 57}, {23, 40}, {5, 37}, {25, 33}, {46, 12}, {58, 22}, {32, 32},
+	}
+	threefish512Rotations = [8][8]uint{
+		{46, 36, 19, 37}, {33, 27, 14, 42}, {17, 49, 36, 39}, {44, 9, 54, 56},
+		{39, 30, 34, 24}, {13, 50, 10, 17}, {25, 29, 39, 43}, {8, 35, 56, 22},
+	}
+	threefish1024Rotations = [8][8]uint{
+		{24, 13, 8, 47, 8, 17, 22, 37}, {38, 19, 10, 55, 49, 18, 23, 52},
+		{33, 4, 51, 13, 34, 41, 59, 17}, {5, 20, 48, 41, 47, 28, 16, 25},
+		{41, 9, 37, 31, 12, 47, 44, 30}, {16, 34, 56, 51, 4, 53, 42, 41},
+		{31, 44, 47, 46, 19, 42, 44, 25}, {9, 48, 35, 52, 23, 31, 37, 20},
+	}
+	threefish256Permutation  = []int{0, 3, 2, 1}
+	threefish512Permutation  = []int{2, 1, 4, 7, 6, 5, 0, 3}
+	threefish1024Permutation = []int{0, 9, 2, 13, 6, 11, 4, 15, 10, 7, 12, 3, 14, 5, 8, 1}
+)
+
+func NewThreefish(key []byte, lengthBits int) *Threefish {
+	return newThreefish(key, lengthBits, sha256.New, nil, "permute.Threefish")
+}
+
+// newThreefish is NewThreefish with the given HKDF hash, salt and info string.
+func newThreefish(key []byte, lengthBits int, kdfHash func() hash.Hash, kdfSalt []byte, kdfInfo string) *Threefish {
+	tfKey, err := hkdf.Key(kdfHash, key, kdfSalt, kdfInfo, lengthBits/8)
+	if err != nil {
+		panic(err)
+	}
+	p := newThreefishFromKey(tfKey, lengthBits)
+	p.kdf = newKDFParams(kdfInfo)
+	p.kdf.salt = slices.Clone(kdfSalt)
+	return p
+}
+
+// newThreefishFromKey returns a Threefish permutation using the raw Threefish key, which
+// must be lengthBits/8 bytes.
+func newThreefishFromKey(key []byte, lengthBits int) *Threefish {
+	p := &Threefish{
+		lengthBits: lengthBits,
+		numWords:   lengthBits / 64,
+	}
+	switch lengthBits {
+	case 256:
+		p.rounds, p.rotations, p.permutation = 72, &threefish256Rotations, threefish256Permutation
+	case 512:
+		p.rounds, p.rotations, p.permutation = 72, &threefish512Rotations, threefish512Permutation
+	case 1024:
+		p.rounds, p.rotations, p.permutation = 80, &threefish1024Rotations, threefish1024Permutation
+	default:
+		panic(fmt.Sprintf("lengthBits must be 256, 512 or 1024, got: %v", lengthBits))
+	}
+	p.setKey(key)
+	return p
+}
+
+// setKey installs the raw Threefish key, which must be lengthBits/8 bytes.
+func (p *Threefish) setKey(key []byte) {
+	parity := uint64(threefishC240)
+	for i := range p.numWords {
+		p.ks[i] = binary.LittleEndian.Uint64(key[i*8:])
+		parity ^= p.ks[i]
+	}
+	p.ks[p.numWords] = parity
+}
+
+// Clone returns an independent copy of p that shares its key-derived state but has its
+// own scratch, so that it can be used concurrently with p.
+func (p *Threefish) Clone() Permutation {
+	c := *p
+	c.in = big.Int{}
+	c.v, c.e, c.block = [16]uint64{}, [16]uint64{}, [128]byte{}
+	return &c
+}
+
+func (p *Threefish) PermuteInt(in int) int {
+	return p.PermuteIntTweak(in, nil)
+}
+
+func (p *Threefish) PermuteIntTweak(in int, tweak []byte) int {
+	return int(p.PermuteInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+func (p *Threefish) InvertInt(in int) int {
+	return p.InvertIntTweak(in, nil)
+}
+
+func (p *Threefish) InvertIntTweak(in int, tweak []byte) int {
+	return int(p.InvertInPlace(p.in.SetInt64(int64(in)), tweak).Int64())
+}
+
+// PermuteUint64 always panics: Threefish's blocks are wider than 64 bits.
+func (p *Threefish) PermuteUint64(in uint64) uint64 {
+	checkUint64Width(p.lengthBits)
+	return stepUint64(p.PermuteInPlace, &p.in, in)
+}
+
+// InvertUint64 always panics, as PermuteUint64 does.
+func (p *Threefish) InvertUint64(in uint64) uint64 {
+	checkUint64Width(p.lengthBits)
+	return stepUint64(p.InvertInPlace, &p.in, in)
+}
+
+// InDomain returns whether v is in [0, 2^lengthBits).
+func (p *Threefish) InDomain(v *big.Int) bool {
+	return v.Sign() >= 0 && v.BitLen() <= p.lengthBits
+}
+
+func (p *Threefish) Rounds() int {
+	return p.rounds
+}
+
+func (p *Threefish) Algorithm() string {
+	return AlgoThreefish
+}
+
+// PermuteInPlace calculates inOut's permutated value and stores it back into inOut.
+// Returns inOut as a convenience.
+func (p *Threefish) PermuteInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	t := threefishTweak(tweak)
+	p.load(inOut)
+	p.encrypt(&t)
+	return p.store(inOut)
+}
+
+// InvertInPlace is the inverse of PermuteInPlace.
+func (p *Threefish) InvertInPlace(inOut *big.Int, tweak []byte) *big.Int {
+	t := threefishTweak(tweak)
+	p.load(inOut)
+	p.decrypt(&t)
+	return p.store(inOut)
+}
+
+func threefishTweak(tweak []byte) (t [3]uint64) {
+	if len(tweak) == 0 {
+		return
+	}
+	h := sha256.Sum256(tweak)
+	t[0] = binary.LittleEndian.Uint64(h[0:8])
+	t[1] = binary.LittleEndian.Uint64(h[8:16])
+	t[2] = t[0] ^ t[1]
+	return
+}
+
+// load converts the big-endian value in into little-endian Threefish words.
+func (p *Threefish) load(in *big.Int) {
+	n := p.numWords * 8
+	block := p.block[:n]
+	in.FillBytes(block)
+	for i := range p.numWords {
+		p.v[i] = binary.BigEndian.Uint64(block[n-8-i*8:])
+	}
+}
+
+func (p *Threefish) store(out *big.Int) *big.Int {
+	n := p.numWords * 8
+	block := p.block[:n]
+	for i := range p.numWords {
+		binary.BigEndian.PutUint64(block[n-8-i*8:], p.v[i])
+	}
+	return out.SetBytes(block)
+}
+
+func (p *Threefish) subkey(s, i int, t *[3]uint64) uint64 {
+	k := p.ks[(s+i)%(p.numWords+1)]
+	switch i {
+	case p.numWords - 3:
+		k += t[s%3]
+	case p.numWords - 2:
+		k += t[(s+1)%3]
+	case p.numWords - 1:
+		k += uint64(s)
+	}
+	return k
+}
+
+func (p *Threefish) encrypt(t *[3]uint64) {
+	nw := p.numWords
+	v, e := p.v[:nw], p.e[:nw]
+	for d := range p.rounds {
+		if d%4 == 0 {
+			for i := range nw {
+				v[i] += p.subkey(d/4, i, t)
+			}
+		}
+		rot := &p.rotations[d%8]
+		for j := range nw / 2 {
+			x0, x1 := v[2*j], v[2*j+1]
+			y0 := x0 + x1
+			e[2*j] = y0
+			e[2*j+1] = bits.RotateLeft64(x1, int(rot[j])) ^ y0
+		}
+		for i := range nw {
+			v[i] = e[p.permutation[i]]
+		}
+	}
+	for i := range nw {
+		v[i] += p.subkey(p.rounds/4, i, t)
+	}
+}
+
+func (p *Threefish) decrypt(t *[3]uint64) {
+	nw := p.numWords
+	v, e := p.v[:nw], p.e[:nw]
+	for i := range nw {
+		v[i] -= p.subkey(p.rounds/4, i, t)
+	}
+	for d := p.rounds - 1; d >= 0; d-- {
+		for i := range nw {
+			e[p.permutation[i]] = v[i]
+		}
+		rot := &p.rotations[d%8]
+		for j := range nw / 2 {
+			y0, y1 := e[2*j], e[2*j+1]
+			x1 := bits.RotateLeft64(y1^y0, -int(rot[j]))
+			v[2*j] = y0 - x1
+			v[2*j+1] = x1
+		}
+		if d%4 == 0 {
+			for i := range nw {
+				v[i] -= p.subkey(d/4, i, t)
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package permutation
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"slices"
+)
+
+var tokenEncoding = base64.RawURLEncoding.Strict()
+
+// ByteOrder selects how fixed-width byte strings are interpreted as integers.
+type ByteOrder int
+
+const (
+	BigEndian ByteOrder = iota
+	LittleEndian
+)
+
+// Tokenizer permutes fixed-width byte strings, or equivalently values in
+// [0, 2^(8*lengthBytes)), and encodes the results as URL-safe tokens.
+type Tokenizer struct {
+	p           Permutation
+	lengthBytes int
+	order       ByteOrder
+	signed      bool
+
+	// Scratch variables to avoid allocations.
+	v   big.Int
+	buf []byte
+}
+
+func NewTokenizer(key []byte, lengthBytes int) *Tokenizer {
+	if lengthBytes <= 0 {
+		panic(fmt.Sprintf("lengthBytes must be positive, got: %v", lengthBytes))
+	}
+	return &Tokenizer{
+		p:           newBlockPermutation(key, lengthBytes*8),
+		lengthBytes: lengthBytes,
+		buf:         make([]byte, lengthBytes),
+	}
+}
+
+// WithByteOrder sets the byte order used to convert between integers and the byte strings
+// accepted and returned by PermuteBytes, InvertBytes and the tokens.  The default is
+// BigEndian.  Returns t as a convenience.
+func (t *Tokenizer) WithByteOrder(order ByteOrder) *Tokenizer {
+	t.order = order
+	return t
+}
+
+// WithSigned makes the integers accepted and returned by PermuteToBytes, InvertFromBytes,
+// EncodeToken and DecodeToken signed: they are in [-2^(8*lengthBytes-1),
+// 2^(8*lengthBytes-1)) and their byte strings are two's complement, so that the top bit of
+// the value is its sign, as in Java's fixed-width integers.  The byte strings, and so the
+// permutation, are unchanged; only their interpretation as integers differs.  Returns t as
+// a convenience.
+func (t *Tokenizer) WithSigned() *Tokenizer {
+	t.signed = true
+	return t
+}
+
+// PermuteBytes permutes in, which must be lengthBytes long, and returns the result as a
+// new slice of the same length.
+func (t *Tokenizer) PermuteBytes(in []byte) ([]byte, error) {
+	if err := t.checkLen(len(in)); err != nil {
+		return nil, err
+	}
+	t.setBytes(&t.v, in)
+	t.p.PermuteInPlace(&t.v, nil)
+	return t.fillBytes(make([]byte, t.lengthBytes), &t.v), nil
+}
+
+// InvertBytes is the inverse of PermuteBytes.
+func (t *Tokenizer) InvertBytes(in []byte) ([]byte, error) {
+	if err := t.checkLen(len(in)); err != nil {
+		return nil, err
+	}
+	t.setBytes(&t.v, in)
+	t.p.InvertInPlace(&t.v, nil)
+	return t.fillBytes(make([]byte, t.lengthBytes), &t.v), nil
+}
+
+// PermuteToBytes permutes in and returns the result as a new lengthBytes slice.  in is
+// not modified.
+func (t *Tokenizer) PermuteToBytes(in *big.Int) ([]byte, error) {
+	if err := t.setInt(in); err != nil {
+		return nil, err
+	}
+	t.p.PermuteInPlace(&t.v, nil)
+	return t.fillBytes(make([]byte, t.lengthBytes), &t.v), nil
+}
+
+// InvertFromBytes is the inverse of PermuteToBytes.
+func (t *Tokenizer) InvertFromBytes(in []byte) (*big.Int, error) {
+	if err := t.checkLen(len(in)); err != nil {
+		return nil, err
+	}
+	out := t.setBytes(new(big.Int), in)
+	return t.toInt(t.p.InvertInPlace(out, nil)), nil
+}
+
+// EncodeToken permutes in and returns the result as unpadded base64url (RFC 4648) of its
+// lengthBytes encoding.  in is not modified.
+func (t *Tokenizer) EncodeToken(in *big.Int) (string, error) {
+	if err := t.setInt(in); err != nil {
+		return "", err
+	}
+	t.p.PermuteInPlace(&t.v, nil)
+	return tokenEncoding.EncodeToString(t.fillBytes(t.buf, &t.v)), nil
+}
+
+// DecodeToken is the inverse of EncodeToken.  It rejects tokens that aren't the canonical
+// encoding of exactly lengthBytes bytes.
+func (t *Tokenizer) DecodeToken(s string) (*big.Int, error) {
+	if len(s) != tokenEncoding.EncodedLen(t.lengthBytes) {
+		return nil, errorf(ErrInvalidLength, "token must be %v characters, got %v", tokenEncoding.EncodedLen(t.lengthBytes), len(s))
+	}
+	n, err := tokenEncoding.Decode(t.buf, []byte(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	if err := t.checkLen(n); err != nil {
+		return nil, err
+	}
+	out := t.setBytes(new(big.Int), t.buf)
+	return t.toInt(t.p.InvertInPlace(out, nil)), nil
+}
+
+// setInt stores in into t.v as a value in [0, 2^(8*lengthBytes)), mapping negative values
+// to their two's complement if t is signed.
+func (t *Tokenizer) setInt(in *big.Int) error {
+	bits := uint(t.lengthBytes * 8)
+	if t.signed {
+		t.v.Lsh(big.NewInt(1), bits-1)
+		if in.Cmp(&t.v) >= 0 || (in.Sign() < 0 && in.CmpAbs(&t.v) > 0) {
+			return errorf(ErrOutOfRange, "input %v is outside signed range [-2^%v, 2^%v)", in, bits-1, bits-1)
+		}
+		if in.Sign() < 0 {
+			t.v.Lsh(&t.v, 1)
+			t.v.Add(&t.v, in)
+			return nil
+		}
+	} else if !t.p.InDomain(in) {
+		return errorf(ErrOutOfRange, "input %v is outside range of permutation [0, 2^%v)", in, bits)
+	}
+	t.v.Set(in)
+	return nil
+}
+
+// toInt is the inverse of setInt: if t is signed and v's top bit is set, it subtracts
+// 2^(8*lengthBytes) from v.  Returns v as a convenience.
+func (t *Tokenizer) toInt(v *big.Int) *big.Int {
+	bits := t.lengthBytes * 8
+	if t.signed && v.Bit(bits-1) == 1 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(bits)))
+	}
+	return v
+}
+
+func (t *Tokenizer) checkLen(n int) error {
+	if n != t.lengthBytes {
+		return errorf(ErrInvalidLength, "input must be %v bytes, got %v", t.lengthBytes, n)
+	}
+	return nil
+}
+
+func (t *Tokenizer) setBytes(v *big.Int, buf []byte) *big.Int {
+	if t.order == LittleEndian {
+		copy(t.buf, buf)
+		buf = t.buf
+		slices.Reverse(buf)
+	}
+	return v.SetBytes(buf)
+}
+
+func (t *Tokenizer) fillBytes(buf []byte, v *big.Int) []byte {
+	v.FillBytes(buf)
+	if t.order == LittleEndian {
+		slices.Reverse(buf)
+	}
+	return buf
+}
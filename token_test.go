@@ -0,0 +1,189 @@
+package permutation
+
+import (
+	"bytes"
+	"math/big"
+	"slices"
+	"testing"
+)
+
+func TestTokenizer(t *testing.T) {
+	for _, lengthBytes := range []int{1, 2, 8, 16, 20} {
+		tok := NewTokenizer([]byte("foo"), lengthBytes)
+		seen := make(map[string]bool)
+		for i := range int64(256) {
+			in := big.NewInt(i)
+			token, err := tok.EncodeToken(in)
+			if err != nil {
+				t.Fatalf("EncodeToken(%v) failed: %v", in, err)
+			}
+			if in.Int64() != i {
+				t.Fatalf("EncodeToken modified its input")
+			}
+			if seen[token] {
+				t.Fatalf("duplicate token %q", token)
+			}
+			seen[token] = true
+			out, err := tok.DecodeToken(token)
+			if err != nil {
+				t.Fatalf("DecodeToken(%q) failed: %v", token, err)
+			}
+			if out.Cmp(in) != 0 {
+				t.Fatalf("%v -> %q decoded to %v", in, token, out)
+			}
+		}
+	}
+}
+
+func TestTokenizerBytes(t *testing.T) {
+	tok := NewTokenizer([]byte("foo"), 4)
+	in := []byte{0, 0, 1, 2}
+	out, err := tok.PermuteBytes(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 4 {
+		t.Fatalf("expected 4 bytes, got %d", len(out))
+	}
+	inv, err := tok.InvertBytes(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(inv, in) {
+		t.Fatalf("%x -> %x inverted to %x", in, out, inv)
+	}
+	if _, err := tok.PermuteBytes([]byte{1, 2, 3}); err == nil {
+		t.Fatal("expected error for short input")
+	}
+}
+
+func TestTokenizerRejects(t *testing.T) {
+	tok := NewTokenizer([]byte("foo"), 2)
+	if _, err := tok.EncodeToken(big.NewInt(1 << 16)); err == nil {
+		t.Error("expected error for out-of-range input")
+	}
+	if _, err := tok.EncodeToken(big.NewInt(-1)); err == nil {
+		t.Error("expected error for negative input")
+	}
+	for _, token := range []string{"", "AA", "AAAA", "AA=", "A*A", "AAB"} {
+		if _, err := tok.DecodeToken(token); err == nil {
+			t.Errorf("expected error decoding %q", token)
+		}
+	}
+}
+
+func TestTokenizerByteOrder(t *testing.T) {
+	be := NewTokenizer([]byte("foo"), 4)
+	le := NewTokenizer([]byte("foo"), 4).WithByteOrder(LittleEndian)
+	in := []byte{1, 2, 3, 4}
+	inReversed := []byte{4, 3, 2, 1}
+
+	beOut, err := be.PermuteBytes(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leOut, err := le.PermuteBytes(inReversed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(in, []byte{1, 2, 3, 4}) || !bytes.Equal(inReversed, []byte{4, 3, 2, 1}) {
+		t.Fatal("PermuteBytes modified its input")
+	}
+	// Same integer in, so the same integer out, just with the bytes reversed.
+	slices.Reverse(leOut)
+	if !bytes.Equal(beOut, leOut) {
+		t.Fatalf("big-endian output %x doesn't match reversed little-endian output %x", beOut, leOut)
+	}
+
+	for _, tok := range []*Tokenizer{be, le} {
+		out, err := tok.PermuteBytes(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inv, err := tok.InvertBytes(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(inv, in) {
+			t.Fatalf("%x -> %x inverted to %x", in, out, inv)
+		}
+		token, err := tok.EncodeToken(big.NewInt(1234))
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := tok.DecodeToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Int64() != 1234 {
+			t.Fatalf("1234 -> %q decoded to %v", token, v)
+		}
+	}
+}
+
+func TestTokenizerSigned(t *testing.T) {
+	// Values and their encodings as written by Java's ByteBuffer.putLong and putInt.
+	for _, tc := range []struct {
+		lengthBytes int
+		order       ByteOrder
+		value       int64
+		java        []byte
+	}{
+		{8, BigEndian, 0, []byte{0, 0, 0, 0, 0, 0, 0, 0}},
+		{8, BigEndian, 1, []byte{0, 0, 0, 0, 0, 0, 0, 1}},
+		{8, BigEndian, -1, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{8, BigEndian, -2, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}},
+		{8, BigEndian, -9223372036854775808, []byte{0x80, 0, 0, 0, 0, 0, 0, 0}},
+		{8, BigEndian, 9223372036854775807, []byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{8, LittleEndian, -2, []byte{0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{8, LittleEndian, -9223372036854775808, []byte{0, 0, 0, 0, 0, 0, 0, 0x80}},
+		{4, BigEndian, -123456789, []byte{0xf8, 0xa4, 0x32, 0xeb}},
+		{4, LittleEndian, -123456789, []byte{0xeb, 0x32, 0xa4, 0xf8}},
+		{4, BigEndian, -2147483648, []byte{0x80, 0, 0, 0}},
+	} {
+		tok := NewTokenizer([]byte("foo"), tc.lengthBytes).WithByteOrder(tc.order).WithSigned()
+		in := big.NewInt(tc.value)
+		out, err := tok.PermuteToBytes(in)
+		if err != nil {
+			t.Fatalf("PermuteToBytes(%v) failed: %v", in, err)
+		}
+		if expected, _ := tok.PermuteBytes(tc.java); !bytes.Equal(out, expected) {
+			t.Errorf("PermuteToBytes(%v) = %x, expected PermuteBytes(%x) = %x", in, out, tc.java, expected)
+		}
+		if inv, _ := tok.InvertBytes(out); !bytes.Equal(inv, tc.java) {
+			t.Errorf("%v -> %x inverted to %x, expected %x", in, out, inv, tc.java)
+		}
+		if inv, err := tok.InvertFromBytes(out); err != nil || inv.Int64() != tc.value {
+			t.Errorf("InvertFromBytes(%x) = %v, %v, expected %v", out, inv, err, tc.value)
+		}
+		token, err := tok.EncodeToken(in)
+		if err != nil {
+			t.Fatalf("EncodeToken(%v) failed: %v", in, err)
+		}
+		if dec, err := tok.DecodeToken(token); err != nil || dec.Int64() != tc.value {
+			t.Errorf("DecodeToken(%q) = %v, %v, expected %v", token, dec, err, tc.value)
+		}
+	}
+
+	tok := NewTokenizer([]byte("foo"), 2).WithSigned()
+	for _, v := range []int64{1 << 15, -1<<15 - 1, 1 << 16} {
+		if _, err := tok.PermuteToBytes(big.NewInt(v)); err == nil {
+			t.Errorf("expected error for out-of-range input %v", v)
+		}
+	}
+	// Every signed value round-trips, and the outputs cover all 2^16 byte strings.
+	seen := make(map[string]bool)
+	for v := int64(-1 << 15); v < 1<<15; v++ {
+		out, err := tok.PermuteToBytes(big.NewInt(v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[string(out)] = true
+		if inv, _ := tok.InvertFromBytes(out); inv.Int64() != v {
+			t.Fatalf("%v -> %x inverted to %v", v, out, inv)
+		}
+	}
+	if len(seen) != 1<<16 {
+		t.Errorf("expected %v distinct outputs, got %v", 1<<16, len(seen))
+	}
+}
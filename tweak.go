@@ -0,0 +1,88 @@
+package permutation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// tweakLimit is an optional maximum tweak length.  The zero value is unlimited.
+type tweakLimit struct {
+	max int
+	set bool
+}
+
+func (l *tweakLimit) setMax(max int) {
+	if max < 0 {
+		panic(fmt.Sprintf("maximum tweak length must be non-negative, got: %v", max))
+	}
+	l.max = max
+	l.set = true
+}
+
+func (l *tweakLimit) check(tweak []byte) error {
+	if l.set && len(tweak) > l.max {
+		return errorf(ErrTweakTooLong, "tweak is %v bytes, longer than the maximum of %v", len(tweak), l.max)
+	}
+	return nil
+}
+
+// mustCheck is check for the panicking APIs.
+func (l *tweakLimit) mustCheck(tweak []byte) {
+	if err := l.check(tweak); err != nil {
+		panic(err)
+	}
+}
+
+// TweakBuilder builds a tweak from typed fields, such as a table name and a tenant ID, with
+// an encoding that is unambiguous: each field is a type byte followed by the value, with
+// strings and byte slices prefixed by their 8-byte big-endian length.  Two different
+// sequences of fields therefore never give the same tweak, whereas simply concatenating
+// "ab", "c" and "a", "bc" would.  The zero value is an empty builder.
+type TweakBuilder struct {
+	buf []byte
+}
+
+// Field types in the TweakBuilder encoding.
+const (
+	tweakFieldString = 's'
+	tweakFieldUint64 = 'u'
+	tweakFieldBytes  = 'b'
+)
+
+// AddString appends a string field.  Returns b as a convenience.
+func (b *TweakBuilder) AddString(s string) *TweakBuilder {
+	b.buf = append(b.buf, tweakFieldString)
+	b.buf = binary.BigEndian.AppendUint64(b.buf, uint64(len(s)))
+	b.buf = append(b.buf, s...)
+	return b
+}
+
+// AddUint64 appends an integer field.  Returns b as a convenience.
+func (b *TweakBuilder) AddUint64(v uint64) *TweakBuilder {
+	b.buf = append(b.buf, tweakFieldUint64)
+	b.buf = binary.BigEndian.AppendUint64(b.buf, v)
+	return b
+}
+
+// AddBytes appends a byte slice field, which is distinct from a string field with the
+// same contents.  Returns b as a convenience.
+func (b *TweakBuilder) AddBytes(v []byte) *TweakBuilder {
+	b.buf = append(b.buf, tweakFieldBytes)
+	b.buf = binary.BigEndian.AppendUint64(b.buf, uint64(len(v)))
+	b.buf = append(b.buf, v...)
+	return b
+}
+
+// Tweak returns the encoding of the fields added so far.  It is a copy, so b can go on to
+// add more fields or be reset.  With no fields it is empty, which is the same as no tweak.
+func (b *TweakBuilder) Tweak() []byte {
+	return bytes.Clone(b.buf)
+}
+
+// Reset removes all the fields so that b can build another tweak.  Returns b as a
+// convenience.
+func (b *TweakBuilder) Reset() *TweakBuilder {
+	b.buf = b.buf[:0]
+	return b
+}
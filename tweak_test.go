@@ -0,0 +1,100 @@
+package permutation
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestWithTweakMaxLen(t *testing.T) {
+	type tryPermutation interface {
+		Permutation
+		TryPermuteInPlace(inOut *big.Int, tweak []byte) (*big.Int, error)
+		TryInvertInPlace(inOut *big.Int, tweak []byte) (*big.Int, error)
+	}
+	for _, tc := range []struct {
+		name      string
+		unlimited tryPermutation
+		limited   tryPermutation
+	}{
+		{"ArbitraryN", NewNInt([]byte("foo"), 1000), NewNInt([]byte("foo"), 1000).WithTweakMaxLen(4)},
+		{"FFX", NewFFX([]byte("foo"), 10), NewFFX([]byte("foo"), 10).WithTweakMaxLen(4)},
+		{"FeistelSHAKE128", NewPowerOf2([]byte("foo"), 10), NewPowerOf2([]byte("foo"), 10).WithTweakMaxLen(4)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			long := make([]byte, 1000)
+			if _, err := tc.unlimited.TryPermuteInPlace(big.NewInt(1), long); err != nil {
+				t.Fatalf("unexpected error with no limit: %v", err)
+			}
+			ok, err := tc.limited.TryPermuteInPlace(big.NewInt(1), []byte("abcd"))
+			if err != nil {
+				t.Fatalf("unexpected error for tweak at the limit: %v", err)
+			}
+			if expected := tc.unlimited.PermuteInPlace(big.NewInt(1), []byte("abcd")); ok.Cmp(expected) != 0 {
+				t.Fatalf("limit changed the output: %v != %v", ok, expected)
+			}
+			if _, err := tc.limited.TryPermuteInPlace(big.NewInt(1), []byte("abcde")); err == nil {
+				t.Fatal("expected error for over-length tweak")
+			}
+			if _, err := tc.limited.TryInvertInPlace(big.NewInt(1), []byte("abcde")); err == nil {
+				t.Fatal("expected error for over-length tweak")
+			}
+			if _, err := tc.limited.TryPermuteInPlace(big.NewInt(1<<20), nil); err == nil {
+				t.Fatal("expected error for out-of-range input")
+			}
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected PermuteInPlace to panic for over-length tweak")
+				}
+			}()
+			tc.limited.PermuteInPlace(big.NewInt(1), []byte("abcde"))
+		})
+	}
+}
+
+func TestTweakBuilder(t *testing.T) {
+	fieldSets := []func(b *TweakBuilder){
+		func(b *TweakBuilder) {},
+		func(b *TweakBuilder) { b.AddString("") },
+		func(b *TweakBuilder) { b.AddBytes(nil) },
+		func(b *TweakBuilder) { b.AddString("ab").AddString("c") },
+		func(b *TweakBuilder) { b.AddString("a").AddString("bc") },
+		func(b *TweakBuilder) { b.AddString("abc") },
+		func(b *TweakBuilder) { b.AddBytes([]byte("abc")) },
+		func(b *TweakBuilder) { b.AddString("users").AddUint64(42) },
+		func(b *TweakBuilder) { b.AddString("users").AddUint64(43) },
+		func(b *TweakBuilder) { b.AddUint64(42).AddString("users") },
+		func(b *TweakBuilder) { b.AddString("users").AddBytes([]byte{0, 0, 0, 0, 0, 0, 0, 42}) },
+		func(b *TweakBuilder) { b.AddString("users\x00").AddUint64(42) },
+	}
+	seen := make(map[string]int)
+	for i, add := range fieldSets {
+		var b TweakBuilder
+		add(&b)
+		tweak := string(b.Tweak())
+		if j, ok := seen[tweak]; ok {
+			t.Errorf("field sets %d and %d both give tweak %q", j, i, tweak)
+		}
+		seen[tweak] = i
+
+		// The same fields give the same tweak, including after a Reset.
+		var again TweakBuilder
+		add(&again)
+		if string(again.Tweak()) != tweak {
+			t.Errorf("field set %d isn't deterministic", i)
+		}
+		b.AddString("more").Reset()
+		add(&b)
+		if string(b.Tweak()) != tweak {
+			t.Errorf("field set %d differs after Reset", i)
+		}
+	}
+
+	var b TweakBuilder
+	tweak := b.AddString("users").AddUint64(42).Tweak()
+	b.AddString("more")
+	p := NewNInt([]byte("foo"), 1000)
+	out := p.PermuteInPlace(big.NewInt(7), tweak)
+	if inv := p.InvertInPlace(out, new(TweakBuilder).AddString("users").AddUint64(42).Tweak()); inv.Int64() != 7 {
+		t.Errorf("round trip with a rebuilt tweak gave %v", inv)
+	}
+}
@@ -0,0 +1,280 @@
+package permutation
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha3"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"os"
+	"testing"
+)
+
+type testVector struct {
+	Key        string `json:"key"`
+	LengthBits int    `json:"lengthBits"`
+	Tweak      string `json:"tweak"`
+	Input      string `json:"input"`
+	Output     string `json:"output"`
+
+	// Construction and Domain are only used by the stability vectors, which cover several
+	// constructions; Domain is decimal.
+	Construction string `json:"construction,omitempty"`
+	Domain       string `json:"domain,omitempty"`
+}
+
+func loadTestVectors(t *testing.T, filename string) []testVector {
+	t.Helper()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []testVector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	return vectors
+}
+
+func (v testVector) decode(t *testing.T) (key, tweak []byte, in, out *big.Int) {
+	t.Helper()
+	key, err := hex.DecodeString(v.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak, err = hex.DecodeString(v.Tweak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, ok := new(big.Int).SetString(v.Input, 10)
+	if !ok {
+		t.Fatalf("bad input %q", v.Input)
+	}
+	out, ok = new(big.Int).SetString(v.Output, 10)
+	if !ok {
+		t.Fatalf("bad output %q", v.Output)
+	}
+	return
+}
+
+func TestFeistelSHAKE128Vectors(t *testing.T) {
+	vectors := loadTestVectors(t, "testdata/feistel_shake128_vectors.json")
+	masked := false
+	for _, v := range vectors {
+		key, tweak, in, expected := v.decode(t)
+		p := NewPowerOf2(key, v.LengthBits)
+		if out := p.PermuteInPlace(new(big.Int).Set(in), tweak); out.Cmp(expected) != 0 {
+			t.Errorf("key=%s lengthBits=%d tweak=%s input=%v: got %v, expected %v",
+				v.Key, v.LengthBits, v.Tweak, in, out, expected)
+		}
+		if inv := p.InvertInPlace(new(big.Int).Set(expected), tweak); inv.Cmp(in) != 0 {
+			t.Errorf("key=%s lengthBits=%d tweak=%s output=%v: inverted to %v, expected %v",
+				v.Key, v.LengthBits, v.Tweak, expected, inv, in)
+		}
+		if (v.LengthBits-v.LengthBits/2)%8 != 0 {
+			masked = true
+		}
+	}
+	if !masked {
+		t.Error("no vector exercises the final-byte mask")
+	}
+}
+
+// TestStabilityVectors checks the mappings that AlgorithmVersion promises never to
+// change, for FFX, FeistelSHAKE128 and ArbitraryN with empty and non-empty keys and
+// tweaks, at the edges of each domain.  The vectors were generated on linux/amd64 and the
+// same outputs are expected on every platform.
+func TestStabilityVectors(t *testing.T) {
+	constructions := make(map[string]bool)
+	for _, v := range loadTestVectors(t, "testdata/stability_vectors.json") {
+		key, tweak, in, expected := v.decode(t)
+		n, ok := new(big.Int).SetString(v.Domain, 10)
+		if !ok {
+			t.Fatalf("bad domain %q", v.Domain)
+		}
+		var p Permutation
+		switch v.Construction {
+		case AlgoFFX:
+			p = NewFFX(key, n.BitLen()-1)
+		case AlgoFeistelSHAKE128:
+			p = NewPowerOf2(key, n.BitLen()-1)
+		case "ArbitraryN":
+			p = NewN(key, n)
+		default:
+			t.Fatalf("unknown construction %q", v.Construction)
+		}
+		constructions[v.Construction] = true
+		if out := p.PermuteInPlace(new(big.Int).Set(in), tweak); out.Cmp(expected) != 0 {
+			t.Errorf("%s key=%s n=%v tweak=%s input=%v: got %v, expected %v",
+				v.Construction, v.Key, n, v.Tweak, in, out, expected)
+		}
+		if inv := p.InvertInPlace(new(big.Int).Set(expected), tweak); inv.Cmp(in) != 0 {
+			t.Errorf("%s key=%s n=%v tweak=%s output=%v: inverted to %v, expected %v",
+				v.Construction, v.Key, n, v.Tweak, expected, inv, in)
+		}
+	}
+	if len(constructions) != 3 {
+		t.Errorf("vectors cover %d constructions, expected 3", len(constructions))
+	}
+}
+
+// TestSHAKE128KnownAnswers checks the parts of crypto/sha3 that FeistelSHAKE128 relies on,
+// so that an upstream change would show up here as well as in the vectors above: SHAKE128
+// output against the FIPS 202 examples, including reads beyond the first 168-byte block,
+// and copying a SHAKE by value to fork its state, which FeistelSHAKE128 does to reuse the
+// absorbed key in every round.
+func TestSHAKE128KnownAnswers(t *testing.T) {
+	for _, tc := range []struct {
+		msg    []byte
+		length int
+		// expected is the last 32 bytes of the first length bytes of output.
+		expected string
+	}{
+		{nil, 32, "7f9c2ba4e88f827d616045507605853ed73b8093f6efbc88eb1a6eacfa66ef26"},
+		{[]byte("abc"), 32, "5881092dd818bf5cf8a3ddb793fbcba74097d5c526a6d35f97b83351940f2cc8"},
+		{bytes.Repeat([]byte{0xa3}, 200), 400, "b744c8506f37e9b4e749a184b30f43eb188d855f1b70d71ff3e50c537ac1b0f8"},
+	} {
+		out := sha3.SumSHAKE128(tc.msg, tc.length)
+		if got := hex.EncodeToString(out[len(out)-32:]); got != tc.expected {
+			t.Errorf("SHAKE128(%x)[:%d] ends %s, expected %s", tc.msg, tc.length, got, tc.expected)
+		}
+	}
+
+	prefix := *sha3.NewSHAKE128()
+	prefix.Write([]byte("ab"))
+	for range 2 {
+		fork := prefix
+		fork.Write([]byte("c"))
+		out := make([]byte, 32)
+		fork.Read(out)
+		if got := hex.EncodeToString(out); got != "5881092dd818bf5cf8a3ddb793fbcba74097d5c526a6d35f97b83351940f2cc8" {
+			t.Fatalf("forked SHAKE128 state gave %s", got)
+		}
+	}
+}
+
+// ffxA2Reference is a direct transcription of FFX-A2 for radix 2 from the FFX
+// specification addendum, using big.Int throughout, to check FFX.WithSpecRoundByte.
+func ffxA2Reference(aesKey []byte, n int, tweak []byte, x *big.Int) *big.Int {
+	return ffxReference(aesKey, n, tweak, x, 0, characterwiseAdd)
+}
+
+// characterwiseAdd is FFX's characterwise addition for radix 2: each bit of a plus the
+// corresponding bit of b, modulo 2.  m is the width of the values in bits.
+func characterwiseAdd(a, b *big.Int, m int) *big.Int {
+	sum := new(big.Int)
+	for i := range m {
+		sum.SetBit(sum, i, (a.Bit(i)+b.Bit(i))%2)
+	}
+	return sum
+}
+
+// blockwiseAdd is FFX's blockwise addition: a + b modulo 2^m.
+func blockwiseAdd(a, b *big.Int, m int) *big.Int {
+	sum := new(big.Int).Add(a, b)
+	return sum.And(sum, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(m)), big.NewInt(1)))
+}
+
+// ffxReference is ffxA2Reference with the addition byte of P and the matching operation
+// for combining A with the round function.
+func ffxReference(aesKey []byte, n int, tweak []byte, x *big.Int, addition byte, add func(a, b *big.Int, m int) *big.Int) *big.Int {
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		panic(err)
+	}
+	l := n / 2
+	rounds := RecommendedRounds(n)
+	one := big.NewInt(1)
+	mask := func(bits int) *big.Int { return new(big.Int).Sub(new(big.Int).Lsh(one, uint(bits)), one) }
+
+	// P = [vers]2 || [method]1 || [addition]1 || [radix]1 || [n]1 || [split(n)]1 || [rnds(n)]1 || [t]8
+	P := []byte{0, 1, 2, addition, 2, byte(n), byte(l), byte(rounds)}
+	P = binary.BigEndian.AppendUint64(P, uint64(len(tweak)))
+	F := func(i int, B *big.Int) *big.Int {
+		// Q = T || [0]^((-t-9) mod 16) || [i]1 || [B]8
+		Q := append([]byte{}, tweak...)
+		for (len(Q)+9)%16 != 0 {
+			Q = append(Q, 0)
+		}
+		Q = append(Q, byte(i))
+		Q = binary.BigEndian.AppendUint64(Q, B.Uint64())
+		Y := make([]byte, aes.BlockSize)
+		for msg := append(P, Q...); len(msg) > 0; msg = msg[aes.BlockSize:] {
+			for j := range Y {
+				Y[j] ^= msg[j]
+			}
+			block.Encrypt(Y, Y)
+		}
+		m := l
+		if i%2 == 1 {
+			m = n - l
+		}
+		return new(big.Int).And(new(big.Int).SetBytes(Y), mask(m))
+	}
+
+	A := new(big.Int).Rsh(x, uint(n-l))
+	B := new(big.Int).And(x, mask(n-l))
+	for i := range rounds {
+		m := l
+		if i%2 == 1 {
+			m = n - l
+		}
+		A, B = B, add(A, F(i, B), m)
+	}
+	return new(big.Int).Or(new(big.Int).Lsh(A, uint(n-l)), B)
+}
+
+func TestFFXSpecRoundByteVectors(t *testing.T) {
+	vectors := loadTestVectors(t, "testdata/ffx_a2_vectors.json")
+	for _, v := range vectors {
+		key, tweak, in, expected := v.decode(t)
+		if ref := ffxA2Reference(key, v.LengthBits, tweak, in); ref.Cmp(expected) != 0 {
+			t.Errorf("key=%s lengthBits=%d tweak=%s input=%v: reference gives %v, expected %v",
+				v.Key, v.LengthBits, v.Tweak, in, ref, expected)
+		}
+		p := NewFFXFromAESKey(key, v.LengthBits).WithSpecRoundByte()
+		if out := p.PermuteInPlace(new(big.Int).Set(in), tweak); out.Cmp(expected) != 0 {
+			t.Errorf("key=%s lengthBits=%d tweak=%s input=%v: got %v, expected %v",
+				v.Key, v.LengthBits, v.Tweak, in, out, expected)
+		}
+		if inv := p.InvertInPlace(new(big.Int).Set(expected), tweak); inv.Cmp(in) != 0 {
+			t.Errorf("key=%s lengthBits=%d tweak=%s output=%v: inverted to %v, expected %v",
+				v.Key, v.LengthBits, v.Tweak, expected, inv, in)
+		}
+		if legacy := NewFFXFromAESKey(key, v.LengthBits).PermuteInPlace(new(big.Int).Set(in), tweak); legacy.Cmp(expected) == 0 {
+			t.Errorf("key=%s lengthBits=%d tweak=%s input=%v: default round byte gives the same output",
+				v.Key, v.LengthBits, v.Tweak, in)
+		}
+	}
+}
+
+// TestFFXAdditionMode checks that the addition mode that FFX declares in P, characterwise
+// addition, is the operation its rounds perform.  For radix 2, adding each bit modulo 2
+// is XOR, which is how FFX combines the round function; blockwise addition, mode 1, would
+// be addition modulo 2^m and give different outputs.
+func TestFFXAdditionMode(t *testing.T) {
+	aesKey := DeriveKey([]byte("foo"))
+	for _, n := range []int{8, 9, 33, 64, 128} {
+		p := NewFFXFromAESKey(aesKey, n).WithSpecRoundByte()
+		if p.p[3] != 0 {
+			t.Fatalf("FFX declares addition mode %d, expected 0 (characterwise)", p.p[3])
+		}
+		blockwiseDiffers := false
+		for i := range int64(50) {
+			in := new(big.Int).Lsh(big.NewInt(i*2654435761), uint(max(n-32, 0)))
+			in.And(in, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(n)), big.NewInt(1)))
+			out := p.PermuteInPlace(new(big.Int).Set(in), nil)
+			if ref := ffxReference(aesKey, n, nil, in, 0, characterwiseAdd); out.Cmp(ref) != 0 {
+				t.Fatalf("n=%d input=%v: got %v, characterwise reference gives %v", n, in, out, ref)
+			}
+			if ffxReference(aesKey, n, nil, in, 1, blockwiseAdd).Cmp(out) != 0 {
+				blockwiseDiffers = true
+			}
+		}
+		if !blockwiseDiffers {
+			t.Errorf("n=%d: blockwise addition gave the same outputs", n)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package permutation
+
+import (
+	"crypto/sha256"
+	"math/big"
+)
+
+// AlgorithmVersion identifies the exact mapping produced by every constructor in this
+// package.  Outputs for a given key, domain and tweak will never change while it stays
+// the same.  Any change to the rounds, key derivation or absorb format of an existing
+// construction must increment it and be offered behind a new constructor, so that values
+// permuted with existing constructors stay decodable.
+//
+// The mapping depends only on the key, domain, tweak and input: never on the machine,
+// architecture, word size, byte order or Go version.  Every multi-byte encoding has an
+// explicit byte order and the primitives, AES, SHA-2 and SHAKE128, are standardized.
+// testdata/stability_vectors.json pins outputs of FFX, FeistelSHAKE128 and ArbitraryN.
+// Methods that take and return int, such as PermuteInt, need the domain to fit in an
+// int, which on 32-bit platforms is smaller; the *big.Int methods have no such limit.
+const AlgorithmVersion = 1
+
+// Params describes a permutation, for example to be stored alongside permuted values.
+type Params struct {
+	// Version is AlgorithmVersion.
+	Version   int
+	Algorithm string
+	Rounds    int
+	// Domain is the number of values in the domain, which is [0, Domain).
+	Domain *big.Int
+}
+
+func powerOf2Params(p Permutation, lengthBits int) Params {
+	return Params{
+		Version:   AlgorithmVersion,
+		Algorithm: p.Algorithm(),
+		Rounds:    p.Rounds(),
+		Domain:    new(big.Int).Lsh(big.NewInt(1), uint(lengthBits)),
+	}
+}
+
+func (p *FFX) Params() Params {
+	return powerOf2Params(p, p.lengthBits)
+}
+
+func (p *FeistelSHAKE128) Params() Params {
+	return powerOf2Params(p, p.lengthBits)
+}
+
+func (p *Threefish) Params() Params {
+	return powerOf2Params(p, p.lengthBits)
+}
+
+func (p *ArbitraryN) Params() Params {
+	return Params{
+		Version:   AlgorithmVersion,
+		Algorithm: p.Algorithm(),
+		Rounds:    p.Rounds(),
+		Domain:    new(big.Int).Set(&p.n),
+	}
+}
+
+func (p *SwapOrNot) Params() Params {
+	return Params{
+		Version:   AlgorithmVersion,
+		Algorithm: p.Algorithm(),
+		Rounds:    p.Rounds(),
+		Domain:    new(big.Int).SetUint64(p.n),
+	}
+}
+
+// paramsAppender is implemented by the permutations that can encode their parameters for
+// ParamsHash.
+type paramsAppender interface {
+	appendParams(b *TweakBuilder)
+}
+
+// paramsHash returns SHA-256 of the canonical encoding of p's parameters.  The encoding
+// is built with TweakBuilder, so it is unambiguous, and is prefixed with a label and
+// AlgorithmVersion.
+func paramsHash(p paramsAppender) [sha256.Size]byte {
+	var b TweakBuilder
+	b.AddString("permute.ParamsHash").AddUint64(AlgorithmVersion)
+	p.appendParams(&b)
+	return sha256.Sum256(b.buf)
+}
+
+// appendBlockParams encodes the parameters of a block permutation, falling back on its
+// algorithm and rounds for blocks that don't encode their own.
+func appendBlockParams(b *TweakBuilder, p Permutation) {
+	if a, ok := p.(paramsAppender); ok {
+		a.appendParams(b)
+		return
+	}
+	b.AddString(p.Algorithm()).AddUint64(uint64(p.Rounds()))
+}
+
+// ParamsHash returns a stable identifier for p's parameters, such as its length, rounds
+// and KDF info, but not its key, for cache keys and detecting configuration drift.
+// Permutations with the same parameters share the hash whatever their keys, and changing
+// any parameter that affects the mapping changes it.  Having a pepper is a parameter, but
+// the pepper itself is a secret, so it isn't included.
+func (p *FFX) ParamsHash() [sha256.Size]byte {
+	return paramsHash(p)
+}
+
+func (p *FFX) appendParams(b *TweakBuilder) {
+	b.AddString(p.Algorithm()).AddUint64(uint64(p.lengthBits)).AddUint64(uint64(p.rounds))
+	b.AddUint64(2).AddUint64(uint64(p.lengthBits / 2)) // Radix and split.
+	p.kdf.append(b)
+	b.AddUint64(boolToUint64(p.specRound))
+}
+
+// kdfParams records how a block permutation's key was derived, for ParamsHash.
+type kdfParams struct {
+	set bool
+	// info is the HKDF info without any pepper, and peppered is whether a pepper was
+	// appended to it; the pepper itself is secret.
+	info     string
+	peppered bool
+	// salt is the HKDF salt, which unlike the pepper needn't be secret.
+	salt []byte
+	// hash is the name of the HKDF hash: defaultKDFHashName or the name passed to
+	// WithKDFHash.  It is a name rather than anything derived from the hash's Go type,
+	// which can change between toolchains.
+	hash string
+}
+
+// defaultKDFHashName is the name that ParamsHash records for HKDF with SHA-256, the
+// default.
+const defaultKDFHashName = "SHA-256"
+
+func newKDFParams(info string) kdfParams {
+	return kdfParams{
+		set:  true,
+		info: info,
+		hash: defaultKDFHashName,
+	}
+}
+
+func (k *kdfParams) append(b *TweakBuilder) {
+	b.AddUint64(boolToUint64(k.set)).AddString(k.info).AddUint64(boolToUint64(k.peppered)).AddString(k.hash)
+	// Leaving out an empty salt keeps the hashes from before salts were supported.
+	if len(k.salt) > 0 {
+		b.AddBytes(k.salt)
+	}
+}
+
+func boolToUint64(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// ParamsHash is FFX.ParamsHash for FeistelSHAKE128; the parameters include the split and
+// any domain label.
+func (p *FeistelSHAKE128) ParamsHash() [sha256.Size]byte {
+	return paramsHash(p)
+}
+
+func (p *FeistelSHAKE128) appendParams(b *TweakBuilder) {
+	b.AddString(p.Algorithm()).AddUint64(uint64(p.lengthBits)).AddUint64(uint64(p.rounds))
+	b.AddUint64(uint64(p.split)).AddUint64(boolToUint64(p.labeled)).AddString(p.label)
+	b.AddUint64(boolToUint64(len(p.pepper) > 0))
+	p.kdf.append(b)
+}
+
+// ParamsHash is FFX.ParamsHash for Threefish.
+func (p *Threefish) ParamsHash() [sha256.Size]byte {
+	return paramsHash(p)
+}
+
+func (p *Threefish) appendParams(b *TweakBuilder) {
+	b.AddString(p.Algorithm()).AddUint64(uint64(p.lengthBits)).AddUint64(uint64(p.rounds))
+	p.kdf.append(b)
+}
+
+// ParamsHash is FFX.ParamsHash for SwapOrNot.
+func (p *SwapOrNot) ParamsHash() [sha256.Size]byte {
+	return paramsHash(p)
+}
+
+func (p *SwapOrNot) appendParams(b *TweakBuilder) {
+	b.AddString(p.Algorithm()).AddUint64(p.n).AddUint64(uint64(p.rounds))
+}
+
+func (p *mixedRadixFeistel) appendParams(b *TweakBuilder) {
+	b.AddString(p.Algorithm()).AddUint64(p.a).AddUint64(p.b).AddUint64(uint64(p.rounds))
+}
+
+// ParamsHash is FFX.ParamsHash for ArbitraryN; the parameters are the domain, any values
+// removed by WithForbidden and the parameters of the block permutation.
+func (p *ArbitraryN) ParamsHash() [sha256.Size]byte {
+	return paramsHash(p)
+}
+
+func (p *ArbitraryN) appendParams(b *TweakBuilder) {
+	b.AddString("ArbitraryN").AddBytes(p.n.Bytes()).AddBytes(p.blockN.Bytes())
+	b.AddUint64(uint64(len(p.forbidden)))
+	for i := range p.forbidden {
+		b.AddBytes(p.forbidden[i].Bytes())
+	}
+	appendBlockParams(b, p.p)
+}
@@ -0,0 +1,242 @@
+package permutation
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+// TestAlgorithmVersionGolden pins a digest of the outputs of every construction.  If it
+// fails, existing permuted values would no longer decode: rather than updating the digest,
+// restore the old behaviour and put the new one behind a new constructor, bumping
+// AlgorithmVersion.
+func TestAlgorithmVersionGolden(t *testing.T) {
+	if AlgorithmVersion != 1 {
+		t.Fatalf("AlgorithmVersion = %d; add digests for the new version", AlgorithmVersion)
+	}
+	key := []byte("golden key")
+	prf := func(input []byte) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+	mustNew := func(n *big.Int, opts ...Option) Permutation {
+		p, err := New(key, n, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	pow2 := func(bits int) *big.Int {
+		return new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	}
+
+	for _, tc := range []struct {
+		name   string
+		p      Permutation
+		digest string
+	}{
+		{
+			"NewNInt 1000", NewNInt(key, 1000),
+			"bccfc187e73228542265a1f7d16b753042d98097adcf6bb8d9d27bf637cceb9c",
+		},
+		{
+			"NewNInt 100", NewNInt(key, 100),
+			"edd112d9e39467d49466178d4ca9f5a170e1780ff2e5025698db69eb57984b99",
+		},
+		{
+			"NewN 2^200+1", NewN(key, new(big.Int).Add(pow2(200), big.NewInt(1))),
+			"4e403d2cb8194434224392d439e1a92b35be24f205008ccc73279260dfa5e553",
+		},
+		{
+			"NewFFX 8", NewFFX(key, 8),
+			"88653f0283363974280b40666059b97dc20f0eac0ff8acfa64d281b92a52b0dc",
+		},
+		{
+			"NewFFX 64", NewFFX(key, 64),
+			"c07bd128933181aee0327f24ddd4eaeac358cb938d61f1a51bf68fc59a7c7765",
+		},
+		{
+			"NewFFX 128", NewFFX(key, 128),
+			"ac86ed86e281bd8e8deead458de79782f1d439423d1c0d2e20769ac041e239c2",
+		},
+		{
+			"NewPowerOf2 5", NewPowerOf2(key, 5),
+			"385518c15a85ceb25b10bc1f43f54ff4fb25055e7d4c4b0bed9ad91804914204",
+		},
+		{
+			"NewPowerOf2 300", NewPowerOf2(key, 300),
+			"3ea932ce54585605ce5fb527721c745acf49e587f8f4b07516d66a344b174502",
+		},
+		{
+			"NewPowerOf2 WithSplit", NewPowerOf2(key, 20).WithSplit(7),
+			"eb6cca0390e22946e058796446b728254a5975cfa885a6dfdb0a0ebe962348f6",
+		},
+		{
+			"NewPowerOf2 WithDomainLabel", NewPowerOf2(key, 20).WithDomainLabel("label"),
+			"e99bc04958ad573e0942eb141fbe42763797451c03400a605da3e2153d847c42",
+		},
+		{
+			"NewPowerOf2PRF", NewPowerOf2PRF(prf, 20),
+			"b527dc768907d11dfc9d75e35c33421eb8d72ee69ef0abf79b173b71ed045573",
+		},
+		{
+			"NewThreefish 256", NewThreefish(key, 256),
+			"bb142cc5fff4f9f17944b343c3ef069d59948b0699eb1ff3b4898c9f2079dcc7",
+		},
+		{
+			"NewThreefish 1024", NewThreefish(key, 1024),
+			"b42c3acac0b230f5243cd673ccbaaa4e1f4724fd7c87fca2645a83ec3b4db96b",
+		},
+		{
+			"NewNCompact 2^20+1", NewNCompact(key, new(big.Int).Add(pow2(20), big.NewInt(1))),
+			"4924d1135376dd465bbf15493eca711d0a840e847199686a862d906afaf12963",
+		},
+		{
+			"NewSwapOrNot", NewSwapOrNot(key, 1000),
+			"94c0b5453ad3e18e448ec0484bcb0a8172254635700c74ad3d87b621c2db41b5",
+		},
+		{
+			"NewFFXRadix 10^6", NewFFXRadix(key, 10, 6),
+			"35298d36fae44feb0e16d8053751f2d4cc41f276b87bef50b307abfe8333bbe4",
+		},
+		{
+			"New WithRounds", mustNew(big.NewInt(1000), WithRounds(20)),
+			"281444a2c51e2fb36dd576f48ddbc0ef8f405197b8f79111694d0a385716e13b",
+		},
+		{
+			"New WithKDFInfo", mustNew(big.NewInt(1000), WithKDFInfo("info")),
+			"a6c4b4e1db90cd08046813381369e15c7d1796e0f97dc2115d1f7032764b163c",
+		},
+		{
+			"New WithPepper", mustNew(big.NewInt(1000), WithPepper([]byte("pepper"))),
+			"b6dd0c4352d44398fa4c26264243e2ecae0dcae6109125456012b5beb7b58b0e",
+		},
+		{
+			"New FeistelSHAKE128 WithKDFInfo WithPepper",
+			mustNew(big.NewInt(1000), WithAlgorithm(AlgoFeistelSHAKE128), WithKDFInfo("info"), WithPepper([]byte("pepper"))),
+			"d7ce3d1b291d60befdee998ab0f7f447f58ed3aa2ca12d3582f130e45f18914e",
+		},
+	} {
+		h := sha256.New()
+		for _, tweak := range [][]byte{nil, []byte("tweak")} {
+			for i := range int64(64) {
+				out := tc.p.PermuteInPlace(big.NewInt(i), tweak)
+				h.Write(out.Append(nil, 16))
+				h.Write([]byte{','})
+			}
+		}
+		if digest := hex.EncodeToString(h.Sum(nil)); digest != tc.digest {
+			t.Errorf("%s: outputs changed, digest is %s, expected %s", tc.name, digest, tc.digest)
+		}
+	}
+}
+
+func TestParams(t *testing.T) {
+	for _, tc := range []struct {
+		params   Params
+		expected Params
+	}{
+		{NewNInt([]byte("foo"), 1000).Params(), Params{AlgorithmVersion, AlgoFFX, 30, big.NewInt(1000)}},
+		{NewFFX([]byte("foo"), 16).Params(), Params{AlgorithmVersion, AlgoFFX, 24, big.NewInt(1 << 16)}},
+		{NewPowerOf2([]byte("foo"), 5).Params(), Params{AlgorithmVersion, AlgoFeistelSHAKE128, 36, big.NewInt(32)}},
+		{NewSwapOrNot([]byte("foo"), 10).Params(), Params{AlgorithmVersion, AlgoSwapOrNot, 36, big.NewInt(10)}},
+		{
+			NewThreefish([]byte("foo"), 256).Params(),
+			Params{AlgorithmVersion, AlgoThreefish, 72, new(big.Int).Lsh(big.NewInt(1), 256)},
+		},
+	} {
+		p, e := tc.params, tc.expected
+		if p.Version != e.Version || p.Algorithm != e.Algorithm || p.Rounds != e.Rounds || p.Domain.Cmp(e.Domain) != 0 {
+			t.Errorf("Params() = %+v, expected %+v", p, e)
+		}
+	}
+}
+
+func TestParamsHash(t *testing.T) {
+	type hasher interface{ ParamsHash() [32]byte }
+	mustNew := func(key string, n *big.Int, opts ...Option) hasher {
+		p, err := New([]byte(key), n, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.(hasher)
+	}
+	big1000 := big.NewInt(1000)
+	pow2 := func(bits int) *big.Int { return new(big.Int).Lsh(big.NewInt(1), uint(bits)) }
+
+	// Each entry builds the same parameters with two keys.
+	cases := []struct {
+		name string
+		new  func(key string) hasher
+	}{
+		{"FFX 16", func(key string) hasher { return NewFFX([]byte(key), 16) }},
+		{"FFX 17", func(key string) hasher { return NewFFX([]byte(key), 17) }},
+		{"FFX 16 rounds", func(key string) hasher { return mustNew(key, pow2(16), WithRounds(10)) }},
+		{"FFX 16 KDF info", func(key string) hasher { return mustNew(key, pow2(16), WithKDFInfo("other")) }},
+		{"FFX 16 KDF hash", func(key string) hasher { return mustNew(key, pow2(16), WithKDFHash("SHA-512", sha512.New)) }},
+		{"FFX 16 KDF hash 384", func(key string) hasher { return mustNew(key, pow2(16), WithKDFHash("SHA-384", sha512.New384)) }},
+		{"FFX 16 KDF salt", func(key string) hasher { return mustNew(key, pow2(16), WithKDFSalt([]byte("salt"))) }},
+		{"FFX 16 pepper", func(key string) hasher { return mustNew(key, pow2(16), WithPepper([]byte(key))) }},
+		{"FFX 16 spec round byte", func(key string) hasher { return NewFFX([]byte(key), 16).WithSpecRoundByte() }},
+		{"SHAKE 16", func(key string) hasher { return NewPowerOf2([]byte(key), 16) }},
+		{"SHAKE 16 split", func(key string) hasher { return NewPowerOf2([]byte(key), 16).WithSplit(5) }},
+		{"SHAKE 16 label", func(key string) hasher { return NewPowerOf2([]byte(key), 16).WithDomainLabel("label") }},
+		{"SHAKE 16 empty label", func(key string) hasher { return NewPowerOf2([]byte(key), 16).WithDomainLabel("") }},
+		{"SHAKE 16 pepper", func(key string) hasher { return NewPowerOf2([]byte(key), 16).withPepper([]byte(key)) }},
+		{"SHAKE 16 KDF info", func(key string) hasher {
+			return mustNew(key, pow2(16), WithAlgorithm(AlgoFeistelSHAKE128), WithKDFInfo("info"))
+		}},
+		{"SHAKE 16 KDF salt", func(key string) hasher {
+			return mustNew(key, pow2(16), WithAlgorithm(AlgoFeistelSHAKE128), WithKDFInfo("info"), WithKDFSalt([]byte("salt")))
+		}},
+		{"Threefish 256", func(key string) hasher { return NewThreefish([]byte(key), 256) }},
+		{"Threefish 256 KDF info", func(key string) hasher {
+			return mustNew(key, pow2(256), WithAlgorithm(AlgoThreefish), WithKDFInfo("info")).(*ArbitraryN).p.(hasher)
+		}},
+		{"SwapOrNot 1000", func(key string) hasher { return NewSwapOrNot([]byte(key), 1000) }},
+		{"FFXRadix 10^6", func(key string) hasher { return NewFFXRadix([]byte(key), 10, 6) }},
+		{"FFXRadix 10^7", func(key string) hasher { return NewFFXRadix([]byte(key), 10, 7) }},
+		{"FFXRadix 16^6", func(key string) hasher { return NewFFXRadix([]byte(key), 16, 6) }},
+		{"NewN 1000", func(key string) hasher { return NewNInt([]byte(key), 1000) }},
+		{"NewN 1001", func(key string) hasher { return NewNInt([]byte(key), 1001) }},
+		{"NewN 1000 forbidden", func(key string) hasher { return NewNInt([]byte(key), 1000).WithForbidden(big.NewInt(3)) }},
+		{"NewNWithBits 1000", func(key string) hasher { return NewNWithBits([]byte(key), big1000, 12) }},
+		{"NewNCompact 2^20+1", func(key string) hasher {
+			return NewNCompact([]byte(key), new(big.Int).Add(pow2(20), big.NewInt(1))).(hasher)
+		}},
+		{"NewN 2^20+1", func(key string) hasher { return NewN([]byte(key), new(big.Int).Add(pow2(20), big.NewInt(1))) }},
+	}
+	seen := make(map[[32]byte]string)
+	for _, tc := range cases {
+		h := tc.new("key one").ParamsHash()
+		if other := tc.new("key two").ParamsHash(); other != h {
+			t.Errorf("%s: different keys give different hashes", tc.name)
+		}
+		if again := tc.new("key one").ParamsHash(); again != h {
+			t.Errorf("%s: ParamsHash isn't deterministic", tc.name)
+		}
+		if prev, ok := seen[h]; ok {
+			t.Errorf("%s and %s have the same hash", prev, tc.name)
+		}
+		seen[h] = tc.name
+	}
+
+	// New with default options matches the specific constructors.
+	if mustNew("foo", big1000).ParamsHash() != NewNInt([]byte("bar"), 1000).ParamsHash() {
+		t.Error("New and NewNInt with the same parameters give different hashes")
+	}
+	if mustNew("foo", pow2(16), WithKDFHash("SHA-256", sha256.New)).ParamsHash() != mustNew("foo", pow2(16)).ParamsHash() {
+		t.Error("naming SHA-256 explicitly changed the hash")
+	}
+
+	// The hash mustn't depend on anything that can change between Go releases, such as the
+	// hash's internal type name.
+	const golden = "2ee4e75f9e00a89f3ed9271eb578b3a214e080fc99d8c750cac2c9017e44a269"
+	if h := NewFFX([]byte("k"), 16).ParamsHash(); hex.EncodeToString(h[:]) != golden {
+		t.Errorf("FFX ParamsHash = %x, expected %v", h, golden)
+	}
+}